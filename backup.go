@@ -0,0 +1,337 @@
+package tasmota
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+	"time"
+)
+
+// BackupVersion is the version of the backup document written by Backup.
+const BackupVersion = 1
+
+// Backup is a versioned snapshot of a device's readable configuration.
+// Passwords cannot be read from the device and are not included.
+type Backup struct {
+	Version   int          `json:"version"`
+	CreatedAt time.Time    `json:"created_at"`
+	Device    BackupDevice `json:"device"`
+	// Config holds the settings in desired-state form, so a backup can also
+	// be used as a starting point for a desired-state document.
+	Config DesiredState `json:"config"`
+	// Status is the raw Status 0 response at the time of the backup.
+	Status json.RawMessage `json:"status,omitempty"`
+}
+
+// BackupDevice identifies the device a backup was taken from.
+type BackupDevice struct {
+	DeviceName string `json:"device_name"`
+	Hostname   string `json:"hostname"`
+	IPAddress  string `json:"ip_address"`
+	MAC        string `json:"mac"`
+	Firmware   string `json:"firmware"`
+}
+
+// Backup reads every setting covered by DesiredState: device settings,
+// friendly names, PulseTime, module and template, MQTT and network settings,
+// SetOptions, rules and timers.
+func (c *Client) Backup(ctx context.Context) (*Backup, error) {
+	raw, err := c.ExecuteCommand(ctx, "Status 0")
+	if err != nil {
+		return nil, err
+	}
+	var status StatusResponse
+	if err := unmarshalJSON(raw, &status); err != nil {
+		return nil, err
+	}
+	if status.Status == nil || status.StatusLOG == nil || status.StatusNET == nil || status.StatusMQT == nil {
+		return nil, NewError(ErrorTypeParse, "status response missing required sections", nil)
+	}
+
+	b := &Backup{
+		Version:   BackupVersion,
+		CreatedAt: time.Now().UTC(),
+		Status:    raw,
+		Device: BackupDevice{
+			DeviceName: status.Status.DeviceName,
+			Hostname:   status.StatusNET.Hostname,
+			IPAddress:  status.StatusNET.IPAddress.String(),
+			MAC:        status.StatusNET.Mac.String(),
+		},
+	}
+	if status.StatusFWR != nil {
+		b.Device.Firmware = status.StatusFWR.Version
+	}
+
+	p := &planner{client: c, ctx: ctx, status: &status}
+	steps := []func(*Backup) error{
+		p.backupDevice,
+		p.backupMQTT,
+		p.backupNetwork,
+		p.backupSetOptions,
+		p.backupRules,
+		p.backupTimers,
+	}
+	for _, step := range steps {
+		if err := step(b); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+// Restore applies a backup to the device and verifies the result by planning
+// again. Only settings that differ are sent. Module and network changes restart
+// the device, which can make verification fail until it is back online.
+func (c *Client) Restore(ctx context.Context, b *Backup, opts ...PlanOption) (*Plan, error) {
+	if b == nil {
+		return nil, NewError(ErrorTypeCommand, "backup cannot be nil", nil)
+	}
+	if b.Version < 1 || b.Version > BackupVersion {
+		return nil, NewError(ErrorTypeCommand, fmt.Sprintf("unsupported backup version %d", b.Version), nil)
+	}
+
+	plan, err := c.ApplyState(ctx, &b.Config, opts...)
+	if err != nil {
+		return plan, err
+	}
+
+	remaining, err := c.Plan(ctx, &b.Config, opts...)
+	if err != nil {
+		return plan, NewError(ErrorTypeDevice, "failed to verify restore", err)
+	}
+	if !remaining.Empty() {
+		fields := make([]string, len(remaining.Changes))
+		for i, change := range remaining.Changes {
+			fields[i] = change.Field
+		}
+		msg := fmt.Sprintf("restore verification failed: %d settings differ (%s)", len(fields), strings.Join(fields, ", "))
+		return plan, NewError(ErrorTypeDevice, msg, nil)
+	}
+
+	return plan, nil
+}
+
+// LoadBackup reads a backup written by SaveBackup.
+func LoadBackup(path string) (*Backup, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, NewError(ErrorTypeCommand, "failed to read backup", err)
+	}
+
+	var b Backup
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, NewError(ErrorTypeParse, "failed to parse backup", err)
+	}
+	if err := b.Config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &b, nil
+}
+
+// SaveBackup writes a backup as indented JSON.
+func SaveBackup(path string, b *Backup) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return NewError(ErrorTypeParse, "failed to encode backup", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		return NewError(ErrorTypeCommand, "failed to write backup", err)
+	}
+	return nil
+}
+
+func (p *planner) backupDevice(b *Backup) error {
+	info := p.status.Status
+	d := &DesiredDevice{
+		DeviceName:   &info.DeviceName,
+		FriendlyName: info.FriendlyName,
+		PowerOnState: &info.PowerOnState,
+		LedState:     &info.LedState,
+		ButtonRetain: intBool(info.ButtonRetain),
+		SwitchRetain: intBool(info.SwitchRetain),
+		SensorRetain: intBool(info.SensorRetain),
+		PowerRetain:  intBool(info.PowerRetain),
+		TelePeriod:   &p.status.StatusLOG.TelePeriod,
+		Module:       &info.Module,
+		PulseTime:    make(map[int]int),
+	}
+	if p.status.StatusSTS != nil {
+		d.Sleep = &p.status.StatusSTS.Sleep
+	}
+
+	// Tasmota reports one friendly name per relay
+	for relay := 1; relay <= max(len(info.FriendlyName), 1); relay++ {
+		value, err := p.pulseTime(relay)
+		if err != nil {
+			return err
+		}
+		d.PulseTime[relay] = value
+	}
+
+	raw, err := p.client.ExecuteCommand(p.ctx, "Template")
+	if err != nil {
+		return err
+	}
+	template, err := canonicalJSON(raw)
+	if err != nil {
+		return err
+	}
+	d.Template = json.RawMessage(template)
+
+	b.Config.Device = d
+	return nil
+}
+
+func (p *planner) backupMQTT(b *Backup) error {
+	info := p.status.StatusMQT
+	m := &DesiredMQTT{
+		Host:   &info.MqttHost,
+		Port:   &info.MqttPort,
+		User:   &info.MqttUser,
+		Client: &info.MqttClient,
+		Topic:  &p.status.Status.Topic,
+	}
+
+	options, err := p.status.StatusLOG.SetOptions()
+	if err != nil {
+		return err
+	}
+	m.Enabled = intBool(options[3])
+
+	for field, command := range map[**string]string{
+		&m.FullTopic:  "FullTopic",
+		&m.GroupTopic: "GroupTopic",
+		&m.Prefix1:    "Prefix1",
+		&m.Prefix2:    "Prefix2",
+		&m.Prefix3:    "Prefix3",
+	} {
+		value, err := p.queryString(command, command)
+		if err != nil {
+			return err
+		}
+		*field = &value
+	}
+
+	b.Config.MQTT = m
+	return nil
+}
+
+func (p *planner) backupNetwork(b *Backup) error {
+	n := &DesiredNetwork{Hostname: &p.status.StatusNET.Hostname}
+
+	for field, command := range map[**string]string{
+		&n.IPAddress: "IPAddress1",
+		&n.Gateway:   "IPAddress2",
+		&n.Subnet:    "IPAddress3",
+		&n.DNSServer: "IPAddress4",
+	} {
+		value, err := p.queryString(command, command)
+		if err != nil {
+			return err
+		}
+		*field = &value
+	}
+
+	ssids := p.status.StatusLOG.SSId
+	if len(ssids) > 0 {
+		n.SSID1 = &ssids[0]
+	}
+	if len(ssids) > 1 {
+		n.SSID2 = &ssids[1]
+	}
+
+	b.Config.Network = n
+	return nil
+}
+
+func (p *planner) backupSetOptions(b *Backup) error {
+	options, err := p.status.StatusLOG.SetOptions()
+	if err != nil {
+		return err
+	}
+	// SetOption3 is captured as MQTT.Enabled
+	delete(options, 3)
+	// Reserved bits would be restored as commands the firmware rejects
+	maps.DeleteFunc(options, func(n, _ int) bool { return !settableSetOption(n) })
+
+	b.Config.SetOptions = options
+	return nil
+}
+
+func (p *planner) backupRules(b *Backup) error {
+	b.Config.Rules = make(map[int]*DesiredRule)
+
+	for n := 1; n <= 3; n++ {
+		value, err := p.query(fmt.Sprintf("Rule%d", n), fmt.Sprintf("Rule%d", n))
+		if err != nil {
+			return err
+		}
+		var rule struct {
+			State       string `json:"State"`
+			Once        string `json:"Once"`
+			StopOnError string `json:"StopOnError"`
+			Rules       string `json:"Rules"`
+		}
+		if err := unmarshalJSON(value, &rule); err != nil {
+			return err
+		}
+
+		b.Config.Rules[n] = &DesiredRule{
+			Rules:       &rule.Rules,
+			Enabled:     onOffBool(rule.State),
+			Once:        onOffBool(rule.Once),
+			StopOnError: onOffBool(rule.StopOnError),
+		}
+	}
+
+	return nil
+}
+
+func (p *planner) backupTimers(b *Backup) error {
+	b.Config.Timers = make(map[int]*DesiredTimer)
+
+	for n := 1; n <= 16; n++ {
+		value, err := p.query(fmt.Sprintf("Timer%d", n), fmt.Sprintf("Timer%d", n))
+		if err != nil {
+			return err
+		}
+		var timer DesiredTimer
+		if err := unmarshalJSON(value, &timer); err != nil {
+			return err
+		}
+		b.Config.Timers[n] = &timer
+	}
+
+	return nil
+}
+
+func intBool(n int) *bool {
+	b := n == 1
+	return &b
+}
+
+func onOffBool(s string) *bool {
+	b := strings.EqualFold(s, "ON")
+	return &b
+}
+
+// MaxSetOption is the highest SetOption number the firmware defines. Status 3
+// reports the options in 32-bit masks whose remaining bits are reserved.
+const MaxSetOption = 161
+
+// settableSetOption reports whether option n can be set with SetOption<n>.
+// A few of the first 32 flags are changed through their own command
+// (PowerRetain, Interlock, ...) and the firmware rejects them as SetOptions.
+func settableSetOption(n int) bool {
+	switch n {
+	case 5, 6, 7, 9, 14, 22, 23, 25, 27:
+		return false
+	}
+	return n >= 0 && n <= MaxSetOption
+}
@@ -0,0 +1,126 @@
+package tasmota
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/kradalby/tasmota-go/tasmotatest"
+)
+
+func TestIntegration_BackupRestore(t *testing.T) {
+	ctx := context.Background()
+
+	source, sourceClient := newTestDevice(t, tasmotatest.WithRelays(2))
+	source.Update(func(s *tasmotatest.State) {
+		s.DeviceName = "Kitchen"
+		s.FriendlyName = []string{"Kettle", "Toaster"}
+		s.PulseTime[1] = 120
+		s.TelePeriod = 60
+		s.SetOptions[19] = 1
+		s.SetOptions[36] = 20
+		s.SetOptions[114] = 1
+		s.Template = `{"BASE":18,"FLAG":0,"GPIO":[32,0,0,0,0,0,0,0,224,0,0,0,0,0],"NAME":"Kitchen Plug"}`
+		s.MQTT.Host = "mqtt.home"
+		s.MQTT.Topic = "kitchen"
+		s.MQTT.Prefix[2] = "telemetry"
+		s.Network.IPAddress = "192.168.1.50"
+		s.Network.SSID[0] = "home"
+		s.Rules[1] = tasmotatest.RuleState{Rules: "ON Power1#State=1 DO Backlog Delay 10; Power2 ON ENDON", Enabled: true}
+		s.Timers[4] = tasmotatest.TimerState{Enable: 1, Time: "07:15", Days: "1000001", Output: 2, Action: 1}
+	})
+
+	backup, err := sourceClient.Backup(ctx)
+	if err != nil {
+		t.Fatalf("Backup() error: %v", err)
+	}
+	if backup.Version != BackupVersion || backup.Device.MAC != "aa:bb:cc:12:34:56" || len(backup.Status) == 0 {
+		t.Errorf("Backup() device = %+v, version %d", backup.Device, backup.Version)
+	}
+	if _, ok := backup.Config.SetOptions[3]; ok {
+		t.Error("SetOption3 should be captured as MQTT.Enabled, not in SetOptions")
+	}
+
+	path := filepath.Join(t.TempDir(), "kitchen.json")
+	if err := SaveBackup(path, backup); err != nil {
+		t.Fatalf("SaveBackup() error: %v", err)
+	}
+	loaded, err := LoadBackup(path)
+	if err != nil {
+		t.Fatalf("LoadBackup() error: %v", err)
+	}
+
+	target, targetClient := newTestDevice(t, tasmotatest.WithRelays(2))
+	plan, err := targetClient.Restore(ctx, loaded)
+	if err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	if plan.Empty() {
+		t.Fatal("Restore() applied no changes")
+	}
+
+	want, got := source.State(), target.State()
+	got.BootCount, want.BootCount = 0, 0
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("restored state differs:\n got: %+v\nwant: %+v", got, want)
+	}
+
+	if _, err := targetClient.Restore(ctx, &Backup{Version: BackupVersion + 1}); !IsCommandError(err) {
+		t.Errorf("Restore() future version error = %v, want command error", err)
+	}
+}
+
+func TestRestore_VerifyFails(t *testing.T) {
+	srv, client := newTestDevice(t)
+	// A device that ignores DeviceName changes never converges
+	srv.Handle("DeviceName", func(s *tasmotatest.State, _ tasmotatest.Command) map[string]any {
+		return map[string]any{"DeviceName": s.DeviceName}
+	})
+
+	name := "Kitchen"
+	backup := &Backup{Version: BackupVersion, Config: DesiredState{Device: &DesiredDevice{DeviceName: &name}}}
+
+	if _, err := client.Restore(context.Background(), backup); !IsDeviceError(err) {
+		t.Errorf("Restore() error = %v, want device error", err)
+	}
+}
+
+func TestRestore_ReservedSetOptions(t *testing.T) {
+	source, sourceClient := newTestDevice(t)
+	source.Update(func(s *tasmotatest.State) {
+		s.SetOptions[5] = 1
+		s.SetOptions[19] = 1
+		s.SetOptions[170] = 1
+	})
+
+	backup, err := sourceClient.Backup(context.Background())
+	if err != nil {
+		t.Fatalf("Backup() error: %v", err)
+	}
+	for _, n := range []int{5, 170} {
+		if _, ok := backup.Config.SetOptions[n]; ok {
+			t.Errorf("backup contains reserved SetOption%d", n)
+		}
+	}
+
+	target, targetClient := newTestDevice(t)
+	// Like the firmware, answer Unknown for options it does not define
+	target.Handle("SetOption", func(s *tasmotatest.State, cmd tasmotatest.Command) map[string]any {
+		value, err := strconv.Atoi(cmd.Payload)
+		if err != nil || !settableSetOption(cmd.Index) {
+			return nil
+		}
+		s.SetOptions[cmd.Index] = value
+		return map[string]any{fmt.Sprintf("SetOption%d", cmd.Index): value}
+	})
+
+	if _, err := targetClient.Restore(context.Background(), backup); err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	if got := target.State().SetOptions[19]; got != 1 {
+		t.Errorf("SetOption19 = %d, want 1", got)
+	}
+}
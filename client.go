@@ -3,6 +3,7 @@ package tasmota
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -20,13 +21,29 @@ const (
 	DefaultResponseTimeout = 20 * time.Second
 )
 
-// Client represents a Tasmota device client.
+// Client represents a Tasmota device client. It is safe for concurrent use;
+// requests to the device are sent one at a time.
 type Client struct {
 	baseURL    string
 	httpClient *http.Client
+	timeout    time.Duration
 	username   string
 	password   string
 	logger     *slog.Logger
+	transport  Transport
+	retry      *RetryPolicy
+	breaker    *circuitBreaker
+	queue      *requestQueue
+	keepAlive  *time.Duration
+	formPost   bool
+	middleware []Middleware
+}
+
+// Transport delivers a single command to a device and returns the raw response body.
+// When no Transport is configured, commands are sent as HTTP GET requests to the
+// device's /cm endpoint.
+type Transport interface {
+	Execute(ctx context.Context, command string) ([]byte, error)
 }
 
 // ClientOption is a functional option for configuring the Client.
@@ -40,10 +57,14 @@ func WithAuth(username, password string) ClientOption {
 	}
 }
 
-// WithTimeout configures the HTTP client timeout.
+// WithTimeout configures the HTTP client timeout. For a client with a
+// Transport it bounds each command that has no earlier context deadline.
 func WithTimeout(timeout time.Duration) ClientOption {
 	return func(c *Client) {
-		c.httpClient.Timeout = timeout
+		c.timeout = timeout
+		if c.httpClient != nil {
+			c.httpClient.Timeout = timeout
+		}
 	}
 }
 
@@ -62,6 +83,21 @@ func WithLogger(logger *slog.Logger) ClientOption {
 	}
 }
 
+// WithTransport routes all commands through the given Transport instead of HTTP.
+func WithTransport(transport Transport) ClientOption {
+	return func(c *Client) {
+		c.transport = transport
+	}
+}
+
+// WithFormPost sends commands and credentials as a form POST body instead of
+// in the URL, keeping them out of the request logs of proxies and servers.
+func WithFormPost() ClientOption {
+	return func(c *Client) {
+		c.formPost = true
+	}
+}
+
 // NewClient creates a new Tasmota client for the specified host.
 // The host can be an IP address (192.168.1.100) or hostname with optional port.
 // If no scheme is provided, http:// will be used.
@@ -76,16 +112,22 @@ func NewClient(host string, opts ...ClientOption) (*Client, error) {
 		return nil, NewError(ErrorTypeNetwork, "invalid host", err)
 	}
 
+	// The device serves one connection at a time
+	transport := &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: DefaultConnectTimeout,
+		}).DialContext,
+		MaxConnsPerHost:     1,
+		MaxIdleConnsPerHost: 1,
+		IdleConnTimeout:     DefaultKeepAlive,
+	}
 	client := &Client{
 		baseURL: baseURL,
 		httpClient: &http.Client{
-			Timeout: DefaultResponseTimeout,
-			Transport: &http.Transport{
-				DialContext: (&net.Dialer{
-					Timeout: DefaultConnectTimeout,
-				}).DialContext,
-			},
+			Timeout:   DefaultResponseTimeout,
+			Transport: transport,
 		},
+		queue: newRequestQueue(),
 	}
 
 	// Apply options
@@ -93,6 +135,10 @@ func NewClient(host string, opts ...ClientOption) (*Client, error) {
 		opt(client)
 	}
 
+	if client.keepAlive != nil && client.httpClient.Transport == transport {
+		applyKeepAlive(transport, *client.keepAlive)
+	}
+
 	return client, nil
 }
 
@@ -132,6 +178,14 @@ func (c *Client) buildURL(command string) (string, error) {
 
 	u.Path = "/cm"
 	q := u.Query()
+	c.setCommand(q, command)
+
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// setCommand sets the /cm parameters for a command.
+func (c *Client) setCommand(q url.Values, command string) {
 	q.Set("cmnd", command)
 
 	// Add authentication if configured
@@ -141,9 +195,56 @@ func (c *Client) buildURL(command string) (string, error) {
 	if c.password != "" {
 		q.Set("password", c.password)
 	}
+}
 
-	u.RawQuery = q.Encode()
-	return u.String(), nil
+// post sends a command as a form POST to /cm.
+func (c *Client) post(ctx context.Context, command string) ([]byte, error) {
+	if command == "" {
+		return nil, NewError(ErrorTypeCommand, "command cannot be empty", nil)
+	}
+
+	u, err := url.Parse(c.baseURL)
+	if err != nil {
+		return nil, NewError(ErrorTypeNetwork, "invalid base URL", err)
+	}
+	u.Path = "/cm"
+
+	form := url.Values{}
+	c.setCommand(form, command)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, NewError(ErrorTypeNetwork, "failed to create request", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return c.doRequest(ctx, req)
+}
+
+// send delivers a command through the configured transport, falling back to HTTP.
+func (c *Client) send(ctx context.Context, command string) ([]byte, error) {
+	if c.transport != nil {
+		if c.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+		}
+		if err := c.queue.acquire(ctx); err != nil {
+			return nil, err
+		}
+		defer c.queue.release()
+		return c.transport.Execute(ctx, command)
+	}
+	if c.formPost {
+		return c.post(ctx, command)
+	}
+
+	urlStr, err := c.buildURL(command)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.do(ctx, urlStr)
 }
 
 // do executes an HTTP GET request and returns the response body.
@@ -153,6 +254,19 @@ func (c *Client) do(ctx context.Context, urlStr string) ([]byte, error) {
 		return nil, NewError(ErrorTypeNetwork, "failed to create request", err)
 	}
 
+	return c.doRequest(ctx, req)
+}
+
+// doRequest sends an HTTP request to the device and returns the response body.
+// Requests wait for each other, since the device handles one at a time.
+func (c *Client) doRequest(ctx context.Context, req *http.Request) ([]byte, error) {
+	if err := c.queue.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer c.queue.release()
+
+	// Never log credentials
+	urlStr := redactURL(req.URL.String())
 	req.Header.Set("User-Agent", UserAgent)
 
 	if c.logger != nil {
@@ -163,6 +277,10 @@ func (c *Client) do(ctx context.Context, urlStr string) ([]byte, error) {
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = urlStr
+		}
 		if c.logger != nil {
 			c.logger.Error("request failed",
 				"url", urlStr,
@@ -188,10 +306,15 @@ func (c *Client) do(ctx context.Context, urlStr string) ([]byte, error) {
 	}
 
 	if c.logger != nil {
+		// Binary bodies are settings dumps, which hold passwords
+		logged := redactBody(string(body))
+		if resp.Header.Get("Content-Type") == "application/octet-stream" {
+			logged = "(binary)"
+		}
 		c.logger.Debug("received response",
 			"status_code", resp.StatusCode,
 			"body_length", len(body),
-			"body", string(body))
+			"body", logged)
 	}
 
 	// Check for HTTP errors
@@ -206,6 +329,14 @@ func (c *Client) do(ctx context.Context, urlStr string) ([]byte, error) {
 	return body, nil
 }
 
+// device identifies the device for middleware.
+func (c *Client) device() string {
+	if t, ok := c.transport.(*MQTTTransport); ok {
+		return t.topics.Topic
+	}
+	return c.baseURL
+}
+
 // BaseURL returns the base URL of the client.
 func (c *Client) BaseURL() string {
 	return c.baseURL
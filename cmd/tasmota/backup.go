@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/kradalby/tasmota-go"
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+func newBackupCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota backup", flag.ExitOnError)
+	output := fs.String("output", "", "Write the backup to this file instead of stdout")
+
+	return &ffcli.Command{
+		Name:       "backup",
+		ShortUsage: "tasmota backup [--output <file>]",
+		ShortHelp:  "Save the device configuration to a JSON backup",
+		LongHelp: `Read every readable setting from the device (device settings, friendly
+names, PulseTime, module and template, MQTT and network settings,
+SetOptions, rules and timers) into a versioned JSON document.
+
+Passwords cannot be read from the device and are not included.
+
+Examples:
+  tasmota --host 192.168.1.100 backup --output kitchen.json
+  tasmota --host 192.168.1.100 backup > kitchen.json`,
+		FlagSet: fs,
+		Exec: func(ctx context.Context, _ []string) error {
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+
+			backup, err := client.Backup(ctx)
+			if err != nil {
+				return err
+			}
+
+			if *output != "" {
+				if err := tasmota.SaveBackup(*output, backup); err != nil {
+					return err
+				}
+				fmt.Printf("Backed up %s to %s\n", backup.Device.DeviceName, *output)
+				return nil
+			}
+
+			data, err := json.MarshalIndent(backup, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal JSON: %w", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		},
+	}
+}
+
+func newRestoreCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota restore", flag.ExitOnError)
+	file := fs.String("file", "", "Backup file to restore (required)")
+	dryRun := fs.Bool("dry-run", false, "Show the changes without applying them")
+
+	return &ffcli.Command{
+		Name:       "restore",
+		ShortUsage: "tasmota restore --file <backup.json> [--dry-run]",
+		ShortHelp:  "Restore the device configuration from a backup",
+		LongHelp: `Apply a backup written by "tasmota backup". Only settings that differ are
+sent, using Backlog, and the result is verified by reading the device again.
+
+Module and network changes restart the device, so verification can fail
+until it is back online; re-run restore to check.
+
+Examples:
+  tasmota --host 192.168.1.100 restore --file kitchen.json --dry-run
+  tasmota --host 192.168.1.100 restore --file kitchen.json`,
+		FlagSet: fs,
+		Exec: func(ctx context.Context, _ []string) error {
+			if *file == "" {
+				return fmt.Errorf("--file is required")
+			}
+
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+
+			backup, err := tasmota.LoadBackup(*file)
+			if err != nil {
+				return err
+			}
+
+			if *dryRun {
+				plan, err := client.Plan(ctx, &backup.Config)
+				if err != nil {
+					return err
+				}
+				fmt.Print(plan)
+				return nil
+			}
+
+			plan, err := client.Restore(ctx, backup)
+			if plan != nil {
+				fmt.Print(plan)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Println("Restore verified")
+			return nil
+		},
+	}
+}
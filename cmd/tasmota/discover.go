@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kradalby/tasmota-go"
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+func newDiscoverCmd(username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota discover", flag.ExitOnError)
+	subnets := fs.String("subnet", "", "Comma-separated CIDR ranges to scan (e.g. 192.168.1.0/24)")
+	mdns := fs.Bool("mdns", false, "Query mDNS (requires SetOption55 1 on devices)")
+	mqttBroker := fs.String("mqtt-broker", "", "MQTT broker host:port to listen for discovery messages")
+	mqttUser := fs.String("mqtt-user", "", "MQTT broker username")
+	mqttPassword := fs.String("mqtt-password", "", "MQTT broker password")
+	wait := fs.Duration("wait", tasmota.DefaultDiscoveryWait, "How long to listen for mDNS and MQTT replies")
+	concurrency := fs.Int("concurrency", tasmota.DefaultDiscoveryConcurrency, "Maximum concurrent probes")
+	port := fs.Int("port", 80, "HTTP port to probe")
+	jsonOutput := fs.Bool("json", false, "Output JSON")
+
+	return &ffcli.Command{
+		Name:       "discover",
+		ShortUsage: "tasmota discover [--subnet <cidr>] [--mdns] [--mqtt-broker <host:port>]",
+		ShortHelp:  "Find Tasmota devices on the local network",
+		LongHelp: `Find Tasmota devices on the local network.
+
+Discovery methods can be combined; results are merged by MAC address:
+  - Subnet scan: probes every address in the given ranges with Status 0
+  - mDNS: queries _http._tcp.local and probes responders (needs SetOption55 1)
+  - MQTT: listens on tasmota/discovery/+/config for devices announcing themselves
+
+The --host flag is not used by this command.
+
+Examples:
+  # Scan a /24
+  tasmota discover --subnet 192.168.1.0/24
+
+  # Combine mDNS and MQTT discovery
+  tasmota discover --mdns --mqtt-broker mqtt.home:1883 --wait 5s
+
+  # JSON output for scripting
+  tasmota discover --subnet 192.168.1.0/24 --json`,
+		FlagSet: fs,
+		Exec: func(ctx context.Context, _ []string) error {
+			probeOpts := []tasmota.ClientOption{tasmota.WithTimeout(*timeout)}
+			if *username != "" || *password != "" {
+				probeOpts = append(probeOpts, tasmota.WithAuth(*username, *password))
+			}
+			if *debug {
+				logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+					Level: slog.LevelDebug,
+				}))
+				probeOpts = append(probeOpts, tasmota.WithLogger(logger))
+			}
+
+			opts := []tasmota.DiscoverOption{
+				tasmota.WithScanPort(*port),
+				tasmota.WithDiscoveryWait(*wait),
+				tasmota.WithDiscoveryConcurrency(*concurrency),
+				tasmota.WithProbeOptions(probeOpts...),
+			}
+
+			methods := 0
+			for _, s := range strings.Split(*subnets, ",") {
+				s = strings.TrimSpace(s)
+				if s == "" {
+					continue
+				}
+				prefix, err := netip.ParsePrefix(s)
+				if err != nil {
+					return fmt.Errorf("invalid subnet %q: %w", s, err)
+				}
+				opts = append(opts, tasmota.WithScan(prefix))
+				methods++
+			}
+
+			if *mdns {
+				opts = append(opts, tasmota.WithMDNS())
+				methods++
+			}
+
+			if *mqttBroker != "" {
+				var dialOpts []tasmota.MQTTDialOption
+				if *mqttUser != "" || *mqttPassword != "" {
+					dialOpts = append(dialOpts, tasmota.WithMQTTCredentials(*mqttUser, *mqttPassword))
+				}
+				conn, err := tasmota.DialMQTT(ctx, *mqttBroker, dialOpts...)
+				if err != nil {
+					return fmt.Errorf("failed to connect to MQTT broker: %w", err)
+				}
+				defer func() { _ = conn.Close() }()
+
+				opts = append(opts, tasmota.WithMQTTDiscovery(conn))
+				methods++
+			}
+
+			if methods == 0 {
+				return fmt.Errorf("at least one of --subnet, --mdns or --mqtt-broker is required")
+			}
+
+			devices, err := tasmota.Discover(ctx, opts...)
+			if err != nil {
+				return fmt.Errorf("discovery failed: %w", err)
+			}
+
+			if *jsonOutput {
+				data, err := json.MarshalIndent(devices, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal JSON: %w", err)
+				}
+				fmt.Println(string(data))
+				return nil
+			}
+
+			if len(devices) == 0 {
+				fmt.Println("No devices found")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "MAC\tIP\tHOSTNAME\tFIRMWARE\tMODULE\tFOUND BY")
+			for _, d := range devices {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+					d.MAC, d.IP, d.Hostname, d.Firmware, d.Module, d.Methods)
+			}
+			return w.Flush()
+		},
+	}
+}
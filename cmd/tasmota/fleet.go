@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kradalby/tasmota-go"
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+func newFleetCmd(username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota fleet", flag.ExitOnError)
+	inventory := fs.String("inventory", "fleet.json", "Path to the fleet inventory JSON file")
+	selector := fs.String("selector", "", "Label selector (e.g. room=kitchen,type!=bulb)")
+
+	return &ffcli.Command{
+		Name:       "fleet",
+		ShortUsage: "tasmota fleet [--inventory <file>] [--selector <labels>] <subcommand>",
+		ShortHelp:  "Run commands across many devices",
+		LongHelp: `Run commands across many devices listed in an inventory file.
+
+The inventory is a JSON file listing devices with optional labels and
+per-device credentials:
+
+  {
+    "devices": [
+      {"name": "kitchen-plug", "host": "192.168.1.10", "labels": {"room": "kitchen"}},
+      {"name": "desk-lamp", "host": "192.168.1.11", "labels": {"room": "office", "type": "bulb"}}
+    ]
+  }
+
+Devices are chosen with a label selector: a comma-separated list of
+key=value, key!=value, key (label present) and !key (label absent).
+The --host flag is not used by this command.
+
+Examples:
+  # List devices in the kitchen
+  tasmota fleet --selector room=kitchen list
+
+  # Turn off every plug
+  tasmota fleet --selector type=plug run Power OFF
+
+  # Query status of all devices, 20 at a time
+  tasmota fleet run --concurrency 20 Status 0`,
+		FlagSet: fs,
+		Subcommands: []*ffcli.Command{
+			newFleetListCmd(inventory, selector, username, password, timeout, debug),
+			newFleetRunCmd(inventory, selector, username, password, timeout, debug),
+		},
+		Exec: func(_ context.Context, _ []string) error {
+			return flag.ErrHelp
+		},
+	}
+}
+
+func newFleetListCmd(inventory, selector, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota fleet list", flag.ExitOnError)
+
+	return &ffcli.Command{
+		Name:       "list",
+		ShortUsage: "tasmota fleet list",
+		ShortHelp:  "List devices matching the selector",
+		FlagSet:    fs,
+		Exec: func(_ context.Context, _ []string) error {
+			fleet, sel, err := loadFleet(*inventory, *selector, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tHOST\tLABELS")
+			for _, d := range fleet.Devices(sel) {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", d.Name, d.Client.BaseURL(), formatLabels(d.Labels))
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func newFleetRunCmd(inventory, selector, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota fleet run", flag.ExitOnError)
+	concurrency := fs.Int("concurrency", tasmota.DefaultFleetConcurrency, "Maximum devices in flight")
+	deviceTimeout := fs.Duration("device-timeout", tasmota.DefaultDeviceTimeout, "Time allowed per device")
+	jsonOutput := fs.Bool("json", false, "Output JSON")
+
+	return &ffcli.Command{
+		Name:       "run",
+		ShortUsage: "tasmota fleet run [flags] <command> [payload]",
+		ShortHelp:  "Send a raw command to every device matching the selector",
+		LongHelp: `Send a raw Tasmota command to every device matching the selector and
+print a per-device report. Exits with an error if any device failed.
+
+Examples:
+  tasmota fleet --selector room=kitchen run Power OFF
+  tasmota fleet run --json Status 2`,
+		FlagSet: fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("command is required")
+			}
+			command := strings.Join(args, " ")
+
+			fleet, sel, err := loadFleet(*inventory, *selector, *username, *password, *timeout, *debug,
+				tasmota.WithFleetConcurrency(*concurrency),
+				tasmota.WithDeviceTimeout(*deviceTimeout),
+			)
+			if err != nil {
+				return err
+			}
+
+			report := fleet.Run(ctx, sel, func(ctx context.Context, c *tasmota.Client) (any, error) {
+				return c.ExecuteCommand(ctx, command)
+			})
+
+			if *jsonOutput {
+				type result struct {
+					Device     string          `json:"device"`
+					Response   json.RawMessage `json:"response,omitempty"`
+					Error      string          `json:"error,omitempty"`
+					DurationMS int64           `json:"duration_ms"`
+				}
+				out := make([]result, len(report.Results))
+				for i, res := range report.Results {
+					out[i] = result{Device: res.Device, DurationMS: res.Duration.Milliseconds()}
+					if res.Err != nil {
+						out[i].Error = res.Err.Error()
+					} else if raw, ok := res.Value.(json.RawMessage); ok {
+						out[i].Response = raw
+					}
+				}
+				data, err := json.MarshalIndent(out, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal JSON: %w", err)
+				}
+				fmt.Println(string(data))
+			} else {
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "DEVICE\tRESULT\tDURATION\tRESPONSE")
+				for _, res := range report.Results {
+					status, detail := "ok", ""
+					if res.Err != nil {
+						status, detail = "error", res.Err.Error()
+					} else if raw, ok := res.Value.(json.RawMessage); ok {
+						detail = string(raw)
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", res.Device, status, res.Duration.Round(time.Millisecond), detail)
+				}
+				if err := w.Flush(); err != nil {
+					return err
+				}
+				fmt.Printf("\n%d succeeded, %d failed in %s\n",
+					len(report.Succeeded()), len(report.Failed()), report.Duration.Round(time.Millisecond))
+			}
+
+			return report.Err()
+		},
+	}
+}
+
+// loadFleet reads the inventory and parses the selector.
+func loadFleet(path, selector, username, password string, timeout time.Duration, debug bool, opts ...tasmota.FleetOption) (*tasmota.Fleet, tasmota.Selector, error) {
+	sel, err := tasmota.ParseSelector(selector)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inv, err := tasmota.LoadInventory(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clientOpts := []tasmota.ClientOption{tasmota.WithTimeout(timeout)}
+	if username != "" || password != "" {
+		clientOpts = append(clientOpts, tasmota.WithAuth(username, password))
+	}
+	if debug {
+		logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+			Level: slog.LevelDebug,
+		}))
+		clientOpts = append(clientOpts, tasmota.WithLogger(logger))
+	}
+
+	fleet, err := tasmota.NewFleetFromInventory(inv, clientOpts, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return fleet, sel, nil
+}
+
+func formatLabels(labels tasmota.Labels) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + labels[k]
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kradalby/tasmota-go"
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+func newLightCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "light",
+		ShortUsage: "tasmota light <subcommand>",
+		ShortHelp:  "Control bulbs and LED strips",
+		LongHelp: `Control the brightness, color and effects of bulbs and LED strips.
+
+Colors are hex (FF8000) or decimal (255,128,0) channel values, up to five
+channels for red, green, blue, cold and warm white. Use --hsb to give hue,
+saturation and brightness instead. Color temperatures are mireds (153-500)
+or Kelvin with a K suffix.
+
+Examples:
+  tasmota --host 192.168.1.100 light get
+  tasmota --host 192.168.1.100 light dimmer 40
+  tasmota --host 192.168.1.100 light color FF8000
+  tasmota --host 192.168.1.100 light color --hsb 240,100,50
+  tasmota --host 192.168.1.100 light ct 2700K
+  tasmota --host 192.168.1.100 light scheme cycleup
+  tasmota --host 192.168.1.100 light wakeup --dimmer 80 --duration 15m`,
+		Subcommands: []*ffcli.Command{
+			newLightGetCmd(host, username, password, timeout, debug),
+			newLightSetCmd("dimmer", "<0-100>", "Set the brightness in percent",
+				host, username, password, timeout, debug,
+				func(ctx context.Context, client *tasmota.Client, arg string) (*tasmota.LightState, error) {
+					n, err := strconv.Atoi(arg)
+					if err != nil {
+						return nil, fmt.Errorf("invalid dimmer %q", arg)
+					}
+					return client.SetDimmer(ctx, n)
+				}),
+			newLightColorCmd(host, username, password, timeout, debug),
+			newLightSetCmd("ct", "<mireds|<kelvin>K>", "Set the white color temperature",
+				host, username, password, timeout, debug,
+				func(ctx context.Context, client *tasmota.Client, arg string) (*tasmota.LightState, error) {
+					ct, err := parseCT(arg)
+					if err != nil {
+						return nil, err
+					}
+					return client.SetCT(ctx, ct)
+				}),
+			newLightSetCmd("fade", "<on|off>", "Fade between light changes",
+				host, username, password, timeout, debug,
+				func(ctx context.Context, client *tasmota.Client, arg string) (*tasmota.LightState, error) {
+					on, err := parseOnOff(arg)
+					if err != nil {
+						return nil, err
+					}
+					return nil, client.SetFade(ctx, on)
+				}),
+			newLightSetCmd("speed", "<1-40>", "Set the fade and scheme speed, 1 is fastest",
+				host, username, password, timeout, debug,
+				func(ctx context.Context, client *tasmota.Client, arg string) (*tasmota.LightState, error) {
+					n, err := strconv.Atoi(arg)
+					if err != nil {
+						return nil, fmt.Errorf("invalid speed %q", arg)
+					}
+					return nil, client.SetSpeed(ctx, n)
+				}),
+			newLightSetCmd("scheme", "<single|wakeup|cycleup|cycledown|random|0-12>", "Select a light scheme",
+				host, username, password, timeout, debug,
+				func(ctx context.Context, client *tasmota.Client, arg string) (*tasmota.LightState, error) {
+					scheme, err := parseScheme(arg)
+					if err != nil {
+						return nil, err
+					}
+					return nil, client.SetScheme(ctx, scheme)
+				}),
+			newLightWakeupCmd(host, username, password, timeout, debug),
+		},
+		Exec: func(_ context.Context, _ []string) error {
+			return flag.ErrHelp
+		},
+	}
+}
+
+func newLightGetCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota light get", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "Output JSON")
+
+	return &ffcli.Command{
+		Name:       "get",
+		ShortUsage: "tasmota light get [--json]",
+		ShortHelp:  "Show the light state",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, _ []string) error {
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+			light, err := client.GetLight(ctx)
+			if err != nil {
+				return err
+			}
+
+			if *jsonOutput {
+				data, err := json.MarshalIndent(light, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal JSON: %w", err)
+				}
+				fmt.Println(string(data))
+				return nil
+			}
+			printLight(light)
+			fmt.Printf("Scheme:  %s, speed %d, fade %s\n", light.Scheme, light.Speed, onOff(light.Fade, "on", "off"))
+			return nil
+		},
+	}
+}
+
+// newLightSetCmd builds a subcommand taking one argument. set returns the
+// new light state, or nil for commands that do not report it.
+func newLightSetCmd(name, usage, help string, host, username, password *string, timeout *time.Duration, debug *bool,
+	set func(context.Context, *tasmota.Client, string) (*tasmota.LightState, error),
+) *ffcli.Command {
+	return &ffcli.Command{
+		Name:       name,
+		ShortUsage: fmt.Sprintf("tasmota light %s %s", name, usage),
+		ShortHelp:  help,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("expected one argument: %s", usage)
+			}
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+			light, err := set(ctx, client, args[0])
+			if err != nil {
+				return err
+			}
+			if light != nil {
+				printLight(light)
+			} else {
+				fmt.Printf("%s set to %s\n", strings.ToUpper(name[:1])+name[1:], args[0])
+			}
+			return nil
+		},
+	}
+}
+
+func newLightColorCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota light color", flag.ExitOnError)
+	hsb := fs.String("hsb", "", "Hue, saturation and brightness, e.g. 240,100,50")
+
+	return &ffcli.Command{
+		Name:       "color",
+		ShortUsage: "tasmota light color <hex|r,g,b[,cw,ww]> | --hsb <h,s,b>",
+		ShortHelp:  "Set the color",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, args []string) error {
+			var color tasmota.Color
+			switch {
+			case *hsb != "" && len(args) == 0:
+				c, err := tasmota.ParseHSB(*hsb)
+				if err != nil {
+					return err
+				}
+				color = c
+			case *hsb == "" && len(args) == 1:
+				c, err := tasmota.ParseColor(args[0])
+				if err != nil {
+					return err
+				}
+				color = c
+				if strings.Count(args[0], ",") == 2 || len(strings.TrimPrefix(args[0], "#")) == 6 {
+					// Leave the white channels alone for plain RGB colors
+					color = c.RGB()
+				}
+			default:
+				return fmt.Errorf("give either a color or --hsb")
+			}
+
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+			light, err := client.SetColor(ctx, color)
+			if err != nil {
+				return err
+			}
+			printLight(light)
+			return nil
+		},
+	}
+}
+
+func newLightWakeupCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota light wakeup", flag.ExitOnError)
+	dimmer := fs.Int("dimmer", 100, "Brightness to end at (1-100)")
+	duration := fs.Duration("duration", 0, "Time to reach it, up to 50m (default: the device's WakeupDuration)")
+
+	return &ffcli.Command{
+		Name:       "wakeup",
+		ShortUsage: "tasmota light wakeup [--dimmer <n>] [--duration <d>]",
+		ShortHelp:  "Slowly raise the brightness",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, _ []string) error {
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+			if err := client.Wakeup(ctx, *dimmer, *duration); err != nil {
+				return err
+			}
+			fmt.Printf("Wakeup to %d%% started\n", *dimmer)
+			return nil
+		},
+	}
+}
+
+func printLight(light *tasmota.LightState) {
+	fmt.Printf("Power:   %s\n", onOff(light.Power, "ON", "OFF"))
+	fmt.Printf("Dimmer:  %d%%\n", light.Dimmer)
+	if light.Channels >= 3 {
+		fmt.Printf("Color:   %s (HSB %s)\n", light.Color.RGB(), light.HSB)
+	}
+	if light.CT != 0 {
+		fmt.Printf("CT:      %d mireds (%dK)\n", light.CT, light.CT.Kelvin())
+	}
+	fmt.Printf("Channel: %v\n", light.Channel)
+}
+
+// parseCT parses mireds, or Kelvin with a K suffix.
+func parseCT(s string) (tasmota.CT, error) {
+	if k, ok := strings.CutSuffix(strings.ToUpper(s), "K"); ok {
+		n, err := strconv.Atoi(k)
+		if err != nil {
+			return 0, fmt.Errorf("invalid color temperature %q", s)
+		}
+		return tasmota.Kelvin(n), nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid color temperature %q", s)
+	}
+	return tasmota.CT(n), nil
+}
+
+func parseScheme(s string) (tasmota.LightScheme, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return tasmota.LightScheme(n), nil
+	}
+	for scheme := tasmota.SchemeSingle; scheme <= tasmota.SchemeRandom; scheme++ {
+		if strings.EqualFold(s, scheme.String()) {
+			return scheme, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid scheme %q", s)
+}
+
+func parseOnOff(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "on", "1", "true":
+		return true, nil
+	case "off", "0", "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("expected on or off, got %q", s)
+}
@@ -30,10 +30,24 @@ func main() {
 
 This CLI provides comprehensive control over Tasmota devices including:
   - Power control (on/off/toggle for up to 8 relays)
+  - Light control (dimmer, color, color temperature and schemes)
+  - Shutter and blind positioning and calibration
+  - Zigbee2Tasmota bridges: pairing, naming, binding and sending to devices
+  - Infrared codes and air conditioner states from IR blasters
+  - RF bridge codes: sending, learning and copying RfKey slots between bridges
+  - TuyaMCU data point mapping, sending and watching
   - Device status and information queries
   - Network configuration (hostname, static IP, DHCP, WiFi)
   - MQTT setup and testing
   - Real-time device information
+  - Discovery of devices on the local network
+  - Running commands across a fleet of devices selected by label
+  - Declarative configuration with plan/apply
+  - Configuration backup and restore
+  - Decoding and uploading binary settings dumps
+  - Firmware upgrades, one device or a rolling fleet upgrade
+  - Clock, sunrise and sunset timers
+  - Rule sets, with offline checking of rule files
 
 Authentication:
   If your device requires authentication, use --username and --password flags.
@@ -45,12 +59,54 @@ Examples:
   # Turn on a relay
   tasmota --host 192.168.1.100 power on
 
+  # Set a bulb to warm white at 40%
+  tasmota --host 192.168.1.100 light ct 2700K
+  tasmota --host 192.168.1.100 light dimmer 40
+
+  # Half open a shutter and wait until it gets there
+  tasmota --host 192.168.1.100 shutter position --wait 50
+
+  # Pair a Zigbee device and turn it on
+  tasmota --host 192.168.1.100 zigbee join on
+  tasmota --host 192.168.1.100 zigbee send 0x1234 '{"Power":1}'
+
+  # Cool to 22 degrees through an IR blaster
+  tasmota --host 192.168.1.100 ir hvac --vendor DAIKIN --mode Cool --temp 22
+
+  # Copy the learned RF remotes of one bridge to another
+  tasmota --host 192.168.1.100 rf export --output codes.json
+  tasmota --host 192.168.1.101 rf import --file codes.json
+
+  # Map the dimmer of a TuyaMCU device and watch what the MCU reports
+  tasmota --host 192.168.1.100 tuya map 21 2
+  tasmota --host 192.168.1.100 tuya watch --mqtt-broker mqtt.home:1883
+
   # Configure network
   tasmota --host 192.168.1.100 network set-hostname --hostname tasmota-bedroom
 
   # Setup MQTT
   tasmota --host 192.168.1.100 mqtt set-config --mqtt-host mqtt.home --mqtt-topic bedroom
 
+  # Find devices on the local network
+  tasmota discover --subnet 192.168.1.0/24
+
+  # Turn off every device labelled room=kitchen in fleet.json
+  tasmota fleet --selector room=kitchen run Power OFF
+
+  # Show and apply the changes needed to match a config file
+  tasmota --host 192.168.1.100 plan --file kitchen.yaml
+  tasmota --host 192.168.1.100 apply --file kitchen.yaml
+
+  # Back up a device before upgrading it, and restore it afterwards
+  tasmota --host 192.168.1.100 backup --output kitchen.json
+  tasmota --host 192.168.1.100 restore --file kitchen.json
+
+  # Upgrade the firmware and check the new version
+  tasmota --host 192.168.1.100 upgrade --url http://ota.tasmota.com/tasmota/release/tasmota.bin.gz --expect 14.3.0
+
+  # Switch relay 1 on at 06:30 on weekdays
+  tasmota --host 192.168.1.100 timers set --timer 1 --enable --time 06:30 --days -MTWTF- --action on
+
   # Enable debug logging
   tasmota --host 192.168.1.100 --debug status
 
@@ -62,9 +118,25 @@ Environment Variables:
 		Subcommands: []*ffcli.Command{
 			newStatusCmd(host, username, password, timeout, debug),
 			newPowerCmd(host, username, password, timeout, debug),
+			newLightCmd(host, username, password, timeout, debug),
+			newShutterCmd(host, username, password, timeout, debug),
+			newZigbeeCmd(host, username, password, timeout, debug),
+			newIRCmd(host, username, password, timeout, debug),
+			newRFCmd(host, username, password, timeout, debug),
+			newTuyaCmd(host, username, password, timeout, debug),
 			newInfoCmd(host, username, password, timeout, debug),
 			newNetworkCmd(host, username, password, timeout, debug),
 			newMQTTCmd(host, username, password, timeout, debug),
+			newDiscoverCmd(username, password, timeout, debug),
+			newFleetCmd(username, password, timeout, debug),
+			newPlanCmd(host, username, password, timeout, debug),
+			newApplyCmd(host, username, password, timeout, debug),
+			newBackupCmd(host, username, password, timeout, debug),
+			newRestoreCmd(host, username, password, timeout, debug),
+			newSettingsCmd(host, username, password, timeout, debug),
+			newUpgradeCmd(host, username, password, timeout, debug),
+			newTimersCmd(host, username, password, timeout, debug),
+			newRulesCmd(host, username, password, timeout, debug),
 		},
 		Exec: func(_ context.Context, _ []string) error {
 			return flag.ErrHelp
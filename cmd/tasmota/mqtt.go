@@ -246,7 +246,7 @@ configuring MQTT for the first time or changing multiple settings.`,
 				Host:       *mqttHost,
 				Port:       *mqttPort,
 				User:       *mqttUser,
-				Password:   *mqttPassword,
+				Password:   tasmota.Secret(*mqttPassword),
 				Client:     *mqttClient,
 				Topic:      *mqttTopic,
 				FullTopic:  *mqttFullTopic,
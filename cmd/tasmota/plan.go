@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/kradalby/tasmota-go"
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+// errChangesPending is returned by "plan --exit-code" when the device differs.
+var errChangesPending = errors.New("device does not match the desired state")
+
+func newPlanCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota plan", flag.ExitOnError)
+	file := fs.String("file", "", "Desired state file (.yaml, .yml or .json, required)")
+	secrets := fs.Bool("secrets", false, "Include write-only passwords in the plan")
+	exitCode := fs.Bool("exit-code", false, "Exit with an error when changes are pending")
+
+	return &ffcli.Command{
+		Name:       "plan",
+		ShortUsage: "tasmota plan --file <desired.yaml> [flags]",
+		ShortHelp:  "Show the changes needed to reach a desired state",
+		LongHelp: `Compare the device configuration with a desired-state document and print
+the changes that "tasmota apply" would make. Nothing is sent to the device
+other than read-only queries.
+
+The document covers device, MQTT and network settings, SetOptions, rules
+and timers. Only the settings present are managed:
+
+  Device:
+    DeviceName: Kitchen
+    PowerOnState: 3
+  MQTT:
+    Host: mqtt.home
+    Topic: kitchen
+  SetOptions:
+    19: 0
+  Rules:
+    1:
+      Rules: ON Power1#State=1 DO Publish stat/kitchen/on 1 ENDON
+      Enabled: true
+
+Passwords cannot be read back from the device, so they are only planned
+with --secrets.
+
+Examples:
+  tasmota --host 192.168.1.100 plan --file kitchen.yaml
+  tasmota --host 192.168.1.100 plan --file kitchen.yaml --exit-code`,
+		FlagSet: fs,
+		Exec: func(ctx context.Context, _ []string) error {
+			client, desired, err := loadDesired(*host, *username, *password, *timeout, *debug, *file)
+			if err != nil {
+				return err
+			}
+
+			plan, err := client.Plan(ctx, desired, planOptions(*secrets)...)
+			if err != nil {
+				return err
+			}
+
+			fmt.Print(plan)
+			if *exitCode && !plan.Empty() {
+				return errChangesPending
+			}
+			return nil
+		},
+	}
+}
+
+func newApplyCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota apply", flag.ExitOnError)
+	file := fs.String("file", "", "Desired state file (.yaml, .yml or .json, required)")
+	secrets := fs.Bool("secrets", false, "Also set write-only passwords")
+
+	return &ffcli.Command{
+		Name:       "apply",
+		ShortUsage: "tasmota apply --file <desired.yaml> [flags]",
+		ShortHelp:  "Apply a desired state, changing only what differs",
+		LongHelp: `Plan the changes needed to reach a desired-state document, print them and
+send only the differing commands to the device using Backlog. Network
+changes are applied last since they restart the device.
+
+See "tasmota plan --help" for the document format.
+
+Examples:
+  tasmota --host 192.168.1.100 apply --file kitchen.yaml
+  tasmota --host 192.168.1.100 apply --file kitchen.yaml --secrets`,
+		FlagSet: fs,
+		Exec: func(ctx context.Context, _ []string) error {
+			client, desired, err := loadDesired(*host, *username, *password, *timeout, *debug, *file)
+			if err != nil {
+				return err
+			}
+
+			plan, err := client.Plan(ctx, desired, planOptions(*secrets)...)
+			if err != nil {
+				return err
+			}
+
+			fmt.Print(plan)
+			if plan.Empty() {
+				return nil
+			}
+
+			if err := client.ApplyPlan(ctx, plan); err != nil {
+				return err
+			}
+			fmt.Printf("Applied %d changes\n", len(plan.Changes))
+			return nil
+		},
+	}
+}
+
+// loadDesired creates the client and reads the desired state file.
+func loadDesired(host, username, password string, timeout time.Duration, debug bool, file string) (*tasmota.Client, *tasmota.DesiredState, error) {
+	if file == "" {
+		return nil, nil, fmt.Errorf("--file is required")
+	}
+
+	client, err := newClient(host, username, password, timeout, debug)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	desired, err := tasmota.LoadDesiredState(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return client, desired, nil
+}
+
+func planOptions(secrets bool) []tasmota.PlanOption {
+	if secrets {
+		return []tasmota.PlanOption{tasmota.WithSecrets()}
+	}
+	return nil
+}
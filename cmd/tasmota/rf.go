@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kradalby/tasmota-go"
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+func newRFCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "rf",
+		ShortUsage: "tasmota rf <subcommand>",
+		ShortHelp:  "Send, learn and copy 433 MHz RF codes",
+		LongHelp: `Send RF codes and manage the 16 RfKey slots of a Sonoff RF Bridge.
+Learned slots can be exported to a JSON file and imported into another
+bridge. Raw sniffing needs the Portisch firmware on the bridge's RF chip.
+
+Examples:
+  tasmota --host 192.168.1.100 rf send --bits 24 --protocol 1 0x7028D2
+  tasmota --host 192.168.1.100 rf key learn 3
+  tasmota --host 192.168.1.100 rf key send 3
+  tasmota --host 192.168.1.100 rf export --output codes.json
+  tasmota --host 192.168.1.101 rf import --file codes.json
+  tasmota --host 192.168.1.100 rf raw on`,
+		Subcommands: []*ffcli.Command{
+			newRFSendCmd(host, username, password, timeout, debug),
+			newRFKeyCmd(host, username, password, timeout, debug),
+			newRFRawCmd(host, username, password, timeout, debug),
+			newRFExportCmd(host, username, password, timeout, debug),
+			newRFImportCmd(host, username, password, timeout, debug),
+		},
+		Exec: func(_ context.Context, _ []string) error {
+			return flag.ErrHelp
+		},
+	}
+}
+
+func newRFSendCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota rf send", flag.ExitOnError)
+	bits := fs.Int("bits", 0, "Code length (default: 24)")
+	protocol := fs.Int("protocol", 0, "RCSwitch protocol (default: 1)")
+	pulse := fs.Int("pulse", 0, "Pulse length in microseconds (default: the protocol's)")
+	repeat := fs.Int("repeat", 0, "Times to repeat the code (default: 10)")
+
+	return &ffcli.Command{
+		Name:       "send",
+		ShortUsage: "tasmota rf send [flags] <data>",
+		ShortHelp:  "Send a code with RfSend",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("expected the code data")
+			}
+			data, err := strconv.ParseUint(args[0], 0, 64)
+			if err != nil {
+				return fmt.Errorf("invalid data %q", args[0])
+			}
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+			code := tasmota.RfCode{Data: data, Bits: *bits, Protocol: *protocol, Pulse: *pulse, Repeat: *repeat}
+			if err := client.SendRf(ctx, code); err != nil {
+				return err
+			}
+			fmt.Printf("Sent 0x%X\n", data)
+			return nil
+		},
+	}
+}
+
+func newRFKeyCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "key",
+		ShortUsage: "tasmota rf key <send|learn|forget|show> <1-16>",
+		ShortHelp:  "Send, learn, forget or show an RfKey slot",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("expected an action and a key number")
+			}
+			key, err := strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid key %q", args[1])
+			}
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+
+			switch args[0] {
+			case "send":
+				err = client.SendRfKey(ctx, key)
+			case "learn":
+				if err = client.LearnRfKey(ctx, key); err == nil {
+					fmt.Printf("Learning RfKey%d, press the remote button now\n", key)
+					return nil
+				}
+			case "forget":
+				err = client.ForgetRfKey(ctx, key)
+			case "show":
+				code, learned, err := client.GetRfKey(ctx, key)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("RfKey%d: sync %d, low %d, high %d, data %06X (%s)\n", key,
+					code.Sync, code.Low, code.High, code.Data, onOff(learned, "learned", "default"))
+				return nil
+			default:
+				return fmt.Errorf("unknown action %q, expected send, learn, forget or show", args[0])
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Println("Done")
+			return nil
+		},
+	}
+}
+
+func newRFRawCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "raw",
+		ShortUsage: "tasmota rf raw <on|off|AA...55>",
+		ShortHelp:  "Turn Portisch raw sniffing on or off, or send a raw frame",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("expected on, off or a frame")
+			}
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+
+			arg := strings.Join(args, "")
+			if on, err := parseOnOff(arg); err == nil {
+				if err := client.SetRfRaw(ctx, on); err != nil {
+					return err
+				}
+				fmt.Printf("Raw sniffing %s\n", onOff(on, "on", "off"))
+				return nil
+			}
+			if err := client.SendRfRaw(ctx, arg); err != nil {
+				return err
+			}
+			fmt.Println("Sent raw frame")
+			return nil
+		},
+	}
+}
+
+func newRFExportCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota rf export", flag.ExitOnError)
+	output := fs.String("output", "rf-codes.json", "File to write")
+
+	return &ffcli.Command{
+		Name:       "export",
+		ShortUsage: "tasmota rf export [--output <file>]",
+		ShortHelp:  "Save the learned RfKey slots to a file",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, _ []string) error {
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+			store, err := client.ExportRfKeys(ctx)
+			if err != nil {
+				return err
+			}
+			if err := tasmota.SaveRfStore(*output, store); err != nil {
+				return err
+			}
+			fmt.Printf("Exported %d learned keys to %s\n", len(store.Codes), *output)
+			return nil
+		},
+	}
+}
+
+func newRFImportCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota rf import", flag.ExitOnError)
+	file := fs.String("file", "rf-codes.json", "File written by rf export")
+
+	return &ffcli.Command{
+		Name:       "import",
+		ShortUsage: "tasmota rf import [--file <file>]",
+		ShortHelp:  "Load RfKey slots from a file; each code is transmitted once",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, _ []string) error {
+			store, err := tasmota.LoadRfStore(*file)
+			if err != nil {
+				return err
+			}
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+			if err := client.ImportRfKeys(ctx, store); err != nil {
+				return err
+			}
+			fmt.Printf("Imported keys from %s\n", *file)
+			return nil
+		},
+	}
+}
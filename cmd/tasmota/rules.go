@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kradalby/tasmota-go"
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+func newRulesCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "rules",
+		ShortUsage: "tasmota rules <subcommand>",
+		ShortHelp:  "Read, write and check rule sets",
+		LongHelp: `Read, write and check the three rule sets (Rule1 to Rule3).
+
+Rules are written as ON <trigger> DO <commands> ENDON and can be kept in
+text files, one rule per line. Rules are parsed and checked against the
+511 character limit before they are sent.
+
+Examples:
+  tasmota --host 192.168.1.100 rules get
+  tasmota --host 192.168.1.100 rules set --rule 1 --file kitchen.rules --enable
+  tasmota --host 192.168.1.100 rules set --rule 1 --append ON Power1#State=0 DO Power2 OFF ENDON
+  tasmota rules lint kitchen.rules`,
+		Subcommands: []*ffcli.Command{
+			newRulesGetCmd(host, username, password, timeout, debug),
+			newRulesSetCmd(host, username, password, timeout, debug),
+			newRulesLintCmd(),
+		},
+		Exec: func(_ context.Context, _ []string) error {
+			return flag.ErrHelp
+		},
+	}
+}
+
+func newRulesGetCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota rules get", flag.ExitOnError)
+	number := fs.Int("rule", 0, "Rule set 1-3 (default: all)")
+	jsonOutput := fs.Bool("json", false, "Output JSON")
+
+	return &ffcli.Command{
+		Name:       "get",
+		ShortUsage: "tasmota rules get [--rule <n>] [--json]",
+		ShortHelp:  "Show rule sets and their flags",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, _ []string) error {
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+
+			numbers := []int{1, 2, 3}
+			if *number != 0 {
+				numbers = []int{*number}
+			}
+			sets := make(map[string]*tasmota.RuleSet, len(numbers))
+			for _, n := range numbers {
+				rs, err := client.GetRule(ctx, n)
+				if err != nil {
+					return err
+				}
+				sets[fmt.Sprintf("Rule%d", n)] = rs
+			}
+
+			if *jsonOutput {
+				data, err := json.MarshalIndent(sets, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal JSON: %w", err)
+				}
+				fmt.Println(string(data))
+				return nil
+			}
+
+			for _, n := range numbers {
+				rs := sets[fmt.Sprintf("Rule%d", n)]
+				fmt.Printf("Rule%d: %s, once %s, stop on error %s, %d/%d characters\n",
+					n, onOff(rs.Enabled, "enabled", "disabled"), onOff(rs.Once, "on", "off"),
+					onOff(rs.StopOnError, "on", "off"), rs.Length, tasmota.MaxRuleLength)
+				if rs.Rules == "" {
+					continue
+				}
+				// Show one rule per line when the text parses
+				if rules, err := rs.Parse(); err == nil {
+					for _, r := range rules {
+						fmt.Printf("  %s\n", r)
+					}
+				} else {
+					fmt.Printf("  %s\n", rs.Rules)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func newRulesSetCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota rules set", flag.ExitOnError)
+	number := fs.Int("rule", 0, "Rule set 1-3 (required)")
+	file := fs.String("file", "", "Read rules from a file instead of the arguments")
+	appendRules := fs.Bool("append", false, "Append to the rule set instead of replacing it")
+	clearRules := fs.Bool("clear", false, "Clear the rule set")
+	enable := fs.Bool("enable", false, "Enable (--enable) or disable (--enable=false) the rule set")
+	once := fs.Bool("once", false, "Run rules only once until the trigger is false again")
+	stopOnError := fs.Bool("stop-on-error", false, "Disable the rule set when a command fails")
+
+	return &ffcli.Command{
+		Name:       "set",
+		ShortUsage: "tasmota rules set --rule <n> [flags] [ON <trigger> DO <commands> ENDON ...]",
+		ShortHelp:  "Write a rule set and its flags",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, args []string) error {
+			text := strings.Join(args, " ")
+			if *file != "" {
+				data, err := os.ReadFile(*file)
+				if err != nil {
+					return fmt.Errorf("failed to read rules: %w", err)
+				}
+				text = string(data)
+			}
+
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case *clearRules:
+				err = client.SetRule(ctx, *number, "")
+			case strings.TrimSpace(text) == "":
+			case *appendRules:
+				err = client.AppendRule(ctx, *number, text)
+			default:
+				err = client.SetRule(ctx, *number, text)
+			}
+			if err != nil {
+				return err
+			}
+
+			var flagErr error
+			fs.Visit(func(f *flag.Flag) {
+				if flagErr != nil {
+					return
+				}
+				switch f.Name {
+				case "enable":
+					flagErr = client.EnableRule(ctx, *number, *enable)
+				case "once":
+					flagErr = client.SetRuleOnce(ctx, *number, *once)
+				case "stop-on-error":
+					flagErr = client.SetRuleStopOnError(ctx, *number, *stopOnError)
+				}
+			})
+			if flagErr != nil {
+				return flagErr
+			}
+
+			rs, err := client.GetRule(ctx, *number)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Rule%d: %s, %d/%d characters\n",
+				*number, onOff(rs.Enabled, "enabled", "disabled"), rs.Length, tasmota.MaxRuleLength)
+			return nil
+		},
+	}
+}
+
+func newRulesLintCmd() *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota rules lint", flag.ExitOnError)
+
+	return &ffcli.Command{
+		Name:       "lint",
+		ShortUsage: "tasmota rules lint <file>...",
+		ShortHelp:  "Check rule files without a device",
+		LongHelp: `Parse each file as one rule set, check trigger syntax and the length
+limit, and print the rules as they would be sent.`,
+		FlagSet: fs,
+		Exec: func(_ context.Context, args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("at least one rule file is required")
+			}
+
+			failed := 0
+			for _, path := range args {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return fmt.Errorf("failed to read rules: %w", err)
+				}
+				rules, err := tasmota.ParseRules(string(data))
+				if err == nil {
+					err = rules.Validate()
+				}
+				if err != nil {
+					fmt.Printf("%s: %v\n", path, err)
+					failed++
+					continue
+				}
+				fmt.Printf("%s: %d rules, %d/%d characters\n", path, len(rules), len(rules.String()), tasmota.MaxRuleLength)
+				for _, r := range rules {
+					fmt.Printf("  %s\n", r)
+				}
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%d of %d rule files failed", failed, len(args))
+			}
+			return nil
+		},
+	}
+}
+
+func onOff(b bool, on, off string) string {
+	if b {
+		return on
+	}
+	return off
+}
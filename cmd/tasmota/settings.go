@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kradalby/tasmota-go"
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+func newSettingsCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "settings",
+		ShortUsage: "tasmota settings <subcommand>",
+		ShortHelp:  "Download, inspect and upload binary settings dumps",
+		LongHelp: `Work with the binary settings dump (.dmp) used by the web UI's
+Backup Configuration and Restore Configuration pages.
+
+Unlike the command API, a dump contains every setting including passwords,
+so keep dump files private. The web UI authenticates with the web password
+(--password).
+
+Examples:
+  tasmota --host 192.168.1.100 --password secret settings download --output kitchen.dmp
+  tasmota settings show --file kitchen.dmp
+  tasmota --host 192.168.1.100 --password secret settings upload --file kitchen.dmp`,
+		Subcommands: []*ffcli.Command{
+			newSettingsDownloadCmd(host, username, password, timeout, debug),
+			newSettingsShowCmd(host, username, password, timeout, debug),
+			newSettingsUploadCmd(host, username, password, timeout, debug),
+		},
+		Exec: func(_ context.Context, _ []string) error {
+			return flag.ErrHelp
+		},
+	}
+}
+
+func newSettingsDownloadCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota settings download", flag.ExitOnError)
+	output := fs.String("output", "", "File to write the dump to (required)")
+
+	return &ffcli.Command{
+		Name:       "download",
+		ShortUsage: "tasmota settings download --output <file.dmp>",
+		ShortHelp:  "Download the settings dump",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, _ []string) error {
+			if *output == "" {
+				return fmt.Errorf("--output is required")
+			}
+
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+
+			dump, err := client.DownloadSettings(ctx)
+			if err != nil {
+				return err
+			}
+			settings, err := tasmota.DecodeSettings(dump)
+			if err != nil {
+				return err
+			}
+
+			if err := os.WriteFile(*output, dump, 0o600); err != nil {
+				return fmt.Errorf("failed to write dump: %w", err)
+			}
+			fmt.Printf("Saved %d byte settings dump from firmware %s to %s\n", len(dump), settings.VersionString(), *output)
+			return nil
+		},
+	}
+}
+
+func newSettingsShowCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota settings show", flag.ExitOnError)
+	file := fs.String("file", "", "Read a dump file instead of downloading from --host")
+	showPasswords := fs.Bool("show-passwords", false, "Print passwords instead of masking them")
+
+	return &ffcli.Command{
+		Name:       "show",
+		ShortUsage: "tasmota settings show [--file <file.dmp>] [--show-passwords]",
+		ShortHelp:  "Decode a settings dump and print it as JSON",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, _ []string) error {
+			var dump []byte
+			var err error
+			if *file != "" {
+				dump, err = os.ReadFile(*file)
+				if err != nil {
+					return fmt.Errorf("failed to read dump: %w", err)
+				}
+			} else {
+				client, err := newClient(*host, *username, *password, *timeout, *debug)
+				if err != nil {
+					return err
+				}
+				dump, err = client.DownloadSettings(ctx)
+				if err != nil {
+					return err
+				}
+			}
+
+			settings, err := tasmota.DecodeSettings(dump)
+			if err != nil {
+				return err
+			}
+
+			// Passwords are masked unless asked for
+			reveal := func(s tasmota.Secret) string {
+				if *showPasswords {
+					return string(s)
+				}
+				return s.String()
+			}
+
+			out := struct {
+				Firmware string `json:"firmware"`
+				*tasmota.Settings
+				WiFiPassword [2]string
+				WebPassword  string
+				MQTTPassword string
+			}{
+				Firmware:     settings.VersionString(),
+				Settings:     settings,
+				WiFiPassword: [2]string{reveal(settings.WiFiPassword[0]), reveal(settings.WiFiPassword[1])},
+				WebPassword:  reveal(settings.WebPassword),
+				MQTTPassword: reveal(settings.MQTTPassword),
+			}
+			data, err := json.MarshalIndent(out, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal JSON: %w", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		},
+	}
+}
+
+func newSettingsUploadCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota settings upload", flag.ExitOnError)
+	file := fs.String("file", "", "Dump file to upload (required)")
+
+	return &ffcli.Command{
+		Name:       "upload",
+		ShortUsage: "tasmota settings upload --file <file.dmp>",
+		ShortHelp:  "Upload a settings dump; the device restarts",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, _ []string) error {
+			if *file == "" {
+				return fmt.Errorf("--file is required")
+			}
+
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+
+			dump, err := os.ReadFile(*file)
+			if err != nil {
+				return fmt.Errorf("failed to read dump: %w", err)
+			}
+			if err := client.UploadSettings(ctx, dump); err != nil {
+				return err
+			}
+			fmt.Println("Settings uploaded, device is restarting")
+			return nil
+		},
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/kradalby/tasmota-go"
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+func newShutterCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "shutter",
+		ShortUsage: "tasmota shutter <subcommand>",
+		ShortHelp:  "Move, calibrate and inspect shutters and blinds",
+		LongHelp: `Move, calibrate and inspect roller shutters and blinds. Shutters use a
+pair of relays and need SetOption80 1. Positions are percent, 0 closed and
+100 open. Use --shutter to pick a shutter; the default is 1.
+
+Examples:
+  tasmota --host 192.168.1.100 shutter get
+  tasmota --host 192.168.1.100 shutter position --wait 30
+  tasmota --host 192.168.1.100 shutter open --shutter 2
+  tasmota --host 192.168.1.100 shutter tilt -- -45
+  tasmota --host 192.168.1.100 shutter config --relay 1 --open-duration 12.5s --close-duration 11s --halfway 60`,
+		Subcommands: []*ffcli.Command{
+			newShutterGetCmd(host, username, password, timeout, debug),
+			newShutterMoveCmd("open", "Open the shutter", 100, host, username, password, timeout, debug),
+			newShutterMoveCmd("close", "Close the shutter", 0, host, username, password, timeout, debug),
+			newShutterMoveCmd("position", "Move the shutter to a position", -1, host, username, password, timeout, debug),
+			newShutterStopCmd(host, username, password, timeout, debug),
+			newShutterTiltCmd(host, username, password, timeout, debug),
+			newShutterConfigCmd(host, username, password, timeout, debug),
+		},
+		Exec: func(_ context.Context, _ []string) error {
+			return flag.ErrHelp
+		},
+	}
+}
+
+func newShutterGetCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota shutter get", flag.ExitOnError)
+	number := fs.Int("shutter", 1, "Shutter number")
+	jsonOutput := fs.Bool("json", false, "Output JSON")
+
+	return &ffcli.Command{
+		Name:       "get",
+		ShortUsage: "tasmota shutter get [--shutter <n>] [--json]",
+		ShortHelp:  "Show the position and configuration of a shutter",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, _ []string) error {
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+			state, err := client.GetShutter(ctx, *number)
+			if err != nil {
+				return err
+			}
+			config, err := client.GetShutterConfig(ctx, *number)
+			if err != nil {
+				return err
+			}
+
+			if *jsonOutput {
+				data, err := json.MarshalIndent(map[string]any{"State": state, "Config": config}, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal JSON: %w", err)
+				}
+				fmt.Println(string(data))
+				return nil
+			}
+
+			fmt.Printf("Shutter%d: %d%% (%s, target %d%%, tilt %d)\n",
+				*number, state.Position, state.Direction, state.Target, state.Tilt)
+			fmt.Printf("Relays:   %d and %d\n", config.Relay, config.Relay+1)
+			fmt.Printf("Open:     %s\n", config.OpenDuration)
+			fmt.Printf("Close:    %s\n", config.CloseDuration)
+			fmt.Printf("Halfway:  %d%%\n", config.Halfway)
+			return nil
+		},
+	}
+}
+
+// newShutterMoveCmd builds open, close and position. A negative position
+// is taken from the argument.
+func newShutterMoveCmd(name, help string, position int, host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota shutter "+name, flag.ExitOnError)
+	number := fs.Int("shutter", 1, "Shutter number")
+	wait := fs.Bool("wait", false, "Wait until the shutter gets there")
+	waitTimeout := fs.Duration("wait-timeout", tasmota.DefaultShutterTimeout, "How long to wait")
+
+	usage := fmt.Sprintf("tasmota shutter %s [--shutter <n>] [--wait]", name)
+	if position < 0 {
+		usage += " <0-100>"
+	}
+
+	return &ffcli.Command{
+		Name:       name,
+		ShortUsage: usage,
+		ShortHelp:  help,
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, args []string) error {
+			target := position
+			if target < 0 {
+				if len(args) != 1 {
+					return fmt.Errorf("expected a position from 0 to 100")
+				}
+				n, err := strconv.Atoi(args[0])
+				if err != nil {
+					return fmt.Errorf("invalid position %q", args[0])
+				}
+				target = n
+			}
+
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+			switch name {
+			case "open":
+				err = client.OpenShutter(ctx, *number)
+			case "close":
+				err = client.CloseShutter(ctx, *number)
+			default:
+				err = client.SetShutterPosition(ctx, *number, target)
+			}
+			if err != nil {
+				return err
+			}
+
+			if !*wait {
+				fmt.Printf("Shutter%d moving to %d%%\n", *number, target)
+				return nil
+			}
+			state, err := client.WaitShutter(ctx, *number, target, tasmota.WithShutterTimeout(*waitTimeout))
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Shutter%d at %d%%\n", *number, state.Position)
+			return nil
+		},
+	}
+}
+
+func newShutterStopCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota shutter stop", flag.ExitOnError)
+	number := fs.Int("shutter", 1, "Shutter number")
+
+	return &ffcli.Command{
+		Name:       "stop",
+		ShortUsage: "tasmota shutter stop [--shutter <n>]",
+		ShortHelp:  "Stop the shutter",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, _ []string) error {
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+			if err := client.StopShutter(ctx, *number); err != nil {
+				return err
+			}
+			fmt.Printf("Shutter%d stopped\n", *number)
+			return nil
+		},
+	}
+}
+
+func newShutterTiltCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota shutter tilt", flag.ExitOnError)
+	number := fs.Int("shutter", 1, "Shutter number")
+
+	return &ffcli.Command{
+		Name:       "tilt",
+		ShortUsage: "tasmota shutter tilt [--shutter <n>] [--] <-90..90>",
+		ShortHelp:  "Set the slat angle of a venetian blind",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("expected an angle from -90 to 90")
+			}
+			tilt, err := strconv.Atoi(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid angle %q", args[0])
+			}
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+			if err := client.SetShutterTilt(ctx, *number, tilt); err != nil {
+				return err
+			}
+			fmt.Printf("Shutter%d tilt set to %d\n", *number, tilt)
+			return nil
+		},
+	}
+}
+
+func newShutterConfigCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota shutter config", flag.ExitOnError)
+	number := fs.Int("shutter", 1, "Shutter number")
+	relay := fs.Int("relay", 0, "First of the shutter's two relays, 0 removes the shutter")
+	openDuration := fs.Duration("open-duration", 0, "Time to open fully")
+	closeDuration := fs.Duration("close-duration", 0, "Time to close fully")
+	halfway := fs.Int("halfway", 0, "Position in percent after half the open duration")
+
+	return &ffcli.Command{
+		Name:       "config",
+		ShortUsage: "tasmota shutter config [--shutter <n>] [flags]",
+		ShortHelp:  "Assign relays and calibrate a shutter; unset flags are left alone",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, _ []string) error {
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+
+			set := map[string]bool{}
+			fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+			if set["relay"] {
+				if err := client.SetShutterRelay(ctx, *number, *relay); err != nil {
+					return err
+				}
+			}
+			if set["open-duration"] || set["close-duration"] {
+				current, err := client.GetShutterConfig(ctx, *number)
+				if err != nil {
+					return err
+				}
+				open, closing := current.OpenDuration, current.CloseDuration
+				if set["open-duration"] {
+					open = *openDuration
+				}
+				if set["close-duration"] {
+					closing = *closeDuration
+				}
+				if err := client.SetShutterDurations(ctx, *number, open, closing); err != nil {
+					return err
+				}
+			}
+			if set["halfway"] {
+				if err := client.SetShutterHalfway(ctx, *number, *halfway); err != nil {
+					return err
+				}
+			}
+
+			if set["relay"] && *relay == 0 {
+				fmt.Printf("Shutter%d removed\n", *number)
+				return nil
+			}
+			config, err := client.GetShutterConfig(ctx, *number)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Shutter%d: relays %d and %d, open %s, close %s, halfway %d%%\n", *number,
+				config.Relay, config.Relay+1, config.OpenDuration, config.CloseDuration, config.Halfway)
+			return nil
+		},
+	}
+}
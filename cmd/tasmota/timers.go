@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kradalby/tasmota-go"
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+func newTimersCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "timers",
+		ShortUsage: "tasmota timers <subcommand>",
+		ShortHelp:  "List and configure the sixteen device timers",
+		LongHelp: `List and configure timers. Each timer switches an output at a clock time
+or at an offset from sunrise or sunset on chosen weekdays. Sunrise and
+sunset timers need the device latitude and longitude to be set.
+
+Days are seven characters starting with Sunday, where 0 or - is off and any
+other character is on, so "0111110" and "-MTWTF-" both mean weekdays.
+
+Examples:
+  tasmota --host 192.168.1.100 timers list
+  tasmota --host 192.168.1.100 timers set --timer 1 --enable --time 06:30 --days -MTWTF- --action on
+  tasmota --host 192.168.1.100 timers set --timer 2 --enable --mode sunset --time -00:30 --action off
+  tasmota --host 192.168.1.100 timers clear --timer 2
+  tasmota --host 192.168.1.100 timers disable`,
+		Subcommands: []*ffcli.Command{
+			newTimersListCmd(host, username, password, timeout, debug),
+			newTimersSetCmd(host, username, password, timeout, debug),
+			newTimersClearCmd(host, username, password, timeout, debug),
+			newTimersSwitchCmd("enable", true, host, username, password, timeout, debug),
+			newTimersSwitchCmd("disable", false, host, username, password, timeout, debug),
+		},
+		Exec: func(_ context.Context, _ []string) error {
+			return flag.ErrHelp
+		},
+	}
+}
+
+func newTimersListCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota timers list", flag.ExitOnError)
+	all := fs.Bool("all", false, "Include disarmed timers")
+	jsonOutput := fs.Bool("json", false, "Output JSON")
+
+	return &ffcli.Command{
+		Name:       "list",
+		ShortUsage: "tasmota timers list [--all] [--json]",
+		ShortHelp:  "List armed timers",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, _ []string) error {
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+
+			timers, err := client.GetTimers(ctx)
+			if err != nil {
+				return err
+			}
+
+			if *jsonOutput {
+				out := make(map[string]any, len(timers.Timers)+1)
+				out["Timers"] = timers.Enabled
+				for i, t := range timers.Timers {
+					out[fmt.Sprintf("Timer%d", i+1)] = t
+				}
+				data, err := json.MarshalIndent(out, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal JSON: %w", err)
+				}
+				fmt.Println(string(data))
+				return nil
+			}
+
+			state := "enabled"
+			if !timers.Enabled {
+				state = "disabled"
+			}
+			fmt.Printf("Timers are %s\n\n", state)
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "TIMER\tARMED\tMODE\tTIME\tWINDOW\tDAYS\tREPEAT\tOUTPUT\tACTION")
+			for i, t := range timers.Timers {
+				if !t.Enable && !*all {
+					continue
+				}
+				fmt.Fprintf(w, "%d\t%v\t%s\t%s\t%d\t%s\t%v\t%d\t%s\n",
+					i+1, t.Enable, t.Mode, t.Time, t.Window, formatDays(t.Days), t.Repeat, t.Output, t.Action)
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func newTimersSetCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota timers set", flag.ExitOnError)
+	number := fs.Int("timer", 0, "Timer number 1-16 (required)")
+	enable := fs.Bool("enable", false, "Arm the timer")
+	mode := fs.String("mode", "", "clock, sunrise or sunset")
+	at := fs.String("time", "", "HH:MM, or an offset such as -00:30 for sunrise/sunset")
+	window := fs.Int("window", 0, "Randomize the time by up to this many minutes (0-15)")
+	days := fs.String("days", "", "Seven characters from Sunday, e.g. 0111110 or -MTWTF-")
+	repeat := fs.Bool("repeat", false, "Keep the timer armed after it runs")
+	output := fs.Int("output", 0, "Relay to switch, from 1")
+	action := fs.String("action", "", "off, on, toggle or rule")
+
+	return &ffcli.Command{
+		Name:       "set",
+		ShortUsage: "tasmota timers set --timer <n> [flags]",
+		ShortHelp:  "Change a timer; unset flags keep their current value",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, _ []string) error {
+			if *number < 1 || *number > tasmota.MaxTimers {
+				return fmt.Errorf("--timer must be between 1 and %d", tasmota.MaxTimers)
+			}
+
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+
+			timer, err := client.GetTimer(ctx, *number)
+			if err != nil {
+				return err
+			}
+
+			var flagErr error
+			fs.Visit(func(f *flag.Flag) {
+				switch f.Name {
+				case "enable":
+					timer.Enable = *enable
+				case "mode":
+					m, ok := parseTimerMode(*mode)
+					if !ok {
+						flagErr = fmt.Errorf("invalid --mode %q", *mode)
+					}
+					timer.Mode = m
+				case "time":
+					timer.Time = *at
+				case "window":
+					timer.Window = *window
+				case "days":
+					timer.Days = *days
+				case "repeat":
+					timer.Repeat = *repeat
+				case "output":
+					timer.Output = *output
+				case "action":
+					a, ok := parseTimerAction(*action)
+					if !ok {
+						flagErr = fmt.Errorf("invalid --action %q", *action)
+					}
+					timer.Action = a
+				}
+			})
+			if flagErr != nil {
+				return flagErr
+			}
+
+			if err := client.SetTimer(ctx, *number, timer); err != nil {
+				return err
+			}
+			armed := "armed"
+			if !timer.Enable {
+				armed = "disarmed"
+			}
+			fmt.Printf("Timer%d: %s %s %s on %s, output %d %s\n", *number,
+				armed, timer.Mode, timer.Time, formatDays(timer.Days), timer.Output, timer.Action)
+			return nil
+		},
+	}
+}
+
+func newTimersClearCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota timers clear", flag.ExitOnError)
+	number := fs.Int("timer", 0, "Timer number 1-16 (required)")
+
+	return &ffcli.Command{
+		Name:       "clear",
+		ShortUsage: "tasmota timers clear --timer <n>",
+		ShortHelp:  "Reset a timer to its defaults",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, _ []string) error {
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+			if err := client.ClearTimer(ctx, *number); err != nil {
+				return err
+			}
+			fmt.Printf("Timer%d cleared\n", *number)
+			return nil
+		},
+	}
+}
+
+func newTimersSwitchCmd(name string, enabled bool, host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	return &ffcli.Command{
+		Name:       name,
+		ShortUsage: "tasmota timers " + name,
+		ShortHelp:  strings.ToUpper(name[:1]) + name[1:] + " all timers, keeping their settings",
+		Exec: func(ctx context.Context, _ []string) error {
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+			if err := client.EnableTimers(ctx, enabled); err != nil {
+				return err
+			}
+			fmt.Printf("Timers %sd\n", name)
+			return nil
+		},
+	}
+}
+
+func parseTimerMode(s string) (tasmota.TimerMode, bool) {
+	for _, m := range []tasmota.TimerMode{tasmota.TimerModeClock, tasmota.TimerModeSunrise, tasmota.TimerModeSunset} {
+		if strings.EqualFold(s, m.String()) {
+			return m, true
+		}
+	}
+	return 0, false
+}
+
+func parseTimerAction(s string) (tasmota.TimerAction, bool) {
+	for _, a := range []tasmota.TimerAction{tasmota.TimerActionOff, tasmota.TimerActionOn, tasmota.TimerActionToggle, tasmota.TimerActionRule} {
+		if strings.EqualFold(s, a.String()) {
+			return a, true
+		}
+	}
+	return 0, false
+}
+
+// formatDays shows a Days value as weekday letters, such as -MTWTF-.
+func formatDays(days string) string {
+	const letters = "SMTWTFS"
+	b := []byte("-------")
+	for i := 0; i < len(days) && i < 7; i++ {
+		if days[i] != '0' && days[i] != '-' {
+			b[i] = letters[i]
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kradalby/tasmota-go"
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+func newTuyaCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "tuya",
+		ShortUsage: "tasmota tuya <subcommand>",
+		ShortHelp:  "Map, send and watch TuyaMCU data points",
+		LongHelp: `Manage devices where Tasmota talks to a TuyaMCU, such as many dimmers
+and fans. The MCU exposes data points (DPs) that are mapped to Tasmota
+functions with TuyaMCU. watch follows the TuyaReceived messages the device
+publishes over MQTT, which is the easiest way to find out what each DP does.
+
+Examples:
+  tasmota --host 192.168.1.100 tuya map
+  tasmota --host 192.168.1.100 tuya map 21 2
+  tasmota --host 192.168.1.100 tuya send --type bool 1 on
+  tasmota --host 192.168.1.100 tuya watch --mqtt-broker mqtt.home:1883`,
+		Subcommands: []*ffcli.Command{
+			newTuyaMapCmd(host, username, password, timeout, debug),
+			newTuyaSendCmd(host, username, password, timeout, debug),
+			newTuyaWatchCmd(host, username, password, timeout, debug),
+		},
+		Exec: func(_ context.Context, _ []string) error {
+			return flag.ErrHelp
+		},
+	}
+}
+
+func newTuyaMapCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota tuya map", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "Output JSON")
+
+	return &ffcli.Command{
+		Name:       "map",
+		ShortUsage: "tasmota tuya map [--json] [<fnId> <dpId>]",
+		ShortHelp:  "Show the DP mapping, or map a DP to a function (dpId 0 removes it)",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 0 && len(args) != 2 {
+				return fmt.Errorf("expected no arguments or a function id and a DP id")
+			}
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+
+			if len(args) == 2 {
+				fn, err := strconv.Atoi(args[0])
+				if err != nil {
+					return fmt.Errorf("invalid function id %q", args[0])
+				}
+				dp, err := strconv.Atoi(args[1])
+				if err != nil {
+					return fmt.Errorf("invalid DP id %q", args[1])
+				}
+				if err := client.SetTuyaMCU(ctx, tasmota.TuyaFunction(fn), dp); err != nil {
+					return err
+				}
+			}
+
+			mappings, err := client.GetTuyaMCU(ctx)
+			if err != nil {
+				return err
+			}
+
+			if *jsonOutput {
+				data, err := json.MarshalIndent(mappings, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal JSON: %w", err)
+				}
+				fmt.Println(string(data))
+				return nil
+			}
+
+			if len(mappings) == 0 {
+				fmt.Println("No DPs mapped")
+				return nil
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "FNID\tFUNCTION\tDPID")
+			for _, m := range mappings {
+				fmt.Fprintf(w, "%d\t%s\t%d\n", m.Function, m.Function, m.DP)
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func newTuyaSendCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota tuya send", flag.ExitOnError)
+	typ := fs.String("type", "value", "DP type: bool, value, string or enum")
+
+	return &ffcli.Command{
+		Name:       "send",
+		ShortUsage: "tasmota tuya send [--type <type>] <dpId> <value>",
+		ShortHelp:  "Set a DP with TuyaSend",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("expected a DP id and a value")
+			}
+			dp, err := strconv.Atoi(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid DP id %q", args[0])
+			}
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+
+			switch *typ {
+			case "bool":
+				var on bool
+				if on, err = parseOnOff(args[1]); err == nil {
+					err = client.TuyaSendBool(ctx, dp, on)
+				}
+			case "value", "enum":
+				var n int
+				if n, err = strconv.Atoi(args[1]); err != nil {
+					return fmt.Errorf("invalid %s %q", *typ, args[1])
+				}
+				if *typ == "value" {
+					err = client.TuyaSendValue(ctx, dp, n)
+				} else {
+					err = client.TuyaSendEnum(ctx, dp, n)
+				}
+			case "string":
+				err = client.TuyaSendString(ctx, dp, args[1])
+			default:
+				return fmt.Errorf("unknown type %q, expected bool, value, string or enum", *typ)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Set DP %d to %s\n", dp, args[1])
+			return nil
+		},
+	}
+}
+
+func newTuyaWatchCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota tuya watch", flag.ExitOnError)
+	mqttBroker := fs.String("mqtt-broker", "", "MQTT broker host:port (default: the device's broker)")
+	mqttUser := fs.String("mqtt-user", "", "MQTT broker username")
+	mqttPassword := fs.String("mqtt-password", "", "MQTT broker password")
+	query := fs.Bool("query", true, "Ask the MCU to report every DP once subscribed")
+
+	return &ffcli.Command{
+		Name:       "watch",
+		ShortUsage: "tasmota tuya watch [--mqtt-broker <host:port>]",
+		ShortHelp:  "Print DP reports from the MCU until interrupted",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, _ []string) error {
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+			cfg, err := client.GetMQTTConfig(ctx)
+			if err != nil {
+				return err
+			}
+			broker := *mqttBroker
+			if broker == "" {
+				if cfg.Host == "" {
+					return fmt.Errorf("the device has no MQTT broker, use --mqtt-broker")
+				}
+				broker = fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+			}
+
+			var dialOpts []tasmota.MQTTDialOption
+			if *mqttUser != "" || *mqttPassword != "" {
+				dialOpts = append(dialOpts, tasmota.WithMQTTCredentials(*mqttUser, *mqttPassword))
+			}
+			conn, err := tasmota.DialMQTT(ctx, broker, dialOpts...)
+			if err != nil {
+				return fmt.Errorf("failed to connect to MQTT broker: %w", err)
+			}
+			defer func() { _ = conn.Close() }()
+
+			stream, err := tasmota.SubscribeTelemetry(ctx, conn, cfg.Topics())
+			if err != nil {
+				return err
+			}
+			defer func() { _ = stream.Close() }()
+
+			if *query {
+				if err := client.TuyaQuery(ctx); err != nil {
+					return err
+				}
+			}
+
+			fmt.Fprintf(os.Stderr, "Watching %s on %s, press Ctrl-C to stop\n", cfg.Topic, broker)
+			for event := range stream.Events() {
+				if event.Type != tasmota.EventResult {
+					continue
+				}
+				received, err := tasmota.ParseTuyaReceived(event.Raw)
+				if err != nil {
+					continue
+				}
+				for _, dp := range received.DPs {
+					value := dp.Value()
+					if data, ok := value.([]byte); ok {
+						value = fmt.Sprintf("%X", data)
+					}
+					fmt.Printf("%s  DP %-3d %-6s %v\n", event.Received.Format(time.TimeOnly), dp.ID, dp.Type, value)
+				}
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/kradalby/tasmota-go"
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+func newUpgradeCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota upgrade", flag.ExitOnError)
+	otaURL := fs.String("url", "", "Firmware URL to upgrade from over the air")
+	file := fs.String("file", "", "Firmware image to upload instead of --url")
+	minimalURL := fs.String("minimal-url", "", "Minimal firmware URL to install first on ESP8266")
+	minimalFile := fs.String("minimal-file", "", "Minimal firmware image to upload first on ESP8266")
+	expect := fs.String("expect", "", "Version the device must report afterwards (e.g. 14.3.0)")
+	wait := fs.Duration("wait", tasmota.DefaultUpgradeTimeout, "Time allowed per device, including restarts")
+	inventory := fs.String("inventory", "", "Upgrade the devices in this fleet inventory one at a time")
+	selector := fs.String("selector", "", "Label selector for --inventory (e.g. room=kitchen)")
+
+	return &ffcli.Command{
+		Name:       "upgrade",
+		ShortUsage: "tasmota upgrade (--url <url> | --file <image>) [flags]",
+		ShortHelp:  "Upgrade device firmware and verify the new version",
+		LongHelp: `Upgrade the firmware over the air from --url, or by uploading --file
+through the web UI, then wait for the device to restart and check the
+version it reports.
+
+ESP8266 devices often lack the space to download a full image while running
+one. Give --minimal-url or --minimal-file to install the minimal firmware
+first; a device that comes back running the minimal firmware is upgraded
+again automatically.
+
+With --inventory, the devices matching --selector are upgraded one at a
+time and the rollout stops at the first failure. Uploads use the web
+password (--password); raise --timeout for slow uploads.
+
+Examples:
+  tasmota --host 192.168.1.100 upgrade --url http://ota.tasmota.com/tasmota/release/tasmota.bin.gz --expect 14.3.0
+  tasmota --host 192.168.1.100 --password secret upgrade --file tasmota.bin.gz --minimal-file tasmota-minimal.bin.gz
+  tasmota upgrade --inventory fleet.json --selector type=plug --url http://ota.local/tasmota.bin.gz --expect 14.3.0`,
+		FlagSet: fs,
+		Exec: func(ctx context.Context, _ []string) error {
+			if (*otaURL == "") == (*file == "") {
+				return fmt.Errorf("exactly one of --url or --file is required")
+			}
+
+			opts := []tasmota.UpgradeOption{tasmota.WithUpgradeTimeout(*wait)}
+			if *expect != "" {
+				opts = append(opts, tasmota.WithExpectedVersion(*expect))
+			}
+			if *minimalURL != "" {
+				opts = append(opts, tasmota.WithMinimalURL(*minimalURL))
+			}
+			if *minimalFile != "" {
+				image, err := os.ReadFile(*minimalFile)
+				if err != nil {
+					return fmt.Errorf("failed to read minimal firmware: %w", err)
+				}
+				opts = append(opts, tasmota.WithMinimalImage(image))
+			}
+
+			var image []byte
+			if *file != "" {
+				var err error
+				image, err = os.ReadFile(*file)
+				if err != nil {
+					return fmt.Errorf("failed to read firmware: %w", err)
+				}
+			}
+
+			upgrade := func(ctx context.Context, client *tasmota.Client, name string) (*tasmota.UpgradeResult, error) {
+				deviceOpts := append(slices.Clip(opts), tasmota.WithUpgradeProgress(upgradeProgressPrinter(name)))
+				if image != nil {
+					return client.UpgradeFile(ctx, image, deviceOpts...)
+				}
+				return client.Upgrade(ctx, *otaURL, deviceOpts...)
+			}
+
+			if *inventory == "" {
+				client, err := newClient(*host, *username, *password, *timeout, *debug)
+				if err != nil {
+					return err
+				}
+				result, err := upgrade(ctx, client, "")
+				if err != nil {
+					return err
+				}
+				printUpgradeResult("", result)
+				return nil
+			}
+
+			// The upgrade timeout bounds each device
+			fleet, sel, err := loadFleet(*inventory, *selector, *username, *password, *timeout, *debug,
+				tasmota.WithFleetConcurrency(1),
+				tasmota.WithDeviceTimeout(0),
+				tasmota.WithStopOnError(),
+			)
+			if err != nil {
+				return err
+			}
+
+			devices := fleet.Devices(sel)
+			names := make(map[*tasmota.Client]string, len(devices))
+			for _, d := range devices {
+				names[d.Client] = d.Name
+			}
+
+			report := fleet.Run(ctx, sel, func(ctx context.Context, c *tasmota.Client) (any, error) {
+				return upgrade(ctx, c, names[c])
+			})
+
+			for _, res := range report.Results {
+				switch {
+				case res.Skipped:
+					fmt.Printf("%s: skipped\n", res.Device)
+				case res.Err != nil:
+					fmt.Printf("%s: failed: %v\n", res.Device, res.Err)
+				default:
+					printUpgradeResult(res.Device, res.Value.(*tasmota.UpgradeResult))
+				}
+			}
+			return report.Err()
+		},
+	}
+}
+
+// upgradeProgressPrinter prints upgrade stages, prefixed with the device
+// name in rolling mode. Uploads are reported every 10%.
+func upgradeProgressPrinter(name string) func(tasmota.UpgradeProgress) {
+	prefix := ""
+	if name != "" {
+		prefix = name + ": "
+	}
+	lastPercent := int64(-10)
+
+	return func(p tasmota.UpgradeProgress) {
+		if p.Stage == tasmota.UpgradeStageUploading {
+			percent := p.BytesSent * 100 / p.BytesTotal
+			if percent/10 == lastPercent/10 {
+				return
+			}
+			lastPercent = percent
+			fmt.Printf("%suploading %d%%\n", prefix, percent)
+			return
+		}
+		lastPercent = -10
+		if p.Message != "" {
+			fmt.Printf("%s%s: %s\n", prefix, p.Stage, p.Message)
+		} else {
+			fmt.Printf("%s%s\n", prefix, p.Stage)
+		}
+	}
+}
+
+func printUpgradeResult(name string, result *tasmota.UpgradeResult) {
+	prefix := ""
+	if name != "" {
+		prefix = name + ": "
+	}
+	if result.UpToDate {
+		fmt.Printf("%salready running %s\n", prefix, result.Version)
+		return
+	}
+	fmt.Printf("%supgraded from %s to %s in %s\n", prefix, result.PreviousVersion, result.Version, result.Duration.Round(time.Second))
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kradalby/tasmota-go"
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+func newZigbeeCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "zigbee",
+		ShortUsage: "tasmota zigbee <subcommand>",
+		ShortHelp:  "Manage the devices of a Zigbee2Tasmota bridge",
+		LongHelp: `List, pair, name, bind and control the devices of a Zigbee2Tasmota
+bridge. Devices are given by short address (0x1234), IEEE address or name.
+
+Examples:
+  tasmota --host 192.168.1.100 zigbee list
+  tasmota --host 192.168.1.100 zigbee join on
+  tasmota --host 192.168.1.100 zigbee rename 0x1234 Lamp
+  tasmota --host 192.168.1.100 zigbee send Lamp '{"Power":1,"Dimmer":128}'
+  tasmota --host 192.168.1.100 zigbee bind --cluster 6 --to Lamp Remote`,
+		Subcommands: []*ffcli.Command{
+			newZigbeeListCmd(host, username, password, timeout, debug),
+			newZigbeeGetCmd(host, username, password, timeout, debug),
+			newZigbeeJoinCmd(host, username, password, timeout, debug),
+			newZigbeeActionCmd("rename", "<device> [name]", "Name a device; no name removes it", 1, 2,
+				host, username, password, timeout, debug,
+				func(ctx context.Context, client *tasmota.Client, args []string) (string, error) {
+					name := ""
+					if len(args) == 2 {
+						name = args[1]
+					}
+					return fmt.Sprintf("%s renamed to %q", args[0], name), client.ZigbeeRename(ctx, args[0], name)
+				}),
+			newZigbeeActionCmd("forget", "<device>", "Remove a device from the coordinator", 1, 1,
+				host, username, password, timeout, debug,
+				func(ctx context.Context, client *tasmota.Client, args []string) (string, error) {
+					return args[0] + " forgotten", client.ZigbeeForget(ctx, args[0])
+				}),
+			newZigbeeActionCmd("light", "<device> <-1..5>", "Set the light channels of a device, -1 for none", 2, 2,
+				host, username, password, timeout, debug,
+				func(ctx context.Context, client *tasmota.Client, args []string) (string, error) {
+					n, err := strconv.Atoi(args[1])
+					if err != nil {
+						return "", fmt.Errorf("invalid channel count %q", args[1])
+					}
+					return fmt.Sprintf("%s light channels set to %d", args[0], n), client.ZigbeeSetLight(ctx, args[0], n)
+				}),
+			newZigbeeSendCmd(host, username, password, timeout, debug),
+			newZigbeeBindCmd("bind", host, username, password, timeout, debug),
+			newZigbeeBindCmd("unbind", host, username, password, timeout, debug),
+		},
+		Exec: func(_ context.Context, _ []string) error {
+			return flag.ErrHelp
+		},
+	}
+}
+
+func newZigbeeListCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota zigbee list", flag.ExitOnError)
+	level := fs.Int("level", 2, "Detail level: 1 names, 2 models, 3 endpoints and attributes")
+	jsonOutput := fs.Bool("json", false, "Output JSON")
+
+	return &ffcli.Command{
+		Name:       "list",
+		ShortUsage: "tasmota zigbee list [--level <1-3>] [--json]",
+		ShortHelp:  "List the paired devices",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, _ []string) error {
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+			devices, err := client.GetZigbeeDevices(ctx, tasmota.ZigbeeStatusLevel(*level))
+			if err != nil {
+				return err
+			}
+
+			if *jsonOutput {
+				data, err := json.MarshalIndent(devices, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal JSON: %w", err)
+				}
+				fmt.Println(string(data))
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "DEVICE\tNAME\tIEEE ADDRESS\tMODEL\tMANUFACTURER")
+			for _, dev := range devices {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", dev.Device, dev.Name, dev.IEEEAddr, dev.ModelID, dev.Manufacturer)
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func newZigbeeGetCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota zigbee get", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "Output JSON")
+
+	return &ffcli.Command{
+		Name:       "get",
+		ShortUsage: "tasmota zigbee get [--json] <device>",
+		ShortHelp:  "Show a device and its last known attributes",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("expected a device")
+			}
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+			dev, err := client.GetZigbeeDevice(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			if *jsonOutput {
+				data, err := json.MarshalIndent(dev, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal JSON: %w", err)
+				}
+				fmt.Println(string(data))
+				return nil
+			}
+
+			fmt.Printf("Device:       %s\n", dev.Device)
+			fmt.Printf("Name:         %s\n", dev.Name)
+			fmt.Printf("IEEE address: %s\n", dev.IEEEAddr)
+			fmt.Printf("Model:        %s (%s)\n", dev.ModelID, dev.Manufacturer)
+			fmt.Printf("Endpoints:    %v\n", dev.Endpoints)
+			names := make([]string, 0, len(dev.Attributes))
+			for name := range dev.Attributes {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Printf("  %s: %v\n", name, dev.Attributes[name])
+			}
+			return nil
+		},
+	}
+}
+
+func newZigbeeJoinCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "join",
+		ShortUsage: "tasmota zigbee join <on|off|forever>",
+		ShortHelp:  "Allow new devices to pair, for 60 seconds or until restart",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("expected on, off or forever")
+			}
+			var mode tasmota.ZigbeeJoin
+			switch strings.ToLower(args[0]) {
+			case "on":
+				mode = tasmota.ZigbeeJoinMinute
+			case "off":
+				mode = tasmota.ZigbeeJoinOff
+			case "forever":
+				mode = tasmota.ZigbeeJoinUntilRestart
+			default:
+				return fmt.Errorf("expected on, off or forever, got %q", args[0])
+			}
+
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+			if err := client.ZigbeePermitJoin(ctx, mode); err != nil {
+				return err
+			}
+			switch mode {
+			case tasmota.ZigbeeJoinOff:
+				fmt.Println("Pairing disabled")
+			case tasmota.ZigbeeJoinMinute:
+				fmt.Println("Pairing enabled for 60 seconds")
+			default:
+				fmt.Println("Pairing enabled until restart")
+			}
+			return nil
+		},
+	}
+}
+
+// newZigbeeActionCmd builds a subcommand taking between minArgs and
+// maxArgs arguments. run returns the message printed on success.
+func newZigbeeActionCmd(name, usage, help string, minArgs, maxArgs int, host, username, password *string, timeout *time.Duration, debug *bool,
+	run func(context.Context, *tasmota.Client, []string) (string, error),
+) *ffcli.Command {
+	return &ffcli.Command{
+		Name:       name,
+		ShortUsage: fmt.Sprintf("tasmota zigbee %s %s", name, usage),
+		ShortHelp:  help,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) < minArgs || len(args) > maxArgs {
+				return fmt.Errorf("expected arguments: %s", usage)
+			}
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+			msg, err := run(ctx, client, args)
+			if err != nil {
+				return err
+			}
+			fmt.Println(msg)
+			return nil
+		},
+	}
+}
+
+func newZigbeeSendCmd(host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota zigbee send", flag.ExitOnError)
+	group := fs.Int("group", 0, "Send to a group instead of a device")
+	endpoint := fs.Int("endpoint", 0, "Endpoint (default: the device's first)")
+	read := fs.Bool("read", false, "Read the comma separated attributes instead of sending commands")
+
+	return &ffcli.Command{
+		Name:       "send",
+		ShortUsage: "tasmota zigbee send [--endpoint <n>] <device> <json> | --group <n> <json> | --read <device> <attributes>",
+		ShortHelp:  "Send commands to a device or group",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, args []string) error {
+			cmd := &tasmota.ZigbeeCommand{Group: *group, Endpoint: *endpoint}
+			if *group == 0 {
+				if len(args) != 2 {
+					return fmt.Errorf("expected a device and a payload")
+				}
+				cmd.Device, args = args[0], args[1:]
+			} else if len(args) != 1 {
+				return fmt.Errorf("expected a payload")
+			}
+
+			if *read {
+				cmd.Read = strings.Split(args[0], ",")
+			} else if err := json.Unmarshal([]byte(args[0]), &cmd.Send); err != nil {
+				return fmt.Errorf("invalid JSON payload: %w", err)
+			}
+
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+			if err := client.ZigbeeSend(ctx, cmd); err != nil {
+				return err
+			}
+			fmt.Println("Sent")
+			return nil
+		},
+	}
+}
+
+func newZigbeeBindCmd(name string, host, username, password *string, timeout *time.Duration, debug *bool) *ffcli.Command {
+	fs := flag.NewFlagSet("tasmota zigbee "+name, flag.ExitOnError)
+	cluster := fs.Uint("cluster", 6, "Cluster to bind, e.g. 6 for on/off or 8 for level")
+	endpoint := fs.Int("endpoint", 0, "Source endpoint (default: the device's first)")
+	to := fs.String("to", "", "Destination device")
+	toEndpoint := fs.Int("to-endpoint", 0, "Destination endpoint")
+	toGroup := fs.Int("to-group", 0, "Destination group")
+
+	help := "Bind a device's cluster to another device or a group"
+	if name == "unbind" {
+		help = "Remove a binding"
+	}
+
+	return &ffcli.Command{
+		Name:       name,
+		ShortUsage: fmt.Sprintf("tasmota zigbee %s [--cluster <n>] (--to <device> | --to-group <n>) <device>", name),
+		ShortHelp:  help,
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("expected a device")
+			}
+			if *cluster > 0xFFFF {
+				return fmt.Errorf("invalid cluster %d", *cluster)
+			}
+			b := &tasmota.ZigbeeBinding{
+				Device:     args[0],
+				Endpoint:   *endpoint,
+				Cluster:    uint16(*cluster),
+				ToDevice:   *to,
+				ToEndpoint: *toEndpoint,
+				ToGroup:    *toGroup,
+			}
+
+			client, err := newClient(*host, *username, *password, *timeout, *debug)
+			if err != nil {
+				return err
+			}
+			bind := client.ZigbeeBind
+			if name == "unbind" {
+				bind = client.ZigbeeUnbind
+			}
+			if err := bind(ctx, b); err != nil {
+				return err
+			}
+			verb := "Bound"
+			if name == "unbind" {
+				verb = "Unbound"
+			}
+			fmt.Printf("%s cluster 0x%04X of %s\n", verb, *cluster, args[0])
+			return nil
+		},
+	}
+}
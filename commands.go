@@ -3,7 +3,9 @@ package tasmota
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
 )
 
@@ -13,12 +15,34 @@ func (c *Client) ExecuteCommand(ctx context.Context, command string) (json.RawMe
 		return nil, NewError(ErrorTypeCommand, "command cannot be empty", nil)
 	}
 
-	urlStr, err := c.buildURL(command)
-	if err != nil {
+	next := c.executeRequest
+	for _, mw := range slices.Backward(c.middleware) {
+		next = mw(next)
+	}
+	return next(ctx, Request{Device: c.device(), Command: command})
+}
+
+// executeRequest runs a command through the circuit breaker and retries.
+func (c *Client) executeRequest(ctx context.Context, req Request) (json.RawMessage, error) {
+	command := req.Command
+	if command == "" {
+		return nil, NewError(ErrorTypeCommand, "command cannot be empty", nil)
+	}
+
+	if err := c.breaker.allow(); err != nil {
 		return nil, err
 	}
+	raw, err := c.executeWithRetry(ctx, command)
+	// A caller giving up says nothing about the device.
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		c.breaker.record(err)
+	}
+	return raw, err
+}
 
-	body, err := c.do(ctx, urlStr)
+// execute sends a command once and checks the response.
+func (c *Client) execute(ctx context.Context, command string) (json.RawMessage, error) {
+	body, err := c.send(ctx, command)
 	if err != nil {
 		return nil, err
 	}
@@ -29,6 +53,10 @@ func (c *Client) ExecuteCommand(ctx context.Context, command string) (json.RawMe
 		return nil, NewError(ErrorTypeParse, "invalid JSON response", err)
 	}
 
+	if err := checkResponse(command, raw); err != nil {
+		return nil, err
+	}
+
 	return raw, nil
 }
 
@@ -62,3 +90,79 @@ func (c *Client) ExecuteBacklog(ctx context.Context, commands ...string) (json.R
 
 	return c.ExecuteCommand(ctx, backlogCmd)
 }
+
+// checkResponse turns the replies the firmware uses to reject a command into
+// errors: {"Command":"Unknown"} and {"Command":"Error"} are command errors,
+// {"WARNING":"Need user=..."} is an auth error and {"<command>":"Error"} is a
+// device error. Each command of a Backlog is checked.
+func checkResponse(command string, raw json.RawMessage) error {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(raw, &fields) != nil {
+		return nil
+	}
+
+	// Other warnings, such as "Enable weblog 2 if response expected", are
+	// not failures.
+	if msg, ok := stringField(fields, "WARNING"); ok && strings.Contains(strings.ToLower(msg), "need user") {
+		return rejected(ErrorTypeAuth, command, msg)
+	}
+	if msg, ok := stringField(fields, "Command"); ok && (strings.EqualFold(msg, "Unknown") || strings.EqualFold(msg, "Error")) {
+		return rejected(ErrorTypeCommand, command, msg)
+	}
+
+	for _, line := range backlogCommands(command) {
+		name, payload, _ := strings.Cut(line, " ")
+		for key := range fields {
+			if !strings.EqualFold(key, name) {
+				continue
+			}
+			// Setting a value to "Error" echoes it back.
+			if msg, ok := stringField(fields, key); ok && strings.EqualFold(msg, "Error") && !strings.EqualFold(strings.TrimSpace(payload), msg) {
+				return rejected(ErrorTypeDevice, line, msg)
+			}
+		}
+	}
+	return nil
+}
+
+// backlogCommands splits a Backlog into its commands. Other commands are
+// returned as is.
+func backlogCommands(command string) []string {
+	name, payload, _ := strings.Cut(strings.TrimSpace(command), " ")
+	if !strings.EqualFold(strings.TrimRight(name, "0"), "Backlog") {
+		return []string{command}
+	}
+	var commands []string
+	for part := range strings.SplitSeq(payload, ";") {
+		if part = strings.TrimSpace(part); part != "" {
+			commands = append(commands, part)
+		}
+	}
+	return commands
+}
+
+// commandName returns the lower case name of a command without its index.
+func commandName(command string) string {
+	name, _, _ := strings.Cut(strings.TrimSpace(command), " ")
+	return strings.ToLower(strings.TrimRight(name, "0123456789"))
+}
+
+func stringField(fields map[string]json.RawMessage, key string) (string, bool) {
+	value, ok := fields[key]
+	if !ok {
+		return "", false
+	}
+	var s string
+	if json.Unmarshal(value, &s) != nil {
+		return "", false
+	}
+	return s, true
+}
+
+func rejected(errType ErrorType, command, msg string) *Error {
+	command = redactCommand(command)
+	err := NewError(errType, fmt.Sprintf("device rejected %q: %s", command, msg), nil)
+	err.Command = command
+	err.DeviceMessage = msg
+	return err
+}
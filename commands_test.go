@@ -3,6 +3,7 @@ package tasmota
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -46,6 +47,52 @@ func TestClient_ExecuteCommand(t *testing.T) {
 			wantErr:    true,
 			errType:    ErrorTypeParse,
 		},
+		{
+			name:       "unknown command",
+			command:    "MqttHots 10.0.0.1",
+			response:   `{"Command":"Unknown"}`,
+			statusCode: http.StatusOK,
+			wantErr:    true,
+			errType:    ErrorTypeCommand,
+		},
+		{
+			name:       "invalid parameters",
+			command:    "Power maybe",
+			response:   `{"Command":"Error"}`,
+			statusCode: http.StatusOK,
+			wantErr:    true,
+			errType:    ErrorTypeCommand,
+		},
+		{
+			name:       "authentication required",
+			command:    "Power",
+			response:   `{"WARNING":"Need user=<username>&password=<password>"}`,
+			statusCode: http.StatusOK,
+			wantErr:    true,
+			errType:    ErrorTypeAuth,
+		},
+		{
+			name:       "device error",
+			command:    "Timer1 {\"Arm\":1}",
+			response:   `{"Timer1":"Error"}`,
+			statusCode: http.StatusOK,
+			wantErr:    true,
+			errType:    ErrorTypeDevice,
+		},
+		{
+			name:       "value echoed back",
+			command:    "DeviceName Error",
+			response:   `{"DeviceName":"Error"}`,
+			statusCode: http.StatusOK,
+			wantErr:    false,
+		},
+		{
+			name:       "benign warning",
+			command:    "Power",
+			response:   `{"WARNING":"Enable weblog 2 if response expected"}`,
+			statusCode: http.StatusOK,
+			wantErr:    false,
+		},
 		{
 			name:       "server error",
 			command:    "Power",
@@ -97,6 +144,14 @@ func TestClient_ExecuteCommand(t *testing.T) {
 					if !IsNetworkError(err) {
 						t.Errorf("error type = %T, want network error", err)
 					}
+				case ErrorTypeAuth:
+					if !IsAuthError(err) {
+						t.Errorf("error = %v, want auth error", err)
+					}
+				case ErrorTypeDevice:
+					if !IsDeviceError(err) {
+						t.Errorf("error = %v, want device error", err)
+					}
 				}
 			} else {
 				if err != nil {
@@ -255,3 +310,31 @@ func TestClient_ExecuteBacklog_Integration(t *testing.T) {
 		t.Errorf("command = %v, want %v", commandsReceived[0], expected)
 	}
 }
+
+func TestClient_ExecuteCommand_Rejected(t *testing.T) {
+	_, client := newTestDevice(t)
+	ctx := context.Background()
+
+	_, err := client.ExecuteCommand(ctx, "Power3 ON")
+	var tErr *Error
+	if !errors.As(err, &tErr) || tErr.Type != ErrorTypeCommand || tErr.Command != "Power3 ON" || tErr.DeviceMessage != "Unknown" {
+		t.Fatalf("ExecuteCommand() error = %#v, want unknown command", err)
+	}
+
+	// A failing command in a backlog is reported by itself.
+	_, err = client.ExecuteBacklog(ctx, "Power ON", "Timer1 {bad")
+	if !errors.As(err, &tErr) || tErr.Type != ErrorTypeCommand || tErr.DeviceMessage != "Error" {
+		t.Fatalf("ExecuteBacklog() error = %#v, want command error", err)
+	}
+}
+
+func TestCheckResponse_Backlog(t *testing.T) {
+	err := checkResponse("Backlog Power ON; Timer2 {\"Arm\":1}", json.RawMessage(`{"POWER":"ON","Timer2":"Error"}`))
+	var tErr *Error
+	if !errors.As(err, &tErr) || tErr.Type != ErrorTypeDevice || tErr.Command != `Timer2 {"Arm":1}` {
+		t.Fatalf("checkResponse() = %#v, want device error for Timer2", err)
+	}
+	if err := checkResponse("Backlog Power ON; Delay 5", json.RawMessage(`{"POWER":"ON"}`)); err != nil {
+		t.Errorf("checkResponse() = %v, want nil", err)
+	}
+}
@@ -0,0 +1,968 @@
+package tasmota
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DesiredState is a declarative description of device configuration.
+// Only fields that are set are compared and applied, so a document can
+// manage as little or as much of a device as needed. Keys match the Tasmota
+// command names:
+//
+//	Device:
+//	  DeviceName: Kitchen
+//	  PowerOnState: 3
+//	MQTT:
+//	  Host: mqtt.home
+//	  Topic: kitchen
+//	SetOptions:
+//	  19: 0
+//	Rules:
+//	  1:
+//	    Rules: ON Power1#State=1 DO Publish stat/kitchen/on 1 ENDON
+//	    Enabled: true
+type DesiredState struct {
+	Device     *DesiredDevice        `json:"Device,omitempty"`
+	MQTT       *DesiredMQTT          `json:"MQTT,omitempty"`
+	Network    *DesiredNetwork       `json:"Network,omitempty"`
+	SetOptions map[int]int           `json:"SetOptions,omitempty"`
+	Rules      map[int]*DesiredRule  `json:"Rules,omitempty"`
+	Timers     map[int]*DesiredTimer `json:"Timers,omitempty"`
+}
+
+// DesiredDevice covers the settings of DeviceConfig.
+type DesiredDevice struct {
+	DeviceName   *string  `json:"DeviceName,omitempty"`
+	FriendlyName []string `json:"FriendlyName,omitempty"`
+	PowerOnState *int     `json:"PowerOnState,omitempty"`
+	LedState     *int     `json:"LedState,omitempty"`
+	Sleep        *int     `json:"Sleep,omitempty"`
+	ButtonRetain *bool    `json:"ButtonRetain,omitempty"`
+	SwitchRetain *bool    `json:"SwitchRetain,omitempty"`
+	SensorRetain *bool    `json:"SensorRetain,omitempty"`
+	PowerRetain  *bool    `json:"PowerRetain,omitempty"`
+	TelePeriod   *int     `json:"TelePeriod,omitempty"`
+	// PulseTime maps relay numbers to PulseTime values.
+	PulseTime map[int]int `json:"PulseTime,omitempty"`
+	Module    *int        `json:"Module,omitempty"`
+	// Template is the template JSON object, as returned by the Template command.
+	Template json.RawMessage `json:"Template,omitempty"`
+}
+
+// DesiredMQTT covers the settings of MQTTConfig.
+// Password is write-only on the device and only planned with WithSecrets.
+type DesiredMQTT struct {
+	Enabled    *bool   `json:"Enabled,omitempty"`
+	Host       *string `json:"Host,omitempty"`
+	Port       *int    `json:"Port,omitempty"`
+	User       *string `json:"User,omitempty"`
+	Password   *string `json:"Password,omitempty"`
+	Client     *string `json:"Client,omitempty"`
+	Topic      *string `json:"Topic,omitempty"`
+	FullTopic  *string `json:"FullTopic,omitempty"`
+	GroupTopic *string `json:"GroupTopic,omitempty"`
+	Prefix1    *string `json:"Prefix1,omitempty"`
+	Prefix2    *string `json:"Prefix2,omitempty"`
+	Prefix3    *string `json:"Prefix3,omitempty"`
+}
+
+// DesiredNetwork covers the settings of NetworkConfig.
+// An IPAddress of 0.0.0.0 selects DHCP. Passwords are write-only on the
+// device and only planned with WithSecrets.
+type DesiredNetwork struct {
+	Hostname  *string `json:"Hostname,omitempty"`
+	IPAddress *string `json:"IPAddress,omitempty"`
+	Gateway   *string `json:"Gateway,omitempty"`
+	Subnet    *string `json:"Subnet,omitempty"`
+	DNSServer *string `json:"DNSServer,omitempty"`
+	SSID1     *string `json:"SSID1,omitempty"`
+	SSID2     *string `json:"SSID2,omitempty"`
+	Password1 *string `json:"Password1,omitempty"`
+	Password2 *string `json:"Password2,omitempty"`
+}
+
+// DesiredRule describes one of the three rule sets.
+type DesiredRule struct {
+	Rules       *string `json:"Rules,omitempty"`
+	Enabled     *bool   `json:"Enabled,omitempty"`
+	Once        *bool   `json:"Once,omitempty"`
+	StopOnError *bool   `json:"StopOnError,omitempty"`
+}
+
+// DesiredTimer describes one of the sixteen timers using the Timer<n> JSON fields.
+type DesiredTimer struct {
+	Enable *int    `json:"Enable,omitempty"`
+	Mode   *int    `json:"Mode,omitempty"`
+	Time   *string `json:"Time,omitempty"`
+	Window *int    `json:"Window,omitempty"`
+	Days   *string `json:"Days,omitempty"`
+	Repeat *int    `json:"Repeat,omitempty"`
+	Output *int    `json:"Output,omitempty"`
+	Action *int    `json:"Action,omitempty"`
+}
+
+// ParseDesiredState parses a desired-state document in JSON or YAML.
+// Unknown keys are rejected so typos do not silently drop settings.
+func ParseDesiredState(data []byte) (*DesiredState, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		converted, err := yamlToJSON(data, reflect.TypeFor[DesiredState]())
+		if err != nil {
+			return nil, err
+		}
+		data = converted
+	}
+
+	var state DesiredState
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&state); err != nil {
+		return nil, NewError(ErrorTypeParse, "failed to parse desired state", err)
+	}
+
+	// A template may be given as a string holding the JSON object
+	if d := state.Device; d != nil && len(d.Template) > 0 && d.Template[0] == '"' {
+		var text string
+		if err := json.Unmarshal(d.Template, &text); err != nil || !json.Valid([]byte(text)) {
+			return nil, NewError(ErrorTypeParse, "template must be a JSON object", err)
+		}
+		d.Template = json.RawMessage(text)
+	}
+
+	if err := state.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// LoadDesiredState reads a desired-state document from a .json, .yaml or .yml file.
+func LoadDesiredState(path string) (*DesiredState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, NewError(ErrorTypeCommand, "failed to read desired state", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 || data[0] != '{' {
+			return nil, NewError(ErrorTypeParse, "desired state JSON must be an object", nil)
+		}
+	}
+
+	return ParseDesiredState(data)
+}
+
+// Validate checks value ranges using the same limits as the setter methods.
+func (s *DesiredState) Validate() error {
+	invalid := func(msg string) error {
+		return NewError(ErrorTypeCommand, msg, nil)
+	}
+	outside := func(v *int, lo, hi int) bool {
+		return v != nil && (*v < lo || *v > hi)
+	}
+
+	if d := s.Device; d != nil {
+		if d.DeviceName != nil && *d.DeviceName == "" {
+			return invalid("device name cannot be empty")
+		}
+		if len(d.FriendlyName) > 8 {
+			return invalid("at most 8 friendly names are supported")
+		}
+		if outside(d.PowerOnState, 0, 5) {
+			return invalid("power on state must be between 0 and 5")
+		}
+		if outside(d.LedState, 0, 8) {
+			return invalid("LED state must be between 0 and 8")
+		}
+		if outside(d.Sleep, 0, 250) {
+			return invalid("sleep duration must be between 0 and 250")
+		}
+		if d.TelePeriod != nil && *d.TelePeriod != 0 && outside(d.TelePeriod, 10, 3600) {
+			return invalid("telemetry period must be 0 (disabled) or between 10 and 3600 seconds")
+		}
+		for relay, value := range d.PulseTime {
+			if relay < 1 || relay > 8 || value < 0 || value > 65535 {
+				return invalid("pulse time must be set for relays 1-8 with values between 0 and 65535")
+			}
+		}
+		if outside(d.Module, 0, 255) {
+			return invalid("module must be between 0 and 255")
+		}
+		if len(d.Template) > 0 && !json.Valid(d.Template) {
+			return invalid("template must be valid JSON")
+		}
+	}
+
+	if m := s.MQTT; m != nil && outside(m.Port, 1, 65535) {
+		return invalid("MQTT port must be between 1 and 65535")
+	}
+
+	if n := s.Network; n != nil {
+		if n.Hostname != nil && (*n.Hostname == "" || len(*n.Hostname) > 32) {
+			return invalid("hostname must be between 1 and 32 characters")
+		}
+		for _, addr := range []*string{n.IPAddress, n.Gateway, n.Subnet, n.DNSServer} {
+			if addr == nil {
+				continue
+			}
+			if _, err := NewIPAddr(*addr); err != nil {
+				return invalid(fmt.Sprintf("invalid IP address %q", *addr))
+			}
+		}
+	}
+
+	for n := range s.SetOptions {
+		if n < 0 {
+			return invalid("option number cannot be negative")
+		}
+	}
+	for n, r := range s.Rules {
+		if n < 1 || n > 3 {
+			return invalid("rule number must be between 1 and 3")
+		}
+		if r == nil || r.Rules == nil || strings.TrimSpace(*r.Rules) == "" {
+			continue
+		}
+		parsed, err := ParseRules(*r.Rules)
+		if err != nil {
+			return invalid(fmt.Sprintf("rule set %d: %v", n, err))
+		}
+		if err := parsed.Validate(); err != nil {
+			return invalid(fmt.Sprintf("rule set %d: %v", n, err))
+		}
+	}
+	for n, t := range s.Timers {
+		if n < 1 || n > 16 {
+			return invalid("timer number must be between 1 and 16")
+		}
+		if t != nil && outside(t.Mode, 0, 2) {
+			return invalid("timer mode must be between 0 and 2")
+		}
+	}
+
+	return nil
+}
+
+// Change is a single difference between the device and the desired state.
+type Change struct {
+	// Field names the setting, such as "MQTT.Host" or "Rules.1.Enabled".
+	Field   string
+	Current string
+	Desired string
+	// Command is the Tasmota command that applies the change.
+	Command string
+	// Sensitive marks write-only values that are never displayed.
+	Sensitive bool
+}
+
+// Plan is the ordered list of changes needed to reach a desired state.
+type Plan struct {
+	Changes []Change
+}
+
+// Empty reports whether the device already matches the desired state.
+func (p *Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// Commands returns the commands that apply the plan, in order.
+func (p *Plan) Commands() []string {
+	cmds := make([]string, len(p.Changes))
+	for i, c := range p.Changes {
+		cmds[i] = c.Command
+	}
+	return cmds
+}
+
+// String renders the plan for display, hiding sensitive values.
+func (p *Plan) String() string {
+	if p.Empty() {
+		return "No changes. Device matches the desired state.\n"
+	}
+
+	var b strings.Builder
+	for _, c := range p.Changes {
+		if c.Sensitive {
+			fmt.Fprintf(&b, "~ %s: (sensitive)\n", c.Field)
+			continue
+		}
+		fmt.Fprintf(&b, "~ %s: %q -> %q\n", c.Field, c.Current, c.Desired)
+	}
+	fmt.Fprintf(&b, "\n%d to change.\n", len(p.Changes))
+	return b.String()
+}
+
+// PlanOption is a functional option for Client.Plan.
+type PlanOption func(*planConfig)
+
+type planConfig struct {
+	secrets bool
+}
+
+// WithSecrets always plans write-only settings (MQTT and WiFi passwords)
+// that are present in the desired state. Their current value cannot be read,
+// so by default they are left out to keep plans stable.
+func WithSecrets() PlanOption {
+	return func(c *planConfig) {
+		c.secrets = true
+	}
+}
+
+// Plan reads the current device configuration and returns the changes
+// needed to reach desired.
+func (c *Client) Plan(ctx context.Context, desired *DesiredState, opts ...PlanOption) (*Plan, error) {
+	if desired == nil {
+		return nil, NewError(ErrorTypeCommand, "desired state cannot be nil", nil)
+	}
+	if err := desired.Validate(); err != nil {
+		return nil, err
+	}
+
+	cfg := &planConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	raw, err := c.ExecuteCommand(ctx, "Status 0")
+	if err != nil {
+		return nil, err
+	}
+	var status StatusResponse
+	if err := unmarshalJSON(raw, &status); err != nil {
+		return nil, err
+	}
+	if status.Status == nil {
+		return nil, NewError(ErrorTypeParse, "status response missing Status field", nil)
+	}
+
+	p := &planner{client: c, ctx: ctx, status: &status, cfg: cfg, plan: &Plan{}}
+	if status.StatusLOG != nil {
+		// Fall back to querying options one by one if the masks are unreadable
+		p.options, _ = status.StatusLOG.SetOptions()
+	}
+
+	// Network and module settings go last since changing them restarts the device.
+	steps := []func(*DesiredState) error{
+		p.device,
+		p.setOptions,
+		p.mqtt,
+		p.rules,
+		p.timers,
+		p.network,
+		p.module,
+	}
+	for _, step := range steps {
+		if err := step(desired); err != nil {
+			return nil, err
+		}
+	}
+
+	return p.plan, nil
+}
+
+// ApplyPlan executes the plan's commands using Backlog, at most 30 commands
+// per request. Commands containing ";" (such as rules) are sent on their own
+// since Backlog would split them.
+func (c *Client) ApplyPlan(ctx context.Context, plan *Plan) error {
+	if plan == nil || plan.Empty() {
+		return nil
+	}
+
+	var batch []string
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := c.ExecuteBacklog(ctx, batch...)
+		batch = nil
+		return err
+	}
+
+	for _, cmd := range plan.Commands() {
+		if strings.Contains(cmd, ";") {
+			if err := flush(); err != nil {
+				return err
+			}
+			if _, err := c.ExecuteCommand(ctx, cmd); err != nil {
+				return err
+			}
+			continue
+		}
+		batch = append(batch, cmd)
+		if len(batch) == 30 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return flush()
+}
+
+// ApplyState plans and applies desired, returning the plan that was applied.
+func (c *Client) ApplyState(ctx context.Context, desired *DesiredState, opts ...PlanOption) (*Plan, error) {
+	plan, err := c.Plan(ctx, desired, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.ApplyPlan(ctx, plan); err != nil {
+		return plan, err
+	}
+	return plan, nil
+}
+
+// planner accumulates changes while comparing sections of the desired state.
+type planner struct {
+	client *Client
+	ctx    context.Context
+	status *StatusResponse
+	cfg    *planConfig
+	plan   *Plan
+	// options holds the SetOptions decoded from Status 3.
+	options map[int]int
+}
+
+func (p *planner) add(field, current, desired, command string) {
+	if current == desired {
+		return
+	}
+	p.plan.Changes = append(p.plan.Changes, Change{
+		Field:   field,
+		Current: current,
+		Desired: desired,
+		Command: command,
+	})
+}
+
+func (p *planner) addSecret(field, command string) {
+	if !p.cfg.secrets {
+		return
+	}
+	p.plan.Changes = append(p.plan.Changes, Change{
+		Field:     field,
+		Command:   command,
+		Sensitive: true,
+	})
+}
+
+// query runs a command and returns the value of the first key starting with prefix.
+func (p *planner) query(command, prefix string) (json.RawMessage, error) {
+	raw, err := p.client.ExecuteCommand(p.ctx, command)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := unmarshalJSON(raw, &fields); err != nil {
+		return nil, err
+	}
+	for key, value := range fields {
+		if strings.HasPrefix(strings.ToLower(key), strings.ToLower(prefix)) {
+			return value, nil
+		}
+	}
+	return nil, NewError(ErrorTypeParse, fmt.Sprintf("response to %s missing %s", command, prefix), nil)
+}
+
+// queryString returns a string setting, stripping any " (current)" suffix the
+// firmware appends to configured values such as IPAddress1.
+func (p *planner) queryString(command, prefix string) (string, error) {
+	value, err := p.query(command, prefix)
+	if err != nil {
+		return "", err
+	}
+	var s string
+	if err := unmarshalJSON(value, &s); err != nil {
+		return "", err
+	}
+	if i := strings.Index(s, " ("); i > 0 {
+		s = s[:i]
+	}
+	return s, nil
+}
+
+func (p *planner) device(desired *DesiredState) error {
+	d := desired.Device
+	if d == nil {
+		return nil
+	}
+	info := p.status.Status
+
+	if d.DeviceName != nil {
+		p.add("Device.DeviceName", info.DeviceName, *d.DeviceName, "DeviceName "+*d.DeviceName)
+	}
+	for i, name := range d.FriendlyName {
+		current := ""
+		if i < len(info.FriendlyName) {
+			current = info.FriendlyName[i]
+		}
+		if name != "" {
+			p.add(fmt.Sprintf("Device.FriendlyName%d", i+1), current, name, fmt.Sprintf("FriendlyName%d %s", i+1, name))
+		}
+	}
+
+	intSetting := func(name string, current int, desired *int) {
+		if desired != nil {
+			p.add("Device."+name, strconv.Itoa(current), strconv.Itoa(*desired), fmt.Sprintf("%s %d", name, *desired))
+		}
+	}
+	boolSetting := func(name string, current int, desired *bool) {
+		if desired != nil {
+			want := boolToInt(*desired)
+			p.add("Device."+name, strconv.Itoa(current), strconv.Itoa(want), fmt.Sprintf("%s %d", name, want))
+		}
+	}
+
+	intSetting("PowerOnState", info.PowerOnState, d.PowerOnState)
+	intSetting("LedState", info.LedState, d.LedState)
+	if d.Sleep != nil {
+		current := 0
+		if p.status.StatusSTS != nil {
+			current = p.status.StatusSTS.Sleep
+		}
+		intSetting("Sleep", current, d.Sleep)
+	}
+	boolSetting("ButtonRetain", info.ButtonRetain, d.ButtonRetain)
+	boolSetting("SwitchRetain", info.SwitchRetain, d.SwitchRetain)
+	boolSetting("SensorRetain", info.SensorRetain, d.SensorRetain)
+	boolSetting("PowerRetain", info.PowerRetain, d.PowerRetain)
+	if d.TelePeriod != nil {
+		current := 0
+		if p.status.StatusLOG != nil {
+			current = p.status.StatusLOG.TelePeriod
+		}
+		intSetting("TelePeriod", current, d.TelePeriod)
+	}
+
+	relays := make([]int, 0, len(d.PulseTime))
+	for relay := range d.PulseTime {
+		relays = append(relays, relay)
+	}
+	sort.Ints(relays)
+	for _, relay := range relays {
+		current, err := p.pulseTime(relay)
+		if err != nil {
+			return err
+		}
+		want := d.PulseTime[relay]
+		p.add(fmt.Sprintf("Device.PulseTime%d", relay), strconv.Itoa(current), strconv.Itoa(want), fmt.Sprintf("PulseTime%d %d", relay, want))
+	}
+
+	return nil
+}
+
+// pulseTime reads PulseTime<n>, reported as a number by older firmware and
+// as {"Set":n,"Remaining":n} by newer.
+func (p *planner) pulseTime(relay int) (int, error) {
+	value, err := p.query(fmt.Sprintf("PulseTime%d", relay), fmt.Sprintf("PulseTime%d", relay))
+	if err != nil {
+		return 0, err
+	}
+	var set struct {
+		Set int `json:"Set"`
+	}
+	if json.Unmarshal(value, &set) == nil {
+		return set.Set, nil
+	}
+	var n int
+	if err := unmarshalJSON(value, &n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// module plans the template before the module, since a template only takes
+// effect once module 0 is selected.
+func (p *planner) module(desired *DesiredState) error {
+	d := desired.Device
+	if d == nil {
+		return nil
+	}
+
+	if len(d.Template) > 0 {
+		raw, err := p.client.ExecuteCommand(p.ctx, "Template")
+		if err != nil {
+			return err
+		}
+		current, err := canonicalJSON(raw)
+		if err != nil {
+			return err
+		}
+		want, err := canonicalJSON(d.Template)
+		if err != nil {
+			return err
+		}
+		p.add("Device.Template", current, want, "Template "+want)
+	}
+
+	if d.Module != nil {
+		p.add("Device.Module", strconv.Itoa(p.status.Status.Module), strconv.Itoa(*d.Module), fmt.Sprintf("Module %d", *d.Module))
+	}
+
+	return nil
+}
+
+// canonicalJSON re-encodes data compactly with sorted object keys.
+func canonicalJSON(data []byte) (string, error) {
+	var v any
+	if err := unmarshalJSON(data, &v); err != nil {
+		return "", err
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return "", NewError(ErrorTypeParse, "failed to encode JSON", err)
+	}
+	return string(out), nil
+}
+
+func (p *planner) setOptions(desired *DesiredState) error {
+	options := make([]int, 0, len(desired.SetOptions))
+	for n := range desired.SetOptions {
+		options = append(options, n)
+	}
+	sort.Ints(options)
+
+	for _, n := range options {
+		current, err := p.setOption(n)
+		if err != nil {
+			return err
+		}
+		want := desired.SetOptions[n]
+		p.add(fmt.Sprintf("SetOptions.%d", n), strconv.Itoa(current), strconv.Itoa(want), fmt.Sprintf("SetOption%d %d", n, want))
+	}
+
+	return nil
+}
+
+// setOption reads SetOption<n>, which reports either ON/OFF or a number.
+func (p *planner) setOption(n int) (int, error) {
+	if value, ok := p.options[n]; ok {
+		return value, nil
+	}
+	value, err := p.query(fmt.Sprintf("SetOption%d", n), fmt.Sprintf("SetOption%d", n))
+	if err != nil {
+		return 0, err
+	}
+	return parseSwitchValue(value)
+}
+
+// parseSwitchValue decodes "ON"/"OFF" or a number.
+func parseSwitchValue(value json.RawMessage) (int, error) {
+	var n int
+	if err := json.Unmarshal(value, &n); err == nil {
+		return n, nil
+	}
+	var s string
+	if err := unmarshalJSON(value, &s); err != nil {
+		return 0, err
+	}
+	switch strings.ToUpper(s) {
+	case "ON":
+		return 1, nil
+	case "OFF":
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, NewError(ErrorTypeParse, fmt.Sprintf("unexpected switch value %q", s), err)
+	}
+	return n, nil
+}
+
+func (p *planner) mqtt(desired *DesiredState) error {
+	m := desired.MQTT
+	if m == nil {
+		return nil
+	}
+	info := p.status.StatusMQT
+	if info == nil {
+		info = &StatusMQTT{}
+	}
+
+	if m.Enabled != nil {
+		current, err := p.setOption(3)
+		if err != nil {
+			return err
+		}
+		want := boolToInt(*m.Enabled)
+		p.add("MQTT.Enabled", strconv.Itoa(current), strconv.Itoa(want), fmt.Sprintf("SetOption3 %d", want))
+	}
+
+	stringSetting := func(field, command, current string, desired *string) {
+		if desired != nil {
+			p.add("MQTT."+field, current, *desired, command+" "+*desired)
+		}
+	}
+	stringSetting("Host", "MqttHost", info.MqttHost, m.Host)
+	if m.Port != nil {
+		p.add("MQTT.Port", strconv.Itoa(info.MqttPort), strconv.Itoa(*m.Port), fmt.Sprintf("MqttPort %d", *m.Port))
+	}
+	stringSetting("User", "MqttUser", info.MqttUser, m.User)
+	if m.Password != nil {
+		p.addSecret("MQTT.Password", "MqttPassword "+*m.Password)
+	}
+	stringSetting("Client", "MqttClient", info.MqttClient, m.Client)
+	stringSetting("Topic", "Topic", p.status.Status.Topic, m.Topic)
+
+	queried := []struct {
+		field   string
+		command string
+		desired *string
+	}{
+		{"FullTopic", "FullTopic", m.FullTopic},
+		{"GroupTopic", "GroupTopic", m.GroupTopic},
+		{"Prefix1", "Prefix1", m.Prefix1},
+		{"Prefix2", "Prefix2", m.Prefix2},
+		{"Prefix3", "Prefix3", m.Prefix3},
+	}
+	for _, q := range queried {
+		if q.desired == nil {
+			continue
+		}
+		current, err := p.queryString(q.command, q.command)
+		if err != nil {
+			return err
+		}
+		stringSetting(q.field, q.command, current, q.desired)
+	}
+
+	return nil
+}
+
+func (p *planner) network(desired *DesiredState) error {
+	n := desired.Network
+	if n == nil {
+		return nil
+	}
+
+	if n.Hostname != nil {
+		current := ""
+		if p.status.StatusNET != nil {
+			current = p.status.StatusNET.Hostname
+		}
+		p.add("Network.Hostname", current, *n.Hostname, "Hostname "+*n.Hostname)
+	}
+
+	// Configured addresses are queried directly since Status 5 reports the
+	// address in use, which differs from the setting under DHCP.
+	addresses := []struct {
+		field   string
+		command string
+		desired *string
+	}{
+		{"IPAddress", "IPAddress1", n.IPAddress},
+		{"Gateway", "IPAddress2", n.Gateway},
+		{"Subnet", "IPAddress3", n.Subnet},
+		{"DNSServer", "IPAddress4", n.DNSServer},
+	}
+	for _, a := range addresses {
+		if a.desired == nil {
+			continue
+		}
+		current, err := p.queryString(a.command, a.command)
+		if err != nil {
+			return err
+		}
+		p.add("Network."+a.field, current, *a.desired, a.command+" "+*a.desired)
+	}
+
+	var ssids []string
+	if p.status.StatusLOG != nil {
+		ssids = p.status.StatusLOG.SSId
+	}
+	for i, ssid := range []*string{n.SSID1, n.SSID2} {
+		if ssid == nil {
+			continue
+		}
+		current := ""
+		if i < len(ssids) {
+			current = ssids[i]
+		}
+		p.add(fmt.Sprintf("Network.SSID%d", i+1), current, *ssid, fmt.Sprintf("SSId%d %s", i+1, *ssid))
+	}
+	for i, password := range []*string{n.Password1, n.Password2} {
+		if password != nil {
+			p.addSecret(fmt.Sprintf("Network.Password%d", i+1), fmt.Sprintf("Password%d %s", i+1, *password))
+		}
+	}
+
+	return nil
+}
+
+func (p *planner) rules(desired *DesiredState) error {
+	for n := 1; n <= 3; n++ {
+		r := desired.Rules[n]
+		if r == nil {
+			continue
+		}
+
+		value, err := p.query(fmt.Sprintf("Rule%d", n), fmt.Sprintf("Rule%d", n))
+		if err != nil {
+			return err
+		}
+		var current struct {
+			State       string `json:"State"`
+			Once        string `json:"Once"`
+			StopOnError string `json:"StopOnError"`
+			Rules       string `json:"Rules"`
+		}
+		if err := unmarshalJSON(value, &current); err != nil {
+			return err
+		}
+
+		field := fmt.Sprintf("Rules.%d.", n)
+		if r.Rules != nil {
+			want := canonicalRules(*r.Rules)
+			command := fmt.Sprintf("Rule%d %s", n, want)
+			if want == "" {
+				command = fmt.Sprintf(`Rule%d "`, n)
+			}
+			// The firmware may change case and whitespace, so compare normalized text
+			if normalizeRule(current.Rules) != normalizeRule(want) {
+				p.plan.Changes = append(p.plan.Changes, Change{
+					Field: field + "Rules", Current: current.Rules, Desired: want, Command: command,
+				})
+			}
+		}
+
+		flags := []struct {
+			name    string
+			current string
+			desired *bool
+			off, on int
+		}{
+			{"Enabled", current.State, r.Enabled, 0, 1},
+			{"Once", current.Once, r.Once, 4, 5},
+			{"StopOnError", current.StopOnError, r.StopOnError, 8, 9},
+		}
+		for _, f := range flags {
+			if f.desired == nil {
+				continue
+			}
+			code := f.off
+			if *f.desired {
+				code = f.on
+			}
+			p.add(field+f.name, strings.ToUpper(f.current), onOffString(*f.desired), fmt.Sprintf("Rule%d %d", n, code))
+		}
+	}
+
+	return nil
+}
+
+// canonicalRules returns rule text in the form ParseRules prints, or the
+// trimmed text if it does not parse.
+func canonicalRules(text string) string {
+	parsed, err := ParseRules(text)
+	if err != nil {
+		return strings.TrimSpace(text)
+	}
+	return parsed.String()
+}
+
+// normalizeRule folds whitespace and the case of keywords, triggers and
+// command names for rule comparison. Payloads keep their case, as a Publish
+// message or a Var value is case sensitive.
+func normalizeRule(s string) string {
+	parsed, err := ParseRules(s)
+	if err != nil {
+		return strings.Join(strings.Fields(s), " ")
+	}
+	for i := range parsed {
+		r := &parsed[i]
+		r.Trigger.Name = strings.ToLower(r.Trigger.Name)
+		r.Backlog = strings.ToLower(r.Backlog)
+		for j, command := range r.Commands {
+			name, payload, ok := strings.Cut(command, " ")
+			r.Commands[j] = strings.ToLower(name)
+			if ok {
+				r.Commands[j] += " " + payload
+			}
+		}
+	}
+	return strings.Join(strings.Fields(parsed.String()), " ")
+}
+
+func (p *planner) timers(desired *DesiredState) error {
+	for n := 1; n <= 16; n++ {
+		t := desired.Timers[n]
+		if t == nil {
+			continue
+		}
+
+		value, err := p.query(fmt.Sprintf("Timer%d", n), fmt.Sprintf("Timer%d", n))
+		if err != nil {
+			return err
+		}
+		var current map[string]any
+		if err := unmarshalJSON(value, &current); err != nil {
+			return err
+		}
+
+		// Compare each desired field and send only the differing ones
+		wantJSON, err := json.Marshal(t)
+		if err != nil {
+			return NewError(ErrorTypeParse, "failed to encode timer", err)
+		}
+		var want map[string]any
+		_ = json.Unmarshal(wantJSON, &want)
+
+		keys := make([]string, 0, len(want))
+		for k := range want {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		diff := make(map[string]any)
+		var currentParts, desiredParts []string
+		for _, k := range keys {
+			cur, next := fmt.Sprint(current[k]), fmt.Sprint(want[k])
+			if cur != next {
+				diff[k] = want[k]
+				currentParts = append(currentParts, k+"="+cur)
+				desiredParts = append(desiredParts, k+"="+next)
+			}
+		}
+		if len(diff) == 0 {
+			continue
+		}
+
+		payload, err := json.Marshal(diff)
+		if err != nil {
+			return NewError(ErrorTypeParse, "failed to encode timer", err)
+		}
+		p.plan.Changes = append(p.plan.Changes, Change{
+			Field:   fmt.Sprintf("Timers.%d", n),
+			Current: strings.Join(currentParts, " "),
+			Desired: strings.Join(desiredParts, " "),
+			Command: fmt.Sprintf("Timer%d %s", n, payload),
+		})
+	}
+
+	return nil
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func onOffString(b bool) string {
+	if b {
+		return "ON"
+	}
+	return "OFF"
+}
@@ -0,0 +1,234 @@
+package tasmota
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kradalby/tasmota-go/tasmotatest"
+)
+
+const testDesiredYAML = `
+Device:
+  DeviceName: Kitchen
+  FriendlyName: [Kitchen Plug]
+  PowerOnState: 1
+  PowerRetain: true
+  TelePeriod: 60
+MQTT:
+  Host: mqtt.home
+  Port: 1884
+  Password: hunter2
+  Topic: kitchen
+  GroupTopic: plugs
+SetOptions:
+  19: 1
+  55: 1
+Rules:
+  1:
+    Rules: ON Power1#State=1 DO Publish stat/kitchen/on 1 ENDON
+    Enabled: true
+Timers:
+  3:
+    Enable: 1
+    Time: "06:30"
+    Days: "0111110"
+    Action: 1
+Network:
+  Hostname: kitchen-plug
+  IPAddress: 192.168.1.50
+`
+
+func TestParseDesiredState(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{name: "yaml", input: testDesiredYAML},
+		{name: "json", input: `{"Device": {"DeviceName": "Kitchen"}, "SetOptions": {"19": 1}}`},
+		{name: "unknown key", input: "Device:\n  DevName: Kitchen\n", wantErr: true},
+		{name: "invalid range", input: "Device:\n  Sleep: 500\n", wantErr: true},
+		{name: "invalid address", input: "Network:\n  IPAddress: nope\n", wantErr: true},
+		{name: "invalid rule", input: "Rules:\n  4:\n    Enabled: true\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseDesiredState([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseDesiredState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseDesiredState_ScalarTypes(t *testing.T) {
+	input := `
+Device:
+  DeviceName: 007
+  FriendlyName: [1, Lamp]
+  TelePeriod: 60
+  Template: '{"NAME":"Plug","GPIO":[0,0],"FLAG":0,"BASE":18}'
+MQTT:
+  Enabled: yes
+  Topic: 1234
+Network:
+  Password1: 12345678
+  SSID1: true
+`
+	state, err := ParseDesiredState([]byte(input))
+	if err != nil {
+		t.Fatalf("ParseDesiredState() error: %v", err)
+	}
+
+	d, m, n := state.Device, state.MQTT, state.Network
+	if *d.DeviceName != "007" || fmt.Sprint(d.FriendlyName) != "[1 Lamp]" || *d.TelePeriod != 60 {
+		t.Errorf("Device = %q %q %d", *d.DeviceName, d.FriendlyName, *d.TelePeriod)
+	}
+	if !*m.Enabled || *m.Topic != "1234" {
+		t.Errorf("MQTT = %v %q, want enabled with topic 1234", *m.Enabled, *m.Topic)
+	}
+	if *n.Password1 != "12345678" || *n.SSID1 != "true" {
+		t.Errorf("Network = %q %q", *n.Password1, *n.SSID1)
+	}
+	if want := `{"NAME":"Plug","GPIO":[0,0],"FLAG":0,"BASE":18}`; string(d.Template) != want {
+		t.Errorf("Template = %s, want %s", d.Template, want)
+	}
+
+	// A string template is accepted in JSON documents too
+	state, err = ParseDesiredState([]byte(`{"Device": {"Template": "{\"NAME\":\"Plug\"}"}}`))
+	if err != nil || string(state.Device.Template) != `{"NAME":"Plug"}` {
+		t.Errorf("ParseDesiredState() template = %s, %v", state.Device.Template, err)
+	}
+	if _, err := ParseDesiredState([]byte("Device:\n  Template: not json\n")); !IsParseError(err) {
+		t.Errorf("ParseDesiredState() invalid template error = %v, want parse error", err)
+	}
+}
+
+func TestIntegration_PlanApply(t *testing.T) {
+	srv, client := newTestDevice(t)
+	srv.Update(func(s *tasmotatest.State) { s.SetOptions[55] = 1 })
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "kitchen.yaml")
+	if err := os.WriteFile(path, []byte(testDesiredYAML), 0o600); err != nil {
+		t.Fatalf("WriteFile() error: %v", err)
+	}
+	desired, err := LoadDesiredState(path)
+	if err != nil {
+		t.Fatalf("LoadDesiredState() error: %v", err)
+	}
+
+	plan, err := client.Plan(ctx, desired)
+	if err != nil {
+		t.Fatalf("Plan() error: %v", err)
+	}
+
+	fields := make(map[string]bool)
+	for _, c := range plan.Changes {
+		fields[c.Field] = true
+	}
+	for _, want := range []string{"Device.DeviceName", "MQTT.Port", "SetOptions.19", "Rules.1.Rules", "Rules.1.Enabled", "Timers.3", "Network.IPAddress"} {
+		if !fields[want] {
+			t.Errorf("plan missing %s:\n%s", want, plan)
+		}
+	}
+	// Unchanged and write-only settings are left out
+	for _, unwanted := range []string{"SetOptions.55", "MQTT.Password"} {
+		if fields[unwanted] {
+			t.Errorf("plan unexpectedly contains %s", unwanted)
+		}
+	}
+	if last := plan.Changes[len(plan.Changes)-1]; !strings.HasPrefix(last.Field, "Network.") {
+		t.Errorf("last change = %s, want network change last", last.Field)
+	}
+
+	if err := client.ApplyPlan(ctx, plan); err != nil {
+		t.Fatalf("ApplyPlan() error: %v", err)
+	}
+
+	state := srv.State()
+	if state.DeviceName != "Kitchen" || state.MQTT.Port != 1884 || state.Network.IPAddress != "192.168.1.50" {
+		t.Errorf("state not applied: %+v", state)
+	}
+	if r := state.Rules[0]; !r.Enabled || !strings.HasPrefix(r.Rules, "ON Power1#State=1") {
+		t.Errorf("rule not applied: %+v", r)
+	}
+	if tm := state.Timers[2]; tm.Enable != 1 || tm.Time != "06:30" || tm.Days != "0111110" || tm.Output != 1 {
+		t.Errorf("timer not applied: %+v", tm)
+	}
+
+	again, err := client.Plan(ctx, desired)
+	if err != nil {
+		t.Fatalf("Plan() error: %v", err)
+	}
+	if !again.Empty() {
+		t.Errorf("plan after apply not empty:\n%s", again)
+	}
+
+	secrets, err := client.Plan(ctx, desired, WithSecrets())
+	if err != nil {
+		t.Fatalf("Plan() error: %v", err)
+	}
+	if len(secrets.Changes) != 1 || !secrets.Changes[0].Sensitive || strings.Contains(secrets.String(), "hunter2") {
+		t.Errorf("Plan(WithSecrets()) = %+v", secrets.Changes)
+	}
+}
+
+func TestPlan_RuleCase(t *testing.T) {
+	srv, client := newTestDevice(t)
+	srv.Update(func(s *tasmotatest.State) {
+		s.Rules[0].Rules = "on power1#state=1 do publish stat/kitchen/on Hello endon"
+	})
+
+	tests := []struct {
+		name       string
+		rules      string
+		wantChange bool
+	}{
+		{name: "keyword case", rules: "ON Power1#State=1 DO Publish stat/kitchen/on Hello ENDON"},
+		{name: "payload case", rules: "ON Power1#State=1 DO Publish stat/kitchen/on HELLO ENDON", wantChange: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desired, err := ParseDesiredState(fmt.Appendf(nil, "Rules:\n  1:\n    Rules: %s\n", tt.rules))
+			if err != nil {
+				t.Fatalf("ParseDesiredState() error: %v", err)
+			}
+			plan, err := client.Plan(context.Background(), desired)
+			if err != nil {
+				t.Fatalf("Plan() error: %v", err)
+			}
+			if changed := !plan.Empty(); changed != tt.wantChange {
+				t.Errorf("plan changed = %v, want %v:\n%s", changed, tt.wantChange, plan)
+			}
+		})
+	}
+}
+
+func TestApplyPlan_Batching(t *testing.T) {
+	srv, client := newTestDevice(t)
+
+	plan := &Plan{}
+	for i := range 35 {
+		plan.Changes = append(plan.Changes, Change{Command: fmt.Sprintf("Sleep %d", i)})
+	}
+	plan.Changes = append(plan.Changes, Change{Command: "Rule1 ON a DO Backlog b; c ENDON"})
+
+	if err := client.ApplyPlan(context.Background(), plan); err != nil {
+		t.Fatalf("ApplyPlan() error: %v", err)
+	}
+
+	commands := srv.Commands()
+	if got := len(commands); got != 36 {
+		t.Fatalf("device ran %d commands, want 36", got)
+	}
+	if last := commands[len(commands)-1]; last != "Rule1 ON a DO Backlog b; c ENDON" {
+		t.Errorf("rule command = %q, want it sent unsplit", last)
+	}
+}
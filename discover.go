@@ -0,0 +1,626 @@
+package tasmota
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultDiscoveryConcurrency is the default number of parallel subnet probes.
+	DefaultDiscoveryConcurrency = 32
+	// DefaultDiscoveryWait is how long mDNS and MQTT discovery listen for replies.
+	DefaultDiscoveryWait = 3 * time.Second
+	// DefaultProbeTimeout is the default timeout for a single device probe.
+	DefaultProbeTimeout = 2 * time.Second
+	// DiscoveryTopic is the MQTT topic filter Tasmota's native discovery publishes to.
+	DiscoveryTopic = "tasmota/discovery/+/config"
+
+	mdnsAddress    = "224.0.0.251:5353"
+	mdnsService    = "_http._tcp.local."
+	mdnsTypeA      = 1
+	mdnsTypePTR    = 12
+	mdnsClassIN    = 1
+	mdnsMaxMessage = 9000
+)
+
+// DiscoveryMethod identifies how a device was found.
+type DiscoveryMethod int
+
+const (
+	// DiscoveryScan means the device answered a Status 0 probe during a subnet scan.
+	DiscoveryScan DiscoveryMethod = 1 << iota
+	// DiscoveryMDNS means the device answered an mDNS query (requires SetOption55 1).
+	DiscoveryMDNS
+	// DiscoveryMQTT means the device published to the tasmota/discovery topic.
+	DiscoveryMQTT
+)
+
+// String returns a string representation of the DiscoveryMethod.
+func (m DiscoveryMethod) String() string {
+	var names []string
+	if m&DiscoveryScan != 0 {
+		names = append(names, "scan")
+	}
+	if m&DiscoveryMDNS != 0 {
+		names = append(names, "mdns")
+	}
+	if m&DiscoveryMQTT != 0 {
+		names = append(names, "mqtt")
+	}
+	if len(names) == 0 {
+		return "unknown"
+	}
+	return strings.Join(names, ",")
+}
+
+// MarshalJSON implements json.Marshaler for DiscoveryMethod.
+func (m DiscoveryMethod) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// DiscoveredDevice describes a Tasmota device found on the network.
+// Devices are identified by MAC address so an IP change does not create a duplicate.
+type DiscoveredDevice struct {
+	MAC        MACAddr
+	IP         IPAddr
+	Hostname   string
+	DeviceName string
+	Firmware   string
+	Module     string
+	Topics     DeviceTopics
+	Methods    DiscoveryMethod
+	LastSeen   time.Time
+}
+
+// discoverConfig holds the settings applied by DiscoverOption.
+type discoverConfig struct {
+	subnets     []netip.Prefix
+	port        int
+	mdns        bool
+	mdnsAddr    string
+	mqtt        MQTTConn
+	concurrency int
+	wait        time.Duration
+	probeOpts   []ClientOption
+}
+
+// DiscoverOption is a functional option for configuring Discover.
+type DiscoverOption func(*discoverConfig)
+
+// WithScan probes every address in the IPv4 prefix with Status 0.
+func WithScan(prefix netip.Prefix) DiscoverOption {
+	return func(c *discoverConfig) {
+		c.subnets = append(c.subnets, prefix)
+	}
+}
+
+// WithScanPort sets the HTTP port probed during subnet scans (default 80).
+func WithScanPort(port int) DiscoverOption {
+	return func(c *discoverConfig) {
+		c.port = port
+	}
+}
+
+// WithMDNS queries mDNS for devices that have SetOption55 enabled.
+func WithMDNS() DiscoverOption {
+	return func(c *discoverConfig) {
+		c.mdns = true
+	}
+}
+
+// WithMQTTDiscovery listens on the tasmota/discovery topic of the broker.
+func WithMQTTDiscovery(conn MQTTConn) DiscoverOption {
+	return func(c *discoverConfig) {
+		c.mqtt = conn
+	}
+}
+
+// WithDiscoveryConcurrency sets the number of parallel probes.
+func WithDiscoveryConcurrency(n int) DiscoverOption {
+	return func(c *discoverConfig) {
+		c.concurrency = n
+	}
+}
+
+// WithDiscoveryWait sets how long mDNS and MQTT discovery listen for replies.
+func WithDiscoveryWait(wait time.Duration) DiscoverOption {
+	return func(c *discoverConfig) {
+		c.wait = wait
+	}
+}
+
+// WithProbeOptions sets the client options used to probe devices,
+// e.g. WithAuth for devices with a web password.
+func WithProbeOptions(opts ...ClientOption) DiscoverOption {
+	return func(c *discoverConfig) {
+		c.probeOpts = append(c.probeOpts, opts...)
+	}
+}
+
+// Discover finds Tasmota devices using the configured methods and returns
+// them merged by MAC address, sorted by IP.
+func Discover(ctx context.Context, opts ...DiscoverOption) ([]DiscoveredDevice, error) {
+	cfg := &discoverConfig{
+		port:        80,
+		mdnsAddr:    mdnsAddress,
+		concurrency: DefaultDiscoveryConcurrency,
+		wait:        DefaultDiscoveryWait,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if len(cfg.subnets) == 0 && !cfg.mdns && cfg.mqtt == nil {
+		return nil, NewError(ErrorTypeCommand, "no discovery method configured", nil)
+	}
+	if cfg.concurrency < 1 {
+		cfg.concurrency = 1
+	}
+	probeOpts := append([]ClientOption{WithTimeout(DefaultProbeTimeout)}, cfg.probeOpts...)
+
+	var (
+		mu    sync.Mutex
+		found []DiscoveredDevice
+		errs  []error
+		wg    sync.WaitGroup
+	)
+	collect := func(devices []DiscoveredDevice, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		found = append(found, devices...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	var hosts []string
+	for _, prefix := range cfg.subnets {
+		addrs, err := prefixHosts(prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			hosts = append(hosts, net.JoinHostPort(addr.String(), strconv.Itoa(cfg.port)))
+		}
+	}
+	if len(hosts) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			collect(probeHosts(ctx, hosts, DiscoveryScan, cfg.concurrency, probeOpts), nil)
+		}()
+	}
+
+	if cfg.mdns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ips, err := queryMDNS(ctx, cfg.mdnsAddr, cfg.wait)
+			if err != nil {
+				collect(nil, err)
+				return
+			}
+			hosts := make([]string, 0, len(ips))
+			for _, ip := range ips {
+				hosts = append(hosts, net.JoinHostPort(ip.String(), strconv.Itoa(cfg.port)))
+			}
+			collect(probeHosts(ctx, hosts, DiscoveryMDNS, cfg.concurrency, probeOpts), nil)
+		}()
+	}
+
+	if cfg.mqtt != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			collect(listenDiscoveryTopic(ctx, cfg.mqtt, cfg.wait))
+		}()
+	}
+
+	wg.Wait()
+
+	devices := MergeDevices(nil, found...)
+	if len(devices) == 0 && len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return devices, nil
+}
+
+// ProbeDevice queries host with Status 0 and returns the device it describes.
+// The connection is closed afterwards unless opts ask for keep-alive.
+func ProbeDevice(ctx context.Context, host string, opts ...ClientOption) (*DiscoveredDevice, error) {
+	// A scan probes hundreds of hosts once each, so don't keep idle
+	// connections open until they time out
+	client, err := NewClient(host, append([]ClientOption{WithKeepAlive(0)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := client.ExecuteCommand(ctx, "Status 0")
+	if err != nil {
+		return nil, err
+	}
+
+	var status StatusResponse
+	if err := unmarshalJSON(raw, &status); err != nil {
+		return nil, err
+	}
+	if status.Status == nil || status.StatusNET == nil || status.StatusNET.Mac.IsZero() {
+		return nil, NewError(ErrorTypeDevice, "response does not look like a Tasmota device", nil)
+	}
+
+	device := &DiscoveredDevice{
+		MAC:        status.StatusNET.Mac,
+		IP:         status.StatusNET.IPAddress,
+		Hostname:   status.StatusNET.Hostname,
+		DeviceName: status.Status.DeviceName,
+		Module:     strconv.Itoa(status.Status.Module),
+		Topics: DeviceTopics{
+			Topic:    status.Status.Topic,
+			Hostname: status.StatusNET.Hostname,
+			MAC:      status.StatusNET.Mac,
+		},
+		Methods:  DiscoveryScan,
+		LastSeen: time.Now(),
+	}
+	if status.StatusFWR != nil {
+		device.Firmware = status.StatusFWR.Version
+	}
+	if device.IP.IsZero() {
+		if u, err := url.Parse(client.BaseURL()); err == nil {
+			device.IP, _ = NewIPAddr(u.Hostname())
+		}
+	}
+
+	return device, nil
+}
+
+// MergeDevices merges found into existing, keyed by MAC address.
+// Newer observations update the IP address and fill in missing fields.
+func MergeDevices(existing []DiscoveredDevice, found ...DiscoveredDevice) []DiscoveredDevice {
+	byMAC := make(map[string]*DiscoveredDevice)
+	var order []string
+
+	for _, d := range append(append([]DiscoveredDevice{}, existing...), found...) {
+		if d.MAC.IsZero() {
+			continue
+		}
+		key := d.MAC.String()
+		cur, ok := byMAC[key]
+		if !ok {
+			d := d
+			byMAC[key] = &d
+			order = append(order, key)
+			continue
+		}
+
+		newer := d.LastSeen.After(cur.LastSeen) || d.LastSeen.Equal(cur.LastSeen)
+		cur.Methods |= d.Methods
+		mergeString(&cur.Hostname, d.Hostname, newer)
+		mergeString(&cur.DeviceName, d.DeviceName, newer)
+		mergeString(&cur.Firmware, d.Firmware, newer)
+		mergeString(&cur.Topics.Topic, d.Topics.Topic, newer)
+		mergeString(&cur.Topics.FullTopic, d.Topics.FullTopic, newer)
+		mergeString(&cur.Topics.Prefix1, d.Topics.Prefix1, newer)
+		mergeString(&cur.Topics.Prefix2, d.Topics.Prefix2, newer)
+		mergeString(&cur.Topics.Prefix3, d.Topics.Prefix3, newer)
+		mergeString(&cur.Topics.Hostname, d.Topics.Hostname, newer)
+		// Prefer module names from MQTT discovery over bare module numbers
+		if _, err := strconv.Atoi(d.Module); err != nil || cur.Module == "" {
+			mergeString(&cur.Module, d.Module, true)
+		}
+		if !d.IP.IsZero() && (newer || cur.IP.IsZero()) {
+			cur.IP = d.IP
+		}
+		if newer {
+			cur.LastSeen = d.LastSeen
+		}
+		cur.Topics.MAC = cur.MAC
+	}
+
+	devices := make([]DiscoveredDevice, 0, len(order))
+	for _, key := range order {
+		devices = append(devices, *byMAC[key])
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].IP.Addr != devices[j].IP.Addr {
+			return devices[i].IP.Less(devices[j].IP.Addr)
+		}
+		return devices[i].MAC.String() < devices[j].MAC.String()
+	})
+	return devices
+}
+
+// mergeString copies src into dst when dst is empty, or when src is newer.
+func mergeString(dst *string, src string, newer bool) {
+	if src != "" && (*dst == "" || newer) {
+		*dst = src
+	}
+}
+
+// prefixHosts returns the usable host addresses of an IPv4 prefix.
+func prefixHosts(prefix netip.Prefix) ([]netip.Addr, error) {
+	if !prefix.IsValid() || !prefix.Addr().Is4() {
+		return nil, NewError(ErrorTypeCommand, "only IPv4 prefixes can be scanned", nil)
+	}
+	prefix = prefix.Masked()
+	if 32-prefix.Bits() > 16 {
+		return nil, NewError(ErrorTypeCommand, fmt.Sprintf("prefix %s is too large to scan (max /16)", prefix), nil)
+	}
+
+	var hosts []netip.Addr
+	for addr := prefix.Addr(); addr.IsValid() && prefix.Contains(addr); addr = addr.Next() {
+		hosts = append(hosts, addr)
+	}
+	// Skip the network and broadcast addresses
+	if prefix.Bits() < 31 && len(hosts) > 2 {
+		hosts = hosts[1 : len(hosts)-1]
+	}
+	return hosts, nil
+}
+
+// probeHosts probes hosts in parallel and returns the devices that answered.
+func probeHosts(ctx context.Context, hosts []string, method DiscoveryMethod, concurrency int, opts []ClientOption) []DiscoveredDevice {
+	var (
+		mu      sync.Mutex
+		devices []DiscoveredDevice
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, concurrency)
+	)
+
+	for _, host := range hosts {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return devices
+		}
+
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			device, err := ProbeDevice(ctx, host, opts...)
+			if err != nil {
+				return
+			}
+			device.Methods = method
+
+			mu.Lock()
+			devices = append(devices, *device)
+			mu.Unlock()
+		}(host)
+	}
+
+	wg.Wait()
+	return devices
+}
+
+// discoveryConfig is the retained payload Tasmota publishes to
+// tasmota/discovery/<mac>/config.
+type discoveryConfig struct {
+	IP           string   `json:"ip"`
+	DeviceName   string   `json:"dn"`
+	Hostname     string   `json:"hn"`
+	MAC          string   `json:"mac"`
+	Module       string   `json:"md"`
+	Firmware     string   `json:"sw"`
+	Topic        string   `json:"t"`
+	FullTopic    string   `json:"ft"`
+	TopicPrefix  []string `json:"tp"`
+	FriendlyName []string `json:"fn"`
+}
+
+// listenDiscoveryTopic collects devices announced on the MQTT discovery topic.
+func listenDiscoveryTopic(ctx context.Context, conn MQTTConn, wait time.Duration) ([]DiscoveredDevice, error) {
+	var (
+		mu      sync.Mutex
+		devices []DiscoveredDevice
+	)
+
+	unsubscribe, err := conn.Subscribe(ctx, DiscoveryTopic, func(msg MQTTMessage) {
+		device, err := parseDiscoveryConfig(msg.Payload)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		devices = append(devices, *device)
+		mu.Unlock()
+	})
+	if err != nil {
+		return nil, NewError(ErrorTypeNetwork, "failed to subscribe to discovery topic", err)
+	}
+	defer func() { _ = unsubscribe() }()
+
+	select {
+	case <-time.After(wait):
+	case <-ctx.Done():
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]DiscoveredDevice(nil), devices...), nil
+}
+
+// parseDiscoveryConfig decodes a tasmota/discovery/<mac>/config payload.
+func parseDiscoveryConfig(payload []byte) (*DiscoveredDevice, error) {
+	var cfg discoveryConfig
+	if err := unmarshalJSON(payload, &cfg); err != nil {
+		return nil, err
+	}
+
+	mac, err := parseBareMAC(cfg.MAC)
+	if err != nil {
+		return nil, NewError(ErrorTypeParse, "invalid MAC in discovery message", err)
+	}
+	ip, err := NewIPAddr(cfg.IP)
+	if err != nil {
+		return nil, NewError(ErrorTypeParse, "invalid IP in discovery message", err)
+	}
+
+	device := &DiscoveredDevice{
+		MAC:        mac,
+		IP:         ip,
+		Hostname:   cfg.Hostname,
+		DeviceName: cfg.DeviceName,
+		Firmware:   cfg.Firmware,
+		Module:     cfg.Module,
+		Topics: DeviceTopics{
+			Topic:     cfg.Topic,
+			FullTopic: cfg.FullTopic,
+			Hostname:  cfg.Hostname,
+			MAC:       mac,
+		},
+		Methods:  DiscoveryMQTT,
+		LastSeen: time.Now(),
+	}
+	if len(cfg.TopicPrefix) == 3 {
+		device.Topics.Prefix1 = cfg.TopicPrefix[0]
+		device.Topics.Prefix2 = cfg.TopicPrefix[1]
+		device.Topics.Prefix3 = cfg.TopicPrefix[2]
+	}
+	return device, nil
+}
+
+// parseBareMAC parses MAC addresses with or without separators (AABBCCDDEEFF).
+func parseBareMAC(s string) (MACAddr, error) {
+	if len(s) == 12 && !strings.ContainsAny(s, ":-.") {
+		parts := make([]string, 0, 6)
+		for i := 0; i < 12; i += 2 {
+			parts = append(parts, s[i:i+2])
+		}
+		s = strings.Join(parts, ":")
+	}
+	return NewMACAddr(s)
+}
+
+// queryMDNS asks for HTTP services over mDNS and returns the responding addresses.
+func queryMDNS(ctx context.Context, addr string, wait time.Duration) ([]netip.Addr, error) {
+	raddr, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return nil, NewError(ErrorTypeNetwork, "invalid mDNS address", err)
+	}
+
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, NewError(ErrorTypeNetwork, "failed to open mDNS socket", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if _, err := conn.WriteToUDP(buildMDNSQuery(mdnsService), raddr); err != nil {
+		return nil, NewError(ErrorTypeNetwork, "failed to send mDNS query", err)
+	}
+
+	deadline := time.Now().Add(wait)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetReadDeadline(deadline)
+
+	seen := make(map[netip.Addr]bool)
+	var addrs []netip.Addr
+	buf := make([]byte, mdnsMaxMessage)
+	for {
+		n, from, err := conn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			return addrs, NewError(ErrorTypeNetwork, "failed to read mDNS response", err)
+		}
+
+		candidates := parseMDNSAddrs(buf[:n])
+		if len(candidates) == 0 {
+			candidates = []netip.Addr{from.Addr().Unmap()}
+		}
+		for _, a := range candidates {
+			if !seen[a] {
+				seen[a] = true
+				addrs = append(addrs, a)
+			}
+		}
+	}
+
+	return addrs, nil
+}
+
+// buildMDNSQuery builds a PTR question for service.
+func buildMDNSQuery(service string) []byte {
+	msg := make([]byte, 12)
+	binary.BigEndian.PutUint16(msg[4:], 1) // QDCOUNT
+	for _, label := range strings.Split(strings.TrimSuffix(service, "."), ".") {
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, mdnsTypePTR)
+	msg = binary.BigEndian.AppendUint16(msg, mdnsClassIN)
+	return msg
+}
+
+// parseMDNSAddrs returns the IPv4 addresses from all A records in a DNS message.
+func parseMDNSAddrs(msg []byte) []netip.Addr {
+	if len(msg) < 12 {
+		return nil
+	}
+	qd := int(binary.BigEndian.Uint16(msg[4:]))
+	rr := int(binary.BigEndian.Uint16(msg[6:])) +
+		int(binary.BigEndian.Uint16(msg[8:])) +
+		int(binary.BigEndian.Uint16(msg[10:]))
+
+	off := 12
+	for i := 0; i < qd; i++ {
+		var ok bool
+		if off, ok = skipDNSName(msg, off); !ok || off+4 > len(msg) {
+			return nil
+		}
+		off += 4
+	}
+
+	var addrs []netip.Addr
+	for i := 0; i < rr; i++ {
+		var ok bool
+		if off, ok = skipDNSName(msg, off); !ok || off+10 > len(msg) {
+			return addrs
+		}
+		typ := binary.BigEndian.Uint16(msg[off:])
+		length := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+length > len(msg) {
+			return addrs
+		}
+		if typ == mdnsTypeA && length == 4 {
+			addrs = append(addrs, netip.AddrFrom4([4]byte(msg[off:off+4])))
+		}
+		off += length
+	}
+	return addrs
+}
+
+// skipDNSName returns the offset just past the (possibly compressed) name at off.
+func skipDNSName(msg []byte, off int) (int, bool) {
+	for off < len(msg) {
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			return off + 1, true
+		case n&0xc0 == 0xc0:
+			return off + 2, off+2 <= len(msg)
+		default:
+			off += n + 1
+		}
+	}
+	return 0, false
+}
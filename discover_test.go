@@ -0,0 +1,270 @@
+package tasmota
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const probeStatus0 = `{"Status":{"Module":1,"DeviceName":"Plug","Topic":"plug"},` +
+	`"StatusFWR":{"Version":"14.2.0(tasmota)"},` +
+	`"StatusNET":{"Hostname":"plug-1234","IPAddress":"192.168.1.50","Mac":"AA:BB:CC:DD:EE:FF"}}`
+
+func newProbeServer(t *testing.T) (*httptest.Server, int) {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cmd := r.URL.Query().Get("cmnd"); cmd != "Status 0" {
+			t.Errorf("cmnd = %q, want Status 0", cmd)
+		}
+		_, _ = w.Write([]byte(probeStatus0))
+	}))
+	t.Cleanup(server.Close)
+
+	u, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(u.Port())
+	return server, port
+}
+
+func TestPrefixHosts(t *testing.T) {
+	tests := []struct {
+		prefix  string
+		want    int
+		first   string
+		wantErr bool
+	}{
+		{prefix: "192.168.1.0/24", want: 254, first: "192.168.1.1"},
+		{prefix: "192.168.1.77/24", want: 254, first: "192.168.1.1"},
+		{prefix: "10.0.0.5/32", want: 1, first: "10.0.0.5"},
+		{prefix: "10.0.0.4/31", want: 2, first: "10.0.0.4"},
+		{prefix: "10.0.0.0/8", wantErr: true},
+		{prefix: "fd00::/120", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			hosts, err := prefixHosts(netip.MustParsePrefix(tt.prefix))
+			if tt.wantErr {
+				if !IsCommandError(err) {
+					t.Errorf("prefixHosts() error = %v, want command error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("prefixHosts() error: %v", err)
+			}
+			if len(hosts) != tt.want {
+				t.Errorf("len(hosts) = %d, want %d", len(hosts), tt.want)
+			}
+			if hosts[0].String() != tt.first {
+				t.Errorf("hosts[0] = %s, want %s", hosts[0], tt.first)
+			}
+		})
+	}
+}
+
+func TestProbeDevice(t *testing.T) {
+	server, _ := newProbeServer(t)
+
+	device, err := ProbeDevice(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("ProbeDevice() error: %v", err)
+	}
+	if device.MAC.String() != "aa:bb:cc:dd:ee:ff" {
+		t.Errorf("MAC = %s, want aa:bb:cc:dd:ee:ff", device.MAC)
+	}
+	if device.IP.String() != "192.168.1.50" || device.Hostname != "plug-1234" {
+		t.Errorf("IP/hostname = %s/%s, want 192.168.1.50/plug-1234", device.IP, device.Hostname)
+	}
+	if device.Firmware != "14.2.0(tasmota)" || device.Module != "1" || device.Topics.Topic != "plug" {
+		t.Errorf("device = %+v, want firmware, module and topic set", device)
+	}
+
+	notTasmota := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer notTasmota.Close()
+
+	if _, err := ProbeDevice(context.Background(), notTasmota.URL); !IsDeviceError(err) {
+		t.Errorf("ProbeDevice() error = %v, want device error", err)
+	}
+
+	// The probe does not leave its connection open
+	closed := make(chan struct{}, 1)
+	probed := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(probeStatus0))
+	}))
+	probed.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			closed <- struct{}{}
+		}
+	}
+	probed.Start()
+	defer probed.Close()
+
+	if _, err := ProbeDevice(context.Background(), probed.URL); err != nil {
+		t.Fatalf("ProbeDevice() error: %v", err)
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Error("connection still open after ProbeDevice()")
+	}
+}
+
+func TestParseDiscoveryConfig(t *testing.T) {
+	payload := `{"ip":"192.168.1.60","dn":"Lamp","fn":["Lamp",null],"hn":"lamp-4321","mac":"AABBCCDD4321",` +
+		`"md":"Sonoff Basic","sw":"13.4.0","t":"lamp","ft":"%prefix%/%topic%/","tp":["cmnd","stat","tele"]}`
+
+	device, err := parseDiscoveryConfig([]byte(payload))
+	if err != nil {
+		t.Fatalf("parseDiscoveryConfig() error: %v", err)
+	}
+	if device.MAC.String() != "aa:bb:cc:dd:43:21" {
+		t.Errorf("MAC = %s, want aa:bb:cc:dd:43:21", device.MAC)
+	}
+	if device.Module != "Sonoff Basic" || device.Firmware != "13.4.0" || device.IP.String() != "192.168.1.60" {
+		t.Errorf("device = %+v", device)
+	}
+	if got := device.Topics.Command("Power"); got != "cmnd/lamp/Power" {
+		t.Errorf("command topic = %s, want cmnd/lamp/Power", got)
+	}
+
+	if _, err := parseDiscoveryConfig([]byte(`{"mac":"nope"}`)); !IsParseError(err) {
+		t.Errorf("parseDiscoveryConfig() error = %v, want parse error", err)
+	}
+}
+
+func TestMergeDevices(t *testing.T) {
+	mac := MustParseMACAddr("AA:BB:CC:DD:EE:FF")
+	now := time.Now()
+
+	existing := []DiscoveredDevice{
+		{MAC: mac, IP: MustParseIPAddr("192.168.1.50"), Module: "Sonoff Basic", Methods: DiscoveryMQTT, LastSeen: now.Add(-time.Hour)},
+	}
+	found := []DiscoveredDevice{
+		{MAC: mac, IP: MustParseIPAddr("192.168.1.99"), Hostname: "plug", Module: "1", Methods: DiscoveryScan, LastSeen: now},
+		{MAC: MustParseMACAddr("00:11:22:33:44:55"), IP: MustParseIPAddr("192.168.1.10"), LastSeen: now},
+		{IP: MustParseIPAddr("192.168.1.11")}, // no MAC, dropped
+	}
+
+	devices := MergeDevices(existing, found...)
+	if len(devices) != 2 {
+		t.Fatalf("len(devices) = %d, want 2", len(devices))
+	}
+	if devices[0].IP.String() != "192.168.1.10" {
+		t.Errorf("devices not sorted by IP: %s first", devices[0].IP)
+	}
+
+	d := devices[1]
+	if d.IP.String() != "192.168.1.99" {
+		t.Errorf("IP = %s, want newer 192.168.1.99", d.IP)
+	}
+	if d.Hostname != "plug" || d.Module != "Sonoff Basic" {
+		t.Errorf("hostname/module = %s/%s, want plug/Sonoff Basic", d.Hostname, d.Module)
+	}
+	if d.Methods != DiscoveryMQTT|DiscoveryScan || d.Methods.String() != "scan,mqtt" {
+		t.Errorf("Methods = %s, want scan,mqtt", d.Methods)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	t.Run("no methods", func(t *testing.T) {
+		if _, err := Discover(context.Background()); !IsCommandError(err) {
+			t.Errorf("Discover() error = %v, want command error", err)
+		}
+	})
+
+	t.Run("scan", func(t *testing.T) {
+		_, port := newProbeServer(t)
+
+		devices, err := Discover(context.Background(),
+			WithScan(netip.MustParsePrefix("127.0.0.1/32")),
+			WithScanPort(port),
+		)
+		if err != nil {
+			t.Fatalf("Discover() error: %v", err)
+		}
+		if len(devices) != 1 || devices[0].Methods != DiscoveryScan {
+			t.Fatalf("devices = %+v, want one scanned device", devices)
+		}
+	})
+
+	t.Run("mqtt", func(t *testing.T) {
+		broker := newMemBroker()
+		done := make(chan struct{})
+		defer close(done)
+
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				case <-time.After(5 * time.Millisecond):
+					_ = broker.Publish(context.Background(), "tasmota/discovery/AABBCCDDEEFF/config",
+						[]byte(`{"ip":"192.168.1.50","mac":"AABBCCDDEEFF","t":"plug","md":"Sonoff Basic"}`))
+				}
+			}
+		}()
+
+		devices, err := Discover(context.Background(),
+			WithMQTTDiscovery(broker),
+			WithDiscoveryWait(50*time.Millisecond),
+		)
+		if err != nil {
+			t.Fatalf("Discover() error: %v", err)
+		}
+		if len(devices) != 1 || devices[0].Topics.Topic != "plug" || devices[0].Methods != DiscoveryMQTT {
+			t.Fatalf("devices = %+v, want one device from MQTT", devices)
+		}
+	})
+
+	t.Run("mdns", func(t *testing.T) {
+		_, port := newProbeServer(t)
+
+		responder, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("ListenUDP() error: %v", err)
+		}
+		defer func() { _ = responder.Close() }()
+
+		go func() {
+			buf := make([]byte, 512)
+			n, from, err := responder.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			// Answer with the question echoed and one A record for 127.0.0.1
+			resp := append([]byte{}, buf[:n]...)
+			binary.BigEndian.PutUint16(resp[2:], 0x8400)
+			binary.BigEndian.PutUint16(resp[6:], 1)
+			resp = append(resp, 0xc0, 12) // pointer to question name
+			resp = binary.BigEndian.AppendUint16(resp, mdnsTypeA)
+			resp = binary.BigEndian.AppendUint16(resp, mdnsClassIN)
+			resp = binary.BigEndian.AppendUint32(resp, 120)
+			resp = binary.BigEndian.AppendUint16(resp, 4)
+			resp = append(resp, 127, 0, 0, 1)
+			_, _ = responder.WriteToUDP(resp, from)
+		}()
+
+		devices, err := Discover(context.Background(),
+			WithMDNS(),
+			WithScanPort(port),
+			WithDiscoveryWait(200*time.Millisecond),
+			func(c *discoverConfig) { c.mdnsAddr = responder.LocalAddr().String() },
+		)
+		if err != nil {
+			t.Fatalf("Discover() error: %v", err)
+		}
+		if len(devices) != 1 || devices[0].Methods != DiscoveryMDNS {
+			t.Fatalf("devices = %+v, want one device from mDNS", devices)
+		}
+	})
+}
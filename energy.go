@@ -0,0 +1,259 @@
+package tasmota
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// EnergyData contains power monitoring information.
+//
+// Three phase meters and multi-channel devices such as the Shelly 2.5 report
+// some values as one number per phase or channel. The fields then hold the
+// sum across phases for energy, power and current, and the average for
+// voltage, power factor and frequency; Phase returns the values of a single
+// phase.
+type EnergyData struct {
+	TotalStartTime string  `json:"TotalStartTime"`
+	Total          float64 `json:"Total"`
+	Yesterday      float64 `json:"Yesterday"`
+	Today          float64 `json:"Today"`
+	Period         float64 `json:"Period"`
+	Power          float64 `json:"Power"`
+	ApparentPower  float64 `json:"ApparentPower"`
+	ReactivePower  float64 `json:"ReactivePower"`
+	Factor         float64 `json:"Factor"`
+	Voltage        float64 `json:"Voltage"`
+	Current        float64 `json:"Current"`
+	Frequency      float64 `json:"Frequency"`
+
+	// values holds every reported value by field name, one per phase.
+	values map[string][]float64
+}
+
+// EnergyPhase holds the values of one phase or channel.
+type EnergyPhase struct {
+	Total         float64
+	Yesterday     float64
+	Today         float64
+	Period        float64
+	Power         float64
+	ApparentPower float64
+	ReactivePower float64
+	Factor        float64
+	Voltage       float64
+	Current       float64
+	Frequency     float64
+}
+
+// energyField describes a numeric EnergyData field. Averaged fields are
+// shared by all phases when reported once.
+type energyField struct {
+	name     string
+	averaged bool
+	data     func(*EnergyData) *float64
+	phase    func(*EnergyPhase) *float64
+}
+
+var energyFields = []energyField{
+	{"Total", false, func(e *EnergyData) *float64 { return &e.Total }, func(p *EnergyPhase) *float64 { return &p.Total }},
+	{"Yesterday", false, func(e *EnergyData) *float64 { return &e.Yesterday }, func(p *EnergyPhase) *float64 { return &p.Yesterday }},
+	{"Today", false, func(e *EnergyData) *float64 { return &e.Today }, func(p *EnergyPhase) *float64 { return &p.Today }},
+	{"Period", false, func(e *EnergyData) *float64 { return &e.Period }, func(p *EnergyPhase) *float64 { return &p.Period }},
+	{"Power", false, func(e *EnergyData) *float64 { return &e.Power }, func(p *EnergyPhase) *float64 { return &p.Power }},
+	{"ApparentPower", false, func(e *EnergyData) *float64 { return &e.ApparentPower }, func(p *EnergyPhase) *float64 { return &p.ApparentPower }},
+	{"ReactivePower", false, func(e *EnergyData) *float64 { return &e.ReactivePower }, func(p *EnergyPhase) *float64 { return &p.ReactivePower }},
+	{"Factor", true, func(e *EnergyData) *float64 { return &e.Factor }, func(p *EnergyPhase) *float64 { return &p.Factor }},
+	{"Voltage", true, func(e *EnergyData) *float64 { return &e.Voltage }, func(p *EnergyPhase) *float64 { return &p.Voltage }},
+	{"Current", false, func(e *EnergyData) *float64 { return &e.Current }, func(p *EnergyPhase) *float64 { return &p.Current }},
+	{"Frequency", true, func(e *EnergyData) *float64 { return &e.Frequency }, func(p *EnergyPhase) *float64 { return &p.Frequency }},
+}
+
+// UnmarshalJSON decodes an ENERGY block, accepting each value as a number,
+// a numeric string or an array with one number per phase.
+func (e *EnergyData) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	*e = EnergyData{values: make(map[string][]float64)}
+	if value, ok := fields["TotalStartTime"]; ok {
+		if err := json.Unmarshal(value, &e.TotalStartTime); err != nil {
+			return fmt.Errorf("energy field TotalStartTime: %w", err)
+		}
+	}
+	for _, f := range energyFields {
+		value, ok := fields[f.name]
+		if !ok {
+			continue
+		}
+		values, err := parseEnergyValues(value)
+		if err != nil {
+			return fmt.Errorf("energy field %s: %w", f.name, err)
+		}
+		if len(values) == 0 {
+			continue
+		}
+		e.values[f.name] = values
+
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		if f.averaged {
+			sum /= float64(len(values))
+		}
+		*f.data(e) = sum
+	}
+	return nil
+}
+
+// MarshalJSON encodes the block the way the device sends it, with arrays for
+// the values reported per phase.
+func (e EnergyData) MarshalJSON() ([]byte, error) {
+	fields := map[string]any{"TotalStartTime": e.TotalStartTime}
+	for _, f := range energyFields {
+		if values := e.values[f.name]; len(values) > 1 {
+			fields[f.name] = values
+		} else {
+			fields[f.name] = *f.data(&e)
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// Phases returns the number of phases or channels the device reports.
+func (e *EnergyData) Phases() int {
+	n := 1
+	for _, values := range e.values {
+		n = max(n, len(values))
+	}
+	return n
+}
+
+// Phase returns the values of phase or channel n, counting from 1. Voltage,
+// power factor and frequency reported once are shared by every phase; other
+// values reported once are only known for single phase devices.
+func (e *EnergyData) Phase(n int) (EnergyPhase, bool) {
+	phases := e.Phases()
+	if n < 1 || n > phases {
+		return EnergyPhase{}, false
+	}
+
+	var p EnergyPhase
+	for _, f := range energyFields {
+		values, ok := e.values[f.name]
+		switch {
+		case !ok:
+			if phases == 1 {
+				// Built by hand rather than decoded.
+				*f.phase(&p) = *f.data(e)
+			}
+		case len(values) > 1:
+			if n <= len(values) {
+				*f.phase(&p) = values[n-1]
+			}
+		case f.averaged || phases == 1:
+			*f.phase(&p) = values[0]
+		}
+	}
+	return p, true
+}
+
+// reported reports whether the device sent the named field.
+func (e *EnergyData) reported(name string) bool {
+	_, ok := e.values[name]
+	return ok
+}
+
+func parseEnergyValues(data json.RawMessage) ([]float64, error) {
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	var items []any
+	switch v := raw.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		items = v
+	default:
+		items = []any{v}
+	}
+
+	values := make([]float64, 0, len(items))
+	for _, item := range items {
+		switch v := item.(type) {
+		case float64:
+			values = append(values, v)
+		case string:
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("value %q is not a number", v)
+			}
+			values = append(values, f)
+		default:
+			return nil, fmt.Errorf("value %v is not a number", item)
+		}
+	}
+	return values, nil
+}
+
+// StatusPower contains the power monitoring thresholds (Status 9). A zero
+// threshold is disabled.
+type StatusPower struct {
+	// PowerDelta is the power change of each phase that triggers a
+	// telemetry report: 1-100 W, or 101-32000 for a change of 1-31900 %.
+	PowerDelta []int
+	// PowerLow and PowerHigh are in W.
+	PowerLow  int
+	PowerHigh int
+	// VoltageLow and VoltageHigh are in V.
+	VoltageLow  int
+	VoltageHigh int
+	// CurrentLow and CurrentHigh are in mA.
+	CurrentLow  int
+	CurrentHigh int
+}
+
+// UnmarshalJSON decodes a StatusPTH block. Older firmware reports a single
+// PowerDelta instead of one per phase.
+func (p *StatusPower) UnmarshalJSON(data []byte) error {
+	type plain StatusPower
+	var raw struct {
+		plain
+		PowerDelta json.RawMessage
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*p = StatusPower(raw.plain)
+	p.PowerDelta = nil
+	if len(raw.PowerDelta) == 0 {
+		return nil
+	}
+	deltas, err := parseEnergyValues(raw.PowerDelta)
+	if err != nil {
+		return fmt.Errorf("PowerDelta: %w", err)
+	}
+	for _, d := range deltas {
+		p.PowerDelta = append(p.PowerDelta, int(d))
+	}
+	return nil
+}
+
+// GetPowerThresholds retrieves the power monitoring thresholds (Status 9).
+func (c *Client) GetPowerThresholds(ctx context.Context) (*StatusPower, error) {
+	resp, err := c.Status(ctx, 9)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusPTH == nil {
+		return nil, NewError(ErrorTypeParse, "status response missing StatusPTH field", nil)
+	}
+	return resp.StatusPTH, nil
+}
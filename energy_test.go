@@ -0,0 +1,160 @@
+package tasmota
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/kradalby/tasmota-go/tasmotatest"
+)
+
+func TestEnergyData_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    EnergyData
+		phases  int
+		phase2  EnergyPhase
+		wantErr bool
+	}{
+		{
+			name:    "single phase",
+			payload: `{"TotalStartTime":"2024-01-01T00:00:00","Total":12.5,"Today":0.4,"Power":40,"Factor":0.9,"Voltage":230,"Current":0.19}`,
+			want:    EnergyData{TotalStartTime: "2024-01-01T00:00:00", Total: 12.5, Today: 0.4, Power: 40, Factor: 0.9, Voltage: 230, Current: 0.19},
+			phases:  1,
+		},
+		{
+			name:    "shelly 2.5",
+			payload: `{"Total":3.2,"Today":[0.1,0.3],"Power":[10,30],"Factor":[0.5,0.7],"Voltage":231,"Current":[0.05,0.15],"Frequency":50}`,
+			want:    EnergyData{Total: 3.2, Today: 0.4, Power: 40, Factor: 0.6, Voltage: 231, Current: 0.2, Frequency: 50},
+			phases:  2,
+			phase2:  EnergyPhase{Today: 0.3, Power: 30, Factor: 0.7, Voltage: 231, Current: 0.15, Frequency: 50},
+		},
+		{
+			name:    "three phase",
+			payload: `{"Total":[100,200,300],"Power":[1000,2000,3000],"Voltage":[229,231,230],"Current":[4,9,13]}`,
+			want:    EnergyData{Total: 600, Power: 6000, Voltage: 230, Current: 26},
+			phases:  3,
+			phase2:  EnergyPhase{Total: 200, Power: 2000, Voltage: 231, Current: 9},
+		},
+		{
+			name:    "strings and nulls",
+			payload: `{"Power":"75.5","Voltage":null}`,
+			want:    EnergyData{Power: 75.5},
+			phases:  1,
+		},
+		{name: "not a number", payload: `{"Power":"high"}`, wantErr: true},
+		{name: "nested", payload: `{"Power":[[1]]}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got EnergyData
+			err := json.Unmarshal([]byte(tt.payload), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			got.values = nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unmarshal() = %+v, want %+v", got, tt.want)
+			}
+			_ = json.Unmarshal([]byte(tt.payload), &got)
+			if n := got.Phases(); n != tt.phases {
+				t.Errorf("Phases() = %d, want %d", n, tt.phases)
+			}
+			if tt.phases > 1 {
+				if p, ok := got.Phase(2); !ok || p != tt.phase2 {
+					t.Errorf("Phase(2) = %+v, %v, want %+v", p, ok, tt.phase2)
+				}
+			}
+			if _, ok := got.Phase(tt.phases + 1); ok {
+				t.Errorf("Phase(%d) ok, want out of range", tt.phases+1)
+			}
+		})
+	}
+}
+
+func TestEnergyData_MarshalJSON(t *testing.T) {
+	var e EnergyData
+	if err := json.Unmarshal([]byte(`{"Total":3.2,"Power":[10,30],"Voltage":231}`), &e); err != nil {
+		t.Fatalf("Unmarshal() error: %v", err)
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("Marshal() error: %v", err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("Unmarshal(fields) error: %v", err)
+	}
+	if !reflect.DeepEqual(fields["Power"], []any{10.0, 30.0}) || fields["Voltage"] != 231.0 || fields["Total"] != 3.2 {
+		t.Errorf("Marshal() = %s", data)
+	}
+
+	// A hand built single phase value still has a phase.
+	p, ok := (&EnergyData{Power: 12}).Phase(1)
+	if !ok || p.Power != 12 {
+		t.Errorf("Phase(1) = %+v, %v", p, ok)
+	}
+}
+
+func TestStatusPower_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    StatusPower
+	}{
+		{
+			name:    "per phase",
+			payload: `{"PowerDelta":[0,110,0],"PowerLow":5,"PowerHigh":2000,"VoltageLow":200,"VoltageHigh":250,"CurrentLow":0,"CurrentHigh":16000}`,
+			want:    StatusPower{PowerDelta: []int{0, 110, 0}, PowerLow: 5, PowerHigh: 2000, VoltageLow: 200, VoltageHigh: 250, CurrentHigh: 16000},
+		},
+		{
+			name:    "older firmware",
+			payload: `{"PowerDelta":80,"PowerLow":0,"PowerHigh":0}`,
+			want:    StatusPower{PowerDelta: []int{80}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got StatusPower
+			if err := json.Unmarshal([]byte(tt.payload), &got); err != nil {
+				t.Fatalf("Unmarshal() error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unmarshal() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntegration_Energy(t *testing.T) {
+	_, client := newTestDevice(t, tasmotatest.WithSensor("ENERGY", map[string]any{
+		"Total": 3.2, "Power": []float64{10, 30}, "Voltage": 231, "Current": []float64{0.05, 0.15},
+	}))
+	ctx := context.Background()
+
+	if power, err := client.GetCurrentPower(ctx); err != nil || power != 40 {
+		t.Errorf("GetCurrentPower() = %v, %v, want 40", power, err)
+	}
+	if power, err := client.GetChannelPower(ctx, 2); err != nil || power != 30 {
+		t.Errorf("GetChannelPower(2) = %v, %v, want 30", power, err)
+	}
+	if _, err := client.GetChannelPower(ctx, 3); !IsCommandError(err) {
+		t.Errorf("GetChannelPower(3) error = %v, want command error", err)
+	}
+
+	thresholds, err := client.GetPowerThresholds(ctx)
+	if err != nil {
+		t.Fatalf("GetPowerThresholds() error: %v", err)
+	}
+	if !reflect.DeepEqual(thresholds, &StatusPower{PowerDelta: []int{0, 0, 0}}) {
+		t.Errorf("GetPowerThresholds() = %+v", thresholds)
+	}
+}
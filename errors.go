@@ -48,6 +48,10 @@ type Error struct {
 	Type    ErrorType
 	Message string
 	Err     error
+	// Command and DeviceMessage are set when the device rejected a command:
+	// the command line and the device's reply, e.g. "Unknown".
+	Command       string
+	DeviceMessage string
 }
 
 // Error implements the error interface.
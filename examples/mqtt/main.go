@@ -99,7 +99,7 @@ func main() {
 		Host:       mqttHost,
 		Port:       1883,
 		User:       mqttUser,
-		Password:   mqttPass,
+		Password:   tasmota.Secret(mqttPass),
 		Client:     "tasmota_living_room",
 		Topic:      "living_room_lamp",
 		FullTopic:  "%prefix%/%topic%/",
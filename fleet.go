@@ -0,0 +1,458 @@
+package tasmota
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFleetConcurrency is the default number of devices a Fleet talks to at once.
+	DefaultFleetConcurrency = 10
+	// DefaultDeviceTimeout is the default time a Fleet allows per device.
+	DefaultDeviceTimeout = 30 * time.Second
+)
+
+// Labels are key/value pairs attached to fleet devices.
+type Labels map[string]string
+
+// FleetDevice is a named device in a Fleet.
+type FleetDevice struct {
+	Name   string
+	Client *Client
+	Labels Labels
+}
+
+// Fleet holds many device clients and runs operations across them concurrently.
+type Fleet struct {
+	mu          sync.RWMutex
+	devices     map[string]*FleetDevice
+	concurrency int
+	timeout     time.Duration
+	stopOnError bool
+}
+
+// FleetOption is a functional option for configuring a Fleet.
+type FleetOption func(*Fleet)
+
+// WithFleetConcurrency sets how many devices are operated on at once.
+func WithFleetConcurrency(n int) FleetOption {
+	return func(f *Fleet) {
+		if n > 0 {
+			f.concurrency = n
+		}
+	}
+}
+
+// WithDeviceTimeout sets the time allowed for each device in Run.
+// Zero disables the per-device timeout.
+func WithDeviceTimeout(timeout time.Duration) FleetOption {
+	return func(f *Fleet) {
+		f.timeout = timeout
+	}
+}
+
+// WithStopOnError makes Run start no further devices once one has failed.
+// Combined with a concurrency of 1 this gives a rolling operation that
+// stops at the first failure.
+func WithStopOnError() FleetOption {
+	return func(f *Fleet) {
+		f.stopOnError = true
+	}
+}
+
+// NewFleet creates an empty Fleet.
+func NewFleet(opts ...FleetOption) *Fleet {
+	f := &Fleet{
+		devices:     make(map[string]*FleetDevice),
+		concurrency: DefaultFleetConcurrency,
+		timeout:     DefaultDeviceTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	return f
+}
+
+// Add registers a device under a unique name.
+func (f *Fleet) Add(name string, client *Client, labels Labels) error {
+	if name == "" {
+		return NewError(ErrorTypeCommand, "device name cannot be empty", nil)
+	}
+	if client == nil {
+		return NewError(ErrorTypeCommand, "client cannot be nil", nil)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.devices[name]; ok {
+		return NewError(ErrorTypeCommand, fmt.Sprintf("device %q already in fleet", name), nil)
+	}
+
+	copied := make(Labels, len(labels))
+	for k, v := range labels {
+		copied[k] = v
+	}
+	f.devices[name] = &FleetDevice{Name: name, Client: client, Labels: copied}
+
+	return nil
+}
+
+// Remove removes a device and reports whether it was present.
+func (f *Fleet) Remove(name string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, ok := f.devices[name]
+	delete(f.devices, name)
+	return ok
+}
+
+// Device returns the device with the given name.
+func (f *Fleet) Device(name string) (*FleetDevice, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	d, ok := f.devices[name]
+	return d, ok
+}
+
+// Len returns the number of devices in the fleet.
+func (f *Fleet) Len() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return len(f.devices)
+}
+
+// Devices returns the devices matching selector, sorted by name.
+// An empty selector matches every device.
+func (f *Fleet) Devices(selector Selector) []*FleetDevice {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var devices []*FleetDevice
+	for _, d := range f.devices {
+		if selector.Matches(d.Labels) {
+			devices = append(devices, d)
+		}
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Name < devices[j].Name
+	})
+
+	return devices
+}
+
+// FleetFunc is an operation run against a single device.
+// The returned value is stored in the device's FleetResult.
+type FleetFunc func(ctx context.Context, client *Client) (any, error)
+
+// FleetAction adapts a function that only returns an error, such as a
+// closure around SetPowerOff or ApplyConfig, to a FleetFunc.
+func FleetAction(fn func(ctx context.Context, client *Client) error) FleetFunc {
+	return func(ctx context.Context, client *Client) (any, error) {
+		return nil, fn(ctx, client)
+	}
+}
+
+// FleetResult is the outcome of a FleetFunc on one device.
+type FleetResult struct {
+	Device   string
+	Labels   Labels
+	Value    any
+	Err      error
+	Duration time.Duration
+	// Skipped is set for devices not started because an earlier device
+	// failed and the fleet stops on error.
+	Skipped bool
+}
+
+// FleetReport collects the per-device results of a Run, sorted by device name.
+type FleetReport struct {
+	Results  []FleetResult
+	Duration time.Duration
+}
+
+// Succeeded returns the results without an error.
+func (r *FleetReport) Succeeded() []FleetResult {
+	var out []FleetResult
+	for _, res := range r.Results {
+		if res.Err == nil {
+			out = append(out, res)
+		}
+	}
+	return out
+}
+
+// Failed returns the results with an error.
+func (r *FleetReport) Failed() []FleetResult {
+	var out []FleetResult
+	for _, res := range r.Results {
+		if res.Err != nil {
+			out = append(out, res)
+		}
+	}
+	return out
+}
+
+// Err returns nil when every device succeeded. Otherwise it returns a device
+// error counting the failures and wrapping the first one.
+func (r *FleetReport) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	msg := fmt.Sprintf("%d of %d devices failed (first: %s)", len(failed), len(r.Results), failed[0].Device)
+	return NewError(ErrorTypeDevice, msg, failed[0].Err)
+}
+
+// Run calls fn for every device matching selector, with at most the
+// configured number of devices in flight and the per-device timeout applied.
+// Devices not yet started when ctx is cancelled report ctx's error.
+func (f *Fleet) Run(ctx context.Context, selector Selector, fn FleetFunc) *FleetReport {
+	f.mu.RLock()
+	concurrency, timeout, stopOnError := f.concurrency, f.timeout, f.stopOnError
+	f.mu.RUnlock()
+
+	devices := f.Devices(selector)
+	report := &FleetReport{Results: make([]FleetResult, len(devices))}
+	start := time.Now()
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	// stop is closed by the first failure when stopping on error
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+
+	for i, d := range devices {
+		report.Results[i] = FleetResult{Device: d.Name, Labels: d.Labels}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			report.Results[i].Err = NewError(ErrorTypeTimeout, "fleet run cancelled", ctx.Err())
+			continue
+		}
+
+		select {
+		case <-stop:
+			<-sem
+			report.Results[i].Err = NewError(ErrorTypeDevice, "skipped after an earlier device failed", nil)
+			report.Results[i].Skipped = true
+			continue
+		default:
+		}
+
+		wg.Add(1)
+		go func(res *FleetResult, client *Client) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			dctx := ctx
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				dctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+
+			began := time.Now()
+			res.Value, res.Err = fn(dctx, client)
+			res.Duration = time.Since(began)
+
+			if res.Err != nil && stopOnError {
+				stopOnce.Do(func() { close(stop) })
+			}
+		}(&report.Results[i], d.Client)
+	}
+
+	wg.Wait()
+	report.Duration = time.Since(start)
+
+	return report
+}
+
+// Selector matches device labels. It is parsed from a comma-separated list of
+// requirements: "key=value" (or "=="), "key!=value", "key" (label present)
+// and "!key" (label absent). All requirements must match.
+type Selector []selectorRequirement
+
+type selectorOp int
+
+const (
+	selectorEquals selectorOp = iota
+	selectorNotEquals
+	selectorExists
+	selectorNotExists
+)
+
+type selectorRequirement struct {
+	key   string
+	op    selectorOp
+	value string
+}
+
+// ParseSelector parses a label selector such as "room=kitchen,type!=bulb".
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		var req selectorRequirement
+		switch {
+		case strings.Contains(part, "!="):
+			req.key, req.value, _ = strings.Cut(part, "!=")
+			req.op = selectorNotEquals
+		case strings.Contains(part, "=="):
+			req.key, req.value, _ = strings.Cut(part, "==")
+		case strings.Contains(part, "="):
+			req.key, req.value, _ = strings.Cut(part, "=")
+		case strings.HasPrefix(part, "!"):
+			req.key = part[1:]
+			req.op = selectorNotExists
+		default:
+			req.key = part
+			req.op = selectorExists
+		}
+
+		req.key = strings.TrimSpace(req.key)
+		req.value = strings.TrimSpace(req.value)
+		if req.key == "" {
+			return nil, NewError(ErrorTypeCommand, fmt.Sprintf("invalid selector requirement %q", part), nil)
+		}
+
+		sel = append(sel, req)
+	}
+
+	return sel, nil
+}
+
+// MustParseSelector is like ParseSelector but panics on error.
+func MustParseSelector(s string) Selector {
+	sel, err := ParseSelector(s)
+	if err != nil {
+		panic(err)
+	}
+	return sel
+}
+
+// Matches reports whether labels satisfy every requirement.
+func (s Selector) Matches(labels Labels) bool {
+	for _, req := range s {
+		value, ok := labels[req.key]
+		switch req.op {
+		case selectorEquals:
+			if !ok || value != req.value {
+				return false
+			}
+		case selectorNotEquals:
+			if ok && value == req.value {
+				return false
+			}
+		case selectorExists:
+			if !ok {
+				return false
+			}
+		case selectorNotExists:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// String returns the selector in its parseable form.
+func (s Selector) String() string {
+	parts := make([]string, len(s))
+	for i, req := range s {
+		switch req.op {
+		case selectorEquals:
+			parts[i] = req.key + "=" + req.value
+		case selectorNotEquals:
+			parts[i] = req.key + "!=" + req.value
+		case selectorExists:
+			parts[i] = req.key
+		case selectorNotExists:
+			parts[i] = "!" + req.key
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// Inventory is a list of devices, typically loaded from a JSON file:
+//
+//	{"devices": [{"name": "plug-1", "host": "192.168.1.10", "labels": {"room": "kitchen"}}]}
+type Inventory struct {
+	Devices []InventoryDevice `json:"devices"`
+}
+
+// InventoryDevice describes one device in an Inventory.
+// Username and Password override the credentials passed to NewFleetFromInventory.
+type InventoryDevice struct {
+	Name     string `json:"name"`
+	Host     string `json:"host"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Labels   Labels `json:"labels,omitempty"`
+}
+
+// LoadInventory reads an Inventory from a JSON file.
+func LoadInventory(path string) (*Inventory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, NewError(ErrorTypeCommand, "failed to read inventory", err)
+	}
+
+	var inv Inventory
+	if err := json.Unmarshal(data, &inv); err != nil {
+		return nil, NewError(ErrorTypeParse, "failed to parse inventory", err)
+	}
+
+	return &inv, nil
+}
+
+// NewFleetFromInventory creates a client for every inventory device.
+// Devices without a name are named after their host.
+func NewFleetFromInventory(inv *Inventory, clientOpts []ClientOption, opts ...FleetOption) (*Fleet, error) {
+	if inv == nil {
+		return nil, NewError(ErrorTypeCommand, "inventory cannot be nil", nil)
+	}
+
+	f := NewFleet(opts...)
+
+	for _, d := range inv.Devices {
+		deviceOpts := clientOpts
+		if d.Username != "" || d.Password != "" {
+			deviceOpts = append(deviceOpts[:len(deviceOpts):len(deviceOpts)], WithAuth(d.Username, d.Password))
+		}
+
+		client, err := NewClient(d.Host, deviceOpts...)
+		if err != nil {
+			return nil, err
+		}
+
+		name := d.Name
+		if name == "" {
+			name = d.Host
+		}
+		if err := f.Add(name, client, d.Labels); err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
@@ -0,0 +1,268 @@
+package tasmota
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kradalby/tasmota-go/tasmotatest"
+)
+
+func TestParseSelector(t *testing.T) {
+	labels := Labels{"room": "kitchen", "type": "plug"}
+
+	tests := []struct {
+		selector string
+		want     bool
+		wantErr  bool
+	}{
+		{selector: "", want: true},
+		{selector: "room=kitchen", want: true},
+		{selector: "room==kitchen", want: true},
+		{selector: "room=bedroom", want: false},
+		{selector: "room=kitchen, type!=bulb", want: true},
+		{selector: "type!=plug", want: false},
+		{selector: "floor!=1", want: true},
+		{selector: "type", want: true},
+		{selector: "floor", want: false},
+		{selector: "!floor", want: true},
+		{selector: "!room", want: false},
+		{selector: "=kitchen", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			sel, err := ParseSelector(tt.selector)
+			if tt.wantErr {
+				if !IsCommandError(err) {
+					t.Errorf("ParseSelector() error = %v, want command error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSelector() error: %v", err)
+			}
+			if got := sel.Matches(labels); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := MustParseSelector("room == kitchen,!floor,type").String(); got != "room=kitchen,!floor,type" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestFleet_AddRemove(t *testing.T) {
+	f := NewFleet()
+	client := &Client{}
+
+	if err := f.Add("plug-1", client, Labels{"room": "kitchen"}); err != nil {
+		t.Fatalf("Add() error: %v", err)
+	}
+	if err := f.Add("plug-1", client, nil); !IsCommandError(err) {
+		t.Errorf("Add() duplicate error = %v, want command error", err)
+	}
+	if err := f.Add("", client, nil); !IsCommandError(err) {
+		t.Errorf("Add() empty name error = %v, want command error", err)
+	}
+	if err := f.Add("plug-2", nil, nil); !IsCommandError(err) {
+		t.Errorf("Add() nil client error = %v, want command error", err)
+	}
+
+	if d, ok := f.Device("plug-1"); !ok || d.Labels["room"] != "kitchen" {
+		t.Errorf("Device() = %+v, %v", d, ok)
+	}
+	if !f.Remove("plug-1") || f.Remove("plug-1") || f.Len() != 0 {
+		t.Error("Remove() did not remove exactly once")
+	}
+}
+
+func TestFleet_Run(t *testing.T) {
+	f := NewFleet(WithFleetConcurrency(2))
+	servers := make(map[string]*tasmotatest.Server)
+
+	for i := range 5 {
+		srv := tasmotatest.NewServer()
+		t.Cleanup(srv.Close)
+		srv.Update(func(s *tasmotatest.State) { s.Relays[0] = true })
+
+		name := fmt.Sprintf("plug-%d", i)
+		servers[name] = srv
+
+		client, err := NewClient(srv.URL)
+		if err != nil {
+			t.Fatalf("NewClient() error: %v", err)
+		}
+		room := "kitchen"
+		if i%2 == 1 {
+			room = "bedroom"
+		}
+		if err := f.Add(name, client, Labels{"room": room}); err != nil {
+			t.Fatalf("Add() error: %v", err)
+		}
+	}
+
+	var inFlight, maxInFlight atomic.Int32
+	report := f.Run(context.Background(), MustParseSelector("room=kitchen"),
+		FleetAction(func(ctx context.Context, c *Client) error {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				m := maxInFlight.Load()
+				if n <= m || maxInFlight.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			return c.SetPowerOff(ctx, 0)
+		}),
+	)
+
+	if err := report.Err(); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if peak := maxInFlight.Load(); peak > 2 {
+		t.Errorf("max in flight = %d, want <= 2", peak)
+	}
+
+	wantDevices := []string{"plug-0", "plug-2", "plug-4"}
+	if len(report.Results) != len(wantDevices) {
+		t.Fatalf("len(Results) = %d, want %d", len(report.Results), len(wantDevices))
+	}
+	for i, res := range report.Results {
+		if res.Device != wantDevices[i] {
+			t.Errorf("Results[%d].Device = %s, want %s", i, res.Device, wantDevices[i])
+		}
+	}
+
+	for name, srv := range servers {
+		wantOn := name == "plug-1" || name == "plug-3"
+		if on := srv.State().Relays[0]; on != wantOn {
+			t.Errorf("%s relay on = %v, want %v", name, on, wantOn)
+		}
+	}
+
+	statuses := f.Run(context.Background(), nil, func(ctx context.Context, c *Client) (any, error) {
+		return c.GetDeviceInfo(ctx)
+	})
+	if len(statuses.Succeeded()) != 5 {
+		t.Errorf("Succeeded() = %d, want 5", len(statuses.Succeeded()))
+	}
+	if info, ok := statuses.Results[0].Value.(*StatusInfo); !ok || info.DeviceName != "Tasmota" {
+		t.Errorf("Value = %#v, want *StatusInfo", statuses.Results[0].Value)
+	}
+}
+
+func TestFleet_RunTimeout(t *testing.T) {
+	f := NewFleet(WithDeviceTimeout(20 * time.Millisecond))
+	_ = f.Add("fast", &Client{}, nil)
+	_ = f.Add("slow", &Client{}, nil)
+
+	report := f.Run(context.Background(), nil, FleetAction(func(ctx context.Context, c *Client) error {
+		if c == mustDevice(t, f, "fast").Client {
+			return nil
+		}
+		<-ctx.Done()
+		return NewError(ErrorTypeTimeout, "request timeout", ctx.Err())
+	}))
+
+	failed := report.Failed()
+	if len(failed) != 1 || failed[0].Device != "slow" || !IsTimeoutError(failed[0].Err) {
+		t.Fatalf("Failed() = %+v, want slow with timeout error", failed)
+	}
+	if err := report.Err(); !IsDeviceError(err) {
+		t.Errorf("Err() = %v, want device error", err)
+	}
+}
+
+func TestFleet_RunStopOnError(t *testing.T) {
+	f := NewFleet(WithFleetConcurrency(1), WithStopOnError())
+	for _, name := range []string{"a", "b", "c"} {
+		_ = f.Add(name, &Client{}, nil)
+	}
+
+	var calls atomic.Int32
+	report := f.Run(context.Background(), nil, FleetAction(func(ctx context.Context, c *Client) error {
+		if calls.Add(1) == 2 {
+			return NewError(ErrorTypeDevice, "upgrade failed", nil)
+		}
+		return nil
+	}))
+
+	if n := calls.Load(); n != 2 {
+		t.Errorf("calls = %d, want 2", n)
+	}
+	res := report.Results
+	if res[0].Err != nil || res[1].Err == nil || res[1].Skipped || !res[2].Skipped || !IsDeviceError(res[2].Err) {
+		t.Errorf("Results = %+v, want a ok, b failed, c skipped", res)
+	}
+}
+
+func mustDevice(t *testing.T, f *Fleet, name string) *FleetDevice {
+	t.Helper()
+	d, ok := f.Device(name)
+	if !ok {
+		t.Fatalf("device %s not in fleet", name)
+	}
+	return d
+}
+
+func TestNewFleetFromInventory(t *testing.T) {
+	srv := tasmotatest.NewServer(tasmotatest.WithAuth("admin", "override"))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "fleet.json")
+	inventory := fmt.Sprintf(`{"devices": [
+		{"name": "plug-1", "host": %q, "username": "admin", "password": "override", "labels": {"room": "kitchen"}},
+		{"host": "192.168.1.20"}
+	]}`, srv.URL)
+	if err := os.WriteFile(path, []byte(inventory), 0o600); err != nil {
+		t.Fatalf("WriteFile() error: %v", err)
+	}
+
+	inv, err := LoadInventory(path)
+	if err != nil {
+		t.Fatalf("LoadInventory() error: %v", err)
+	}
+
+	f, err := NewFleetFromInventory(inv, []ClientOption{WithAuth("admin", "default")})
+	if err != nil {
+		t.Fatalf("NewFleetFromInventory() error: %v", err)
+	}
+	if f.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", f.Len())
+	}
+	if _, ok := f.Device("192.168.1.20"); !ok {
+		t.Error("unnamed device not registered under its host")
+	}
+
+	report := f.Run(context.Background(), MustParseSelector("room=kitchen"), FleetAction(func(ctx context.Context, c *Client) error {
+		return c.SetPowerOn(ctx, 0)
+	}))
+	if err := report.Err(); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if !srv.State().Relays[0] {
+		t.Error("relay not switched with per-device credentials")
+	}
+
+	// Saving a loaded inventory keeps the credentials
+	data, err := json.Marshal(inv)
+	if err != nil {
+		t.Fatalf("Marshal() error: %v", err)
+	}
+	if !strings.Contains(string(data), `"password":"override"`) {
+		t.Errorf("Marshal() = %s, want the password kept", data)
+	}
+
+	if _, err := LoadInventory(filepath.Join(t.TempDir(), "missing.json")); !IsCommandError(err) {
+		t.Errorf("LoadInventory() error = %v, want command error", err)
+	}
+}
@@ -0,0 +1,211 @@
+package tasmota
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/kradalby/tasmota-go/tasmotatest"
+)
+
+func newTestDevice(t *testing.T, opts ...tasmotatest.Option) (*tasmotatest.Server, *Client) {
+	t.Helper()
+
+	srv := tasmotatest.NewServer(append(opts, tasmotatest.WithAuth("admin", "secret"))...)
+	t.Cleanup(srv.Close)
+
+	client, err := NewClient(srv.URL, WithAuth("admin", "secret"))
+	if err != nil {
+		t.Fatalf("NewClient() error: %v", err)
+	}
+
+	return srv, client
+}
+
+func TestIntegration_ApplyConfig(t *testing.T) {
+	srv, client := newTestDevice(t, tasmotatest.WithRelays(2))
+	ctx := context.Background()
+
+	err := client.ApplyConfig(ctx, &DeviceConfig{
+		DeviceName:   "Kitchen",
+		FriendlyName: []string{"Counter", "Island"},
+		PowerOnState: PowerOnStateOn,
+		LedState:     LedStateOff,
+		Sleep:        100,
+		PowerRetain:  1,
+	})
+	if err != nil {
+		t.Fatalf("ApplyConfig() error: %v", err)
+	}
+
+	state := srv.State()
+	if state.DeviceName != "Kitchen" {
+		t.Errorf("DeviceName = %q, want Kitchen", state.DeviceName)
+	}
+	if !reflect.DeepEqual(state.FriendlyName, []string{"Counter", "Island"}) {
+		t.Errorf("FriendlyName = %q, want [Counter Island]", state.FriendlyName)
+	}
+	if state.PowerOnState != 1 || state.LedState != 0 || state.Sleep != 100 || state.PowerRetain != 1 {
+		t.Errorf("state = %+v, want PowerOnState 1, LedState 0, Sleep 100, PowerRetain 1", state)
+	}
+
+	// The client reads back what it wrote
+	config, err := client.GetConfig(ctx)
+	if err != nil {
+		t.Fatalf("GetConfig() error: %v", err)
+	}
+	if config.DeviceName != "Kitchen" || config.PowerOnState != PowerOnStateOn || config.PowerRetain != 1 {
+		t.Errorf("GetConfig() = %+v", config)
+	}
+}
+
+func TestIntegration_SetMQTTConfig(t *testing.T) {
+	srv, client := newTestDevice(t)
+	ctx := context.Background()
+
+	srv.Update(func(s *tasmotatest.State) { s.MQTT.Enabled = false })
+
+	err := client.SetMQTTConfig(ctx, &MQTTConfig{
+		Host:       "mqtt.home",
+		Port:       8883,
+		User:       "tasmota",
+		Password:   "hunter2",
+		Topic:      "kitchen",
+		FullTopic:  "home/%prefix%/%topic%/",
+		GroupTopic: "lights",
+		Prefix3:    "telemetry",
+		TelePeriod: 60,
+	})
+	if err != nil {
+		t.Fatalf("SetMQTTConfig() error: %v", err)
+	}
+
+	state := srv.State()
+	want := tasmotatest.MQTTState{
+		Enabled:    true,
+		Host:       "mqtt.home",
+		Port:       8883,
+		User:       "tasmota",
+		Password:   "hunter2",
+		Client:     state.MQTT.Client,
+		Topic:      "kitchen",
+		FullTopic:  "home/%prefix%/%topic%/",
+		GroupTopic: "lights",
+		Prefix:     [3]string{"cmnd", "stat", "telemetry"},
+	}
+	if state.MQTT != want {
+		t.Errorf("MQTT = %+v, want %+v", state.MQTT, want)
+	}
+	if state.TelePeriod != 60 {
+		t.Errorf("TelePeriod = %d, want 60", state.TelePeriod)
+	}
+
+	config, err := client.GetMQTTConfig(ctx)
+	if err != nil {
+		t.Fatalf("GetMQTTConfig() error: %v", err)
+	}
+	if config.Host != "mqtt.home" || config.Port != 8883 || config.Topic != "kitchen" {
+		t.Errorf("GetMQTTConfig() = %+v", config)
+	}
+
+	if err := client.EnableMQTT(ctx, false); err != nil {
+		t.Fatalf("EnableMQTT() error: %v", err)
+	}
+	if srv.State().MQTT.Enabled {
+		t.Error("MQTT still enabled after EnableMQTT(false)")
+	}
+}
+
+func TestIntegration_SetNetworkConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *NetworkConfig
+		want   tasmotatest.NetworkState
+	}{
+		{
+			name: "static",
+			config: &NetworkConfig{
+				Hostname:  "kitchen",
+				IPAddress: MustParseIPAddr("10.0.0.20"),
+				Gateway:   MustParseIPAddr("10.0.0.1"),
+				Subnet:    MustParseIPAddr("255.255.0.0"),
+				DNSServer: MustParseIPAddr("10.0.0.53"),
+				SSID1:     "home",
+				Password1: "wifipass",
+			},
+			want: tasmotatest.NetworkState{
+				Hostname:  "kitchen",
+				IPAddress: "10.0.0.20",
+				Gateway:   "10.0.0.1",
+				Subnet:    "255.255.0.0",
+				DNSServer: "10.0.0.53",
+				SSID:      [2]string{"home", ""},
+				Password:  [2]string{"wifipass", ""},
+			},
+		},
+		{
+			name: "dhcp",
+			config: &NetworkConfig{
+				UseDHCP: true,
+				SSID2:   "backup",
+			},
+			want: tasmotatest.NetworkState{
+				Hostname:  "tasmota-123456",
+				IPAddress: "0.0.0.0",
+				Gateway:   "192.168.1.1",
+				Subnet:    "255.255.255.0",
+				DNSServer: "192.168.1.1",
+				SSID:      [2]string{"", "backup"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, client := newTestDevice(t)
+			ctx := context.Background()
+
+			if err := client.SetNetworkConfig(ctx, tt.config); err != nil {
+				t.Fatalf("SetNetworkConfig() error: %v", err)
+			}
+
+			got := srv.State().Network
+			tt.want.MAC = got.MAC
+			if got != tt.want {
+				t.Errorf("Network = %+v, want %+v", got, tt.want)
+			}
+
+			config, err := client.GetNetworkConfig(ctx)
+			if err != nil {
+				t.Fatalf("GetNetworkConfig() error: %v", err)
+			}
+			if config.UseDHCP != tt.config.UseDHCP || config.Hostname != tt.want.Hostname {
+				t.Errorf("GetNetworkConfig() = %+v", config)
+			}
+		})
+	}
+}
+
+func TestIntegration_Power(t *testing.T) {
+	srv, client := newTestDevice(t, tasmotatest.WithRelays(2))
+	ctx := context.Background()
+
+	if err := client.SetPowerOn(ctx, 2); err != nil {
+		t.Fatalf("SetPowerOn() error: %v", err)
+	}
+	if err := client.TogglePower(ctx, 1); err != nil {
+		t.Fatalf("TogglePower() error: %v", err)
+	}
+
+	if got := srv.State().Relays; !reflect.DeepEqual(got, []bool{true, true}) {
+		t.Errorf("Relays = %v, want [true true]", got)
+	}
+
+	on, err := client.IsPowerOn(ctx, 2)
+	if err != nil {
+		t.Fatalf("IsPowerOn() error: %v", err)
+	}
+	if !on {
+		t.Error("IsPowerOn(2) = false, want true")
+	}
+}
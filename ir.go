@@ -0,0 +1,426 @@
+package tasmota
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// IRCode is a decoded infrared code, as sent with IRSend and reported in
+// IrReceived.
+type IRCode struct {
+	// Protocol is the IRremoteESP8266 protocol name, such as "NEC" or "SONY".
+	Protocol string `json:"Protocol"`
+	// Bits is the code length; 0 uses the protocol default.
+	Bits int `json:"Bits,omitempty"`
+	// Data is the code in hex with a 0x prefix. It is a string because
+	// some protocols have codes longer than 64 bits.
+	Data string `json:"Data"`
+	// Repeat is how many times the code is repeated after the first.
+	Repeat int `json:"Repeat,omitempty"`
+}
+
+// Validate checks the code can be sent.
+func (c *IRCode) Validate() error {
+	if c.Protocol == "" || strings.EqualFold(c.Protocol, "UNKNOWN") {
+		return NewError(ErrorTypeCommand, "IR code needs a protocol", nil)
+	}
+	if c.Bits < 0 || c.Repeat < 0 {
+		return NewError(ErrorTypeCommand, "IR bits and repeat cannot be negative", nil)
+	}
+	if !isHexData(c.Data) {
+		return NewError(ErrorTypeCommand, fmt.Sprintf("IR data must be hex with a 0x prefix, got %q", c.Data), nil)
+	}
+	return nil
+}
+
+func isHexData(s string) bool {
+	digits, ok := strings.CutPrefix(strings.ToLower(s), "0x")
+	if !ok || digits == "" {
+		return false
+	}
+	return strings.Trim(digits, "0123456789abcdef") == ""
+}
+
+// IRRaw is an infrared signal as mark and space durations.
+type IRRaw struct {
+	// Frequency is the carrier in Hz; 0 uses 38 kHz.
+	Frequency int
+	// Timings are alternating mark and space durations in microseconds,
+	// starting with a mark.
+	Timings []int
+}
+
+// Validate checks the signal can be sent.
+func (r *IRRaw) Validate() error {
+	if r.Frequency != 0 && (r.Frequency < 10000 || r.Frequency > 500000) {
+		return NewError(ErrorTypeCommand, "IR frequency must be 0 or between 10 and 500 kHz", nil)
+	}
+	if len(r.Timings) == 0 {
+		return NewError(ErrorTypeCommand, "IR raw signal needs timings", nil)
+	}
+	for _, t := range r.Timings {
+		if t <= 0 || t > 65535 {
+			return NewError(ErrorTypeCommand, fmt.Sprintf("invalid IR timing %d", t), nil)
+		}
+	}
+	return nil
+}
+
+// HVACMode is the operating mode of an air conditioner.
+type HVACMode string
+
+// HVAC modes.
+const (
+	HVACOff  HVACMode = "Off"
+	HVACAuto HVACMode = "Auto"
+	HVACCool HVACMode = "Cool"
+	HVACHeat HVACMode = "Heat"
+	HVACDry  HVACMode = "Dry"
+	HVACFan  HVACMode = "Fan"
+)
+
+// HVACFanSpeed is the fan speed of an air conditioner.
+type HVACFanSpeed string
+
+// HVAC fan speeds.
+const (
+	FanAuto   HVACFanSpeed = "Auto"
+	FanMin    HVACFanSpeed = "Min"
+	FanLow    HVACFanSpeed = "Low"
+	FanMedium HVACFanSpeed = "Medium"
+	FanHigh   HVACFanSpeed = "High"
+	FanMax    HVACFanSpeed = "Max"
+)
+
+// HVACSwingV is the vertical vane position of an air conditioner.
+type HVACSwingV string
+
+// HVAC vertical vane positions.
+const (
+	SwingVOff     HVACSwingV = "Off"
+	SwingVAuto    HVACSwingV = "Auto"
+	SwingVHighest HVACSwingV = "Highest"
+	SwingVHigh    HVACSwingV = "High"
+	SwingVMiddle  HVACSwingV = "Middle"
+	SwingVLow     HVACSwingV = "Low"
+	SwingVLowest  HVACSwingV = "Lowest"
+)
+
+// HVACSwingH is the horizontal vane position of an air conditioner.
+type HVACSwingH string
+
+// HVAC horizontal vane positions.
+const (
+	SwingHOff      HVACSwingH = "Off"
+	SwingHAuto     HVACSwingH = "Auto"
+	SwingHLeftMax  HVACSwingH = "LeftMax"
+	SwingHLeft     HVACSwingH = "Left"
+	SwingHMiddle   HVACSwingH = "Middle"
+	SwingHRight    HVACSwingH = "Right"
+	SwingHRightMax HVACSwingH = "RightMax"
+	SwingHWide     HVACSwingH = "Wide"
+)
+
+// HVACVendors lists the air conditioner protocols IRHVAC supports.
+var HVACVendors = []string{
+	"AIRTON", "AIRWELL", "AMCOR", "ARGO", "BOSCH144", "CARRIER_AC64",
+	"COOLIX", "CORONA_AC", "DAIKIN", "DAIKIN128", "DAIKIN152", "DAIKIN160",
+	"DAIKIN176", "DAIKIN2", "DAIKIN200", "DAIKIN216", "DAIKIN312", "DAIKIN64",
+	"DELONGHI_AC", "ECOCLIM", "ELECTRA_AC", "FUJITSU_AC", "GOODWEATHER",
+	"GREE", "HAIER_AC", "HAIER_AC160", "HAIER_AC176", "HAIER_AC_YRW02",
+	"HITACHI_AC", "HITACHI_AC1", "HITACHI_AC264", "HITACHI_AC296",
+	"HITACHI_AC344", "HITACHI_AC424", "KELON", "KELVINATOR", "LG", "LG2",
+	"MIDEA", "MIRAGE", "MITSUBISHI112", "MITSUBISHI136", "MITSUBISHI_AC",
+	"MITSUBISHI_HEAVY_152", "MITSUBISHI_HEAVY_88", "NEOCLIMA",
+	"PANASONIC_AC", "PANASONIC_AC32", "RHOSS", "SAMSUNG_AC", "SANYO_AC",
+	"SANYO_AC88", "SHARP_AC", "TCL112AC", "TECHNIBEL_AC", "TECO",
+	"TEKNOPOINT", "TOSHIBA_AC", "TRANSCOLD", "TROTEC", "TROTEC_3550",
+	"TRUMA", "VESTEL_AC", "VOLTAS", "WHIRLPOOL_AC", "YORK",
+}
+
+// IRHVAC is the state sent to an air conditioner with IRHVAC. Empty
+// enumerations and a zero Model are left to the device defaults.
+type IRHVAC struct {
+	// Vendor is one of HVACVendors, matched case-insensitively.
+	Vendor string
+	// Model selects a protocol variant; 0 uses the default.
+	Model    int
+	Power    bool
+	Mode     HVACMode
+	Temp     float64
+	FanSpeed HVACFanSpeed
+	SwingV   HVACSwingV
+	SwingH   HVACSwingH
+	// Fahrenheit interprets Temp in Fahrenheit instead of Celsius.
+	Fahrenheit bool
+	Quiet      bool
+	Turbo      bool
+	Econo      bool
+	Light      bool
+	Filter     bool
+	Clean      bool
+	Beep       bool
+	// Sleep is the sleep timer in minutes; 0 turns it off.
+	Sleep int
+}
+
+// Validate checks the vendor, the enumerations and the temperature range.
+func (h *IRHVAC) Validate() error {
+	if !slices.Contains(HVACVendors, strings.ToUpper(h.Vendor)) {
+		return NewError(ErrorTypeCommand, fmt.Sprintf("unknown HVAC vendor %q", h.Vendor), nil)
+	}
+	checks := []struct {
+		name  string
+		value string
+		valid []string
+	}{
+		{"mode", string(h.Mode), []string{"Off", "Auto", "Cool", "Heat", "Dry", "Fan"}},
+		{"fan speed", string(h.FanSpeed), []string{"Auto", "Min", "Low", "Medium", "High", "Max"}},
+		{"vertical swing", string(h.SwingV), []string{"Off", "Auto", "Highest", "High", "Middle", "Low", "Lowest"}},
+		{"horizontal swing", string(h.SwingH), []string{"Off", "Auto", "LeftMax", "Left", "Middle", "Right", "RightMax", "Wide"}},
+	}
+	for _, c := range checks {
+		if c.value != "" && !slices.Contains(c.valid, c.value) {
+			return NewError(ErrorTypeCommand, fmt.Sprintf("invalid HVAC %s %q, want one of %s", c.name, c.value, strings.Join(c.valid, ", ")), nil)
+		}
+	}
+
+	lo, hi := 10.0, 32.0
+	if h.Fahrenheit {
+		lo, hi = 50, 90
+	}
+	if h.Temp != 0 && (h.Temp < lo || h.Temp > hi) {
+		return NewError(ErrorTypeCommand, fmt.Sprintf("HVAC temperature must be between %g and %g", lo, hi), nil)
+	}
+	if h.Sleep < 0 {
+		return NewError(ErrorTypeCommand, "HVAC sleep cannot be negative", nil)
+	}
+	return nil
+}
+
+// hvacJSON is the IRHVAC wire format, with "On" and "Off" for booleans.
+type hvacJSON struct {
+	Vendor   string       `json:"Vendor"`
+	Model    int          `json:"Model,omitempty"`
+	Power    onOffFlag    `json:"Power"`
+	Mode     HVACMode     `json:"Mode,omitempty"`
+	Celsius  onOffFlag    `json:"Celsius"`
+	Temp     float64      `json:"Temp,omitempty"`
+	FanSpeed HVACFanSpeed `json:"FanSpeed,omitempty"`
+	SwingV   HVACSwingV   `json:"SwingV,omitempty"`
+	SwingH   HVACSwingH   `json:"SwingH,omitempty"`
+	Quiet    onOffFlag    `json:"Quiet"`
+	Turbo    onOffFlag    `json:"Turbo"`
+	Econo    onOffFlag    `json:"Econo"`
+	Light    onOffFlag    `json:"Light"`
+	Filter   onOffFlag    `json:"Filter"`
+	Clean    onOffFlag    `json:"Clean"`
+	Beep     onOffFlag    `json:"Beep"`
+	Sleep    int          `json:"Sleep"`
+}
+
+// MarshalJSON encodes the state as an IRHVAC payload.
+func (h IRHVAC) MarshalJSON() ([]byte, error) {
+	sleep := h.Sleep
+	if sleep == 0 {
+		sleep = -1
+	}
+	return json.Marshal(hvacJSON{
+		Vendor: strings.ToUpper(h.Vendor), Model: h.Model, Power: onOffFlag(h.Power), Mode: h.Mode,
+		Celsius: onOffFlag(!h.Fahrenheit), Temp: h.Temp, FanSpeed: h.FanSpeed, SwingV: h.SwingV, SwingH: h.SwingH,
+		Quiet: onOffFlag(h.Quiet), Turbo: onOffFlag(h.Turbo), Econo: onOffFlag(h.Econo), Light: onOffFlag(h.Light),
+		Filter: onOffFlag(h.Filter), Clean: onOffFlag(h.Clean), Beep: onOffFlag(h.Beep), Sleep: sleep,
+	})
+}
+
+// UnmarshalJSON decodes an IRHVAC payload, as echoed by the device or
+// reported in IrReceived.
+func (h *IRHVAC) UnmarshalJSON(data []byte) error {
+	w := hvacJSON{Celsius: true}
+	if err := json.Unmarshal(data, &w); err != nil {
+		return err
+	}
+	*h = IRHVAC{
+		Vendor: w.Vendor, Model: max(w.Model, 0), Power: bool(w.Power), Mode: w.Mode,
+		Fahrenheit: !bool(w.Celsius), Temp: w.Temp, FanSpeed: w.FanSpeed, SwingV: w.SwingV, SwingH: w.SwingH,
+		Quiet: bool(w.Quiet), Turbo: bool(w.Turbo), Econo: bool(w.Econo), Light: bool(w.Light),
+		Filter: bool(w.Filter), Clean: bool(w.Clean), Beep: bool(w.Beep), Sleep: max(w.Sleep, 0),
+	}
+	return nil
+}
+
+// onOffFlag is a boolean encoded as "On" or "Off".
+type onOffFlag bool
+
+func (f onOffFlag) MarshalJSON() ([]byte, error) {
+	if f {
+		return []byte(`"On"`), nil
+	}
+	return []byte(`"Off"`), nil
+}
+
+func (f *onOffFlag) UnmarshalJSON(data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case bool:
+		*f = onOffFlag(v)
+	case float64:
+		*f = v != 0
+	case string:
+		switch strings.ToLower(v) {
+		case "on", "1", "true", "yes":
+			*f = true
+		case "off", "0", "false", "no", "":
+			*f = false
+		default:
+			return fmt.Errorf("invalid on/off value %q", v)
+		}
+	}
+	return nil
+}
+
+// IRReceived is a code decoded from an IrReceived message. Codes with a
+// known protocol can be replayed with SendIR; others only with SendIRRaw,
+// which needs the raw timings reported with SetOption58 1.
+type IRReceived struct {
+	IRCode
+	// DataLSB is Data with the bit order of each byte reversed.
+	DataLSB string `json:"DataLSB,omitempty"`
+	// Hash identifies codes of an unknown protocol.
+	Hash    string `json:"Hash,omitempty"`
+	RawData []int  `json:"RawData,omitempty"`
+	// HVAC is the decoded air conditioner state for HVAC protocols.
+	HVAC *IRHVAC `json:"IRHVAC,omitempty"`
+}
+
+// Known reports whether the protocol was recognized.
+func (r *IRReceived) Known() bool {
+	return r.Protocol != "" && !strings.EqualFold(r.Protocol, "UNKNOWN")
+}
+
+// Raw returns the received timings for replay with SendIRRaw.
+func (r *IRReceived) Raw() (*IRRaw, bool) {
+	if len(r.RawData) == 0 {
+		return nil, false
+	}
+	timings := make([]int, len(r.RawData))
+	for i, t := range r.RawData {
+		timings[i] = max(t, -t)
+	}
+	return &IRRaw{Timings: timings}, true
+}
+
+// ParseIrReceived decodes the IrReceived message in a RESULT payload.
+func ParseIrReceived(payload []byte) (*IRReceived, error) {
+	var resp struct {
+		IrReceived *struct {
+			IRReceived
+			// Data is a number when SetOption69 is off and the code fits
+			Data json.RawMessage `json:"Data"`
+			// RawData is an array of timings or, in compact form, a string
+			RawData json.RawMessage `json:"RawData"`
+		} `json:"IrReceived"`
+	}
+	if err := unmarshalJSON(payload, &resp); err != nil {
+		return nil, err
+	}
+	if resp.IrReceived == nil {
+		return nil, NewError(ErrorTypeParse, "payload has no IrReceived", nil)
+	}
+
+	received := resp.IrReceived.IRReceived
+	if data := resp.IrReceived.Data; len(data) > 0 {
+		var n uint64
+		if err := json.Unmarshal(data, &n); err == nil {
+			received.Data = fmt.Sprintf("0x%X", n)
+		} else if err := unmarshalJSON(data, &received.Data); err != nil {
+			return nil, err
+		}
+	}
+	if raw := resp.IrReceived.RawData; len(raw) > 0 && raw[0] == '[' {
+		if err := unmarshalJSON(raw, &received.RawData); err != nil {
+			return nil, err
+		}
+	}
+	return &received, nil
+}
+
+// SendIR sends a decoded code with IRSend.
+func (c *Client) SendIR(ctx context.Context, code IRCode) error {
+	if err := code.Validate(); err != nil {
+		return err
+	}
+	code.Protocol = strings.ToUpper(code.Protocol)
+	data, err := json.Marshal(code)
+	if err != nil {
+		return NewError(ErrorTypeCommand, "failed to encode IR code", err)
+	}
+	_, err = c.irCommand(ctx, "IRSend", string(data))
+	return err
+}
+
+// SendIRRaw sends raw timings with IRSend.
+func (c *Client) SendIRRaw(ctx context.Context, raw IRRaw) error {
+	if err := raw.Validate(); err != nil {
+		return err
+	}
+	parts := make([]string, 0, len(raw.Timings)+1)
+	parts = append(parts, strconv.Itoa(raw.Frequency))
+	for _, t := range raw.Timings {
+		parts = append(parts, strconv.Itoa(t))
+	}
+	_, err := c.irCommand(ctx, "IRSend", strings.Join(parts, ","))
+	return err
+}
+
+// SendIRHVAC sends an air conditioner state and returns the state the
+// device encoded, with its defaults filled in.
+func (c *Client) SendIRHVAC(ctx context.Context, hvac *IRHVAC) (*IRHVAC, error) {
+	if err := hvac.Validate(); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(hvac)
+	if err != nil {
+		return nil, NewError(ErrorTypeCommand, "failed to encode IRHVAC", err)
+	}
+	value, err := c.irCommand(ctx, "IRHVAC", string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(value) == 0 || value[0] != '{' {
+		return hvac, nil
+	}
+	var sent IRHVAC
+	if err := unmarshalJSON(value, &sent); err != nil {
+		return nil, err
+	}
+	return &sent, nil
+}
+
+// irCommand runs an IR command and returns the value under its name. The
+// device answers "Done" or the sent state on success, and a message such
+// as "Protocol not supported" on failure.
+func (c *Client) irCommand(ctx context.Context, name, payload string) (json.RawMessage, error) {
+	raw, err := c.ExecuteCommand(ctx, name+" "+payload)
+	if err != nil {
+		return nil, err
+	}
+	var resp map[string]json.RawMessage
+	if err := unmarshalJSON(raw, &resp); err != nil {
+		return nil, err
+	}
+	value := resp[name]
+	var msg string
+	if json.Unmarshal(value, &msg) == nil && !strings.EqualFold(msg, "Done") {
+		return nil, NewError(ErrorTypeCommand, fmt.Sprintf("%s failed: %s", name, msg), nil)
+	}
+	return value, nil
+}
@@ -0,0 +1,186 @@
+package tasmota
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kradalby/tasmota-go/tasmotatest"
+)
+
+func TestIRCode_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    IRCode
+		wantErr bool
+	}{
+		{"nec", IRCode{Protocol: "NEC", Bits: 32, Data: "0x20DF10EF"}, false},
+		{"long data", IRCode{Protocol: "DAIKIN", Data: "0x11DA2700C50000D711DA27004200"}, false},
+		{"no protocol", IRCode{Data: "0x1"}, true},
+		{"unknown protocol", IRCode{Protocol: "UNKNOWN", Data: "0x1"}, true},
+		{"no prefix", IRCode{Protocol: "NEC", Data: "20DF10EF"}, true},
+		{"not hex", IRCode{Protocol: "NEC", Data: "0xZZ"}, true},
+		{"negative repeat", IRCode{Protocol: "NEC", Data: "0x1", Repeat: -1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.code.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIRHVAC_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		hvac    IRHVAC
+		wantErr bool
+	}{
+		{"minimal", IRHVAC{Vendor: "daikin"}, false},
+		{"full", IRHVAC{Vendor: "MITSUBISHI_AC", Power: true, Mode: HVACCool, Temp: 22.5, FanSpeed: FanHigh, SwingV: SwingVAuto, SwingH: SwingHWide}, false},
+		{"fahrenheit", IRHVAC{Vendor: "GREE", Temp: 72, Fahrenheit: true}, false},
+		{"unknown vendor", IRHVAC{Vendor: "ACME"}, true},
+		{"bad mode", IRHVAC{Vendor: "GREE", Mode: "cool"}, true},
+		{"bad fan", IRHVAC{Vendor: "GREE", FanSpeed: "Turbo"}, true},
+		{"bad swing", IRHVAC{Vendor: "GREE", SwingH: "Up"}, true},
+		{"too hot", IRHVAC{Vendor: "GREE", Temp: 40}, true},
+		{"celsius as fahrenheit", IRHVAC{Vendor: "GREE", Temp: 22, Fahrenheit: true}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.hvac.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIRHVAC_JSON(t *testing.T) {
+	hvac := IRHVAC{Vendor: "daikin", Power: true, Mode: HVACHeat, Temp: 21, Turbo: true, Sleep: 30}
+	data, err := json.Marshal(hvac)
+	if err != nil {
+		t.Fatalf("Marshal() error: %v", err)
+	}
+	for _, want := range []string{`"Vendor":"DAIKIN"`, `"Power":"On"`, `"Celsius":"On"`, `"Quiet":"Off"`, `"Turbo":"On"`, `"Sleep":30`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Marshal() = %s, missing %s", data, want)
+		}
+	}
+	if strings.Contains(string(data), "Model") {
+		t.Errorf("Marshal() = %s, want no Model", data)
+	}
+
+	var got IRHVAC
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal() error: %v", err)
+	}
+	hvac.Vendor = "DAIKIN"
+	if got != hvac {
+		t.Errorf("round trip = %+v, want %+v", got, hvac)
+	}
+
+	if err := json.Unmarshal([]byte(`{"Vendor":"GREE","Model":-1,"Celsius":"Off","Sleep":-1}`), &got); err != nil {
+		t.Fatalf("Unmarshal() error: %v", err)
+	}
+	if got.Model != 0 || got.Sleep != 0 || !got.Fahrenheit {
+		t.Errorf("Unmarshal() defaults = %+v", got)
+	}
+}
+
+func TestParseIrReceived(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    *IRReceived
+		wantErr bool
+	}{
+		{
+			name:    "nec",
+			payload: `{"IrReceived":{"Protocol":"NEC","Bits":32,"Data":"0x00FF906F","DataLSB":"0x00FF09F6","Repeat":0}}`,
+			want:    &IRReceived{IRCode: IRCode{Protocol: "NEC", Bits: 32, Data: "0x00FF906F"}, DataLSB: "0x00FF09F6"},
+		},
+		{
+			name:    "decimal data",
+			payload: `{"IrReceived":{"Protocol":"SONY","Bits":12,"Data":2704}}`,
+			want:    &IRReceived{IRCode: IRCode{Protocol: "SONY", Bits: 12, Data: "0xA90"}},
+		},
+		{
+			name:    "unknown with raw data",
+			payload: `{"IrReceived":{"Protocol":"UNKNOWN","Bits":26,"Hash":"0x7E9D5D0C","RawData":[3000,-1000,500,-500]}}`,
+			want:    &IRReceived{IRCode: IRCode{Protocol: "UNKNOWN", Bits: 26}, Hash: "0x7E9D5D0C", RawData: []int{3000, -1000, 500, -500}},
+		},
+		{
+			name:    "compact raw data",
+			payload: `{"IrReceived":{"Protocol":"UNKNOWN","Bits":26,"Hash":"0x7E9D5D0C","RawData":"+3000-1000A"}}`,
+			want:    &IRReceived{IRCode: IRCode{Protocol: "UNKNOWN", Bits: 26}, Hash: "0x7E9D5D0C"},
+		},
+		{
+			name: "hvac",
+			payload: `{"IrReceived":{"Protocol":"COOLIX","Bits":24,"Data":"0xB21FD8","IRHVAC":{"Vendor":"COOLIX","Model":-1,` +
+				`"Power":"On","Mode":"Cool","Celsius":"On","Temp":24,"FanSpeed":"Auto","SwingV":"Off","SwingH":"Off","Sleep":-1}}}`,
+			want: &IRReceived{
+				IRCode: IRCode{Protocol: "COOLIX", Bits: 24, Data: "0xB21FD8"},
+				HVAC:   &IRHVAC{Vendor: "COOLIX", Power: true, Mode: HVACCool, Temp: 24, FanSpeed: FanAuto, SwingV: SwingVOff, SwingH: SwingHOff},
+			},
+		},
+		{name: "not ir", payload: `{"POWER":"ON"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseIrReceived([]byte(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseIrReceived() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseIrReceived() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	r, _ := ParseIrReceived([]byte(tests[2].payload))
+	if raw, ok := r.Raw(); !ok || !reflect.DeepEqual(raw.Timings, []int{3000, 1000, 500, 500}) || r.Known() {
+		t.Errorf("Raw() = %+v, %v; Known() = %v", raw, ok, r.Known())
+	}
+}
+
+func TestIntegration_IR(t *testing.T) {
+	srv, client := newTestDevice(t, tasmotatest.WithIR())
+	ctx := context.Background()
+
+	if err := client.SendIR(ctx, IRCode{Protocol: "nec", Bits: 32, Data: "0x20DF10EF"}); err != nil {
+		t.Fatalf("SendIR() error: %v", err)
+	}
+	if err := client.SendIRRaw(ctx, IRRaw{Timings: []int{9000, 4500, 560, 560}}); err != nil {
+		t.Fatalf("SendIRRaw() error: %v", err)
+	}
+	want := []string{`{"Protocol":"NEC","Bits":32,"Data":"0x20DF10EF"}`, "0,9000,4500,560,560"}
+	if got := srv.State().IR.Sent; !reflect.DeepEqual(got, want) {
+		t.Errorf("Sent = %q, want %q", got, want)
+	}
+
+	sent, err := client.SendIRHVAC(ctx, &IRHVAC{Vendor: "daikin", Power: true, Mode: HVACCool, Temp: 23})
+	if err != nil {
+		t.Fatalf("SendIRHVAC() error: %v", err)
+	}
+	if sent.Vendor != "DAIKIN" || !sent.Power || sent.Temp != 23 || sent.FanSpeed != FanAuto {
+		t.Errorf("SendIRHVAC() = %+v", sent)
+	}
+
+	if _, err := client.SendIRHVAC(ctx, &IRHVAC{Vendor: "ACME"}); !IsCommandError(err) {
+		t.Errorf("SendIRHVAC(unknown vendor) error = %v, want command error", err)
+	}
+
+	srv.Handle("IRSend", func(_ *tasmotatest.State, _ tasmotatest.Command) map[string]any {
+		return map[string]any{"IRSend": "Protocol not supported"}
+	})
+	err = client.SendIR(ctx, IRCode{Protocol: "FOO", Data: "0x1"})
+	if !IsCommandError(err) || !strings.Contains(err.Error(), "Protocol not supported") {
+		t.Errorf("SendIR() rejected error = %v, want command error", err)
+	}
+}
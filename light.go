@@ -0,0 +1,370 @@
+package tasmota
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CT is a white color temperature in mireds, as used by the CT command.
+type CT int
+
+const (
+	// MinCT is the coldest color temperature (153 mireds, about 6500K).
+	MinCT CT = 153
+	// MaxCT is the warmest color temperature (500 mireds, 2000K).
+	MaxCT CT = 500
+)
+
+// Kelvin converts a color temperature in Kelvin to mireds.
+func Kelvin(k int) CT {
+	if k <= 0 {
+		return 0
+	}
+	return CT(math.Round(1e6 / float64(k)))
+}
+
+// Kelvin returns the color temperature in Kelvin.
+func (ct CT) Kelvin() int {
+	if ct <= 0 {
+		return 0
+	}
+	return int(math.Round(1e6 / float64(ct)))
+}
+
+// Color is a light color that can be sent with SetColor: RGB, RGBCCT or HSB.
+type Color interface {
+	colorCommand() (string, error)
+}
+
+// RGB is a red, green and blue color.
+type RGB struct {
+	R, G, B uint8
+}
+
+// String returns the color as hex, such as "FF8000".
+func (c RGB) String() string {
+	return fmt.Sprintf("%02X%02X%02X", c.R, c.G, c.B)
+}
+
+func (c RGB) colorCommand() (string, error) {
+	return "Color " + c.String(), nil
+}
+
+// RGBCCT is a color with cold and warm white channels, as used by five
+// channel bulbs.
+type RGBCCT struct {
+	R, G, B uint8
+	// CW and WW are the cold and warm white channels.
+	CW, WW uint8
+}
+
+// String returns the color as hex, such as "FF80000000".
+func (c RGBCCT) String() string {
+	return fmt.Sprintf("%02X%02X%02X%02X%02X", c.R, c.G, c.B, c.CW, c.WW)
+}
+
+// RGB returns the red, green and blue channels.
+func (c RGBCCT) RGB() RGB {
+	return RGB{R: c.R, G: c.G, B: c.B}
+}
+
+func (c RGBCCT) colorCommand() (string, error) {
+	return "Color " + c.String(), nil
+}
+
+// HSB is a hue (0-360), saturation (0-100) and brightness (0-100) color.
+type HSB struct {
+	Hue        int
+	Saturation int
+	Brightness int
+}
+
+// String returns the color as sent with HSBColor, such as "30,100,50".
+func (h HSB) String() string {
+	return fmt.Sprintf("%d,%d,%d", h.Hue, h.Saturation, h.Brightness)
+}
+
+// Validate checks the components are in range.
+func (h HSB) Validate() error {
+	if h.Hue < 0 || h.Hue > 360 {
+		return NewError(ErrorTypeCommand, "hue must be between 0 and 360", nil)
+	}
+	if h.Saturation < 0 || h.Saturation > 100 || h.Brightness < 0 || h.Brightness > 100 {
+		return NewError(ErrorTypeCommand, "saturation and brightness must be between 0 and 100", nil)
+	}
+	return nil
+}
+
+func (h HSB) colorCommand() (string, error) {
+	if err := h.Validate(); err != nil {
+		return "", err
+	}
+	return "HSBColor " + h.String(), nil
+}
+
+// ParseHSB parses an HSBColor value such as "30,100,50".
+func ParseHSB(s string) (HSB, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return HSB{}, NewError(ErrorTypeParse, fmt.Sprintf("invalid HSB color %q", s), nil)
+	}
+	var values [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return HSB{}, NewError(ErrorTypeParse, fmt.Sprintf("invalid HSB color %q", s), err)
+		}
+		values[i] = n
+	}
+	return HSB{Hue: values[0], Saturation: values[1], Brightness: values[2]}, nil
+}
+
+// ParseColor parses a Color value of one to five channels, either as hex
+// ("FF8000", "#FF8000") or as decimals ("255,128,0", reported with
+// SetOption17 1). Missing channels are zero.
+func ParseColor(s string) (RGBCCT, error) {
+	channels, err := parseColorChannels(s)
+	if err != nil {
+		return RGBCCT{}, err
+	}
+	var c RGBCCT
+	for i, dst := range []*uint8{&c.R, &c.G, &c.B, &c.CW, &c.WW} {
+		if i < len(channels) {
+			*dst = channels[i]
+		}
+	}
+	return c, nil
+}
+
+func parseColorChannels(s string) ([]uint8, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "#")
+	invalid := func(err error) ([]uint8, error) {
+		return nil, NewError(ErrorTypeParse, fmt.Sprintf("invalid color %q", s), err)
+	}
+
+	if strings.Contains(s, ",") {
+		parts := strings.Split(s, ",")
+		if len(parts) > 5 {
+			return invalid(nil)
+		}
+		channels := make([]uint8, len(parts))
+		for i, p := range parts {
+			n, err := strconv.ParseUint(strings.TrimSpace(p), 10, 8)
+			if err != nil {
+				return invalid(err)
+			}
+			channels[i] = uint8(n)
+		}
+		return channels, nil
+	}
+
+	channels, err := hex.DecodeString(s)
+	if err != nil || len(channels) == 0 || len(channels) > 5 {
+		return invalid(err)
+	}
+	return channels, nil
+}
+
+// LightScheme is a light effect selected with the Scheme command.
+type LightScheme int
+
+const (
+	// SchemeSingle shows a single color.
+	SchemeSingle LightScheme = 0
+	// SchemeWakeup slowly raises the brightness, see Wakeup.
+	SchemeWakeup LightScheme = 1
+	// SchemeCycleUp cycles the colors with increasing hue.
+	SchemeCycleUp LightScheme = 2
+	// SchemeCycleDown cycles the colors with decreasing hue.
+	SchemeCycleDown LightScheme = 3
+	// SchemeRandom shows random colors.
+	SchemeRandom LightScheme = 4
+	// maxScheme is the last scheme; 5 and up are addressable LED effects.
+	maxScheme LightScheme = 12
+)
+
+// String returns the scheme name.
+func (s LightScheme) String() string {
+	switch s {
+	case SchemeSingle:
+		return "single"
+	case SchemeWakeup:
+		return "wakeup"
+	case SchemeCycleUp:
+		return "cycleup"
+	case SchemeCycleDown:
+		return "cycledown"
+	case SchemeRandom:
+		return "random"
+	default:
+		return fmt.Sprintf("LightScheme(%d)", int(s))
+	}
+}
+
+// LightState is the light part of a device state, as reported in
+// StatusSTS, tele/STATE and the RESULT of light commands.
+type LightState struct {
+	Power  bool
+	Dimmer int
+	// Color holds the output channels; Channels is how many the light has.
+	Color    RGBCCT
+	Channels int
+	HSB      HSB
+	// White is the white channel brightness of RGBW lights.
+	White int
+	// CT is zero on lights without white channels.
+	CT CT
+	// Channel is the brightness of each channel in percent.
+	Channel []int
+	Scheme  LightScheme
+	Fade    bool
+	Speed   int
+}
+
+// ParseLightState parses the light fields of a state or RESULT payload.
+func ParseLightState(data []byte) (*LightState, error) {
+	var state StatusState
+	if err := unmarshalJSON(data, &state); err != nil {
+		return nil, err
+	}
+	return state.Light()
+}
+
+// Light returns the light fields of the state. It returns a device error
+// if the device reported none.
+func (s *StatusState) Light() (*LightState, error) {
+	if s.Channel == nil && s.Color == "" && s.HSBColor == "" {
+		return nil, NewError(ErrorTypeDevice, "device reports no light state", nil)
+	}
+
+	power := s.POWER
+	if power == "" {
+		power = s.POWER1
+	}
+	light := &LightState{
+		Power:   strings.EqualFold(power, "ON"),
+		Dimmer:  s.Dimmer,
+		White:   s.White,
+		CT:      CT(s.CT),
+		Channel: s.Channel,
+		Scheme:  LightScheme(s.Scheme),
+		Fade:    strings.EqualFold(s.Fade, "ON"),
+		Speed:   s.Speed,
+	}
+
+	if s.Color != "" {
+		channels, err := parseColorChannels(s.Color)
+		if err != nil {
+			return nil, err
+		}
+		light.Channels = len(channels)
+		light.Color, _ = ParseColor(s.Color)
+	} else {
+		light.Channels = len(s.Channel)
+	}
+	if s.HSBColor != "" {
+		hsb, err := ParseHSB(s.HSBColor)
+		if err != nil {
+			return nil, err
+		}
+		light.HSB = hsb
+	}
+	return light, nil
+}
+
+// GetLight reads the light state from Status 11.
+func (c *Client) GetLight(ctx context.Context) (*LightState, error) {
+	state, err := c.GetState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return state.Light()
+}
+
+// SetDimmer sets the brightness in percent (0-100).
+func (c *Client) SetDimmer(ctx context.Context, percent int) (*LightState, error) {
+	if percent < 0 || percent > 100 {
+		return nil, NewError(ErrorTypeCommand, "dimmer must be between 0 and 100", nil)
+	}
+	return c.lightCommand(ctx, fmt.Sprintf("Dimmer %d", percent))
+}
+
+// SetColor sets the color from an RGB, RGBCCT or HSB value.
+func (c *Client) SetColor(ctx context.Context, color Color) (*LightState, error) {
+	if color == nil {
+		return nil, NewError(ErrorTypeCommand, "color cannot be nil", nil)
+	}
+	cmd, err := color.colorCommand()
+	if err != nil {
+		return nil, err
+	}
+	return c.lightCommand(ctx, cmd)
+}
+
+// SetCT sets the white color temperature in mireds (153-500); use Kelvin
+// to convert.
+func (c *Client) SetCT(ctx context.Context, ct CT) (*LightState, error) {
+	if ct < MinCT || ct > MaxCT {
+		return nil, NewError(ErrorTypeCommand,
+			fmt.Sprintf("color temperature must be between %d and %d mireds", MinCT, MaxCT), nil)
+	}
+	return c.lightCommand(ctx, fmt.Sprintf("CT %d", ct))
+}
+
+// SetFade enables or disables fading between light changes.
+func (c *Client) SetFade(ctx context.Context, enabled bool) error {
+	_, err := c.ExecuteCommand(ctx, fmt.Sprintf("Fade %d", boolToInt(enabled)))
+	return err
+}
+
+// SetSpeed sets the fade and scheme speed, from 1 (fast) to 40 (slow).
+func (c *Client) SetSpeed(ctx context.Context, speed int) error {
+	if speed < 1 || speed > 40 {
+		return NewError(ErrorTypeCommand, "speed must be between 1 and 40", nil)
+	}
+	_, err := c.ExecuteCommand(ctx, fmt.Sprintf("Speed %d", speed))
+	return err
+}
+
+// SetScheme selects a light scheme. Schemes above SchemeRandom are only
+// available on addressable LEDs.
+func (c *Client) SetScheme(ctx context.Context, scheme LightScheme) error {
+	if scheme < SchemeSingle || scheme > maxScheme {
+		return NewError(ErrorTypeCommand, fmt.Sprintf("scheme must be between 0 and %d", maxScheme), nil)
+	}
+	_, err := c.ExecuteCommand(ctx, fmt.Sprintf("Scheme %d", scheme))
+	return err
+}
+
+// Wakeup raises the brightness from zero to dimmer percent over duration
+// (1s to 3000s). A zero duration keeps the device's WakeupDuration.
+func (c *Client) Wakeup(ctx context.Context, dimmer int, duration time.Duration) error {
+	if dimmer < 1 || dimmer > 100 {
+		return NewError(ErrorTypeCommand, "wakeup dimmer must be between 1 and 100", nil)
+	}
+	wakeup := fmt.Sprintf("Wakeup %d", dimmer)
+	if duration == 0 {
+		_, err := c.ExecuteCommand(ctx, wakeup)
+		return err
+	}
+
+	seconds := int(duration.Round(time.Second) / time.Second)
+	if seconds < 1 || seconds > 3000 {
+		return NewError(ErrorTypeCommand, "wakeup duration must be between 1s and 3000s", nil)
+	}
+	_, err := c.ExecuteBacklog(ctx, fmt.Sprintf("WakeupDuration %d", seconds), wakeup)
+	return err
+}
+
+func (c *Client) lightCommand(ctx context.Context, cmd string) (*LightState, error) {
+	raw, err := c.ExecuteCommand(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	return ParseLightState(raw)
+}
@@ -0,0 +1,196 @@
+package tasmota
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kradalby/tasmota-go/tasmotatest"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    RGBCCT
+		wantErr bool
+	}{
+		{in: "FF8000", want: RGBCCT{R: 255, G: 128}},
+		{in: "#ff800010FF", want: RGBCCT{R: 255, G: 128, CW: 16, WW: 255}},
+		{in: "255,128,0,0,64", want: RGBCCT{R: 255, G: 128, WW: 64}},
+		{in: "80", want: RGBCCT{R: 128}},
+		{in: "", wantErr: true},
+		{in: "FF80", want: RGBCCT{R: 255, G: 128}},
+		{in: "FF8", wantErr: true},
+		{in: "FF80000000FF", wantErr: true},
+		{in: "256,0,0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseColor(tt.in)
+			if tt.wantErr {
+				if !IsParseError(err) {
+					t.Errorf("ParseColor(%q) error = %v, want parse error", tt.in, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ParseColor(%q) = %+v, %v, want %+v", tt.in, got, err, tt.want)
+			}
+		})
+	}
+
+	if got := (RGBCCT{R: 255, G: 128, WW: 64}).String(); got != "FF80000040" {
+		t.Errorf("RGBCCT.String() = %q", got)
+	}
+	if got := (RGB{R: 1, G: 2, B: 255}).String(); got != "0102FF" {
+		t.Errorf("RGB.String() = %q", got)
+	}
+}
+
+func TestKelvin(t *testing.T) {
+	if got := Kelvin(2700); got != 370 {
+		t.Errorf("Kelvin(2700) = %d, want 370", got)
+	}
+	if got := MinCT.Kelvin(); got != 6536 {
+		t.Errorf("MinCT.Kelvin() = %d, want 6536", got)
+	}
+	if Kelvin(0) != 0 || CT(0).Kelvin() != 0 {
+		t.Error("zero should convert to zero")
+	}
+}
+
+func TestParseLightState(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    *LightState
+	}{
+		{
+			name: "rgbcct state",
+			payload: `{"Time":"2024-01-01T00:00:00","POWER":"ON","Dimmer":50,"Color":"7F3F000000",` +
+				`"HSBColor":"30,100,50","White":0,"CT":153,"Channel":[50,25,0,0,0],"Scheme":0,` +
+				`"Fade":"ON","Speed":4,"LedTable":"ON"}`,
+			want: &LightState{
+				Power: true, Dimmer: 50, Color: RGBCCT{R: 127, G: 63}, Channels: 5,
+				HSB: HSB{Hue: 30, Saturation: 100, Brightness: 50}, CT: 153,
+				Channel: []int{50, 25, 0, 0, 0}, Fade: true, Speed: 4,
+			},
+		},
+		{
+			name:    "decimal color result",
+			payload: `{"POWER1":"OFF","Dimmer":0,"Color":"0,0,0","HSBColor":"0,0,0","Channel":[0,0,0]}`,
+			want:    &LightState{Channels: 3, Channel: []int{0, 0, 0}},
+		},
+		{
+			name:    "dimmer only",
+			payload: `{"POWER":"ON","Dimmer":30,"Channel":[30]}`,
+			want:    &LightState{Power: true, Dimmer: 30, Channels: 1, Channel: []int{30}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLightState([]byte(tt.payload))
+			if err != nil {
+				t.Fatalf("ParseLightState() error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseLightState() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseLightState([]byte(`{"POWER":"ON"}`)); !IsDeviceError(err) {
+		t.Errorf("ParseLightState(relay) error = %v, want device error", err)
+	}
+	if _, err := ParseLightState([]byte(`{"Color":"XYZ","Channel":[0]}`)); !IsParseError(err) {
+		t.Errorf("ParseLightState(bad color) error = %v, want parse error", err)
+	}
+}
+
+func TestIntegration_Light(t *testing.T) {
+	srv, client := newTestDevice(t, tasmotatest.WithLight(5))
+	ctx := context.Background()
+
+	light, err := client.SetColor(ctx, RGB{R: 255, G: 128})
+	if err != nil {
+		t.Fatalf("SetColor(RGB) error: %v", err)
+	}
+	if !light.Power || light.Dimmer != 100 || light.Color.RGB() != (RGB{R: 255, G: 128}) || light.HSB.Hue != 30 {
+		t.Errorf("SetColor(RGB) = %+v", light)
+	}
+
+	light, err = client.SetDimmer(ctx, 50)
+	if err != nil {
+		t.Fatalf("SetDimmer() error: %v", err)
+	}
+	if light.Dimmer != 50 || light.Color.R != 128 || light.Channel[0] != 50 {
+		t.Errorf("SetDimmer() = %+v", light)
+	}
+
+	light, err = client.SetColor(ctx, HSB{Hue: 240, Saturation: 100, Brightness: 20})
+	if err != nil {
+		t.Fatalf("SetColor(HSB) error: %v", err)
+	}
+	if light.Color.B != 51 || light.HSB != (HSB{Hue: 240, Saturation: 100, Brightness: 20}) {
+		t.Errorf("SetColor(HSB) = %+v", light)
+	}
+
+	light, err = client.SetCT(ctx, Kelvin(2700))
+	if err != nil {
+		t.Fatalf("SetCT() error: %v", err)
+	}
+	if light.CT != 370 || light.Color.R != 0 || light.Color.WW == 0 {
+		t.Errorf("SetCT() = %+v", light)
+	}
+
+	if err := client.SetFade(ctx, true); err != nil {
+		t.Fatalf("SetFade() error: %v", err)
+	}
+	if err := client.SetSpeed(ctx, 10); err != nil {
+		t.Fatalf("SetSpeed() error: %v", err)
+	}
+	if err := client.SetScheme(ctx, SchemeCycleUp); err != nil {
+		t.Fatalf("SetScheme() error: %v", err)
+	}
+	light, err = client.GetLight(ctx)
+	if err != nil {
+		t.Fatalf("GetLight() error: %v", err)
+	}
+	if !light.Fade || light.Speed != 10 || light.Scheme != SchemeCycleUp || light.CT != 370 {
+		t.Errorf("GetLight() = %+v", light)
+	}
+
+	if err := client.Wakeup(ctx, 80, 10*time.Minute); err != nil {
+		t.Fatalf("Wakeup() error: %v", err)
+	}
+	if l := srv.State().Light; l.WakeupDuration != 600 || l.Scheme != int(SchemeWakeup) || l.Dimmer != 80 {
+		t.Errorf("light after Wakeup = %+v", l)
+	}
+
+	for name, err := range map[string]error{
+		"dimmer":   second(client.SetDimmer(ctx, 101)),
+		"ct":       second(client.SetCT(ctx, Kelvin(10000))),
+		"hsb":      second(client.SetColor(ctx, HSB{Hue: 400})),
+		"nil":      second(client.SetColor(ctx, nil)),
+		"speed":    client.SetSpeed(ctx, 0),
+		"scheme":   client.SetScheme(ctx, 13),
+		"wakeup":   client.Wakeup(ctx, 50, time.Hour),
+		"wake dim": client.Wakeup(ctx, 0, 0),
+	} {
+		if !IsCommandError(err) {
+			t.Errorf("%s: error = %v, want command error", name, err)
+		}
+	}
+
+	_, relay := newTestDevice(t)
+	if _, err := relay.GetLight(ctx); !IsDeviceError(err) {
+		t.Errorf("GetLight() on a relay error = %v, want device error", err)
+	}
+}
+
+func second[T any](_ T, err error) error {
+	return err
+}
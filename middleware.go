@@ -0,0 +1,182 @@
+package tasmota
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Request is a command on its way to a device.
+type Request struct {
+	// Device is the base URL of the device, or its topic over MQTT.
+	Device  string
+	Command string
+}
+
+// CommandFunc executes a command and returns the device's JSON response.
+type CommandFunc func(ctx context.Context, req Request) (json.RawMessage, error)
+
+// Middleware wraps command execution, e.g. to log, measure or trace every
+// command. It sees each call to ExecuteCommand once, including any retries
+// made for it, and may change the request or the result.
+type Middleware func(next CommandFunc) CommandFunc
+
+// WithMiddleware adds middleware around command execution. The first
+// middleware is the outermost.
+func WithMiddleware(mw ...Middleware) ClientOption {
+	return func(c *Client) {
+		c.middleware = append(c.middleware, mw...)
+	}
+}
+
+// Exchange is a completed command as seen by middleware. Credentials are
+// redacted from Command and Response.
+type Exchange struct {
+	Device   string
+	Command  string
+	Start    time.Time
+	Duration time.Duration
+	// Size is the length of the response in bytes.
+	Size     int
+	Response json.RawMessage
+	Err      error
+}
+
+// ErrorType returns the type of Err, and false if the command succeeded or
+// failed with an error that is not an *Error.
+func (e *Exchange) ErrorType() (ErrorType, bool) {
+	var tErr *Error
+	if !errors.As(e.Err, &tErr) {
+		return 0, false
+	}
+	return tErr.Type, true
+}
+
+// Observe returns middleware that calls fn after every command.
+func Observe(fn func(*Exchange)) Middleware {
+	return func(next CommandFunc) CommandFunc {
+		return func(ctx context.Context, req Request) (json.RawMessage, error) {
+			start := time.Now()
+			raw, err := next(ctx, req)
+			e := &Exchange{
+				Device:   req.Device,
+				Command:  redactCommand(req.Command),
+				Start:    start,
+				Duration: time.Since(start),
+				Size:     len(raw),
+				Err:      err,
+			}
+			if raw != nil {
+				e.Response = json.RawMessage(redactBody(string(raw)))
+			}
+			fn(e)
+			return raw, err
+		}
+	}
+}
+
+// LoggingMiddleware logs every command at info level, and failed ones at
+// warn level with the error and its type.
+func LoggingMiddleware(logger *slog.Logger) Middleware {
+	return Observe(func(e *Exchange) {
+		attrs := []slog.Attr{
+			slog.String("device", e.Device),
+			slog.String("command", e.Command),
+			slog.Duration("duration", e.Duration),
+			slog.Int("size", e.Size),
+		}
+		level := slog.LevelInfo
+		if e.Err != nil {
+			level = slog.LevelWarn
+			if errType, ok := e.ErrorType(); ok {
+				attrs = append(attrs, slog.String("error_type", errType.String()))
+			}
+			attrs = append(attrs, slog.String("error", e.Err.Error()))
+		}
+		logger.LogAttrs(context.Background(), level, "tasmota command", attrs...)
+	})
+}
+
+// Metrics receives command metrics. It is small enough to back with any
+// metrics library.
+type Metrics interface {
+	// IncCounter adds one to a counter.
+	IncCounter(name string, labels Labels)
+	// ObserveHistogram records a value in a histogram.
+	ObserveHistogram(name string, value float64, labels Labels)
+}
+
+// Metric names reported by MetricsMiddleware. Every metric has the labels
+// device, command and error. command is the lower case command name without
+// its index, e.g. "power" for "Power2 ON", and error is the error type or
+// empty on success.
+const (
+	MetricCommands        = "tasmota_commands_total"
+	MetricCommandDuration = "tasmota_command_duration_seconds"
+	MetricResponseSize    = "tasmota_response_size_bytes"
+)
+
+// MetricsMiddleware reports the number, duration and response size of
+// commands to m.
+func MetricsMiddleware(m Metrics) Middleware {
+	return Observe(func(e *Exchange) {
+		labels := Labels{
+			"device":  e.Device,
+			"command": commandName(e.Command),
+			"error":   "",
+		}
+		if e.Err != nil {
+			labels["error"] = "unknown"
+			if errType, ok := e.ErrorType(); ok {
+				labels["error"] = errType.String()
+			}
+		}
+		m.IncCounter(MetricCommands, labels)
+		m.ObserveHistogram(MetricCommandDuration, e.Duration.Seconds(), labels)
+		m.ObserveHistogram(MetricResponseSize, float64(e.Size), labels)
+	})
+}
+
+// ExchangeLog keeps the last exchanges with a device for debugging. It is
+// safe for concurrent use.
+type ExchangeLog struct {
+	mu        sync.Mutex
+	exchanges []Exchange
+	next      int
+	full      bool
+}
+
+// NewExchangeLog returns a log that keeps the last n exchanges.
+func NewExchangeLog(n int) *ExchangeLog {
+	return &ExchangeLog{exchanges: make([]Exchange, max(n, 1))}
+}
+
+// Middleware returns middleware that records every command in the log.
+func (l *ExchangeLog) Middleware() Middleware {
+	return Observe(l.add)
+}
+
+func (l *ExchangeLog) add(e *Exchange) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.exchanges[l.next] = *e
+	l.next = (l.next + 1) % len(l.exchanges)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Exchanges returns the recorded exchanges, oldest first.
+func (l *ExchangeLog) Exchanges() []Exchange {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.full {
+		return append([]Exchange(nil), l.exchanges[:l.next]...)
+	}
+	return append(append([]Exchange(nil), l.exchanges[l.next:]...), l.exchanges[:l.next]...)
+}
@@ -0,0 +1,137 @@
+package tasmota
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWithMiddleware(t *testing.T) {
+	srv, client := newTestDevice(t)
+	var order []string
+	tag := func(name string) Middleware {
+		return func(next CommandFunc) CommandFunc {
+			return func(ctx context.Context, req Request) (json.RawMessage, error) {
+				order = append(order, name)
+				if req.Device != client.BaseURL() {
+					t.Errorf("Device = %q, want %q", req.Device, client.BaseURL())
+				}
+				return next(ctx, req)
+			}
+		}
+	}
+	// Middleware may rewrite the request.
+	upper := func(next CommandFunc) CommandFunc {
+		return func(ctx context.Context, req Request) (json.RawMessage, error) {
+			req.Command = strings.ToUpper(req.Command)
+			return next(ctx, req)
+		}
+	}
+	WithMiddleware(tag("outer"), tag("inner"), upper)(client)
+
+	if err := client.SetPowerOn(context.Background(), 1); err != nil {
+		t.Fatalf("SetPowerOn() error: %v", err)
+	}
+	if !reflect.DeepEqual(order, []string{"outer", "inner"}) {
+		t.Errorf("order = %v, want outer, inner", order)
+	}
+	if cmds := srv.Commands(); cmds[len(cmds)-1] != "POWER1 ON" {
+		t.Errorf("device received %q, want POWER1 ON", cmds[len(cmds)-1])
+	}
+}
+
+func TestExchangeLog(t *testing.T) {
+	_, client := newTestDevice(t)
+	log := NewExchangeLog(2)
+	WithMiddleware(log.Middleware())(client)
+	ctx := context.Background()
+
+	for _, cmd := range []string{"Power", "MqttPassword hunter2", "Power9 ON"} {
+		_, _ = client.ExecuteCommand(ctx, cmd)
+	}
+
+	exchanges := log.Exchanges()
+	if len(exchanges) != 2 {
+		t.Fatalf("Exchanges() has %d entries, want 2", len(exchanges))
+	}
+	first, last := exchanges[0], exchanges[1]
+	if first.Command != "MqttPassword ****" || first.Err != nil || first.Size == 0 || first.Size != len(first.Response) {
+		t.Errorf("first = %+v", first)
+	}
+	if errType, ok := last.ErrorType(); last.Command != "Power9 ON" || !ok || errType != ErrorTypeCommand {
+		t.Errorf("last = %+v, error type %v", last, errType)
+	}
+	if last.Duration <= 0 || last.Start.IsZero() {
+		t.Errorf("last timing = %v at %v", last.Duration, last.Start)
+	}
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	_, client := newTestDevice(t)
+	var buf bytes.Buffer
+	WithMiddleware(LoggingMiddleware(slog.New(slog.NewTextHandler(&buf, nil))))(client)
+	ctx := context.Background()
+
+	_, _ = client.ExecuteCommand(ctx, "Power")
+	_, _ = client.ExecuteCommand(ctx, "Power9 ON")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged %d lines, want 2:\n%s", len(lines), buf.String())
+	}
+	if !strings.Contains(lines[0], "level=INFO") || !strings.Contains(lines[0], "command=Power") || !strings.Contains(lines[0], "size=") {
+		t.Errorf("success line = %s", lines[0])
+	}
+	if !strings.Contains(lines[1], "level=WARN") || !strings.Contains(lines[1], "error_type=command") {
+		t.Errorf("failure line = %s", lines[1])
+	}
+}
+
+type testMetrics struct {
+	mu         sync.Mutex
+	counters   map[string]int
+	histograms map[string][]float64
+	labels     []Labels
+}
+
+func (m *testMetrics) IncCounter(name string, labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[name]++
+	m.labels = append(m.labels, labels)
+}
+
+func (m *testMetrics) ObserveHistogram(name string, value float64, _ Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.histograms[name] = append(m.histograms[name], value)
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	_, client := newTestDevice(t)
+	m := &testMetrics{counters: make(map[string]int), histograms: make(map[string][]float64)}
+	WithMiddleware(MetricsMiddleware(m))(client)
+	ctx := context.Background()
+
+	_, _ = client.ExecuteCommand(ctx, "Power1 ON")
+	_, _ = client.ExecuteCommand(ctx, "Power9 ON")
+
+	if m.counters[MetricCommands] != 2 || len(m.histograms[MetricCommandDuration]) != 2 || len(m.histograms[MetricResponseSize]) != 2 {
+		t.Errorf("counters = %v, histograms = %v", m.counters, m.histograms)
+	}
+	want := []Labels{
+		{"device": client.BaseURL(), "command": "power", "error": ""},
+		{"device": client.BaseURL(), "command": "power", "error": "command"},
+	}
+	if !reflect.DeepEqual(m.labels, want) {
+		t.Errorf("labels = %v, want %v", m.labels, want)
+	}
+	if size := m.histograms[MetricResponseSize][0]; size == 0 {
+		t.Error("response size = 0")
+	}
+}
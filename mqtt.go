@@ -10,7 +10,7 @@ type MQTTConfig struct {
 	Host       string
 	Port       int
 	User       string
-	Password   string
+	Password   Secret
 	Client     string
 	Topic      string
 	FullTopic  string
@@ -146,14 +146,9 @@ func (c *Client) SetPrefix(ctx context.Context, prefixNum int, prefix string) er
 }
 
 // EnableMQTT enables or disables MQTT.
-// Uses SetOption3: 0 = enable MQTT, 1 = disable MQTT
+// Uses SetOption3: 0 = disable MQTT, 1 = enable MQTT
 func (c *Client) EnableMQTT(ctx context.Context, enable bool) error {
-	// SetOption3 is inverted: 0 = enable, 1 = disable
-	val := 1
-	if enable {
-		val = 0
-	}
-	return c.SetOption(ctx, 3, val)
+	return c.SetOption(ctx, 3, enable)
 }
 
 // SetMQTTConfig configures MQTT broker settings atomically using Backlog.
@@ -165,7 +160,7 @@ func (c *Client) SetMQTTConfig(ctx context.Context, cfg *MQTTConfig) error {
 	var commands []string
 
 	// Enable MQTT first
-	commands = append(commands, "SetOption3 0")
+	commands = append(commands, "SetOption3 1")
 
 	// Host
 	if cfg.Host != "" {
@@ -182,7 +177,7 @@ func (c *Client) SetMQTTConfig(ctx context.Context, cfg *MQTTConfig) error {
 		commands = append(commands, fmt.Sprintf("MqttUser %s", cfg.User))
 	}
 	if cfg.Password != "" {
-		commands = append(commands, fmt.Sprintf("MqttPassword %s", cfg.Password))
+		commands = append(commands, "MqttPassword "+string(cfg.Password))
 	}
 
 	// Client name
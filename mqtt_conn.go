@@ -0,0 +1,512 @@
+package tasmota
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultMQTTKeepAlive is the default keep-alive interval for DialMQTT.
+const DefaultMQTTKeepAlive = 30 * time.Second
+
+// MQTT 3.1.1 control packet types.
+const (
+	mqttConnect     byte = 1
+	mqttConnAck     byte = 2
+	mqttPublish     byte = 3
+	mqttPubAck      byte = 4
+	mqttSubscribe   byte = 8
+	mqttSubAck      byte = 9
+	mqttUnsubscribe byte = 10
+	mqttUnsubAck    byte = 11
+	mqttPingReq     byte = 12
+	mqttPingResp    byte = 13
+	mqttDisconnect  byte = 14
+)
+
+// errMQTTClosed is returned when using a connection that has been closed.
+var errMQTTClosed = errors.New("mqtt connection closed")
+
+// MQTTBrokerConn is a minimal MQTT 3.1.1 client connection.
+// It supports QoS 0 publish and subscribe, which is all Tasmota needs.
+type MQTTBrokerConn struct {
+	conn      net.Conn
+	keepAlive time.Duration
+
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	nextID   uint16
+	nextSub  int
+	subs     map[int]mqttSubscription
+	pending  map[uint16]chan []byte
+	closed   bool
+	closeErr error
+	done     chan struct{}
+}
+
+type mqttSubscription struct {
+	filter  string
+	handler func(MQTTMessage)
+}
+
+// mqttDialConfig holds the settings applied by MQTTDialOption.
+type mqttDialConfig struct {
+	clientID  string
+	username  string
+	password  string
+	keepAlive time.Duration
+	tlsConfig *tls.Config
+}
+
+// MQTTDialOption is a functional option for configuring DialMQTT.
+type MQTTDialOption func(*mqttDialConfig)
+
+// WithMQTTCredentials configures the broker username and password.
+func WithMQTTCredentials(username, password string) MQTTDialOption {
+	return func(c *mqttDialConfig) {
+		c.username = username
+		c.password = password
+	}
+}
+
+// WithMQTTClientID sets the MQTT client identifier.
+// If not set, a random identifier is generated.
+func WithMQTTClientID(clientID string) MQTTDialOption {
+	return func(c *mqttDialConfig) {
+		c.clientID = clientID
+	}
+}
+
+// WithMQTTKeepAlive sets the keep-alive interval.
+func WithMQTTKeepAlive(keepAlive time.Duration) MQTTDialOption {
+	return func(c *mqttDialConfig) {
+		c.keepAlive = keepAlive
+	}
+}
+
+// WithMQTTTLS connects to the broker using TLS.
+func WithMQTTTLS(config *tls.Config) MQTTDialOption {
+	return func(c *mqttDialConfig) {
+		c.tlsConfig = config
+	}
+}
+
+// DialMQTT connects to the MQTT broker at addr (host:port).
+func DialMQTT(ctx context.Context, addr string, opts ...MQTTDialOption) (*MQTTBrokerConn, error) {
+	if addr == "" {
+		return nil, NewError(ErrorTypeNetwork, "MQTT broker address cannot be empty", nil)
+	}
+
+	cfg := &mqttDialConfig{
+		keepAlive: DefaultMQTTKeepAlive,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.clientID == "" {
+		buf := make([]byte, 4)
+		_, _ = rand.Read(buf)
+		cfg.clientID = "tasmota-go-" + hex.EncodeToString(buf)
+	}
+
+	dialer := &net.Dialer{Timeout: DefaultConnectTimeout}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if cfg.tlsConfig != nil {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: cfg.tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, NewError(ErrorTypeNetwork, "failed to connect to MQTT broker", err)
+	}
+
+	return newMQTTBrokerConn(ctx, conn, cfg)
+}
+
+// newMQTTBrokerConn performs the CONNECT handshake on an established connection.
+func newMQTTBrokerConn(ctx context.Context, conn net.Conn, cfg *mqttDialConfig) (*MQTTBrokerConn, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	} else {
+		_ = conn.SetDeadline(time.Now().Add(DefaultResponseTimeout))
+	}
+
+	var flags byte = 0x02 // clean session
+	payload := mqttString(cfg.clientID)
+	if cfg.username != "" {
+		flags |= 0x80
+		payload = append(payload, mqttString(cfg.username)...)
+	}
+	if cfg.password != "" {
+		flags |= 0x40
+		payload = append(payload, mqttString(cfg.password)...)
+	}
+
+	body := mqttString("MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(cfg.keepAlive/time.Second))
+	body = append(body, payload...)
+
+	if err := writeMQTTPacket(conn, mqttConnect<<4, body); err != nil {
+		_ = conn.Close()
+		return nil, NewError(ErrorTypeNetwork, "failed to send MQTT CONNECT", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	header, ack, err := readMQTTPacket(reader)
+	if err != nil {
+		_ = conn.Close()
+		return nil, NewError(ErrorTypeNetwork, "failed to read MQTT CONNACK", err)
+	}
+	if header>>4 != mqttConnAck || len(ack) < 2 {
+		_ = conn.Close()
+		return nil, NewError(ErrorTypeNetwork, "unexpected MQTT packet during connect", nil)
+	}
+	switch ack[1] {
+	case 0:
+	case 4, 5:
+		_ = conn.Close()
+		return nil, NewError(ErrorTypeAuth, "MQTT broker rejected credentials", nil)
+	default:
+		_ = conn.Close()
+		return nil, NewError(ErrorTypeNetwork, fmt.Sprintf("MQTT broker refused connection: code %d", ack[1]), nil)
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+
+	c := &MQTTBrokerConn{
+		conn:      conn,
+		keepAlive: cfg.keepAlive,
+		subs:      make(map[int]mqttSubscription),
+		pending:   make(map[uint16]chan []byte),
+		done:      make(chan struct{}),
+	}
+
+	go c.readLoop(reader)
+	if c.keepAlive > 0 {
+		go c.pingLoop()
+	}
+
+	return c, nil
+}
+
+// Publish sends a QoS 0 message to topic.
+func (c *MQTTBrokerConn) Publish(_ context.Context, topic string, payload []byte) error {
+	body := mqttString(topic)
+	body = append(body, payload...)
+	return c.write(mqttPublish<<4, body)
+}
+
+// Subscribe subscribes to filter and delivers matching messages to handler.
+func (c *MQTTBrokerConn) Subscribe(ctx context.Context, filter string, handler func(MQTTMessage)) (func() error, error) {
+	if filter == "" {
+		return nil, NewError(ErrorTypeCommand, "MQTT subscription filter cannot be empty", nil)
+	}
+
+	// Register the handler before subscribing: the broker may send retained
+	// messages, such as a device's LWT, ahead of the SUBACK.
+	c.mu.Lock()
+	c.nextSub++
+	subID := c.nextSub
+	c.subs[subID] = mqttSubscription{filter: filter, handler: handler}
+	c.mu.Unlock()
+
+	failed := func(err error) (func() error, error) {
+		c.mu.Lock()
+		delete(c.subs, subID)
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	id, ack := c.register()
+	body := binary.BigEndian.AppendUint16(nil, id)
+	body = append(body, mqttString(filter)...)
+	body = append(body, 0) // QoS 0
+
+	if err := c.write(mqttSubscribe<<4|0x02, body); err != nil {
+		c.unregister(id)
+		return failed(err)
+	}
+
+	resp, err := c.await(ctx, id, ack)
+	if err != nil {
+		return failed(err)
+	}
+	if len(resp) < 3 || resp[2] == 0x80 {
+		return failed(NewError(ErrorTypeNetwork, "MQTT broker rejected subscription to "+filter, nil))
+	}
+
+	return func() error {
+		return c.unsubscribe(subID)
+	}, nil
+}
+
+// Close disconnects from the broker.
+func (c *MQTTBrokerConn) Close() error {
+	_ = c.write(mqttDisconnect<<4, nil)
+	c.shutdown(errMQTTClosed)
+	return nil
+}
+
+// Done is closed when the connection to the broker is lost or closed.
+func (c *MQTTBrokerConn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the reason the connection was closed, if any.
+func (c *MQTTBrokerConn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeErr
+}
+
+// unsubscribe removes a subscription and unsubscribes from the broker when
+// no other subscription uses the same filter.
+func (c *MQTTBrokerConn) unsubscribe(subID int) error {
+	c.mu.Lock()
+	sub, ok := c.subs[subID]
+	if !ok {
+		c.mu.Unlock()
+		return nil
+	}
+	delete(c.subs, subID)
+	for _, other := range c.subs {
+		if other.filter == sub.filter {
+			c.mu.Unlock()
+			return nil
+		}
+	}
+	c.mu.Unlock()
+
+	id, ack := c.register()
+	body := binary.BigEndian.AppendUint16(nil, id)
+	body = append(body, mqttString(sub.filter)...)
+	if err := c.write(mqttUnsubscribe<<4|0x02, body); err != nil {
+		c.unregister(id)
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultResponseTimeout)
+	defer cancel()
+	_, err := c.await(ctx, id, ack)
+	return err
+}
+
+// register allocates a packet identifier and a channel for its acknowledgement.
+func (c *MQTTBrokerConn) register() (uint16, chan []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	ack := make(chan []byte, 1)
+	c.pending[c.nextID] = ack
+	return c.nextID, ack
+}
+
+func (c *MQTTBrokerConn) unregister(id uint16) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+// await waits for the acknowledgement of packet id.
+func (c *MQTTBrokerConn) await(ctx context.Context, id uint16, ack chan []byte) ([]byte, error) {
+	select {
+	case resp := <-ack:
+		return resp, nil
+	case <-c.done:
+		return nil, NewError(ErrorTypeNetwork, "MQTT connection closed", c.Err())
+	case <-ctx.Done():
+		c.unregister(id)
+		return nil, NewError(ErrorTypeTimeout, "MQTT broker did not acknowledge request", ctx.Err())
+	}
+}
+
+// write sends a single packet, serialising concurrent writers.
+func (c *MQTTBrokerConn) write(header byte, body []byte) error {
+	select {
+	case <-c.done:
+		return NewError(ErrorTypeNetwork, "MQTT connection closed", c.Err())
+	default:
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if err := writeMQTTPacket(c.conn, header, body); err != nil {
+		c.shutdown(err)
+		return NewError(ErrorTypeNetwork, "failed to write MQTT packet", err)
+	}
+	return nil
+}
+
+// readLoop dispatches incoming packets until the connection fails.
+func (c *MQTTBrokerConn) readLoop(r *bufio.Reader) {
+	for {
+		header, body, err := readMQTTPacket(r)
+		if err != nil {
+			c.shutdown(err)
+			return
+		}
+
+		switch header >> 4 {
+		case mqttPublish:
+			c.dispatch(header, body)
+		case mqttSubAck, mqttUnsubAck:
+			if len(body) < 2 {
+				continue
+			}
+			id := binary.BigEndian.Uint16(body)
+			c.mu.Lock()
+			ack, ok := c.pending[id]
+			delete(c.pending, id)
+			c.mu.Unlock()
+			if ok {
+				ack <- body
+			}
+		case mqttPingResp:
+		}
+	}
+}
+
+// dispatch decodes a PUBLISH packet and hands it to matching subscribers.
+func (c *MQTTBrokerConn) dispatch(header byte, body []byte) {
+	if len(body) < 2 {
+		return
+	}
+	n := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+n {
+		return
+	}
+	topic := string(body[2 : 2+n])
+	rest := body[2+n:]
+
+	if qos := (header >> 1) & 0x03; qos > 0 {
+		if len(rest) < 2 {
+			return
+		}
+		id := rest[:2]
+		rest = rest[2:]
+		if qos == 1 {
+			_ = c.write(mqttPubAck<<4, id)
+		}
+	}
+
+	msg := MQTTMessage{Topic: topic, Payload: rest}
+
+	c.mu.Lock()
+	var handlers []func(MQTTMessage)
+	for _, sub := range c.subs {
+		if topicMatches(sub.filter, topic) {
+			handlers = append(handlers, sub.handler)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, h := range handlers {
+		h(msg)
+	}
+}
+
+// pingLoop keeps the connection alive.
+func (c *MQTTBrokerConn) pingLoop() {
+	ticker := time.NewTicker(c.keepAlive * 3 / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.write(mqttPingReq<<4, nil); err != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// shutdown closes the connection once and records why.
+func (c *MQTTBrokerConn) shutdown(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.closeErr = err
+	_ = c.conn.Close()
+	close(c.done)
+}
+
+// mqttString encodes s as an MQTT length-prefixed UTF-8 string.
+func mqttString(s string) []byte {
+	b := binary.BigEndian.AppendUint16(nil, uint16(len(s))) //nolint:gosec // MQTT strings are limited to 64KiB
+	return append(b, s...)
+}
+
+// writeMQTTPacket writes a fixed header, the remaining length and body.
+func writeMQTTPacket(w io.Writer, header byte, body []byte) error {
+	buf := []byte{header}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+		if n == 0 {
+			break
+		}
+	}
+	buf = append(buf, body...)
+	_, err := w.Write(buf)
+	return err
+}
+
+// readMQTTPacket reads a single packet and returns its fixed header byte and body.
+func readMQTTPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, errors.New("malformed MQTT remaining length")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		multiplier *= 128
+		if b&0x80 == 0 {
+			break
+		}
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
@@ -0,0 +1,255 @@
+package tasmota
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testBroker is a tiny MQTT 3.1.1 broker used to exercise DialMQTT.
+type testBroker struct {
+	listener   net.Listener
+	rejectUser string
+
+	mu       sync.Mutex
+	conns    map[net.Conn][]string
+	retained map[string][]byte
+}
+
+// startTestBroker starts a broker that refuses clients sending a username
+// when rejectUser is set.
+func startTestBroker(t *testing.T, rejectUser string) *testBroker {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error: %v", err)
+	}
+
+	b := &testBroker{listener: l, rejectUser: rejectUser, conns: make(map[net.Conn][]string), retained: make(map[string][]byte)}
+	go b.serve()
+	t.Cleanup(func() { _ = l.Close() })
+
+	return b
+}
+
+func (b *testBroker) addr() string {
+	return b.listener.Addr().String()
+}
+
+func (b *testBroker) serve() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+func (b *testBroker) handle(conn net.Conn) {
+	defer func() {
+		b.mu.Lock()
+		delete(b.conns, conn)
+		b.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	for {
+		header, body, err := readMQTTPacket(r)
+		if err != nil {
+			return
+		}
+
+		switch header >> 4 {
+		case mqttConnect:
+			code := byte(0)
+			if b.rejectUser != "" && body[7]&0x80 != 0 {
+				code = 5
+			}
+			_ = writeMQTTPacket(conn, mqttConnAck<<4, []byte{0, code})
+			if code != 0 {
+				return
+			}
+			b.mu.Lock()
+			b.conns[conn] = nil
+			b.mu.Unlock()
+		case mqttSubscribe:
+			n := int(binary.BigEndian.Uint16(body[2:]))
+			filter := string(body[4 : 4+n])
+			b.mu.Lock()
+			b.conns[conn] = append(b.conns[conn], filter)
+			// Retained messages go out before the SUBACK, as brokers may do
+			for _, msg := range b.retained {
+				n := int(binary.BigEndian.Uint16(msg))
+				if topicMatches(filter, string(msg[2:2+n])) {
+					_ = writeMQTTPacket(conn, mqttPublish<<4|0x01, msg)
+				}
+			}
+			b.mu.Unlock()
+			_ = writeMQTTPacket(conn, mqttSubAck<<4, append(body[:2:2], 0))
+		case mqttUnsubscribe:
+			_ = writeMQTTPacket(conn, mqttUnsubAck<<4, body[:2])
+		case mqttPublish:
+			n := int(binary.BigEndian.Uint16(body))
+			topic := string(body[2 : 2+n])
+			b.mu.Lock()
+			if header&0x01 != 0 {
+				b.retained[topic] = body
+			}
+			for c, filters := range b.conns {
+				for _, f := range filters {
+					if topicMatches(f, topic) {
+						_ = writeMQTTPacket(c, mqttPublish<<4, body)
+						break
+					}
+				}
+			}
+			b.mu.Unlock()
+		case mqttPingReq:
+			_ = writeMQTTPacket(conn, mqttPingResp<<4, nil)
+		case mqttDisconnect:
+			return
+		}
+	}
+}
+
+func TestDialMQTT(t *testing.T) {
+	broker := startTestBroker(t, "")
+	ctx := context.Background()
+
+	sub, err := DialMQTT(ctx, broker.addr(), WithMQTTClientID("sub"))
+	if err != nil {
+		t.Fatalf("DialMQTT() error: %v", err)
+	}
+	defer func() { _ = sub.Close() }()
+
+	pub, err := DialMQTT(ctx, broker.addr(), WithMQTTKeepAlive(0))
+	if err != nil {
+		t.Fatalf("DialMQTT() error: %v", err)
+	}
+	defer func() { _ = pub.Close() }()
+
+	received := make(chan MQTTMessage, 1)
+	unsubscribe, err := sub.Subscribe(ctx, "tele/+/STATE", func(msg MQTTMessage) {
+		received <- msg
+	})
+	if err != nil {
+		t.Fatalf("Subscribe() error: %v", err)
+	}
+
+	if err := pub.Publish(ctx, "tele/plug/STATE", []byte(`{"POWER":"ON"}`)); err != nil {
+		t.Fatalf("Publish() error: %v", err)
+	}
+
+	select {
+	case msg := <-received:
+		if msg.Topic != "tele/plug/STATE" || string(msg.Payload) != `{"POWER":"ON"}` {
+			t.Errorf("received %s %s, want tele/plug/STATE {\"POWER\":\"ON\"}", msg.Topic, msg.Payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not received")
+	}
+
+	if err := unsubscribe(); err != nil {
+		t.Errorf("unsubscribe() error: %v", err)
+	}
+
+	_ = sub.Close()
+	select {
+	case <-sub.Done():
+	case <-time.After(time.Second):
+		t.Error("Done() not closed after Close()")
+	}
+	if err := sub.Publish(ctx, "x", nil); !IsNetworkError(err) {
+		t.Errorf("Publish() after Close() error = %v, want network error", err)
+	}
+}
+
+func TestDialMQTT_RetainedBeforeSubAck(t *testing.T) {
+	broker := startTestBroker(t, "")
+	ctx := context.Background()
+
+	broker.mu.Lock()
+	broker.retained["tele/plug/LWT"] = append(mqttString("tele/plug/LWT"), "Online"...)
+	broker.mu.Unlock()
+
+	conn, err := DialMQTT(ctx, broker.addr())
+	if err != nil {
+		t.Fatalf("DialMQTT() error: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	received := make(chan MQTTMessage, 1)
+	if _, err := conn.Subscribe(ctx, "tele/plug/LWT", func(msg MQTTMessage) {
+		received <- msg
+	}); err != nil {
+		t.Fatalf("Subscribe() error: %v", err)
+	}
+
+	select {
+	case msg := <-received:
+		if string(msg.Payload) != "Online" {
+			t.Errorf("received %s, want Online", msg.Payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("retained message not received")
+	}
+}
+
+func TestDialMQTT_Errors(t *testing.T) {
+	t.Run("empty address", func(t *testing.T) {
+		if _, err := DialMQTT(context.Background(), ""); !IsNetworkError(err) {
+			t.Errorf("DialMQTT() error = %v, want network error", err)
+		}
+	})
+
+	t.Run("rejected credentials", func(t *testing.T) {
+		broker := startTestBroker(t, "bad")
+
+		_, err := DialMQTT(context.Background(), broker.addr(), WithMQTTCredentials("bad", "pass"))
+		if !IsAuthError(err) {
+			t.Errorf("DialMQTT() error = %v, want auth error", err)
+		}
+	})
+}
+
+func TestDialMQTT_ClientRoundTrip(t *testing.T) {
+	broker := startTestBroker(t, "")
+	ctx := context.Background()
+
+	device, err := DialMQTT(ctx, broker.addr())
+	if err != nil {
+		t.Fatalf("DialMQTT() error: %v", err)
+	}
+	defer func() { _ = device.Close() }()
+
+	topics := DeviceTopics{Topic: "plug"}
+	attachDevice(t, device, topics, func(_, _ string) [][2]string {
+		return [][2]string{{"RESULT", `{"POWER":"OFF"}`}}
+	})
+
+	conn, err := DialMQTT(ctx, broker.addr())
+	if err != nil {
+		t.Fatalf("DialMQTT() error: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	client, err := NewMQTTClient(conn, topics)
+	if err != nil {
+		t.Fatalf("NewMQTTClient() error: %v", err)
+	}
+
+	on, err := client.IsPowerOn(ctx, 0)
+	if err != nil {
+		t.Fatalf("IsPowerOn() error: %v", err)
+	}
+	if on {
+		t.Error("IsPowerOn() = true, want false")
+	}
+}
@@ -376,19 +376,24 @@ func TestClient_SetPrefix(t *testing.T) {
 }
 
 func TestClient_EnableMQTT(t *testing.T) {
+	// SetOption3 1 enables MQTT, 0 disables it
 	tests := []struct {
-		name   string
-		enable bool
+		name    string
+		enable  bool
+		wantCmd string
 	}{
-		{"enable", true},
-		{"disable", false},
+		{"enable", true, "SetOption3 1"},
+		{"disable", false, "SetOption3 0"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if cmd := r.URL.Query().Get("cmnd"); cmd != tt.wantCmd {
+					t.Errorf("command = %q, want %q", cmd, tt.wantCmd)
+				}
 				w.WriteHeader(http.StatusOK)
-				_, _ = w.Write([]byte(`{"SetOption3":0}`))
+				_, _ = w.Write([]byte(`{"SetOption3":"ON"}`))
 			}))
 			defer server.Close()
 
@@ -462,6 +467,9 @@ func TestClient_SetMQTTConfig(t *testing.T) {
 				if !strings.Contains(cmd, "Backlog") {
 					t.Error("command should use Backlog")
 				}
+				if !strings.HasPrefix(cmd, "Backlog SetOption3 1;") {
+					t.Errorf("command = %q, want MQTT enabled first with SetOption3 1", cmd)
+				}
 				w.WriteHeader(http.StatusOK)
 				_, _ = w.Write([]byte(`{"Response":"Done"}`))
 			}))
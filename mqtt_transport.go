@@ -0,0 +1,365 @@
+package tasmota
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFullTopic is the default Tasmota FullTopic template.
+	DefaultFullTopic = "%prefix%/%topic%/"
+	// DefaultMQTTSettle is how long the MQTT transport keeps collecting replies
+	// for commands that answer with several messages (Status 0, Timers,
+	// Backlog).
+	DefaultMQTTSettle = 250 * time.Millisecond
+)
+
+// MQTTMessage is a single message received from an MQTT broker.
+type MQTTMessage struct {
+	Topic   string
+	Payload []byte
+}
+
+// MQTTConn is the minimal broker connection the MQTT features need.
+// It is implemented by the connection returned from DialMQTT and can be
+// implemented on top of any other MQTT library or an in-process stand-in.
+type MQTTConn interface {
+	// Publish sends payload to topic.
+	Publish(ctx context.Context, topic string, payload []byte) error
+	// Subscribe registers handler for messages matching filter, which may
+	// contain the + and # wildcards. Handlers must not block. The returned
+	// function removes the subscription.
+	Subscribe(ctx context.Context, filter string, handler func(MQTTMessage)) (func() error, error)
+}
+
+// DeviceTopics describes how a device composes its MQTT topics.
+// Empty fields fall back to the Tasmota defaults.
+type DeviceTopics struct {
+	Topic     string
+	FullTopic string  // default: %prefix%/%topic%/
+	Prefix1   string  // Command prefix (default: cmnd)
+	Prefix2   string  // Status prefix (default: stat)
+	Prefix3   string  // Telemetry prefix (default: tele)
+	Hostname  string  // Substituted for %hostname%
+	MAC       MACAddr // Substituted for %id%
+}
+
+// Topics returns the DeviceTopics described by the MQTT configuration.
+func (m *MQTTConfig) Topics() DeviceTopics {
+	return DeviceTopics{
+		Topic:     m.Topic,
+		FullTopic: m.FullTopic,
+		Prefix1:   m.Prefix1,
+		Prefix2:   m.Prefix2,
+		Prefix3:   m.Prefix3,
+	}
+}
+
+// Command returns the topic a command is published to, e.g. cmnd/<topic>/Power1.
+func (t DeviceTopics) Command(command string) string {
+	return t.build(t.Prefix1, "cmnd") + command
+}
+
+// Stat returns a status topic, e.g. stat/<topic>/RESULT.
+func (t DeviceTopics) Stat(suffix string) string {
+	return t.build(t.Prefix2, "stat") + suffix
+}
+
+// Tele returns a telemetry topic, e.g. tele/<topic>/STATE.
+func (t DeviceTopics) Tele(suffix string) string {
+	return t.build(t.Prefix3, "tele") + suffix
+}
+
+// build expands the FullTopic template the same way the firmware does.
+func (t DeviceTopics) build(prefix, defaultPrefix string) string {
+	if prefix == "" {
+		prefix = defaultPrefix
+	}
+
+	full := t.FullTopic
+	if full == "" {
+		full = DefaultFullTopic
+	}
+	// Tasmota prepends the mandatory %prefix% token when it is missing
+	if !strings.Contains(full, "%prefix%") {
+		full = "%prefix%/" + full
+	}
+
+	id := ""
+	if mac := strings.ReplaceAll(t.MAC.String(), ":", ""); len(mac) >= 6 {
+		id = strings.ToUpper(mac[len(mac)-6:])
+	}
+
+	full = strings.NewReplacer(
+		"%prefix%", prefix,
+		"%topic%", t.Topic,
+		"%hostname%", t.Hostname,
+		"%id%", id,
+	).Replace(full)
+
+	if !strings.HasSuffix(full, "/") {
+		full += "/"
+	}
+	return full
+}
+
+// MQTTTransport is a Transport that executes commands over an MQTT broker.
+// Commands are published to the device's command topic and the reply is
+// correlated from its status topics. Commands are executed one at a time.
+type MQTTTransport struct {
+	conn   MQTTConn
+	topics DeviceTopics
+	settle time.Duration
+
+	mu          sync.Mutex
+	responses   chan MQTTMessage
+	unsubscribe func() error
+}
+
+// MQTTTransportOption is a functional option for configuring an MQTTTransport.
+type MQTTTransportOption func(*MQTTTransport)
+
+// WithMQTTSettle sets how long the transport waits for further messages
+// after the first reply to a multi-message command such as Status 0.
+func WithMQTTSettle(settle time.Duration) MQTTTransportOption {
+	return func(t *MQTTTransport) {
+		t.settle = settle
+	}
+}
+
+// NewMQTTTransport creates a transport that reaches the device described by
+// topics through conn.
+func NewMQTTTransport(conn MQTTConn, topics DeviceTopics, opts ...MQTTTransportOption) (*MQTTTransport, error) {
+	if conn == nil {
+		return nil, NewError(ErrorTypeNetwork, "MQTT connection cannot be nil", nil)
+	}
+	if topics.Topic == "" {
+		return nil, NewError(ErrorTypeCommand, "MQTT topic cannot be empty", nil)
+	}
+
+	t := &MQTTTransport{
+		conn:   conn,
+		topics: topics,
+		settle: DefaultMQTTSettle,
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t, nil
+}
+
+// NewMQTTClient creates a Client that talks to the device over MQTT instead of HTTP.
+func NewMQTTClient(conn MQTTConn, topics DeviceTopics, opts ...ClientOption) (*Client, error) {
+	transport, err := NewMQTTTransport(conn, topics)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &Client{
+		transport: transport,
+		queue:     newRequestQueue(),
+	}
+
+	for _, opt := range opts {
+		opt(client)
+	}
+
+	return client, nil
+}
+
+// Topics returns the topics the transport uses.
+func (t *MQTTTransport) Topics() DeviceTopics {
+	return t.topics
+}
+
+// Execute publishes the command and waits for the device's reply.
+func (t *MQTTTransport) Execute(ctx context.Context, command string) ([]byte, error) {
+	name, payload := splitCommand(command)
+	if name == "" {
+		return nil, NewError(ErrorTypeCommand, "command cannot be empty", nil)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.subscribe(ctx); err != nil {
+		return nil, err
+	}
+
+	// Drop replies that arrived after an earlier command gave up
+	for len(t.responses) > 0 {
+		<-t.responses
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultResponseTimeout)
+		defer cancel()
+	}
+
+	if err := t.conn.Publish(ctx, t.topics.Command(name), []byte(payload)); err != nil {
+		return nil, NewError(ErrorTypeNetwork, "failed to publish command", err)
+	}
+
+	cmd := commandName(name)
+	collect := cmd == "backlog" || cmd == "timers" || (cmd == "status" && payload == "0")
+
+	// A Backlog answers with a message per command in it
+	names := []string{name}
+	if cmd == "backlog" {
+		names = names[:0]
+		for _, line := range backlogCommands(command) {
+			n, _ := splitCommand(line)
+			names = append(names, n)
+		}
+	}
+
+	var (
+		replies [][]byte
+		merged  map[string]json.RawMessage
+		settle  <-chan time.Time
+	)
+
+	for {
+		select {
+		case msg := <-t.responses:
+			var obj map[string]json.RawMessage
+			if err := json.Unmarshal(msg.Payload, &obj); err != nil {
+				// Plain stat/<topic>/POWER style messages are not replies
+				continue
+			}
+			// Replies are keyed by the command, so a button press or another
+			// client's command arriving meanwhile is not taken as the reply.
+			if !slices.ContainsFunc(names, func(n string) bool { return isReply(n, obj) }) {
+				continue
+			}
+			if !collect {
+				return msg.Payload, nil
+			}
+			if merged == nil {
+				merged = make(map[string]json.RawMessage)
+			}
+			for k, v := range obj {
+				merged[k] = v
+			}
+			replies = append(replies, msg.Payload)
+			settle = time.After(t.settle)
+
+		case <-settle:
+			return mergedResponse(replies, merged)
+
+		case <-ctx.Done():
+			if len(replies) > 0 {
+				return mergedResponse(replies, merged)
+			}
+			return nil, NewError(ErrorTypeTimeout, "no MQTT response from device", ctx.Err())
+		}
+	}
+}
+
+// Close removes the transport's subscription from the broker.
+func (t *MQTTTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.unsubscribe == nil {
+		return nil
+	}
+	err := t.unsubscribe()
+	t.unsubscribe = nil
+	return err
+}
+
+// subscribe lazily subscribes to the device's status topics.
+func (t *MQTTTransport) subscribe(ctx context.Context) error {
+	if t.unsubscribe != nil {
+		return nil
+	}
+
+	if t.responses == nil {
+		t.responses = make(chan MQTTMessage, 64)
+	}
+	responses := t.responses
+
+	unsubscribe, err := t.conn.Subscribe(ctx, t.topics.Stat("+"), func(msg MQTTMessage) {
+		select {
+		case responses <- msg:
+		default:
+		}
+	})
+	if err != nil {
+		return NewError(ErrorTypeNetwork, "failed to subscribe to status topic", err)
+	}
+
+	t.unsubscribe = unsubscribe
+	return nil
+}
+
+// mergedResponse returns the single reply as-is, or the merged object when
+// several replies were collected.
+func mergedResponse(replies [][]byte, merged map[string]json.RawMessage) ([]byte, error) {
+	if len(replies) == 1 {
+		return replies[0], nil
+	}
+
+	body, err := json.Marshal(merged)
+	if err != nil {
+		return nil, NewError(ErrorTypeParse, "failed to merge MQTT responses", err)
+	}
+	return body, nil
+}
+
+// isReply reports whether obj is the device's reply to the command name.
+// Tasmota keys a reply by the command, e.g. POWER2 for Power2, StatusNET for
+// Status 5 or Timers1 for Timers, and reports a failure as
+// {"Command":"Unknown"} or a WARNING.
+func isReply(name string, obj map[string]json.RawMessage) bool {
+	name = commandName(name)
+	for key := range obj {
+		key = commandName(key)
+		switch {
+		case key == "command", key == "warning", strings.HasPrefix(key, name):
+			return true
+		case name == "template" && key == "name":
+			// The active template is returned as is
+			return true
+		case strings.HasPrefix(name, "shutter") && strings.HasPrefix(key, "shutter"):
+			// ShutterOpen1 and friends answer with the position or state
+			return true
+		}
+	}
+	return false
+}
+
+// splitCommand splits "Power1 ON" into the command name and its payload.
+func splitCommand(command string) (string, string) {
+	command = strings.TrimSpace(command)
+	name, payload, _ := strings.Cut(command, " ")
+	return name, strings.TrimSpace(payload)
+}
+
+// topicMatches reports whether topic matches an MQTT subscription filter.
+func topicMatches(filter, topic string) bool {
+	filterParts := strings.Split(filter, "/")
+	topicParts := strings.Split(topic, "/")
+
+	for i, part := range filterParts {
+		if part == "#" {
+			return true
+		}
+		if i >= len(topicParts) {
+			return false
+		}
+		if part != "+" && part != topicParts[i] {
+			return false
+		}
+	}
+
+	return len(filterParts) == len(topicParts)
+}
@@ -0,0 +1,401 @@
+package tasmota
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memBroker is an in-process MQTTConn that routes messages between subscribers.
+type memBroker struct {
+	mu   sync.Mutex
+	next int
+	subs map[int]mqttSubscription
+}
+
+func newMemBroker() *memBroker {
+	return &memBroker{subs: make(map[int]mqttSubscription)}
+}
+
+func (b *memBroker) Publish(_ context.Context, topic string, payload []byte) error {
+	msg := MQTTMessage{Topic: topic, Payload: payload}
+
+	b.mu.Lock()
+	var handlers []func(MQTTMessage)
+	for _, sub := range b.subs {
+		if topicMatches(sub.filter, topic) {
+			handlers = append(handlers, sub.handler)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, h := range handlers {
+		h(msg)
+	}
+	return nil
+}
+
+func (b *memBroker) Subscribe(_ context.Context, filter string, handler func(MQTTMessage)) (func() error, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.next++
+	id := b.next
+	b.subs[id] = mqttSubscription{filter: filter, handler: handler}
+
+	return func() error {
+		b.mu.Lock()
+		delete(b.subs, id)
+		b.mu.Unlock()
+		return nil
+	}, nil
+}
+
+// attachDevice simulates a device on the broker. reply is called for every
+// command and returns the stat topic suffixes and payloads to publish.
+func attachDevice(t *testing.T, conn MQTTConn, topics DeviceTopics, reply func(cmd, payload string) [][2]string) {
+	t.Helper()
+
+	prefix := topics.Command("")
+	_, err := conn.Subscribe(context.Background(), topics.Command("+"), func(msg MQTTMessage) {
+		cmd := strings.TrimPrefix(msg.Topic, prefix)
+		for _, r := range reply(cmd, string(msg.Payload)) {
+			_ = conn.Publish(context.Background(), topics.Stat(r[0]), []byte(r[1]))
+		}
+	})
+	if err != nil {
+		t.Fatalf("Subscribe() error: %v", err)
+	}
+}
+
+func TestDeviceTopics(t *testing.T) {
+	tests := []struct {
+		name    string
+		topics  DeviceTopics
+		command string
+		stat    string
+		tele    string
+	}{
+		{
+			name:    "defaults",
+			topics:  DeviceTopics{Topic: "plug"},
+			command: "cmnd/plug/Power",
+			stat:    "stat/plug/RESULT",
+			tele:    "tele/plug/STATE",
+		},
+		{
+			name:    "custom prefixes",
+			topics:  DeviceTopics{Topic: "plug", Prefix1: "c", Prefix2: "s", Prefix3: "t"},
+			command: "c/plug/Power",
+			stat:    "s/plug/RESULT",
+			tele:    "t/plug/STATE",
+		},
+		{
+			name:    "custom full topic",
+			topics:  DeviceTopics{Topic: "plug", FullTopic: "home/%topic%/%prefix%/"},
+			command: "home/plug/cmnd/Power",
+			stat:    "home/plug/stat/RESULT",
+			tele:    "home/plug/tele/STATE",
+		},
+		{
+			name:    "missing prefix token and trailing slash",
+			topics:  DeviceTopics{Topic: "plug", FullTopic: "home/%topic%"},
+			command: "cmnd/home/plug/Power",
+			stat:    "stat/home/plug/RESULT",
+			tele:    "tele/home/plug/STATE",
+		},
+		{
+			name: "hostname and id tokens",
+			topics: DeviceTopics{
+				FullTopic: "%prefix%/%hostname%-%id%/",
+				Hostname:  "tasmota",
+				MAC:       MustParseMACAddr("AA:BB:CC:DD:EE:FF"),
+			},
+			command: "cmnd/tasmota-DDEEFF/Power",
+			stat:    "stat/tasmota-DDEEFF/RESULT",
+			tele:    "tele/tasmota-DDEEFF/STATE",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.topics.Command("Power"); got != tt.command {
+				t.Errorf("Command() = %v, want %v", got, tt.command)
+			}
+			if got := tt.topics.Stat("RESULT"); got != tt.stat {
+				t.Errorf("Stat() = %v, want %v", got, tt.stat)
+			}
+			if got := tt.topics.Tele("STATE"); got != tt.tele {
+				t.Errorf("Tele() = %v, want %v", got, tt.tele)
+			}
+		})
+	}
+}
+
+func TestTopicMatches(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{"stat/plug/RESULT", "stat/plug/RESULT", true},
+		{"stat/plug/+", "stat/plug/RESULT", true},
+		{"stat/+/RESULT", "stat/plug/RESULT", true},
+		{"stat/#", "stat/plug/RESULT", true},
+		{"#", "stat/plug/RESULT", true},
+		{"stat/plug/+", "stat/plug", false},
+		{"stat/plug/+", "stat/plug/a/b", false},
+		{"stat/plug", "stat/plug/RESULT", false},
+		{"tele/plug/+", "stat/plug/RESULT", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter+"_"+tt.topic, func(t *testing.T) {
+			if got := topicMatches(tt.filter, tt.topic); got != tt.want {
+				t.Errorf("topicMatches(%q, %q) = %v, want %v", tt.filter, tt.topic, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewMQTTTransport(t *testing.T) {
+	if _, err := NewMQTTTransport(nil, DeviceTopics{Topic: "plug"}); !IsNetworkError(err) {
+		t.Errorf("nil conn error = %v, want network error", err)
+	}
+	if _, err := NewMQTTTransport(newMemBroker(), DeviceTopics{}); !IsCommandError(err) {
+		t.Errorf("empty topic error = %v, want command error", err)
+	}
+}
+
+func TestMQTTTransport_Power(t *testing.T) {
+	broker := newMemBroker()
+	topics := DeviceTopics{Topic: "plug"}
+
+	var gotCmd, gotPayload string
+	attachDevice(t, broker, topics, func(cmd, payload string) [][2]string {
+		gotCmd, gotPayload = cmd, payload
+		return [][2]string{
+			{"RESULT", `{"POWER2":"ON"}`},
+			{"POWER2", "ON"},
+		}
+	})
+
+	client, err := NewMQTTClient(broker, topics)
+	if err != nil {
+		t.Fatalf("NewMQTTClient() error: %v", err)
+	}
+
+	resp, err := client.PowerN(context.Background(), 2, PowerOn)
+	if err != nil {
+		t.Fatalf("PowerN() error: %v", err)
+	}
+	if gotCmd != "Power2" || gotPayload != "ON" {
+		t.Errorf("device received %q %q, want Power2 ON", gotCmd, gotPayload)
+	}
+	if !resp.IsOn(2) {
+		t.Errorf("relay 2 = %v, want ON", resp.Power2)
+	}
+}
+
+func TestMQTTTransport_StatusMerge(t *testing.T) {
+	broker := newMemBroker()
+	topics := DeviceTopics{Topic: "plug", Prefix2: "state"}
+
+	attachDevice(t, broker, topics, func(cmd, payload string) [][2]string {
+		if cmd != "Status" || payload != "0" {
+			t.Errorf("device received %q %q, want Status 0", cmd, payload)
+		}
+		return [][2]string{
+			{"STATUS", `{"Status":{"Module":1,"DeviceName":"Plug","Topic":"plug"}}`},
+			{"STATUS2", `{"StatusFWR":{"Version":"14.2.0(tasmota)"}}`},
+			{"STATUS5", `{"StatusNET":{"Hostname":"plug-1234"}}`},
+		}
+	})
+
+	transport, err := NewMQTTTransport(broker, topics, WithMQTTSettle(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewMQTTTransport() error: %v", err)
+	}
+	client, err := NewMQTTClient(broker, topics, WithTransport(transport))
+	if err != nil {
+		t.Fatalf("NewMQTTClient() error: %v", err)
+	}
+
+	raw, err := client.ExecuteCommand(context.Background(), "Status 0")
+	if err != nil {
+		t.Fatalf("ExecuteCommand() error: %v", err)
+	}
+	var resp StatusResponse
+	if err := unmarshalJSON(raw, &resp); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if resp.Status == nil || resp.Status.DeviceName != "Plug" {
+		t.Errorf("Status = %+v, want DeviceName Plug", resp.Status)
+	}
+	if resp.StatusFWR == nil || resp.StatusFWR.Version != "14.2.0(tasmota)" {
+		t.Errorf("StatusFWR = %+v, want version 14.2.0(tasmota)", resp.StatusFWR)
+	}
+	if resp.StatusNET == nil || resp.StatusNET.Hostname != "plug-1234" {
+		t.Errorf("StatusNET = %+v, want hostname plug-1234", resp.StatusNET)
+	}
+}
+
+func TestMQTTTransport_Backlog(t *testing.T) {
+	broker := newMemBroker()
+	topics := DeviceTopics{Topic: "plug"}
+
+	var got string
+	attachDevice(t, broker, topics, func(cmd, payload string) [][2]string {
+		got = cmd + " " + payload
+		return [][2]string{
+			{"RESULT", `{"DeviceName":"Plug"}`},
+			{"RESULT", `{"LedState":1}`},
+		}
+	})
+
+	transport, err := NewMQTTTransport(broker, topics, WithMQTTSettle(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewMQTTTransport() error: %v", err)
+	}
+	client, err := NewMQTTClient(broker, topics, WithTransport(transport))
+	if err != nil {
+		t.Fatalf("NewMQTTClient() error: %v", err)
+	}
+
+	if err := client.ApplyConfig(context.Background(), &DeviceConfig{DeviceName: "Plug"}); err != nil {
+		t.Fatalf("ApplyConfig() error: %v", err)
+	}
+	if !strings.HasPrefix(got, "Backlog DeviceName Plug; ") {
+		t.Errorf("device received %q, want Backlog DeviceName Plug; ...", got)
+	}
+}
+
+func TestMQTTTransport_BacklogIgnoresUnrelatedReplies(t *testing.T) {
+	broker := newMemBroker()
+	topics := DeviceTopics{Topic: "plug"}
+
+	attachDevice(t, broker, topics, func(string, string) [][2]string {
+		return [][2]string{
+			{"RESULT", `{"DeviceName":"Plug"}`},
+			// A button press while the backlog runs
+			{"RESULT", `{"POWER":"OFF"}`},
+			{"RESULT", `{"LedState":1}`},
+		}
+	})
+
+	transport, err := NewMQTTTransport(broker, topics, WithMQTTSettle(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewMQTTTransport() error: %v", err)
+	}
+	client, err := NewMQTTClient(broker, topics, WithTransport(transport))
+	if err != nil {
+		t.Fatalf("NewMQTTClient() error: %v", err)
+	}
+
+	raw, err := client.ExecuteCommand(context.Background(), "Backlog DeviceName Plug; LedState 1")
+	if err != nil {
+		t.Fatalf("ExecuteCommand() error: %v", err)
+	}
+	if got := string(raw); got != `{"DeviceName":"Plug","LedState":1}` {
+		t.Errorf("ExecuteCommand() = %s, want only the backlog replies", got)
+	}
+}
+
+func TestMQTTTransport_Timers(t *testing.T) {
+	broker := newMemBroker()
+	topics := DeviceTopics{Topic: "plug"}
+
+	attachDevice(t, broker, topics, func(cmd, _ string) [][2]string {
+		if cmd != "Timers" {
+			t.Errorf("device received %q, want Timers", cmd)
+		}
+		replies := [][2]string{{"RESULT", `{"Timers":"ON"}`}}
+		for group := range 4 {
+			var timers []string
+			for n := group*4 + 1; n <= group*4+4; n++ {
+				timers = append(timers, fmt.Sprintf(`"Timer%d":{"Enable":%d,"Mode":0,"Time":"07:%02d","Window":0,"Days":"1111111","Repeat":1,"Output":1,"Action":1}`, n, n%2, n))
+			}
+			replies = append(replies, [2]string{"RESULT", fmt.Sprintf(`{"Timers%d":{%s}}`, group+1, strings.Join(timers, ","))})
+		}
+		return replies
+	})
+
+	transport, err := NewMQTTTransport(broker, topics, WithMQTTSettle(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewMQTTTransport() error: %v", err)
+	}
+	client, err := NewMQTTClient(broker, topics, WithTransport(transport))
+	if err != nil {
+		t.Fatalf("NewMQTTClient() error: %v", err)
+	}
+
+	timers, err := client.GetTimers(context.Background())
+	if err != nil {
+		t.Fatalf("GetTimers() error: %v", err)
+	}
+	if !timers.Enabled || len(timers.Timers) != MaxTimers {
+		t.Fatalf("GetTimers() = %+v, want 16 enabled timers", timers)
+	}
+	if got := timers.Timers[15]; got.Time != "07:16" || got.Enable {
+		t.Errorf("Timer16 = %+v, want 07:16 disabled", got)
+	}
+}
+
+func TestMQTTTransport_IgnoresUnrelatedReplies(t *testing.T) {
+	broker := newMemBroker()
+	topics := DeviceTopics{Topic: "plug"}
+
+	attachDevice(t, broker, topics, func(string, string) [][2]string {
+		// A button press lands on the same topic before the reply
+		return [][2]string{
+			{"RESULT", `{"POWER":"OFF"}`},
+			{"RESULT", `{"DeviceName":"Plug"}`},
+		}
+	})
+
+	client, err := NewMQTTClient(broker, topics)
+	if err != nil {
+		t.Fatalf("NewMQTTClient() error: %v", err)
+	}
+
+	raw, err := client.ExecuteCommand(context.Background(), "DeviceName")
+	if err != nil {
+		t.Fatalf("ExecuteCommand() error: %v", err)
+	}
+	if string(raw) != `{"DeviceName":"Plug"}` {
+		t.Errorf("ExecuteCommand() = %s, want the DeviceName reply", raw)
+	}
+}
+
+func TestMQTTTransport_Timeout(t *testing.T) {
+	client, err := NewMQTTClient(newMemBroker(), DeviceTopics{Topic: "offline"})
+	if err != nil {
+		t.Fatalf("NewMQTTClient() error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err = client.GetPower(ctx)
+	if !IsTimeoutError(err) {
+		t.Errorf("GetPower() error = %v, want timeout error", err)
+	}
+}
+
+func TestNewMQTTClient_WithTimeout(t *testing.T) {
+	client, err := NewMQTTClient(newMemBroker(), DeviceTopics{Topic: "offline"}, WithTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewMQTTClient() error: %v", err)
+	}
+
+	start := time.Now()
+	if _, err := client.GetPower(context.Background()); !IsTimeoutError(err) {
+		t.Errorf("GetPower() error = %v, want timeout error", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("GetPower() took %v, want the 20ms timeout", elapsed)
+	}
+}
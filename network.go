@@ -15,8 +15,8 @@ type NetworkConfig struct {
 	DNSServer IPAddr
 	SSID1     string
 	SSID2     string
-	Password1 string
-	Password2 string
+	Password1 Secret
+	Password2 Secret
 	UseDHCP   bool
 }
 
@@ -211,13 +211,13 @@ func (c *Client) SetNetworkConfig(ctx context.Context, cfg *NetworkConfig) error
 	if cfg.SSID1 != "" {
 		commands = append(commands, fmt.Sprintf("SSId1 %s", cfg.SSID1))
 		if cfg.Password1 != "" {
-			commands = append(commands, fmt.Sprintf("Password1 %s", cfg.Password1))
+			commands = append(commands, "Password1 "+string(cfg.Password1))
 		}
 	}
 	if cfg.SSID2 != "" {
 		commands = append(commands, fmt.Sprintf("SSId2 %s", cfg.SSID2))
 		if cfg.Password2 != "" {
-			commands = append(commands, fmt.Sprintf("Password2 %s", cfg.Password2))
+			commands = append(commands, "Password2 "+string(cfg.Password2))
 		}
 	}
 
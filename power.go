@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"strconv"
 	"strings"
 )
 
@@ -69,6 +68,34 @@ func (p *PowerResponse) GetState(relayNum int) string {
 	}
 }
 
+// setState sets the state of a specific relay and reports whether relayNum is valid.
+// relayNum should be 0 for POWER, 1-8 for POWER1-POWER8.
+func (p *PowerResponse) setState(relayNum int, state string) bool {
+	switch relayNum {
+	case 0:
+		p.Power = state
+	case 1:
+		p.Power1 = state
+	case 2:
+		p.Power2 = state
+	case 3:
+		p.Power3 = state
+	case 4:
+		p.Power4 = state
+	case 5:
+		p.Power5 = state
+	case 6:
+		p.Power6 = state
+	case 7:
+		p.Power7 = state
+	case 8:
+		p.Power8 = state
+	default:
+		return false
+	}
+	return true
+}
+
 // Power controls all relays or the main relay.
 // state can be PowerOn, PowerOff, PowerToggle, or PowerBlink.
 func (c *Client) Power(ctx context.Context, state PowerState) (*PowerResponse, error) {
@@ -153,43 +180,42 @@ func (c *Client) TogglePower(ctx context.Context, relayNum int) error {
 	return err
 }
 
-// GetCurrentPower returns the current power consumption in Watts.
+// GetCurrentPower returns the current power consumption in Watts, summed
+// over all phases or channels.
 // This requires a device with power monitoring capability.
 func (c *Client) GetCurrentPower(ctx context.Context) (float64, error) {
-	// Use Status 10 for sensor data which includes power monitoring
-	raw, err := c.ExecuteCommand(ctx, "Status 10")
+	energy, err := c.getEnergy(ctx)
 	if err != nil {
 		return 0, err
 	}
+	return energy.Power, nil
+}
 
-	var result struct {
-		StatusSNS struct {
-			Energy struct {
-				Power interface{} `json:"Power"`
-			} `json:"ENERGY"`
-		} `json:"StatusSNS"`
+// GetChannelPower returns the power consumption in Watts of one phase or
+// channel, counting from 1, of a three phase meter or a multi-channel device
+// such as the Shelly 2.5.
+func (c *Client) GetChannelPower(ctx context.Context, channel int) (float64, error) {
+	energy, err := c.getEnergy(ctx)
+	if err != nil {
+		return 0, err
 	}
-
-	if err := json.Unmarshal(raw, &result); err != nil {
-		return 0, NewError(ErrorTypeParse, "failed to parse status response", err)
+	phase, ok := energy.Phase(channel)
+	if !ok {
+		return 0, NewError(ErrorTypeCommand, fmt.Sprintf("channel must be between 1 and %d", energy.Phases()), nil)
 	}
+	return phase.Power, nil
+}
 
-	// Handle both int and float values
-	switch v := result.StatusSNS.Energy.Power.(type) {
-	case float64:
-		return v, nil
-	case int:
-		return float64(v), nil
-	case string:
-		// Try to parse string as float
-		f, err := strconv.ParseFloat(v, 64)
-		if err != nil {
-			return 0, NewError(ErrorTypeParse, "power value is not a number", err)
-		}
-		return f, nil
-	default:
-		return 0, NewError(ErrorTypeParse, "power value has unexpected type", nil)
+// getEnergy reads the ENERGY block from Status 10.
+func (c *Client) getEnergy(ctx context.Context) (*EnergyData, error) {
+	sensors, err := c.GetSensorData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if sensors.Energy == nil || !sensors.Energy.reported("Power") {
+		return nil, NewError(ErrorTypeParse, "sensor data has no power reading", nil)
 	}
+	return sensors.Energy, nil
 }
 
 // executePowerCommand is a helper to execute power commands and parse responses.
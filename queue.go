@@ -0,0 +1,91 @@
+package tasmota
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// DefaultKeepAlive is how long an idle connection to a device is kept open.
+const DefaultKeepAlive = 30 * time.Second
+
+// WithCommandSpacing makes the client wait at least d between the end of one
+// request to the device and the start of the next.
+func WithCommandSpacing(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.queue.spacing = d
+	}
+}
+
+// WithKeepAlive sets how long an idle connection to the device is kept open
+// for the next request. Zero or less closes the connection after every
+// request, which suits firmware that is slow to notice a client went away.
+// It has no effect on a client set with WithHTTPClient.
+func WithKeepAlive(idle time.Duration) ClientOption {
+	return func(c *Client) {
+		c.keepAlive = &idle
+	}
+}
+
+// requestQueue lets one request at a time through to a device, since the
+// device web server only handles a single connection.
+type requestQueue struct {
+	slot    chan struct{}
+	spacing time.Duration
+	// last is when the previous request finished; it is only accessed
+	// while holding the slot.
+	last time.Time
+}
+
+func newRequestQueue() *requestQueue {
+	return &requestQueue{slot: make(chan struct{}, 1)}
+}
+
+// acquire waits until the device is free and the spacing has passed.
+func (q *requestQueue) acquire(ctx context.Context) error {
+	if q == nil {
+		return nil
+	}
+	select {
+	case q.slot <- struct{}{}:
+	case <-ctx.Done():
+		return queueError(ctx)
+	}
+
+	if wait := time.Until(q.last.Add(q.spacing)); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			<-q.slot
+			return queueError(ctx)
+		}
+	}
+	return nil
+}
+
+// release lets the next request through.
+func (q *requestQueue) release() {
+	if q == nil {
+		return
+	}
+	q.last = time.Now()
+	<-q.slot
+}
+
+func queueError(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return NewError(ErrorTypeTimeout, "timed out waiting for the device", ctx.Err())
+	}
+	return NewError(ErrorTypeNetwork, "request canceled", ctx.Err())
+}
+
+// applyKeepAlive tunes transport for WithKeepAlive.
+func applyKeepAlive(transport *http.Transport, idle time.Duration) {
+	if idle <= 0 {
+		transport.DisableKeepAlives = true
+		return
+	}
+	transport.IdleConnTimeout = idle
+}
@@ -0,0 +1,126 @@
+package tasmota
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient_SerializesRequests(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		_, _ = w.Write([]byte(`{"POWER":"ON"}`))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("NewClient() error: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			if _, err := client.ExecuteCommand(context.Background(), "Power"); err != nil {
+				t.Errorf("ExecuteCommand() error: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if n := maxInFlight.Load(); n != 1 {
+		t.Errorf("%d requests reached the device at once, want 1", n)
+	}
+}
+
+func TestWithCommandSpacing(t *testing.T) {
+	var mu sync.Mutex
+	var times []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"POWER":"ON"}`))
+	}))
+	defer server.Close()
+
+	const spacing = 20 * time.Millisecond
+	client, err := NewClient(server.URL, WithCommandSpacing(spacing))
+	if err != nil {
+		t.Fatalf("NewClient() error: %v", err)
+	}
+	ctx := context.Background()
+
+	for range 3 {
+		if _, err := client.ExecuteCommand(ctx, "Power"); err != nil {
+			t.Fatalf("ExecuteCommand() error: %v", err)
+		}
+	}
+	for i := 1; i < len(times); i++ {
+		if gap := times[i].Sub(times[i-1]); gap < spacing {
+			t.Errorf("request %d came %v after the previous one, want at least %v", i+1, gap, spacing)
+		}
+	}
+
+	// A deadline that expires while waiting is a timeout.
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	if _, err := client.ExecuteCommand(ctx, "Power"); !IsTimeoutError(err) {
+		t.Errorf("ExecuteCommand() error = %v, want timeout error", err)
+	}
+	if _, err := client.ExecuteCommand(context.Background(), "Power"); err != nil {
+		t.Errorf("ExecuteCommand() after timeout error: %v", err)
+	}
+}
+
+func TestWithKeepAlive(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []ClientOption
+		wantIdle    time.Duration
+		wantDisable bool
+	}{
+		{name: "default", wantIdle: DefaultKeepAlive},
+		{name: "custom", opts: []ClientOption{WithKeepAlive(5 * time.Second)}, wantIdle: 5 * time.Second},
+		{name: "disabled", opts: []ClientOption{WithKeepAlive(0)}, wantIdle: DefaultKeepAlive, wantDisable: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient("192.168.1.100", tt.opts...)
+			if err != nil {
+				t.Fatalf("NewClient() error: %v", err)
+			}
+			transport := client.httpClient.Transport.(*http.Transport)
+			if transport.IdleConnTimeout != tt.wantIdle || transport.DisableKeepAlives != tt.wantDisable {
+				t.Errorf("transport idle = %v, disabled = %v, want %v, %v",
+					transport.IdleConnTimeout, transport.DisableKeepAlives, tt.wantIdle, tt.wantDisable)
+			}
+			if transport.MaxConnsPerHost != 1 {
+				t.Errorf("MaxConnsPerHost = %d, want 1", transport.MaxConnsPerHost)
+			}
+		})
+	}
+
+	// A caller's own HTTP client is left alone.
+	own := &http.Client{Transport: &http.Transport{}}
+	if _, err := NewClient("192.168.1.100", WithHTTPClient(own), WithKeepAlive(0)); err != nil {
+		t.Fatalf("NewClient() error: %v", err)
+	}
+	if own.Transport.(*http.Transport).DisableKeepAlives {
+		t.Error("WithKeepAlive changed the transport of WithHTTPClient")
+	}
+}
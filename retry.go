@@ -0,0 +1,225 @@
+package tasmota
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is wrapped by the network error returned while the circuit
+// breaker considers a device offline.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// RetryPolicy configures how failed commands are retried.
+//
+// Commands that change state relative to the current one are never retried,
+// since the first attempt may have reached the device even if its reply did
+// not: Power TOGGLE, Restart, Reset, Upgrade, relative steps such as
+// "Dimmer +" or "Counter1 +5", Add, Sub and Mult, Var, Mem and RuleTimer
+// expressions, and Publish, WebSend and IR, RF, Tuya or Zigbee sends, which
+// may start a one-shot action on another device. A Backlog is retried only if
+// every command in it is safe and no command follows a Delay.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first one.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry. It doubles with
+	// every retry, up to MaxBackoff if that is set.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Jitter is the fraction (0-1) of each wait that is randomized, so
+	// clients retrying together spread out.
+	Jitter float64
+	// RetryOn lists the error types that are retried.
+	RetryOn []ErrorType
+}
+
+// DefaultRetryPolicy returns a policy that makes three attempts, retrying
+// network errors and timeouts after 200 ms and 400 ms.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     2 * time.Second,
+		Jitter:         0.2,
+		RetryOn:        []ErrorType{ErrorTypeNetwork, ErrorTypeTimeout},
+	}
+}
+
+// WithRetry retries failed commands according to policy.
+func WithRetry(policy RetryPolicy) ClientOption {
+	return func(c *Client) {
+		c.retry = &policy
+	}
+}
+
+// WithCircuitBreaker makes the client fail fast once threshold commands in a
+// row failed with a network error or timeout. While the breaker is open,
+// commands return a network error wrapping ErrCircuitOpen without contacting
+// the device. After cooldown one command is let through; if it succeeds the
+// breaker closes, otherwise it stays open for another cooldown.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) ClientOption {
+	return func(c *Client) {
+		c.breaker = &circuitBreaker{
+			threshold: max(threshold, 1),
+			cooldown:  cooldown,
+			now:       time.Now,
+		}
+	}
+}
+
+// retries reports whether err is of a type the policy retries.
+func (p *RetryPolicy) retries(err error) bool {
+	var tErr *Error
+	if !errors.As(err, &tErr) || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	return slices.Contains(p.RetryOn, tErr.Type)
+}
+
+// backoff returns the wait before retry n, counting from 1.
+func (p *RetryPolicy) backoff(n int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < n && (p.MaxBackoff == 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 {
+		d = min(d, p.MaxBackoff)
+	}
+	jitter := min(max(p.Jitter, 0), 1)
+	return d - time.Duration(rand.Float64()*jitter*float64(d))
+}
+
+// executeWithRetry runs a command, retrying it as the retry policy allows.
+func (c *Client) executeWithRetry(ctx context.Context, command string) (json.RawMessage, error) {
+	raw, err := c.execute(ctx, command)
+	if c.retry == nil || err == nil || !retrySafe(command) {
+		return raw, err
+	}
+
+	for attempt := 1; attempt < c.retry.MaxAttempts && c.retry.retries(err); attempt++ {
+		timer := time.NewTimer(c.retry.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+
+		if c.logger != nil {
+			c.logger.Debug("retrying command",
+				"attempt", attempt+1,
+				"error", err)
+		}
+		raw, err = c.execute(ctx, command)
+		if err == nil {
+			break
+		}
+	}
+	return raw, err
+}
+
+// retrySafe reports whether sending command twice has the same effect as
+// sending it once.
+func retrySafe(command string) bool {
+	lines := backlogCommands(command)
+	for i, line := range lines {
+		name, payload, _ := strings.Cut(strings.TrimSpace(line), " ")
+		name = strings.ToLower(strings.TrimRight(name, "0123456789"))
+		payload = strings.ToLower(strings.TrimSpace(payload))
+
+		switch name {
+		case "restart", "reset", "upgrade", "event", "publish", "websend",
+			"irsend", "irhvac", "rfsend", "rfkey", "tuyasend", "zbsend",
+			"shuttertoggle", "add", "sub", "mult":
+			return false
+		case "rfraw":
+			// RfRaw with a number switches modes; AA...55 sends a frame
+			if strings.HasPrefix(payload, "aa") {
+				return false
+			}
+		case "power":
+			if payload == "2" {
+				return false
+			}
+		case "counter":
+			// Counter1 +5 and -5 add to the count
+			if strings.HasPrefix(payload, "+") || strings.HasPrefix(payload, "-") {
+				return false
+			}
+		case "var", "mem", "ruletimer":
+			// Expressions may refer to the current value, as in %var1%+1
+			if strings.HasPrefix(payload, "=") || strings.Contains(payload, "%") {
+				return false
+			}
+		case "delay":
+			// The device answers before a Backlog's delayed commands run, so
+			// a retry could run them twice
+			if i < len(lines)-1 {
+				return false
+			}
+		}
+		switch payload {
+		case "+", "-", "<", ">":
+			return false
+		}
+		if strings.Contains(payload, "toggle") {
+			return false
+		}
+	}
+	return true
+}
+
+// circuitBreaker tracks consecutive connection failures to a device.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// allow returns an error while the breaker is open. Once the cooldown has
+// passed it lets one command through and stays open for the others.
+func (b *circuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return nil
+	}
+	now := b.now()
+	if now.Before(b.openUntil) {
+		return NewError(ErrorTypeNetwork, "device is offline", ErrCircuitOpen)
+	}
+	b.openUntil = now.Add(b.cooldown)
+	return nil
+}
+
+// record counts a command's outcome. Only network errors and timeouts mean
+// the device is unreachable.
+func (b *circuitBreaker) record(err error) {
+	if b == nil || errors.Is(err, ErrCircuitOpen) {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !IsNetworkError(err) && !IsTimeoutError(err) {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = b.now().Add(b.cooldown)
+	}
+}
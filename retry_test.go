@@ -0,0 +1,172 @@
+package tasmota
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetrySafe(t *testing.T) {
+	tests := []struct {
+		command string
+		want    bool
+	}{
+		{"Power ON", true},
+		{"Power2 off", true},
+		{"Power TOGGLE", false},
+		{"Power1 2", false},
+		{"Restart 1", false},
+		{"Reset 5", false},
+		{"Upgrade 1", false},
+		{"Dimmer 50", true},
+		{"Dimmer +", false},
+		{"Dimmer >", false},
+		{"Dimmer <", false},
+		{"Add1 5", false},
+		{"Sub2 1", false},
+		{"Mult3 2", false},
+		{"Counter1 0", true},
+		{"Counter1 +5", false},
+		{"Counter2 -1", false},
+		{"Var1 10", true},
+		{"Var1 =%var1%+1", false},
+		{"Mem2 %var1%", false},
+		{"RuleTimer1 60", true},
+		{"RuleTimer1 %timer1%+60", false},
+		{"Publish stat/kitchen/msg on", false},
+		{"Publish2 stat/kitchen/msg on", false},
+		{"WebSend [10.0.0.2] Power1 ON", false},
+		{"IRSend 0,100", false},
+		{"RfKey3", false},
+		{`IRHVAC {"Vendor":"Mitsubishi_Heavy","Power":"On"}`, false},
+		{"RfRaw AAB0210314016703F924180101010155", false},
+		{"RfRaw 177", true},
+		{"TuyaSend1 1,1", false},
+		{`ZbSend {"Device":"Lamp","Send":{"Power":"On"}}`, false},
+		{`ZbSend {"Device":"Lamp","Send":{"Power":"Toggle"}}`, false},
+		{"Status 0", true},
+		{"Backlog Power ON; Dimmer 20", true},
+		{"Backlog Power ON; Restart 1", false},
+		{"Backlog Power ON; Delay 10", true},
+		{"Backlog Power ON; Delay 10; Power OFF", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			if got := retrySafe(tt.command); got != tt.want {
+				t.Errorf("retrySafe(%q) = %v, want %v", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}
+	for n, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 300 * time.Millisecond, 10: 300 * time.Millisecond} {
+		if got := p.backoff(n); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", n, got, want)
+		}
+	}
+
+	uncapped := RetryPolicy{InitialBackoff: 100 * time.Millisecond}
+	if got := uncapped.backoff(4); got != 800*time.Millisecond {
+		t.Errorf("backoff(4) without MaxBackoff = %v, want 800ms", got)
+	}
+
+	p.Jitter = 0.5
+	for range 100 {
+		if got := p.backoff(2); got < 100*time.Millisecond || got > 200*time.Millisecond {
+			t.Fatalf("backoff(2) with jitter = %v, want 100-200ms", got)
+		}
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, RetryOn: []ErrorType{ErrorTypeNetwork}}
+	srv, client := newTestDevice(t)
+	WithRetry(policy)(client)
+	ctx := context.Background()
+
+	srv.Drop(2)
+	if err := client.SetPowerOn(ctx, 1); err != nil {
+		t.Fatalf("SetPowerOn() after two drops error: %v", err)
+	}
+	if !srv.State().Relays[0] {
+		t.Error("relay is off")
+	}
+
+	srv.Drop(3)
+	if err := client.SetPowerOn(ctx, 1); !IsNetworkError(err) {
+		t.Errorf("SetPowerOn() after three drops error = %v, want network error", err)
+	}
+
+	// A toggle that may have reached the device is not sent again.
+	srv.Drop(1)
+	if _, err := client.ExecuteCommand(ctx, "Power TOGGLE"); !IsNetworkError(err) {
+		t.Errorf("ExecuteCommand(Power TOGGLE) error = %v, want network error", err)
+	}
+	if !srv.State().Relays[0] {
+		t.Error("toggle was retried")
+	}
+
+	// Rejected commands are not retried.
+	before := len(srv.Commands())
+	if _, err := client.ExecuteCommand(ctx, "Power9 ON"); !IsCommandError(err) {
+		t.Errorf("ExecuteCommand(Power9 ON) error = %v, want command error", err)
+	}
+	if n := len(srv.Commands()) - before; n != 1 {
+		t.Errorf("sent %d times, want once", n)
+	}
+
+	// Cancelling the context stops the wait between attempts.
+	WithRetry(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour, RetryOn: []ErrorType{ErrorTypeNetwork}})(client)
+	srv.Drop(1)
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.ExecuteCommand(ctx, "Power"); !IsNetworkError(err) {
+		t.Errorf("ExecuteCommand() error = %v, want network error", err)
+	}
+}
+
+func TestWithCircuitBreaker(t *testing.T) {
+	srv, client := newTestDevice(t)
+	WithCircuitBreaker(2, time.Minute)(client)
+	now := time.Now()
+	client.breaker.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	srv.Drop(2)
+	for range 2 {
+		if _, err := client.ExecuteCommand(ctx, "Power"); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("ExecuteCommand() error = %v, want the device's error", err)
+		}
+	}
+
+	// Open: fail fast without contacting the device.
+	before := len(srv.Commands())
+	if _, err := client.ExecuteCommand(ctx, "Power"); !IsNetworkError(err) || !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("ExecuteCommand() error = %v, want ErrCircuitOpen", err)
+	}
+	if len(srv.Commands()) != before {
+		t.Error("command reached the device while the breaker was open")
+	}
+
+	// After the cooldown a failing probe keeps it open.
+	now = now.Add(time.Minute)
+	srv.Drop(1)
+	if _, err := client.ExecuteCommand(ctx, "Power"); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("probe error = %v, want the device's error", err)
+	}
+	if _, err := client.ExecuteCommand(ctx, "Power"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("ExecuteCommand() after failed probe error = %v, want ErrCircuitOpen", err)
+	}
+
+	// A successful probe closes it.
+	now = now.Add(time.Minute)
+	for range 2 {
+		if _, err := client.ExecuteCommand(ctx, "Power"); err != nil {
+			t.Errorf("ExecuteCommand() after recovery error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,528 @@
+package tasmota
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// RfKeys is the number of RfKey slots on an RF bridge.
+const RfKeys = 16
+
+// RfStoreVersion is the version of the document written by SaveRfStore.
+const RfStoreVersion = 1
+
+// RfCode is a code sent with RfSend or received by an RCSwitch receiver.
+// Zero fields other than Data use the device defaults.
+type RfCode struct {
+	Data     uint64 `json:"data"`
+	Bits     int    `json:"bits,omitempty"`
+	Protocol int    `json:"protocol,omitempty"`
+	// Pulse is the pulse length in microseconds.
+	Pulse  int `json:"pulse,omitempty"`
+	Repeat int `json:"repeat,omitempty"`
+}
+
+// Validate checks the code can be sent.
+func (c *RfCode) Validate() error {
+	if c.Bits < 0 || c.Bits > 64 {
+		return NewError(ErrorTypeCommand, "RF bits must be between 0 and 64", nil)
+	}
+	if c.Bits > 0 && c.Bits < 64 && c.Data>>c.Bits != 0 {
+		return NewError(ErrorTypeCommand, fmt.Sprintf("RF data 0x%X does not fit in %d bits", c.Data, c.Bits), nil)
+	}
+	if c.Protocol < 0 || c.Pulse < 0 || c.Repeat < 0 {
+		return NewError(ErrorTypeCommand, "RF protocol, pulse and repeat cannot be negative", nil)
+	}
+	return nil
+}
+
+// RfKeyCode is a code of the RF bridge receiver: sync, low and high times
+// in microseconds and 24 bits of data.
+type RfKeyCode struct {
+	Sync int    `json:"sync"`
+	Low  int    `json:"low"`
+	High int    `json:"high"`
+	Data uint32 `json:"data"`
+}
+
+// Validate checks the timings fit the bridge settings.
+func (c *RfKeyCode) Validate() error {
+	for _, t := range []int{c.Sync, c.Low, c.High} {
+		if t <= 0 || t > 65535 {
+			return NewError(ErrorTypeCommand, fmt.Sprintf("invalid RF timing %d", t), nil)
+		}
+	}
+	if c.Data > 0xFFFFFF {
+		return NewError(ErrorTypeCommand, fmt.Sprintf("RF key data 0x%X is longer than 24 bits", c.Data), nil)
+	}
+	return nil
+}
+
+// RfReceived is a code decoded from an RfReceived message. The RF bridge
+// reports Key; RCSwitch receivers report Code.
+type RfReceived struct {
+	Key  *RfKeyCode
+	Code *RfCode
+	// RfKey is the slot whose learned code matched, or 0.
+	RfKey int
+}
+
+// ParseRfReceived decodes the RfReceived message in a RESULT payload.
+func ParseRfReceived(payload []byte) (*RfReceived, error) {
+	var resp struct {
+		RfReceived *struct {
+			Sync     int
+			Low      int
+			High     int
+			Data     json.RawMessage
+			Bits     int
+			Protocol int
+			Pulse    int
+			RfKey    any
+		} `json:"RfReceived"`
+	}
+	if err := unmarshalJSON(payload, &resp); err != nil {
+		return nil, err
+	}
+	msg := resp.RfReceived
+	if msg == nil {
+		return nil, NewError(ErrorTypeParse, "payload has no RfReceived", nil)
+	}
+
+	data, err := parseRfData(msg.Data)
+	if err != nil {
+		return nil, err
+	}
+	received := &RfReceived{}
+	if msg.Sync != 0 {
+		received.Key = &RfKeyCode{Sync: msg.Sync, Low: msg.Low, High: msg.High, Data: uint32(data)}
+	} else {
+		received.Code = &RfCode{Data: data, Bits: msg.Bits, Protocol: msg.Protocol, Pulse: msg.Pulse}
+	}
+	switch key := msg.RfKey.(type) {
+	case float64:
+		received.RfKey = int(key)
+	case string:
+		received.RfKey, _ = strconv.Atoi(key)
+	}
+	return received, nil
+}
+
+// parseRfData parses RF data given as a number or as hex, with or without
+// a 0x prefix.
+func parseRfData(raw json.RawMessage) (uint64, error) {
+	if len(raw) == 0 {
+		return 0, NewError(ErrorTypeParse, "RF message has no data", nil)
+	}
+	var n uint64
+	if json.Unmarshal(raw, &n) == nil {
+		return n, nil
+	}
+	var s string
+	if err := unmarshalJSON(raw, &s); err != nil {
+		return 0, err
+	}
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	n, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, NewError(ErrorTypeParse, fmt.Sprintf("invalid RF data %q", s), err)
+	}
+	return n, nil
+}
+
+// RfRawFrame is a frame of the Portisch RF bridge firmware, as sniffed in
+// RfRaw mode. Sniffed frames (0xB1) carry timing buckets and, for every
+// pulse, the index of its bucket.
+type RfRawFrame struct {
+	Command byte
+	// Buckets are pulse lengths in microseconds.
+	Buckets []int
+	// Pulses are bucket indexes, alternating high and low.
+	Pulses []int
+	// Payload is the frame content for commands other than 0xB1.
+	Payload []byte
+}
+
+// Timings returns the pulse lengths of a sniffed frame in microseconds.
+func (f *RfRawFrame) Timings() []int {
+	timings := make([]int, 0, len(f.Pulses))
+	for _, p := range f.Pulses {
+		if p < len(f.Buckets) {
+			timings = append(timings, f.Buckets[p])
+		}
+	}
+	return timings
+}
+
+// B0 converts a sniffed frame to the 0xB0 frame that transmits it,
+// repeated the given number of times, for SendRfRaw.
+func (f *RfRawFrame) B0(repeats int) (string, error) {
+	if f.Command != 0xB1 || len(f.Pulses)%2 != 0 {
+		return "", NewError(ErrorTypeCommand, "only complete sniffed 0xB1 frames can be converted", nil)
+	}
+	if repeats < 1 || repeats > 255 {
+		return "", NewError(ErrorTypeCommand, "RF raw repeats must be between 1 and 255", nil)
+	}
+
+	body := []byte{byte(len(f.Buckets)), byte(repeats)}
+	for _, b := range f.Buckets {
+		body = append(body, byte(b>>8), byte(b))
+	}
+	for i := 0; i < len(f.Pulses); i += 2 {
+		body = append(body, byte(f.Pulses[i]<<4|f.Pulses[i+1]))
+	}
+	if len(body) > 255 {
+		return "", NewError(ErrorTypeCommand, "RF raw frame is too long", nil)
+	}
+
+	frame := append([]byte{0xAA, 0xB0, byte(len(body))}, body...)
+	return strings.ToUpper(hex.EncodeToString(append(frame, 0x55))), nil
+}
+
+// ParseRfRaw decodes the RfRaw message a Portisch bridge sends in RfRaw
+// mode.
+func ParseRfRaw(payload []byte) (*RfRawFrame, error) {
+	var resp struct {
+		RfRaw *struct {
+			Data string `json:"Data"`
+		} `json:"RfRaw"`
+	}
+	if err := unmarshalJSON(payload, &resp); err != nil {
+		return nil, err
+	}
+	if resp.RfRaw == nil {
+		return nil, NewError(ErrorTypeParse, "payload has no RfRaw", nil)
+	}
+
+	data, err := hex.DecodeString(strings.ReplaceAll(resp.RfRaw.Data, " ", ""))
+	if err != nil || len(data) < 3 || data[0] != 0xAA || data[len(data)-1] != 0x55 {
+		return nil, NewError(ErrorTypeParse, fmt.Sprintf("invalid RfRaw frame %q", resp.RfRaw.Data), err)
+	}
+	frame := &RfRawFrame{Command: data[1]}
+	body := data[2 : len(data)-1]
+	if frame.Command != 0xB1 {
+		frame.Payload = body
+		return frame, nil
+	}
+
+	if len(body) < 1 || len(body) < 1+2*int(body[0]) {
+		return nil, NewError(ErrorTypeParse, "truncated RfRaw 0xB1 frame", nil)
+	}
+	n := int(body[0])
+	for i := range n {
+		frame.Buckets = append(frame.Buckets, int(body[1+2*i])<<8|int(body[2+2*i]))
+	}
+	for _, b := range body[1+2*n:] {
+		frame.Pulses = append(frame.Pulses, int(b>>4), int(b&0x0F))
+	}
+	return frame, nil
+}
+
+// SendRf sends a code with RfSend.
+func (c *Client) SendRf(ctx context.Context, code RfCode) error {
+	if err := code.Validate(); err != nil {
+		return err
+	}
+	payload := map[string]any{"Data": fmt.Sprintf("0x%X", code.Data)}
+	for name, v := range map[string]int{"Bits": code.Bits, "Protocol": code.Protocol, "Pulse": code.Pulse, "Repeat": code.Repeat} {
+		if v != 0 {
+			payload[name] = v
+		}
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return NewError(ErrorTypeCommand, "failed to encode RF code", err)
+	}
+	_, err = c.rfCommand(ctx, "RfSend", string(data))
+	return err
+}
+
+// SendRfKey transmits the learned code of a slot, or the default code if
+// nothing was learned.
+func (c *Client) SendRfKey(ctx context.Context, key int) error {
+	return c.rfKeyCommand(ctx, key, "")
+}
+
+// LearnRfKey starts learning a slot. The bridge reports "Learned" or
+// "Learning timeout" on stat/RESULT once a remote is pressed or after
+// about a minute; read the result with GetRfKey.
+func (c *Client) LearnRfKey(ctx context.Context, key int) error {
+	return c.rfKeyCommand(ctx, key, "2")
+}
+
+// ForgetRfKey clears the learned code of a slot.
+func (c *Client) ForgetRfKey(ctx context.Context, key int) error {
+	return c.rfKeyCommand(ctx, key, "3")
+}
+
+// GetRfKey reads a slot. learned is false when the slot holds the default
+// code.
+func (c *Client) GetRfKey(ctx context.Context, key int) (code *RfKeyCode, learned bool, err error) {
+	if err := checkRfKey(key); err != nil {
+		return nil, false, err
+	}
+	value, err := c.rfCommand(ctx, fmt.Sprintf("RfKey%d", key), "5")
+	if err != nil {
+		return nil, false, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := unmarshalJSON(value, &fields); err != nil {
+		return nil, false, err
+	}
+	// Slots without a learned code report "Default Sync" and so on
+	prefix := ""
+	if _, ok := fields["Sync"]; !ok {
+		prefix = "Default "
+	}
+	code = &RfKeyCode{}
+	for name, dst := range map[string]*int{"Sync": &code.Sync, "Low": &code.Low, "High": &code.High} {
+		if err := unmarshalJSON(fields[prefix+name], dst); err != nil {
+			return nil, false, err
+		}
+	}
+	data, err := parseRfData(fields[prefix+"Data"])
+	if err != nil {
+		return nil, false, err
+	}
+	code.Data = uint32(data)
+	return code, prefix == "", nil
+}
+
+// SetRfKey stores a code in a slot, as if it had been learned. The bridge
+// transmits the code once while storing it.
+func (c *Client) SetRfKey(ctx context.Context, key int, code RfKeyCode) error {
+	if err := checkRfKey(key); err != nil {
+		return err
+	}
+	if err := code.Validate(); err != nil {
+		return err
+	}
+	_, err := c.ExecuteBacklog(ctx,
+		fmt.Sprintf("RfSync %d", code.Sync),
+		fmt.Sprintf("RfLow %d", code.Low),
+		fmt.Sprintf("RfHigh %d", code.High),
+		fmt.Sprintf("RfCode #%06X", code.Data),
+		fmt.Sprintf("RfKey%d 4", key),
+	)
+	return err
+}
+
+// SetRfRaw turns raw sniffing on or off. It needs the Portisch firmware on
+// the bridge's RF chip; sniffed frames arrive as RfRaw messages for
+// ParseRfRaw.
+func (c *Client) SetRfRaw(ctx context.Context, enabled bool) error {
+	_, err := c.rfCommand(ctx, "RfRaw", strconv.Itoa(boolToInt(enabled)))
+	return err
+}
+
+// SendRfRaw sends a Portisch frame, such as one made by RfRawFrame.B0.
+func (c *Client) SendRfRaw(ctx context.Context, frame string) error {
+	frame = strings.ToUpper(strings.ReplaceAll(frame, " ", ""))
+	data, err := hex.DecodeString(frame)
+	if err != nil || len(data) < 3 || data[0] != 0xAA || data[len(data)-1] != 0x55 {
+		return NewError(ErrorTypeCommand, "RF raw frames are hex starting with AA and ending with 55", err)
+	}
+	_, err = c.rfCommand(ctx, "RfRaw", frame)
+	return err
+}
+
+func (c *Client) rfKeyCommand(ctx context.Context, key int, payload string) error {
+	if err := checkRfKey(key); err != nil {
+		return err
+	}
+	_, err := c.rfCommand(ctx, fmt.Sprintf("RfKey%d", key), payload)
+	return err
+}
+
+// rfCommand runs an RF command and returns the value under its name. Error
+// messages such as "Invalid data" are command errors.
+func (c *Client) rfCommand(ctx context.Context, name, payload string) (json.RawMessage, error) {
+	cmd := name
+	if payload != "" {
+		cmd += " " + payload
+	}
+	raw, err := c.ExecuteCommand(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	var resp map[string]json.RawMessage
+	if err := unmarshalJSON(raw, &resp); err != nil {
+		return nil, err
+	}
+	value, ok := resp[name]
+	if !ok {
+		return nil, NewError(ErrorTypeParse, fmt.Sprintf("response missing %s", name), nil)
+	}
+	var msg string
+	if json.Unmarshal(value, &msg) == nil && strings.Contains(strings.ToLower(msg), "invalid") {
+		return nil, NewError(ErrorTypeCommand, fmt.Sprintf("%s failed: %s", name, msg), nil)
+	}
+	return value, nil
+}
+
+func checkRfKey(key int) error {
+	if key < 1 || key > RfKeys {
+		return NewError(ErrorTypeCommand, fmt.Sprintf("RF key must be between 1 and %d", RfKeys), nil)
+	}
+	return nil
+}
+
+// RfStore is a library of named RF codes, saved as JSON so codes learned on
+// one bridge can be loaded into another.
+type RfStore struct {
+	Version int            `json:"version"`
+	Codes   []RfStoredCode `json:"codes"`
+}
+
+// RfStoredCode is one code in an RfStore. Exactly one of Key, Code and Raw
+// is set.
+type RfStoredCode struct {
+	Name string `json:"name"`
+	// Slot is the RfKey slot the code was exported from or is imported to.
+	Slot int        `json:"slot,omitempty"`
+	Key  *RfKeyCode `json:"key,omitempty"`
+	Code *RfCode    `json:"code,omitempty"`
+	// Raw is a Portisch frame for SendRfRaw.
+	Raw string `json:"raw,omitempty"`
+}
+
+// NewRfStore returns an empty store.
+func NewRfStore() *RfStore {
+	return &RfStore{Version: RfStoreVersion}
+}
+
+// Add stores a code, replacing any code with the same name.
+func (s *RfStore) Add(code RfStoredCode) error {
+	if code.Name == "" {
+		return NewError(ErrorTypeCommand, "stored RF code needs a name", nil)
+	}
+	set := 0
+	for _, ok := range []bool{code.Key != nil, code.Code != nil, code.Raw != ""} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return NewError(ErrorTypeCommand, fmt.Sprintf("stored RF code %q needs exactly one of key, code or raw", code.Name), nil)
+	}
+	if code.Slot != 0 {
+		if err := checkRfKey(code.Slot); err != nil {
+			return err
+		}
+	}
+
+	for i := range s.Codes {
+		if s.Codes[i].Name == code.Name {
+			s.Codes[i] = code
+			return nil
+		}
+	}
+	s.Codes = append(s.Codes, code)
+	return nil
+}
+
+// Get returns the code with the given name.
+func (s *RfStore) Get(name string) (*RfStoredCode, bool) {
+	for i := range s.Codes {
+		if s.Codes[i].Name == name {
+			return &s.Codes[i], true
+		}
+	}
+	return nil, false
+}
+
+// Remove deletes a code and reports whether it existed.
+func (s *RfStore) Remove(name string) bool {
+	for i := range s.Codes {
+		if s.Codes[i].Name == name {
+			s.Codes = append(s.Codes[:i], s.Codes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// SendStoredRf transmits a stored code with SendRf, SendRfRaw or, for bridge
+// codes, from its slot.
+func (c *Client) SendStoredRf(ctx context.Context, code *RfStoredCode) error {
+	switch {
+	case code.Code != nil:
+		return c.SendRf(ctx, *code.Code)
+	case code.Raw != "":
+		return c.SendRfRaw(ctx, code.Raw)
+	case code.Key != nil && code.Slot != 0:
+		return c.SendRfKey(ctx, code.Slot)
+	}
+	return NewError(ErrorTypeCommand, fmt.Sprintf("stored RF code %q cannot be sent", code.Name), nil)
+}
+
+// ExportRfKeys reads the learned slots of a bridge into a new store, named
+// "RfKey<n>". Slots holding the default code are skipped.
+func (c *Client) ExportRfKeys(ctx context.Context) (*RfStore, error) {
+	store := NewRfStore()
+	for key := 1; key <= RfKeys; key++ {
+		code, learned, err := c.GetRfKey(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if !learned {
+			continue
+		}
+		if err := store.Add(RfStoredCode{Name: fmt.Sprintf("RfKey%d", key), Slot: key, Key: code}); err != nil {
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+// ImportRfKeys stores every bridge code with a slot into that slot. Codes
+// without a slot, RfSend codes and raw frames are skipped.
+func (c *Client) ImportRfKeys(ctx context.Context, store *RfStore) error {
+	for _, code := range store.Codes {
+		if code.Key == nil || code.Slot == 0 {
+			continue
+		}
+		if err := c.SetRfKey(ctx, code.Slot, *code.Key); err != nil {
+			return fmt.Errorf("import %s: %w", code.Name, err)
+		}
+	}
+	return nil
+}
+
+// LoadRfStore reads a store written by SaveRfStore.
+func LoadRfStore(path string) (*RfStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, NewError(ErrorTypeCommand, "failed to read RF store", err)
+	}
+
+	var stored RfStore
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, NewError(ErrorTypeParse, "failed to parse RF store", err)
+	}
+	store := NewRfStore()
+	for _, code := range stored.Codes {
+		if err := store.Add(code); err != nil {
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+// SaveRfStore writes a store as indented JSON.
+func SaveRfStore(path string, s *RfStore) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return NewError(ErrorTypeParse, "failed to encode RF store", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		return NewError(ErrorTypeCommand, "failed to write RF store", err)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package tasmota
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kradalby/tasmota-go/tasmotatest"
+)
+
+func TestParseRfReceived(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    *RfReceived
+		wantErr bool
+	}{
+		{
+			name:    "bridge",
+			payload: `{"RfReceived":{"Sync":8470,"Low":270,"High":840,"Data":"F4C2A2","RfKey":"None"}}`,
+			want:    &RfReceived{Key: &RfKeyCode{Sync: 8470, Low: 270, High: 840, Data: 0xF4C2A2}},
+		},
+		{
+			name:    "bridge learned key",
+			payload: `{"RfReceived":{"Sync":8470,"Low":270,"High":840,"Data":"F4C2A2","RfKey":3}}`,
+			want:    &RfReceived{Key: &RfKeyCode{Sync: 8470, Low: 270, High: 840, Data: 0xF4C2A2}, RfKey: 3},
+		},
+		{
+			name:    "rcswitch",
+			payload: `{"RfReceived":{"Data":"0x7028D2","Bits":24,"Protocol":1,"Pulse":491}}`,
+			want:    &RfReceived{Code: &RfCode{Data: 0x7028D2, Bits: 24, Protocol: 1, Pulse: 491}},
+		},
+		{
+			name:    "rcswitch decimal",
+			payload: `{"RfReceived":{"Data":7350482,"Bits":24,"Protocol":1,"Pulse":491}}`,
+			want:    &RfReceived{Code: &RfCode{Data: 0x7028D2, Bits: 24, Protocol: 1, Pulse: 491}},
+		},
+		{name: "bad data", payload: `{"RfReceived":{"Data":"XYZ"}}`, wantErr: true},
+		{name: "not rf", payload: `{"POWER":"ON"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRfReceived([]byte(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRfReceived() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRfReceived() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRfRaw(t *testing.T) {
+	frame, err := ParseRfRaw([]byte(`{"RfRaw":{"Data":"AA B1 03 0140 0398 2710 0110 0110 0112 55"}}`))
+	if err != nil {
+		t.Fatalf("ParseRfRaw() error: %v", err)
+	}
+	if frame.Command != 0xB1 || !reflect.DeepEqual(frame.Buckets, []int{320, 920, 10000}) {
+		t.Errorf("ParseRfRaw() = %+v", frame)
+	}
+	wantTimings := []int{320, 920, 920, 320, 320, 920, 920, 320, 320, 920, 920, 10000}
+	if got := frame.Timings(); !reflect.DeepEqual(got, wantTimings) {
+		t.Errorf("Timings() = %v, want %v", got, wantTimings)
+	}
+
+	b0, err := frame.B0(8)
+	if err != nil {
+		t.Fatalf("B0() error: %v", err)
+	}
+	if want := "AAB00E030801400398271001100110011255"; b0 != want {
+		t.Errorf("B0() = %s, want %s", b0, want)
+	}
+
+	if frame, err := ParseRfRaw([]byte(`{"RfRaw":{"Data":"AAA055"}}`)); err != nil || frame.Command != 0xA0 {
+		t.Errorf("ParseRfRaw(A0) = %+v, %v", frame, err)
+	}
+	for _, payload := range []string{`{"RfRaw":{"Data":"B1 03 55"}}`, `{"RfRaw":{"Data":"AAB10501405"}}`, `{"RfRaw":{"Data":"AAB1050140 55"}}`, `{}`} {
+		if _, err := ParseRfRaw([]byte(payload)); !IsParseError(err) {
+			t.Errorf("ParseRfRaw(%s) error = %v, want parse error", payload, err)
+		}
+	}
+}
+
+func TestRfStore(t *testing.T) {
+	store := NewRfStore()
+	if err := store.Add(RfStoredCode{Name: "gate", Code: &RfCode{Data: 0x7028D2, Bits: 24}}); err != nil {
+		t.Fatalf("Add() error: %v", err)
+	}
+	if err := store.Add(RfStoredCode{Name: "door", Slot: 2, Key: &RfKeyCode{Sync: 8470, Low: 270, High: 840, Data: 1}}); err != nil {
+		t.Fatalf("Add() error: %v", err)
+	}
+	for _, bad := range []RfStoredCode{
+		{Code: &RfCode{}},
+		{Name: "both", Code: &RfCode{}, Raw: "AA55"},
+		{Name: "none"},
+		{Name: "slot", Slot: 17, Key: &RfKeyCode{}},
+	} {
+		if err := store.Add(bad); !IsCommandError(err) {
+			t.Errorf("Add(%+v) error = %v, want command error", bad, err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "codes.json")
+	if err := SaveRfStore(path, store); err != nil {
+		t.Fatalf("SaveRfStore() error: %v", err)
+	}
+	loaded, err := LoadRfStore(path)
+	if err != nil {
+		t.Fatalf("LoadRfStore() error: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, store) {
+		t.Errorf("LoadRfStore() = %+v, want %+v", loaded, store)
+	}
+
+	if !loaded.Remove("gate") || loaded.Remove("gate") {
+		t.Error("Remove() did not remove exactly once")
+	}
+	if _, ok := loaded.Get("door"); !ok {
+		t.Error("Get(door) not found")
+	}
+}
+
+func TestIntegration_RFBridge(t *testing.T) {
+	srv, client := newTestDevice(t, tasmotatest.WithRFBridge())
+	ctx := context.Background()
+
+	learned := RfKeyCode{Sync: 9000, Low: 300, High: 900, Data: 0xABCDEF}
+	if err := client.SetRfKey(ctx, 3, learned); err != nil {
+		t.Fatalf("SetRfKey() error: %v", err)
+	}
+	code, ok, err := client.GetRfKey(ctx, 3)
+	if err != nil || !ok || *code != learned {
+		t.Errorf("GetRfKey(3) = %+v, %v, %v", code, ok, err)
+	}
+	if _, ok, err := client.GetRfKey(ctx, 4); err != nil || ok {
+		t.Errorf("GetRfKey(4) learned = %v, %v, want default", ok, err)
+	}
+
+	// Copy the learned slots to a second bridge
+	store, err := client.ExportRfKeys(ctx)
+	if err != nil {
+		t.Fatalf("ExportRfKeys() error: %v", err)
+	}
+	if len(store.Codes) != 1 || store.Codes[0].Slot != 3 {
+		t.Fatalf("ExportRfKeys() = %+v", store.Codes)
+	}
+	other, otherClient := newTestDevice(t, tasmotatest.WithRFBridge())
+	if err := otherClient.ImportRfKeys(ctx, store); err != nil {
+		t.Fatalf("ImportRfKeys() error: %v", err)
+	}
+	if key := other.State().RF.Keys[2]; key == nil || key.Code != 0xABCDEF || key.Sync != 9000 {
+		t.Errorf("imported key = %+v", key)
+	}
+
+	if err := client.SendRfKey(ctx, 3); err != nil {
+		t.Fatalf("SendRfKey() error: %v", err)
+	}
+	if err := client.LearnRfKey(ctx, 5); err != nil {
+		t.Fatalf("LearnRfKey() error: %v", err)
+	}
+	if err := client.ForgetRfKey(ctx, 3); err != nil {
+		t.Fatalf("ForgetRfKey() error: %v", err)
+	}
+	if err := client.SendRf(ctx, RfCode{Data: 0x7028D2, Bits: 24, Protocol: 1}); err != nil {
+		t.Fatalf("SendRf() error: %v", err)
+	}
+	if err := client.SetRfRaw(ctx, true); err != nil {
+		t.Fatalf("SetRfRaw() error: %v", err)
+	}
+	if err := client.SendRfRaw(ctx, "AA B0 0E 03 08 0140 0398 2710 0110 0110 0112 55"); err != nil {
+		t.Fatalf("SendRfRaw() error: %v", err)
+	}
+
+	rf := srv.State().RF
+	if rf.Keys[2] != nil || rf.Learning != 5 || !rf.Raw {
+		t.Errorf("RF state = %+v", rf)
+	}
+	wantSent := []string{"#ABCDEF", "RfKey3", `{"Bits":24,"Data":"0x7028D2","Protocol":1}`, "AAB00E030801400398271001100110011255"}
+	if !reflect.DeepEqual(rf.Sent, wantSent) {
+		t.Errorf("Sent = %q, want %q", rf.Sent, wantSent)
+	}
+
+	if err := client.SendRfKey(ctx, 17); !IsCommandError(err) {
+		t.Errorf("SendRfKey(17) error = %v, want command error", err)
+	}
+	if err := client.SendRf(ctx, RfCode{Data: 0x1FF, Bits: 8}); !IsCommandError(err) {
+		t.Errorf("SendRf(too long) error = %v, want command error", err)
+	}
+	if err := client.SendRfRaw(ctx, "B0 55"); !IsCommandError(err) {
+		t.Errorf("SendRfRaw(bad frame) error = %v, want command error", err)
+	}
+}
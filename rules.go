@@ -0,0 +1,373 @@
+package tasmota
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// MaxRuleSets is the number of rule sets a device has (Rule1 to Rule3).
+	MaxRuleSets = 3
+	// MaxRuleLength is the longest rule set the firmware stores.
+	MaxRuleLength = 511
+	// maxBacklogCommands is the most commands one Backlog runs.
+	maxBacklogCommands = 30
+)
+
+// RuleSet is the state of one rule set as reported by Rule<n>.
+type RuleSet struct {
+	Enabled     bool
+	Once        bool
+	StopOnError bool
+	Length      int
+	Free        int
+	// Rules is the rule text as stored on the device.
+	Rules string
+}
+
+// Parse parses the rule text of the set.
+func (rs *RuleSet) Parse() (Rules, error) {
+	return ParseRules(rs.Rules)
+}
+
+// Rule is a single ON <trigger> DO <commands> ENDON rule.
+type Rule struct {
+	Trigger RuleTrigger
+	// Backlog is the Backlog keyword ("Backlog" or "Backlog0") the commands
+	// were given with, if any. The firmware runs rule commands as a backlog
+	// either way.
+	Backlog  string
+	Commands []string
+	// Break ends the rule with BREAK instead of ENDON, which stops the
+	// remaining rules in the set from running when this one triggers.
+	Break bool
+}
+
+// RuleTrigger is the event a rule runs on, such as "Power1#State=1".
+type RuleTrigger struct {
+	// Name is the event path, such as "Power1#State" or "Tele-SI7021#Temperature".
+	Name string
+	// Operator is one of =, ==, !=, <, >, <=, >=, | (modulo), $< (starts
+	// with), $> (ends with), $| (contains), $! (not equal) and $^ (does not
+	// contain), or empty to trigger on any value.
+	Operator string
+	Value    string
+}
+
+// String returns the trigger as written in a rule.
+func (t RuleTrigger) String() string {
+	return t.Name + t.Operator + t.Value
+}
+
+// String returns the rule in canonical form.
+func (r Rule) String() string {
+	var b strings.Builder
+	b.WriteString("ON ")
+	b.WriteString(r.Trigger.String())
+	b.WriteString(" DO ")
+	if r.Backlog != "" {
+		b.WriteString(r.Backlog)
+		b.WriteByte(' ')
+	}
+	b.WriteString(strings.Join(r.Commands, "; "))
+	if r.Break {
+		b.WriteString(" BREAK")
+	} else {
+		b.WriteString(" ENDON")
+	}
+	return b.String()
+}
+
+// Rules is a parsed rule set.
+type Rules []Rule
+
+// String returns the rule set in canonical form, as sent to the device.
+func (rs Rules) String() string {
+	parts := make([]string, len(rs))
+	for i, r := range rs {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, " ")
+}
+
+// Validate checks the rule set fits in the device.
+func (rs Rules) Validate() error {
+	if n := len(rs.String()); n > MaxRuleLength {
+		return NewError(ErrorTypeCommand,
+			fmt.Sprintf("rule set is %d characters, the limit is %d", n, MaxRuleLength), nil)
+	}
+	return nil
+}
+
+var (
+	ruleTriggerPattern = regexp.MustCompile(`^([A-Za-z0-9_.\-\[\]]+(?:#[A-Za-z0-9_.\-\[\]]+)+)(?:(==|!=|<=|>=|\$<|\$>|\$\||\$!|\$\^|=|<|>|\|)([^\s=<>!|$^]\S*))?$`)
+	ruleBacklogPattern = regexp.MustCompile(`^(?i:backlog0?)$`)
+	ruleWordPattern    = regexp.MustCompile(`\S+`)
+	ruleLineBreak      = regexp.MustCompile(`[ \t]*[\r\n]\s*`)
+)
+
+// ParseRules parses rule text made of ON <trigger> DO <commands> ENDON
+// rules, using BREAK instead of ENDON where needed. Keywords are case
+// insensitive and whitespace between them, including newlines, is collapsed,
+// so rules can be kept in files one per line. Commands are kept as written,
+// except that a line break inside one becomes a space.
+func ParseRules(text string) (Rules, error) {
+	spans := ruleWordPattern.FindAllStringIndex(text, -1)
+	words := make([]string, len(spans))
+	for i, span := range spans {
+		words[i] = text[span[0]:span[1]]
+	}
+	var rules Rules
+
+	for i := 0; i < len(words); {
+		n := len(rules) + 1
+		fail := func(msg string) (Rules, error) {
+			return nil, NewError(ErrorTypeParse, fmt.Sprintf("rule %d: %s", n, msg), nil)
+		}
+
+		if !strings.EqualFold(words[i], "ON") {
+			return fail(fmt.Sprintf("expected ON, found %q", words[i]))
+		}
+		if i+1 >= len(words) {
+			return fail("missing trigger after ON")
+		}
+		trigger, err := parseRuleTrigger(words[i+1])
+		if err != nil {
+			return fail(err.Error())
+		}
+		if i+2 >= len(words) || !strings.EqualFold(words[i+2], "DO") {
+			return fail(fmt.Sprintf("expected DO after trigger %s", words[i+1]))
+		}
+
+		end := -1
+		for j := i + 3; j < len(words); j++ {
+			if strings.EqualFold(words[j], "ENDON") || strings.EqualFold(words[j], "BREAK") {
+				end = j
+				break
+			}
+			if strings.EqualFold(words[j], "ON") && j+2 < len(words) && strings.EqualFold(words[j+2], "DO") {
+				break
+			}
+		}
+		if end < 0 {
+			return fail(fmt.Sprintf("missing ENDON after ON %s", trigger))
+		}
+
+		rule := Rule{Trigger: trigger, Break: strings.EqualFold(words[end], "BREAK")}
+		start := i + 3
+		if start < end && ruleBacklogPattern.MatchString(words[start]) {
+			rule.Backlog = words[start]
+			start++
+		}
+		body := ""
+		if start < end {
+			body = text[spans[start][0]:spans[end][0]]
+		}
+		rule.Commands = splitRuleCommands(body)
+		if len(rule.Commands) == 0 {
+			return fail(fmt.Sprintf("no commands for ON %s", trigger))
+		}
+		if len(rule.Commands) > maxBacklogCommands {
+			return fail(fmt.Sprintf("%d commands, Backlog runs at most %d", len(rule.Commands), maxBacklogCommands))
+		}
+
+		rules = append(rules, rule)
+		i = end + 1
+	}
+
+	if len(rules) == 0 {
+		return nil, NewError(ErrorTypeParse, "no rules found", nil)
+	}
+	return rules, nil
+}
+
+func parseRuleTrigger(s string) (RuleTrigger, error) {
+	m := ruleTriggerPattern.FindStringSubmatch(s)
+	if m == nil {
+		return RuleTrigger{}, fmt.Errorf("invalid trigger %q, expected <Source>#<Event>[<operator><value>]", s)
+	}
+	return RuleTrigger{Name: m[1], Operator: m[2], Value: m[3]}, nil
+}
+
+// splitRuleCommands splits a rule body on ';', keeping IF ... ENDIF blocks
+// together. Payloads are kept byte for byte apart from line breaks.
+func splitRuleCommands(body string) []string {
+	var commands []string
+	start, depth := 0, 0
+	flush := func(end int) {
+		if command := strings.TrimSpace(body[start:end]); command != "" {
+			commands = append(commands, ruleLineBreak.ReplaceAllString(command, " "))
+		}
+	}
+
+	for _, span := range ruleWordPattern.FindAllStringIndex(body, -1) {
+		// A word may hold several ';' separated parts, as in "0;Delay"
+		offset := span[0]
+		for part := range strings.SplitSeq(body[span[0]:span[1]], ";") {
+			switch {
+			case strings.EqualFold(part, "IF"):
+				depth++
+			case strings.EqualFold(part, "ENDIF") && depth > 0:
+				depth--
+			}
+			offset += len(part)
+			if offset < span[1] && depth == 0 {
+				flush(offset)
+				start = offset + 1
+			}
+			offset++
+		}
+	}
+	flush(len(body))
+
+	return commands
+}
+
+// GetRules reads the three rule sets.
+func (c *Client) GetRules(ctx context.Context) ([]RuleSet, error) {
+	sets := make([]RuleSet, MaxRuleSets)
+	for n := 1; n <= MaxRuleSets; n++ {
+		rs, err := c.GetRule(ctx, n)
+		if err != nil {
+			return nil, err
+		}
+		sets[n-1] = *rs
+	}
+	return sets, nil
+}
+
+// GetRule reads rule set n (1-3).
+func (c *Client) GetRule(ctx context.Context, n int) (*RuleSet, error) {
+	if err := checkRuleSet(n); err != nil {
+		return nil, err
+	}
+	return c.ruleCommand(ctx, n, "")
+}
+
+// SetRule replaces the rules of set n (1-3) with rules, which are parsed
+// and length checked first and sent in canonical form with command payloads
+// as written. An empty string clears the set. Setting rules
+// does not enable the set; see EnableRule.
+func (c *Client) SetRule(ctx context.Context, n int, rules string) error {
+	if err := checkRuleSet(n); err != nil {
+		return err
+	}
+	if strings.TrimSpace(rules) == "" {
+		_, err := c.ruleCommand(ctx, n, `"`)
+		return err
+	}
+
+	parsed, err := ParseRules(rules)
+	if err != nil {
+		return err
+	}
+	if err := parsed.Validate(); err != nil {
+		return err
+	}
+	_, err = c.ruleCommand(ctx, n, parsed.String())
+	return err
+}
+
+// AppendRule adds rules to the end of set n (1-3), like Rule<n> +<rules>.
+// The combined length is checked against the rules on the device.
+func (c *Client) AppendRule(ctx context.Context, n int, rules string) error {
+	if err := checkRuleSet(n); err != nil {
+		return err
+	}
+	parsed, err := ParseRules(rules)
+	if err != nil {
+		return err
+	}
+
+	current, err := c.GetRule(ctx, n)
+	if err != nil {
+		return err
+	}
+	if total := current.Length + 1 + len(parsed.String()); current.Length > 0 && total > MaxRuleLength {
+		return NewError(ErrorTypeCommand,
+			fmt.Sprintf("rule set %d would be %d characters, the limit is %d", n, total, MaxRuleLength), nil)
+	}
+	if err := parsed.Validate(); err != nil {
+		return err
+	}
+
+	_, err = c.ruleCommand(ctx, n, "+"+parsed.String())
+	return err
+}
+
+// EnableRule enables or disables rule set n (1-3).
+func (c *Client) EnableRule(ctx context.Context, n int, enabled bool) error {
+	return c.setRuleFlag(ctx, n, enabled, 0)
+}
+
+// SetRuleOnce sets whether rule set n (1-3) runs only once per trigger
+// until the trigger condition is false again.
+func (c *Client) SetRuleOnce(ctx context.Context, n int, once bool) error {
+	return c.setRuleFlag(ctx, n, once, 4)
+}
+
+// SetRuleStopOnError sets whether rule set n (1-3) is disabled when one of
+// its commands fails.
+func (c *Client) SetRuleStopOnError(ctx context.Context, n int, stop bool) error {
+	return c.setRuleFlag(ctx, n, stop, 8)
+}
+
+// setRuleFlag sends Rule<n> <off> or <off+1>: 0/1 state, 4/5 once and 8/9
+// stop on error.
+func (c *Client) setRuleFlag(ctx context.Context, n int, on bool, off int) error {
+	if err := checkRuleSet(n); err != nil {
+		return err
+	}
+	_, err := c.ruleCommand(ctx, n, fmt.Sprint(off+boolToInt(on)))
+	return err
+}
+
+func checkRuleSet(n int) error {
+	if n < 1 || n > MaxRuleSets {
+		return NewError(ErrorTypeCommand, "rule set number must be between 1 and 3", nil)
+	}
+	return nil
+}
+
+func (c *Client) ruleCommand(ctx context.Context, n int, payload string) (*RuleSet, error) {
+	cmd := fmt.Sprintf("Rule%d", n)
+	if payload != "" {
+		cmd += " " + payload
+	}
+	raw, err := c.ExecuteCommand(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp map[string]json.RawMessage
+	if err := unmarshalJSON(raw, &resp); err != nil {
+		return nil, err
+	}
+	value, ok := resp[fmt.Sprintf("Rule%d", n)]
+	if !ok {
+		return nil, NewError(ErrorTypeParse, fmt.Sprintf("response missing Rule%d", n), nil)
+	}
+	var rule struct {
+		State       string `json:"State"`
+		Once        string `json:"Once"`
+		StopOnError string `json:"StopOnError"`
+		Length      int    `json:"Length"`
+		Free        int    `json:"Free"`
+		Rules       string `json:"Rules"`
+	}
+	if err := unmarshalJSON(value, &rule); err != nil {
+		return nil, err
+	}
+
+	return &RuleSet{
+		Enabled:     rule.State == "ON",
+		Once:        rule.Once == "ON",
+		StopOnError: rule.StopOnError == "ON",
+		Length:      rule.Length,
+		Free:        rule.Free,
+		Rules:       rule.Rules,
+	}, nil
+}
@@ -0,0 +1,239 @@
+package tasmota
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kradalby/tasmota-go/tasmotatest"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		want      Rules
+		canonical string
+	}{
+		{
+			name: "single",
+			text: "on Power1#State=1 do Publish stat/kitchen/on 1 endon",
+			want: Rules{{
+				Trigger:  RuleTrigger{Name: "Power1#State", Operator: "=", Value: "1"},
+				Commands: []string{"Publish stat/kitchen/on 1"},
+			}},
+			canonical: "ON Power1#State=1 DO Publish stat/kitchen/on 1 ENDON",
+		},
+		{
+			name: "multiline with backlog and break",
+			text: `ON System#Boot DO Backlog0 Var1 0;Delay 10 ; Power2 ON ENDON
+			       ON Tele-SI7021#Temperature>=25.5 DO Power1 OFF BREAK
+			       ON Time#Minute|5 DO Event check ENDON`,
+			want: Rules{
+				{
+					Trigger:  RuleTrigger{Name: "System#Boot"},
+					Backlog:  "Backlog0",
+					Commands: []string{"Var1 0", "Delay 10", "Power2 ON"},
+				},
+				{
+					Trigger:  RuleTrigger{Name: "Tele-SI7021#Temperature", Operator: ">=", Value: "25.5"},
+					Commands: []string{"Power1 OFF"},
+					Break:    true,
+				},
+				{
+					Trigger:  RuleTrigger{Name: "Time#Minute", Operator: "|", Value: "5"},
+					Commands: []string{"Event check"},
+				},
+			},
+			canonical: "ON System#Boot DO Backlog0 Var1 0; Delay 10; Power2 ON ENDON " +
+				"ON Tele-SI7021#Temperature>=25.5 DO Power1 OFF BREAK ON Time#Minute|5 DO Event check ENDON",
+		},
+		{
+			name: "if block and string operator",
+			text: "ON Event#mode$|night DO IF (%var1%==1) Power1 ON; Power2 ON ENDIF; Var1 0 ENDON",
+			want: Rules{{
+				Trigger:  RuleTrigger{Name: "Event#mode", Operator: "$|", Value: "night"},
+				Commands: []string{"IF (%var1%==1) Power1 ON; Power2 ON ENDIF", "Var1 0"},
+			}},
+			canonical: "ON Event#mode$|night DO IF (%var1%==1) Power1 ON; Power2 ON ENDIF; Var1 0 ENDON",
+		},
+		{
+			name: "payload whitespace",
+			text: "ON  Button1#State  DO  Publish2 stat/hall/msg {\"text\":\"a  b\"};  WebSend [10.0.0.2] Power1  TOGGLE\n  ENDON",
+			want: Rules{{
+				Trigger:  RuleTrigger{Name: "Button1#State"},
+				Commands: []string{`Publish2 stat/hall/msg {"text":"a  b"}`, "WebSend [10.0.0.2] Power1  TOGGLE"},
+			}},
+			canonical: `ON Button1#State DO Publish2 stat/hall/msg {"text":"a  b"}; WebSend [10.0.0.2] Power1  TOGGLE ENDON`,
+		},
+		{
+			name: "if block over lines",
+			text: "ON Event#check DO IF (%var1%==1)\n    Power1 ON\n  ENDIF ENDON",
+			want: Rules{{
+				Trigger:  RuleTrigger{Name: "Event#check"},
+				Commands: []string{"IF (%var1%==1) Power1 ON ENDIF"},
+			}},
+			canonical: "ON Event#check DO IF (%var1%==1) Power1 ON ENDIF ENDON",
+		},
+		{
+			name: "nested path",
+			text: "ON ZbReceived#0x1234#Power!=%var2% DO Var2 %value% ENDON",
+			want: Rules{{
+				Trigger:  RuleTrigger{Name: "ZbReceived#0x1234#Power", Operator: "!=", Value: "%var2%"},
+				Commands: []string{"Var2 %value%"},
+			}},
+			canonical: "ON ZbReceived#0x1234#Power!=%var2% DO Var2 %value% ENDON",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRules(tt.text)
+			if err != nil {
+				t.Fatalf("ParseRules() error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRules() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+			if got.String() != tt.canonical {
+				t.Errorf("String() =\n%s\nwant\n%s", got, tt.canonical)
+			}
+			again, err := ParseRules(got.String())
+			if err != nil || !reflect.DeepEqual(again, got) {
+				t.Errorf("ParseRules(String()) = %+v, %v", again, err)
+			}
+		})
+	}
+}
+
+func TestParseRules_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"empty", "   ", "no rules"},
+		{"no on", "Power1#State DO Power2 ON ENDON", `expected ON, found "Power1#State"`},
+		{"missing trigger", "ON", "missing trigger"},
+		{"bad trigger", "ON Power1 DO Power2 ON ENDON", "invalid trigger"},
+		{"bad operator", "ON Power1#State=>1 DO Power2 ON ENDON", "invalid trigger"},
+		{"missing do", "ON Power1#State Power2 ON ENDON", "expected DO"},
+		{"missing endon", "ON Power1#State DO Power2 ON", "missing ENDON"},
+		{"endon swallowed", "ON Power1#State DO Power2 ON ON Power2#State DO Power3 ON ENDON", "rule 1: missing ENDON"},
+		{"no commands", "ON Power1#State DO ENDON", "no commands"},
+		{"second rule", "ON Power1#State DO Power2 ON ENDON garbage", `rule 2: expected ON, found "garbage"`},
+		{"too many commands", "ON System#Boot DO Backlog" + strings.Repeat(" Delay 1;", 31) + " ENDON", "Backlog runs at most 30"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRules(tt.text)
+			if !IsParseError(err) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseRules() error = %v, want parse error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRules_Validate(t *testing.T) {
+	rule := "ON Power1#State=1 DO Publish stat/kitchen/state on ENDON "
+	fits, err := ParseRules(strings.Repeat(rule, MaxRuleLength/len(rule)))
+	if err != nil {
+		t.Fatalf("ParseRules() error: %v", err)
+	}
+	if err := fits.Validate(); err != nil {
+		t.Errorf("Validate() error: %v", err)
+	}
+
+	tooLong := append(fits, fits[0])
+	if err := tooLong.Validate(); !IsCommandError(err) {
+		t.Errorf("Validate() error = %v, want command error", err)
+	}
+}
+
+func TestIntegration_Rules(t *testing.T) {
+	srv, client := newTestDevice(t)
+	ctx := context.Background()
+
+	if err := client.SetRule(ctx, 2, "on Power1#State=1 do backlog Power2 on;Delay 10 endon"); err != nil {
+		t.Fatalf("SetRule() error: %v", err)
+	}
+	if err := client.AppendRule(ctx, 2, "ON Power1#State=0 DO Power2 OFF ENDON"); err != nil {
+		t.Fatalf("AppendRule() error: %v", err)
+	}
+	if err := client.EnableRule(ctx, 2, true); err != nil {
+		t.Fatalf("EnableRule() error: %v", err)
+	}
+	if err := client.SetRuleOnce(ctx, 2, true); err != nil {
+		t.Fatalf("SetRuleOnce() error: %v", err)
+	}
+	if err := client.SetRuleStopOnError(ctx, 2, true); err != nil {
+		t.Fatalf("SetRuleStopOnError() error: %v", err)
+	}
+
+	want := "ON Power1#State=1 DO backlog Power2 on; Delay 10 ENDON ON Power1#State=0 DO Power2 OFF ENDON"
+	if got := srv.State().Rules[1]; got.Rules != want || !got.Enabled || !got.Once || !got.StopOnError {
+		t.Errorf("device Rule2 = %+v", got)
+	}
+
+	sets, err := client.GetRules(ctx)
+	if err != nil {
+		t.Fatalf("GetRules() error: %v", err)
+	}
+	if len(sets) != MaxRuleSets || sets[0].Rules != "" || sets[1].Length != len(want) || sets[1].Free != MaxRuleLength-len(want) {
+		t.Errorf("GetRules() = %+v", sets)
+	}
+	parsed, err := sets[1].Parse()
+	if err != nil || len(parsed) != 2 || parsed[1].Commands[0] != "Power2 OFF" {
+		t.Errorf("Parse() = %+v, %v", parsed, err)
+	}
+
+	long := "ON Power1#State=1 DO Publish stat/kitchen/state " + strings.Repeat("x", 400) + " ENDON"
+	if err := client.AppendRule(ctx, 2, long); !IsCommandError(err) {
+		t.Errorf("AppendRule() over the limit error = %v, want command error", err)
+	}
+	if err := client.SetRule(ctx, 1, "ON Power1 DO x ENDON"); !IsParseError(err) {
+		t.Errorf("SetRule() invalid error = %v, want parse error", err)
+	}
+	if err := client.SetRule(ctx, 4, ""); !IsCommandError(err) {
+		t.Errorf("SetRule(4) error = %v, want command error", err)
+	}
+
+	if err := client.SetRule(ctx, 2, ""); err != nil {
+		t.Fatalf("SetRule(clear) error: %v", err)
+	}
+	if got := srv.State().Rules[1]; got.Rules != "" {
+		t.Errorf("Rule2 after clear = %q", got.Rules)
+	}
+
+	// Payloads reach the device as written
+	spaced := "ON Button1#State DO Publish stat/hall/msg a  b ENDON"
+	if err := client.SetRule(ctx, 1, spaced); err != nil {
+		t.Fatalf("SetRule() error: %v", err)
+	}
+	if got := srv.State().Rules[0].Rules; got != spaced {
+		t.Errorf("Rule1 = %q, want %q", got, spaced)
+	}
+}
+
+func TestDesiredState_ValidateRules(t *testing.T) {
+	bad := "ON Power1#State DO Power2 ON"
+	state := &DesiredState{Rules: map[int]*DesiredRule{1: {Rules: &bad}}}
+	if err := state.Validate(); !IsCommandError(err) || !strings.Contains(err.Error(), "rule set 1") {
+		t.Errorf("Validate() error = %v, want rule set 1 error", err)
+	}
+
+	_, client := newTestDevice(t, tasmotatest.WithState(func(s *tasmotatest.State) {
+		s.Rules[0].Rules = "ON Power1#State DO Backlog Power2 ON; Power3 ON ENDON"
+	}))
+	// Spacing differences around ';' are not a change
+	good := "ON Power1#State DO Backlog Power2 ON;Power3 ON ENDON"
+	plan, err := client.Plan(context.Background(), &DesiredState{Rules: map[int]*DesiredRule{1: {Rules: &good}}})
+	if err != nil {
+		t.Fatalf("Plan() error: %v", err)
+	}
+	if !plan.Empty() {
+		t.Errorf("Plan() = %v, want no changes", plan)
+	}
+}
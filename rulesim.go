@@ -0,0 +1,582 @@
+package tasmota
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxRuleDepth limits how deep events raised by rule commands may nest
+	// before the simulator reports a rule loop.
+	maxRuleDepth = 10
+	// ruleVariables is the number of Var<n> and Mem<n> variables.
+	ruleVariables = 16
+	// ruleTimers is the number of RuleTimer<n> timers.
+	ruleTimers = 8
+)
+
+// FiredCommand is a command a rule would run.
+type FiredCommand struct {
+	// RuleSet is the rule set (1-3) and Rule the rule within it (from 1).
+	RuleSet int
+	Rule    int
+	// Trigger is the trigger of the rule, as written.
+	Trigger string
+	// Value is the event value the rule matched.
+	Value string
+	// Command is the command with variables substituted.
+	Command string
+}
+
+// String returns the fired command with the rule it came from.
+func (f FiredCommand) String() string {
+	return fmt.Sprintf("Rule%d#%d %s: %s", f.RuleSet, f.Rule, f.Trigger, f.Command)
+}
+
+// RuleSimulator runs rule sets against synthetic events without a device.
+// It follows the firmware's rule processing: sets run in order, every
+// matching rule fires, BREAK skips the rest of its set and Once rules only
+// fire again after their trigger was false.
+//
+// Commands are recorded rather than executed, except for those that feed
+// back into rules: Power<n>, Var<n>, Mem<n>, Add<n>, Sub<n>, Mult<n>,
+// RuleTimer<n> and Event. Like the firmware, the events they raise are
+// queued and processed once the rest of the rule's commands have run. IF blocks are recorded as a single command and
+// not evaluated. A RuleSimulator is not safe for concurrent use.
+type RuleSimulator struct {
+	sets   [MaxRuleSets]simRuleSet
+	vars   [ruleVariables]string
+	mems   [ruleVariables]string
+	timers [ruleTimers]int
+	power  map[int]bool
+	now    time.Time
+	topic  string
+}
+
+type simRuleSet struct {
+	rules   Rules
+	enabled bool
+	once    bool
+	// matched holds whether each rule's trigger was last true, for Once
+	matched []bool
+}
+
+// NewRuleSimulator creates a simulator with empty rule sets and the clock at
+// midnight on 2000-01-01 UTC.
+func NewRuleSimulator() *RuleSimulator {
+	return &RuleSimulator{
+		power: make(map[int]bool),
+		now:   time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		topic: "tasmota",
+	}
+}
+
+// SetRule parses rules into set n (1-3) and enables it.
+func (s *RuleSimulator) SetRule(n int, rules string) error {
+	if err := checkRuleSet(n); err != nil {
+		return err
+	}
+	parsed, err := ParseRules(rules)
+	if err != nil {
+		return err
+	}
+	if err := parsed.Validate(); err != nil {
+		return err
+	}
+	s.sets[n-1] = simRuleSet{
+		rules:   parsed,
+		enabled: true,
+		once:    s.sets[n-1].once,
+		matched: make([]bool, len(parsed)),
+	}
+	return nil
+}
+
+// LoadRuleSet copies rule set n (1-3), as read with GetRule, into the
+// simulator including its Enabled and Once flags.
+func (s *RuleSimulator) LoadRuleSet(n int, rs *RuleSet) error {
+	if rs.Rules == "" {
+		if err := checkRuleSet(n); err != nil {
+			return err
+		}
+		s.sets[n-1] = simRuleSet{}
+		return nil
+	}
+	if err := s.SetRule(n, rs.Rules); err != nil {
+		return err
+	}
+	s.sets[n-1].enabled = rs.Enabled
+	s.sets[n-1].once = rs.Once
+	return nil
+}
+
+// EnableRule enables or disables set n (1-3).
+func (s *RuleSimulator) EnableRule(n int, enabled bool) {
+	if checkRuleSet(n) == nil {
+		s.sets[n-1].enabled = enabled
+	}
+}
+
+// SetRuleOnce sets the Once flag of set n (1-3).
+func (s *RuleSimulator) SetRuleOnce(n int, once bool) {
+	if checkRuleSet(n) == nil {
+		s.sets[n-1].once = once
+	}
+}
+
+// SetTopic sets the value substituted for %topic%.
+func (s *RuleSimulator) SetTopic(topic string) {
+	s.topic = topic
+}
+
+// SetTime sets the simulated clock without raising events.
+func (s *RuleSimulator) SetTime(t time.Time) {
+	s.now = t
+}
+
+// Time returns the simulated clock.
+func (s *RuleSimulator) Time() time.Time {
+	return s.now
+}
+
+// Var returns Var<n> (1-16).
+func (s *RuleSimulator) Var(n int) string {
+	if n < 1 || n > ruleVariables {
+		return ""
+	}
+	return s.vars[n-1]
+}
+
+// SetVar sets Var<n> (1-16) without raising an event.
+func (s *RuleSimulator) SetVar(n int, value string) {
+	if n >= 1 && n <= ruleVariables {
+		s.vars[n-1] = value
+	}
+}
+
+// Mem returns Mem<n> (1-16).
+func (s *RuleSimulator) Mem(n int) string {
+	if n < 1 || n > ruleVariables {
+		return ""
+	}
+	return s.mems[n-1]
+}
+
+// SetMem sets Mem<n> (1-16) without raising an event.
+func (s *RuleSimulator) SetMem(n int, value string) {
+	if n >= 1 && n <= ruleVariables {
+		s.mems[n-1] = value
+	}
+}
+
+// PowerState returns the simulated state of relay n.
+func (s *RuleSimulator) PowerState(n int) bool {
+	return s.power[n]
+}
+
+// RuleTimer returns the seconds left on RuleTimer<n> (1-8), 0 if stopped.
+func (s *RuleSimulator) RuleTimer(n int) int {
+	if n < 1 || n > ruleTimers {
+		return 0
+	}
+	return s.timers[n-1]
+}
+
+// Trigger raises an event given as a trigger path and value, so
+// Trigger("Power1#State", 1) raises {"Power1":{"State":1}}.
+func (s *RuleSimulator) Trigger(path string, value any) ([]FiredCommand, error) {
+	return s.process(eventMessage(path, value), false, 0)
+}
+
+// Message processes a JSON message such as a command result or
+// ZbReceived, matching triggers against its fields.
+func (s *RuleSimulator) Message(payload []byte) ([]FiredCommand, error) {
+	msg, err := decodeRuleMessage(payload)
+	if err != nil {
+		return nil, err
+	}
+	return s.process(msg, false, 0)
+}
+
+// Telemetry processes a tele/SENSOR or tele/STATE payload. Only triggers
+// starting with "Tele-" match, with the prefix removed, so
+// Tele-SI7021#Temperature matches {"SI7021":{"Temperature":25}}.
+func (s *RuleSimulator) Telemetry(payload []byte) ([]FiredCommand, error) {
+	msg, err := decodeRuleMessage(payload)
+	if err != nil {
+		return nil, err
+	}
+	return s.process(msg, true, 0)
+}
+
+// Power sets relay n and raises Power<n>#State.
+func (s *RuleSimulator) Power(n int, on bool) ([]FiredCommand, error) {
+	s.power[n] = on
+	return s.Trigger(fmt.Sprintf("Power%d#State", n), boolToInt(on))
+}
+
+// Button raises Button<n>#State with a button action, such as 10 for a
+// single press when buttons are detached (SetOption73).
+func (s *RuleSimulator) Button(n, state int) ([]FiredCommand, error) {
+	return s.Trigger(fmt.Sprintf("Button%d#State", n), state)
+}
+
+// Switch raises Switch<n>#State.
+func (s *RuleSimulator) Switch(n, state int) ([]FiredCommand, error) {
+	return s.Trigger(fmt.Sprintf("Switch%d#State", n), state)
+}
+
+// Boot raises System#Boot.
+func (s *RuleSimulator) Boot() ([]FiredCommand, error) {
+	return s.Trigger("System#Boot", 1)
+}
+
+// Advance moves the clock forward by d, a second at a time. Rule timers
+// that expire raise Rules#Timer=<n> and every new minute raises
+// Time#Minute with the minutes since midnight.
+func (s *RuleSimulator) Advance(d time.Duration) ([]FiredCommand, error) {
+	var fired []FiredCommand
+	for elapsed := time.Second; elapsed <= d; elapsed += time.Second {
+		s.now = s.now.Add(time.Second)
+
+		for i := range s.timers {
+			if s.timers[i] == 0 {
+				continue
+			}
+			s.timers[i]--
+			if s.timers[i] == 0 {
+				out, err := s.Trigger("Rules#Timer", i+1)
+				fired = append(fired, out...)
+				if err != nil {
+					return fired, err
+				}
+			}
+		}
+
+		if s.now.Second() == 0 {
+			out, err := s.Trigger("Time#Minute", s.now.Hour()*60+s.now.Minute())
+			fired = append(fired, out...)
+			if err != nil {
+				return fired, err
+			}
+		}
+	}
+	return fired, nil
+}
+
+func (s *RuleSimulator) process(msg map[string]any, tele bool, depth int) ([]FiredCommand, error) {
+	if depth > maxRuleDepth {
+		return nil, NewError(ErrorTypeCommand,
+			fmt.Sprintf("rule loop: events nested more than %d deep", maxRuleDepth), nil)
+	}
+
+	var fired []FiredCommand
+	for setIndex := range s.sets {
+		set := &s.sets[setIndex]
+		if !set.enabled {
+			continue
+		}
+
+		for i, rule := range set.rules {
+			name := rule.Trigger.Name
+			prefixed := len(name) > 5 && strings.EqualFold(name[:5], "Tele-")
+			if tele != prefixed {
+				continue
+			}
+			if tele {
+				name = name[5:]
+			}
+
+			value, found := lookupRulePath(msg, name)
+			if !found {
+				continue
+			}
+			match := compareRuleValue(value, rule.Trigger.Operator, s.substitute(rule.Trigger.Value, value))
+			if set.once {
+				wasMatched := set.matched[i]
+				set.matched[i] = match
+				if wasMatched {
+					continue
+				}
+			}
+			if !match {
+				continue
+			}
+
+			var raised []map[string]any
+			for _, command := range rule.Commands {
+				cmd := s.substitute(command, value)
+				fired = append(fired, FiredCommand{
+					RuleSet: setIndex + 1,
+					Rule:    i + 1,
+					Trigger: rule.Trigger.String(),
+					Value:   value,
+					Command: cmd,
+				})
+				if event := s.execute(cmd); event != nil {
+					raised = append(raised, event)
+				}
+			}
+			for _, event := range raised {
+				out, err := s.process(event, false, depth+1)
+				fired = append(fired, out...)
+				if err != nil {
+					return fired, err
+				}
+			}
+
+			if rule.Break {
+				break
+			}
+		}
+	}
+	return fired, nil
+}
+
+var simCommandPattern = regexp.MustCompile(`^([A-Za-z]+?)(\d*)$`)
+
+// execute applies the commands that change rule state and returns the event
+// they raise, if any.
+func (s *RuleSimulator) execute(cmd string) map[string]any {
+	word, payload, _ := strings.Cut(cmd, " ")
+	payload = strings.TrimSpace(payload)
+	m := simCommandPattern.FindStringSubmatch(word)
+	if m == nil {
+		return nil
+	}
+	name := strings.ToLower(m[1])
+	index := 1
+	if m[2] != "" {
+		index, _ = strconv.Atoi(m[2])
+	}
+
+	switch name {
+	case "power":
+		on, ok := s.power[index], true
+		switch strings.ToUpper(payload) {
+		case "1", "ON":
+			on = true
+		case "0", "OFF":
+			on = false
+		case "2", "TOGGLE":
+			on = !on
+		default:
+			ok = false
+		}
+		if !ok || on == s.power[index] {
+			return nil
+		}
+		s.power[index] = on
+		return eventMessage(fmt.Sprintf("Power%d#State", index), boolToInt(on))
+
+	case "var", "mem", "add", "sub", "mult":
+		if index < 1 || index > ruleVariables || payload == "" {
+			return nil
+		}
+		target, event := &s.vars[index-1], "Var"
+		if name == "mem" {
+			target, event = &s.mems[index-1], "Mem"
+		}
+		if name == "var" || name == "mem" {
+			*target = payload
+		} else {
+			current, _ := strconv.ParseFloat(*target, 64)
+			operand, err := strconv.ParseFloat(payload, 64)
+			if err != nil {
+				return nil
+			}
+			switch name {
+			case "add":
+				current += operand
+			case "sub":
+				current -= operand
+			case "mult":
+				current *= operand
+			}
+			*target = strconv.FormatFloat(current, 'f', -1, 64)
+		}
+		return eventMessage(fmt.Sprintf("%s%d#State", event, index), *target)
+
+	case "ruletimer":
+		seconds, err := strconv.Atoi(payload)
+		if err != nil || index < 1 || index > ruleTimers || seconds < 0 {
+			return nil
+		}
+		s.timers[index-1] = seconds
+		return nil
+
+	case "event":
+		event, value, _ := strings.Cut(payload, "=")
+		if event == "" {
+			return nil
+		}
+		return eventMessage("Event#"+event, value)
+	}
+
+	return nil
+}
+
+var ruleVariablePattern = regexp.MustCompile(`(?i)%(value|var\d+|mem\d+|time|timestamp|topic)%`)
+
+// substitute replaces %value%, %var<n>%, %mem<n>%, %time% (minutes since
+// midnight), %timestamp% and %topic%.
+func (s *RuleSimulator) substitute(text, value string) string {
+	return ruleVariablePattern.ReplaceAllStringFunc(text, func(match string) string {
+		name := strings.ToLower(match[1 : len(match)-1])
+		switch {
+		case name == "value":
+			return value
+		case name == "time":
+			return strconv.Itoa(s.now.Hour()*60 + s.now.Minute())
+		case name == "timestamp":
+			return s.now.Format("2006-01-02T15:04:05")
+		case name == "topic":
+			return s.topic
+		case strings.HasPrefix(name, "var"):
+			n, _ := strconv.Atoi(name[3:])
+			if n >= 1 && n <= ruleVariables {
+				return s.vars[n-1]
+			}
+		case strings.HasPrefix(name, "mem"):
+			n, _ := strconv.Atoi(name[3:])
+			if n >= 1 && n <= ruleVariables {
+				return s.mems[n-1]
+			}
+		}
+		return match
+	})
+}
+
+// eventMessage builds the message for a trigger path, nesting the value
+// under each # separated segment.
+func eventMessage(path string, value any) map[string]any {
+	segments := strings.Split(path, "#")
+	var v any = ruleValueString(value)
+	for i := len(segments) - 1; i > 0; i-- {
+		v = map[string]any{segments[i]: v}
+	}
+	return map[string]any{segments[0]: v}
+}
+
+func decodeRuleMessage(payload []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	var msg map[string]any
+	if err := dec.Decode(&msg); err != nil {
+		return nil, NewError(ErrorTypeParse, "failed to parse rule message", err)
+	}
+	return msg, nil
+}
+
+var rulePathIndexPattern = regexp.MustCompile(`^(.*)\[(\d+)\]$`)
+
+// lookupRulePath finds a # separated path in msg. Keys match case
+// insensitively and a [n] suffix indexes an array from 1. Objects and
+// arrays are found with an empty value.
+func lookupRulePath(msg map[string]any, path string) (string, bool) {
+	var current any = msg
+	for _, segment := range strings.Split(path, "#") {
+		index := 0
+		if m := rulePathIndexPattern.FindStringSubmatch(segment); m != nil {
+			segment = m[1]
+			index, _ = strconv.Atoi(m[2])
+		}
+
+		obj, ok := current.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		found := false
+		for k, v := range obj {
+			if strings.EqualFold(k, segment) {
+				current, found = v, true
+				break
+			}
+		}
+		if !found {
+			return "", false
+		}
+
+		if index > 0 {
+			arr, ok := current.([]any)
+			if !ok || index > len(arr) {
+				return "", false
+			}
+			current = arr[index-1]
+		}
+	}
+	return ruleValueString(current), true
+}
+
+func ruleValueString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.Itoa(boolToInt(v))
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil, map[string]any, []any:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// compareRuleValue applies a trigger operator like the firmware: = and $!
+// compare strings ignoring case, == and != compare numbers, the ordering
+// operators and | (modulo) need numbers, and $<, $>, $| and $^ test for a
+// prefix, suffix or substring.
+func compareRuleValue(value, op, want string) bool {
+	if op == "" {
+		return true
+	}
+
+	switch op {
+	case "=":
+		return strings.EqualFold(value, want)
+	case "$!":
+		return !strings.EqualFold(value, want)
+	case "$<":
+		return strings.HasPrefix(value, want)
+	case "$>":
+		return strings.HasSuffix(value, want)
+	case "$|":
+		return strings.Contains(value, want)
+	case "$^":
+		return !strings.Contains(value, want)
+	}
+
+	v, err1 := strconv.ParseFloat(value, 64)
+	w, err2 := strconv.ParseFloat(want, 64)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	switch op {
+	case "==":
+		return v == w
+	case "!=":
+		return v != w
+	case ">":
+		return v > w
+	case "<":
+		return v < w
+	case ">=":
+		return v >= w
+	case "<=":
+		return v <= w
+	case "|":
+		return w != 0 && math.Mod(v, w) == 0
+	}
+	return false
+}
@@ -0,0 +1,244 @@
+package tasmota
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func firedCommands(fired []FiredCommand) []string {
+	cmds := make([]string, len(fired))
+	for i, f := range fired {
+		cmds[i] = f.Command
+	}
+	return cmds
+}
+
+func TestRuleSimulator(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+		fire  func(s *RuleSimulator) ([]FiredCommand, error)
+		want  []string
+	}{
+		{
+			name:  "power state",
+			rules: "ON Power1#State=1 DO Backlog Power2 ON; Publish stat/kitchen/light %value% ENDON ON Power1#State=0 DO Power2 OFF ENDON",
+			fire:  func(s *RuleSimulator) ([]FiredCommand, error) { return s.Power(1, true) },
+			want:  []string{"Power2 ON", "Publish stat/kitchen/light 1"},
+		},
+		{
+			name:  "telemetry threshold",
+			rules: "ON Tele-SI7021#Temperature>25 DO Power1 ON ENDON ON SI7021#Temperature DO Publish never ENDON",
+			fire: func(s *RuleSimulator) ([]FiredCommand, error) {
+				return s.Telemetry([]byte(`{"Time":"2024-01-01T00:00:00","SI7021":{"Temperature":25.5,"Humidity":40}}`))
+			},
+			want: []string{"Power1 ON"},
+		},
+		{
+			name:  "telemetry below threshold",
+			rules: "ON Tele-SI7021#Temperature>25 DO Power1 ON ENDON",
+			fire: func(s *RuleSimulator) ([]FiredCommand, error) {
+				return s.Telemetry([]byte(`{"SI7021":{"Temperature":24.9}}`))
+			},
+			want: []string{},
+		},
+		{
+			name:  "break stops the set",
+			rules: "ON Button1#State=10 DO Power1 TOGGLE BREAK ON Button1#State DO Publish any %value% ENDON",
+			fire:  func(s *RuleSimulator) ([]FiredCommand, error) { return s.Button(1, 10) },
+			want:  []string{"Power1 TOGGLE"},
+		},
+		{
+			name:  "variables chain",
+			rules: "ON Switch1#State DO Var1 %value% ENDON ON Var1#State!=0 DO Add2 5 ENDON ON Var2#State>=5 DO Publish var2 %var2% ENDON",
+			fire:  func(s *RuleSimulator) ([]FiredCommand, error) { return s.Switch(1, 1) },
+			want:  []string{"Var1 1", "Add2 5", "Publish var2 5"},
+		},
+		{
+			name:  "event with value",
+			rules: "ON Event#mode$<night DO Mem1 %value% ENDON ON Mem1#State DO Publish mode %mem1% ENDON",
+			fire:  func(s *RuleSimulator) ([]FiredCommand, error) { return s.Trigger("Event#mode", "nightlight") },
+			want:  []string{"Mem1 nightlight", "Publish mode nightlight"},
+		},
+		{
+			name:  "command raises event",
+			rules: "ON System#Boot DO Event start=1 ENDON ON Event#start=1 DO Power1 ON ENDON ON Power1#State=1 DO Publish on ENDON",
+			fire:  func(s *RuleSimulator) ([]FiredCommand, error) { return s.Boot() },
+			want:  []string{"Event start=1", "Power1 ON", "Publish on"},
+		},
+		{
+			name:  "raised events wait for the rule's commands",
+			rules: "ON System#Boot DO Backlog Event start; Power1 ON; Publish booted ENDON ON Event#start DO Publish started ENDON ON Power1#State=1 DO Publish on ENDON",
+			fire:  func(s *RuleSimulator) ([]FiredCommand, error) { return s.Boot() },
+			want:  []string{"Event start", "Power1 ON", "Publish booted", "Publish started", "Publish on"},
+		},
+		{
+			name:  "json message with array index",
+			rules: "ON ENERGY#Current[2]>=1.5 DO Publish overload %value% ENDON",
+			fire: func(s *RuleSimulator) ([]FiredCommand, error) {
+				return s.Message([]byte(`{"energy":{"Current":[0.2,1.5,0.1]}}`))
+			},
+			want: []string{"Publish overload 1.5"},
+		},
+		{
+			name:  "trigger compares against a variable",
+			rules: "ON Power1#State==%var3% DO Publish same ENDON",
+			fire: func(s *RuleSimulator) ([]FiredCommand, error) {
+				s.SetVar(3, "1")
+				return s.Power(1, true)
+			},
+			want: []string{"Publish same"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sim := NewRuleSimulator()
+			if err := sim.SetRule(1, tt.rules); err != nil {
+				t.Fatalf("SetRule() error: %v", err)
+			}
+			fired, err := tt.fire(sim)
+			if err != nil {
+				t.Fatalf("fire error: %v", err)
+			}
+			if got := firedCommands(fired); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fired %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleSimulator_Sets(t *testing.T) {
+	sim := NewRuleSimulator()
+	if err := sim.SetRule(1, "ON Power1#State DO Publish one ENDON"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sim.SetRule(3, "ON Power1#State DO Publish three ENDON"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sim.LoadRuleSet(2, &RuleSet{Rules: "ON Power1#State DO Publish two ENDON"}); err != nil {
+		t.Fatal(err)
+	}
+
+	fired, err := sim.Power(1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := firedCommands(fired); !reflect.DeepEqual(got, []string{"Publish one", "Publish three"}) {
+		t.Errorf("fired %q, want sets 1 and 3 (set 2 is disabled)", got)
+	}
+	if fired[1].RuleSet != 3 || fired[1].Rule != 1 || fired[1].Value != "1" || fired[1].String() != "Rule3#1 Power1#State: Publish three" {
+		t.Errorf("fired[1] = %+v", fired[1])
+	}
+
+	sim.EnableRule(2, true)
+	sim.EnableRule(1, false)
+	fired, _ = sim.Power(1, false)
+	if got := firedCommands(fired); !reflect.DeepEqual(got, []string{"Publish two", "Publish three"}) {
+		t.Errorf("fired %q after toggling sets", got)
+	}
+
+	if err := sim.SetRule(4, "ON Power1#State DO x ENDON"); !IsCommandError(err) {
+		t.Errorf("SetRule(4) error = %v, want command error", err)
+	}
+	if err := sim.SetRule(1, "ON Power1 DO x ENDON"); !IsParseError(err) {
+		t.Errorf("SetRule() invalid error = %v, want parse error", err)
+	}
+}
+
+func TestRuleSimulator_Once(t *testing.T) {
+	sim := NewRuleSimulator()
+	if err := sim.SetRule(1, "ON Tele-AM2301#Humidity>70 DO Power1 ON ENDON"); err != nil {
+		t.Fatal(err)
+	}
+	sim.SetRuleOnce(1, true)
+
+	counts := []int{}
+	for _, humidity := range []string{"71", "75", "60", "72"} {
+		fired, err := sim.Telemetry([]byte(`{"AM2301":{"Humidity":` + humidity + `}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts = append(counts, len(fired))
+	}
+	if want := []int{1, 0, 0, 1}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("fired counts %v, want %v", counts, want)
+	}
+	if !sim.PowerState(1) {
+		t.Error("Power1 should be on")
+	}
+}
+
+func TestRuleSimulator_Advance(t *testing.T) {
+	sim := NewRuleSimulator()
+	sim.SetTime(time.Date(2024, 6, 1, 6, 58, 30, 0, time.UTC))
+	rules := "ON Power1#State=1 DO RuleTimer1 90 ENDON " +
+		"ON Rules#Timer=1 DO Backlog Power1 OFF; Publish off %timestamp% ENDON " +
+		"ON Time#Minute=420 DO Publish seven %time% ENDON"
+	if err := sim.SetRule(1, rules); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sim.Power(1, true); err != nil {
+		t.Fatal(err)
+	}
+	if sim.RuleTimer(1) != 90 {
+		t.Fatalf("RuleTimer(1) = %d, want 90", sim.RuleTimer(1))
+	}
+
+	fired, err := sim.Advance(2 * time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The timer expires in the same second as the minute and runs first
+	want := []string{"Power1 OFF", "Publish off 2024-06-01T07:00:00", "Publish seven 420"}
+	if got := firedCommands(fired); !reflect.DeepEqual(got, want) {
+		t.Errorf("fired %q, want %q", got, want)
+	}
+	if sim.PowerState(1) || sim.RuleTimer(1) != 0 {
+		t.Errorf("Power1 = %v, RuleTimer1 = %d after timer", sim.PowerState(1), sim.RuleTimer(1))
+	}
+	if !sim.Time().Equal(time.Date(2024, 6, 1, 7, 0, 30, 0, time.UTC)) {
+		t.Errorf("Time() = %v", sim.Time())
+	}
+}
+
+func TestRuleSimulator_Loop(t *testing.T) {
+	sim := NewRuleSimulator()
+	if err := sim.SetRule(1, "ON Event#ping DO Event pong ENDON ON Event#pong DO Event ping ENDON"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sim.Trigger("Event#ping", ""); !IsCommandError(err) {
+		t.Errorf("Trigger() error = %v, want command error for a rule loop", err)
+	}
+}
+
+func TestCompareRuleValue(t *testing.T) {
+	tests := []struct {
+		value, op, want string
+		match           bool
+	}{
+		{"ON", "=", "on", true},
+		{"1.0", "=", "1", false},
+		{"1.0", "==", "1", true},
+		{"2", "!=", "1", true},
+		{"abc", ">", "1", false},
+		{"25.5", ">=", "25.5", true},
+		{"24", "<=", "25", true},
+		{"15", "|", "5", true},
+		{"16", "|", "5", false},
+		{"16", "|", "0", false},
+		{"kitchen", "$<", "kit", true},
+		{"kitchen", "$>", "chen", true},
+		{"kitchen", "$|", "tch", true},
+		{"kitchen", "$^", "tch", false},
+		{"kitchen", "$!", "KITCHEN", false},
+		{"anything", "", "", true},
+	}
+	for _, tt := range tests {
+		if got := compareRuleValue(tt.value, tt.op, tt.want); got != tt.match {
+			t.Errorf("compareRuleValue(%q, %q, %q) = %v, want %v", tt.value, tt.op, tt.want, got, tt.match)
+		}
+	}
+}
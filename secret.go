@@ -0,0 +1,91 @@
+package tasmota
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// redacted replaces secrets in logs and output, like the device does.
+const redacted = "****"
+
+// Secret is a password or other credential. It prints and encodes to JSON as
+// "****" so it does not end up in logs or output; use string(s) for the
+// value. It decodes from JSON as a plain string.
+//
+// Files the package loads, the fleet inventory and the desired state, keep
+// passwords as plain strings so that saving them does not lose the value.
+type Secret string
+
+// String returns "****", or "" if the secret is empty.
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// GoString implements fmt.GoStringer for %#v.
+func (s Secret) GoString() string {
+	return `"` + s.String() + `"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// sensitiveCommand reports whether a command's payload is a credential.
+func sensitiveCommand(name string) bool {
+	switch strings.ToLower(strings.TrimRight(name, "0123456789")) {
+	case "password", "webpassword", "mqttpassword":
+		return true
+	}
+	return false
+}
+
+// redactCommand replaces the payload of credential commands, including
+// inside a Backlog.
+func redactCommand(command string) string {
+	name, payload, _ := strings.Cut(strings.TrimSpace(command), " ")
+	if strings.EqualFold(strings.TrimRight(name, "0"), "Backlog") {
+		commands := backlogCommands(command)
+		for i, c := range commands {
+			commands[i] = redactCommand(c)
+		}
+		return name + " " + strings.Join(commands, "; ")
+	}
+	if sensitiveCommand(name) && strings.TrimSpace(payload) != "" {
+		return name + " " + redacted
+	}
+	return command
+}
+
+// redactURL hides the password and credential commands in a request URL.
+func redactURL(urlStr string) string {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return urlStr
+	}
+	q := u.Query()
+	if q.Has("password") {
+		q.Set("password", redacted)
+	}
+	if q.Has("cmnd") {
+		q.Set("cmnd", redactCommand(q.Get("cmnd")))
+	}
+	u.RawQuery = q.Encode()
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return u.String()
+}
+
+// sensitiveValue matches the value of a credential in a JSON response.
+var sensitiveValue = regexp.MustCompile(`(?i)("(?:password\d*|webpassword|mqttpassword)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+// redactBody hides credentials echoed in a response body.
+func redactBody(body string) string {
+	return sensitiveValue.ReplaceAllString(body, `$1"`+redacted+`"`)
+}
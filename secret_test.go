@@ -0,0 +1,129 @@
+package tasmota
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSecret(t *testing.T) {
+	cfg := MQTTConfig{Host: "mqtt.home", Password: "hunter2"}
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		if out := fmt.Sprintf(format, cfg); strings.Contains(out, "hunter2") {
+			t.Errorf("Sprintf(%q) = %s, leaks the password", format, out)
+		}
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("Marshal() error: %v", err)
+	}
+	if strings.Contains(string(data), "hunter2") || !strings.Contains(string(data), `"Password":"****"`) {
+		t.Errorf("Marshal() = %s", data)
+	}
+	if data, _ := json.Marshal(MQTTConfig{}); !strings.Contains(string(data), `"Password":""`) {
+		t.Errorf("Marshal() of an empty secret = %s", data)
+	}
+
+	var decoded MQTTConfig
+	if err := json.Unmarshal([]byte(`{"Password":"hunter2"}`), &decoded); err != nil || string(decoded.Password) != "hunter2" {
+		t.Errorf("Unmarshal() = %q, %v", decoded.Password, err)
+	}
+}
+
+func TestRedactCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"MqttPassword hunter2", "MqttPassword ****"},
+		{"WebPassword hunter2", "WebPassword ****"},
+		{"Password1 hunter2", "Password1 ****"},
+		{"MqttPassword", "MqttPassword"},
+		{"MqttUser admin", "MqttUser admin"},
+		{"Backlog SSId1 home; Password1 hunter2", "Backlog SSId1 home; Password1 ****"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			if got := redactCommand(tt.command); got != tt.want {
+				t.Errorf("redactCommand(%q) = %q, want %q", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	got := redactBody(`{"MqttPassword":"hunter2","Password1": "a\"b","MqttUser":"admin"}`)
+	want := `{"MqttPassword":"****","Password1": "****","MqttUser":"admin"}`
+	if got != want {
+		t.Errorf("redactBody() = %s, want %s", got, want)
+	}
+}
+
+func TestClient_LogsNoCredentials(t *testing.T) {
+	var logs bytes.Buffer
+	srv, _ := newTestDevice(t)
+	client, err := NewClient(srv.URL,
+		WithAuth("admin", "secret"),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() error: %v", err)
+	}
+	ctx := context.Background()
+
+	if err := client.SetWiFi(ctx, "home", "wifi-secret", 1); err != nil {
+		t.Fatalf("SetWiFi() error: %v", err)
+	}
+	if err := client.SetMQTTPassword(ctx, "mqtt-secret"); err != nil {
+		t.Fatalf("SetMQTTPassword() error: %v", err)
+	}
+	if srv.State().MQTT.Password != "mqtt-secret" {
+		t.Error("MQTT password was not set")
+	}
+
+	// Errors carry the URL of the failed request.
+	srv.Close()
+	_, err = client.ExecuteCommand(ctx, "WebPassword web-secret")
+	if err == nil {
+		t.Fatal("ExecuteCommand() on a closed server succeeded")
+	}
+
+	for _, leak := range []string{"password=secret", "wifi-secret", "mqtt-secret", "web-secret"} {
+		if strings.Contains(logs.String(), leak) || strings.Contains(err.Error(), leak) {
+			t.Errorf("%q leaked:\n%s\n%v", leak, logs.String(), err)
+		}
+	}
+}
+
+func TestWithFormPost(t *testing.T) {
+	srv, _ := newTestDevice(t)
+	var method, query string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, query = r.Method, r.URL.RawQuery
+		srv.ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+
+	client, err := NewClient(proxy.URL, WithAuth("admin", "secret"), WithFormPost())
+	if err != nil {
+		t.Fatalf("NewClient() error: %v", err)
+	}
+	if err := client.SetPowerOn(context.Background(), 1); err != nil {
+		t.Fatalf("SetPowerOn() error: %v", err)
+	}
+	if method != http.MethodPost || query != "" {
+		t.Errorf("request = %s ?%s, want a POST without a query", method, query)
+	}
+	if !srv.State().Relays[0] {
+		t.Error("relay is off")
+	}
+}
@@ -0,0 +1,250 @@
+package tasmota
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DS18B20Reading is a reading of a DS18B20 temperature probe.
+type DS18B20Reading struct {
+	// Name is the sensor block, e.g. "DS18B20-2" when several probes share
+	// the bus.
+	Name        string  `json:"-"`
+	ID          string  `json:"Id"`
+	Temperature float64 `json:"Temperature"`
+}
+
+// ClimateReading is a reading of a temperature, humidity and pressure sensor
+// such as the AM2301, SHT3X or BME280. Values a sensor does not measure are
+// zero.
+type ClimateReading struct {
+	Name        string  `json:"-"`
+	Temperature float64 `json:"Temperature"`
+	Humidity    float64 `json:"Humidity"`
+	DewPoint    float64 `json:"DewPoint"`
+	Pressure    float64 `json:"Pressure"`
+	SeaPressure float64 `json:"SeaPressure"`
+}
+
+// BH1750Reading is a reading of a BH1750 light sensor.
+type BH1750Reading struct {
+	Name string `json:"-"`
+	// Illuminance is in lux.
+	Illuminance float64 `json:"Illuminance"`
+}
+
+// PMS5003Reading is a reading of a PMS5003 particle sensor. CF values are
+// factory calibrated concentrations, PM values are for the atmospheric
+// environment, both in µg/m³. PB values count particles above the given size
+// in µm per 0.1 L of air.
+type PMS5003Reading struct {
+	CF1  int `json:"CF1"`
+	CF25 int `json:"CF2.5"`
+	CF10 int `json:"CF10"`
+	PM1  int `json:"PM1"`
+	PM25 int `json:"PM2.5"`
+	PM10 int `json:"PM10"`
+	PB03 int `json:"PB0.3"`
+	PB05 int `json:"PB0.5"`
+	PB1  int `json:"PB1"`
+	PB25 int `json:"PB2.5"`
+	PB5  int `json:"PB5"`
+	PB10 int `json:"PB10"`
+}
+
+// SCD30Reading is a reading of an SCD30 CO2 sensor.
+type SCD30Reading struct {
+	// CarbonDioxide and ECO2 are in ppm.
+	CarbonDioxide float64 `json:"CarbonDioxide"`
+	ECO2          float64 `json:"eCO2"`
+	Temperature   float64 `json:"Temperature"`
+	Humidity      float64 `json:"Humidity"`
+	DewPoint      float64 `json:"DewPoint"`
+}
+
+// UnmarshalJSON decodes a sensor message, keeping every sensor block in Raw.
+func (s *StatusSensor) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	*s = StatusSensor{}
+	for key, value := range fields {
+		var err error
+		switch key {
+		case "Time":
+			err = json.Unmarshal(value, &s.Time)
+		case "TempUnit":
+			err = json.Unmarshal(value, &s.TempUnit)
+		case "PressureUnit":
+			err = json.Unmarshal(value, &s.PressureUnit)
+		case "Switch":
+			err = json.Unmarshal(value, &s.Switch)
+		default:
+			if key == "ENERGY" {
+				s.Energy = &EnergyData{}
+				err = json.Unmarshal(value, s.Energy)
+			}
+			if s.Raw == nil {
+				s.Raw = make(map[string]json.RawMessage)
+			}
+			s.Raw[key] = value
+		}
+		if err != nil {
+			return fmt.Errorf("sensor field %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// MarshalJSON encodes the sensor message the way the device sends it.
+func (s StatusSensor) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]any, len(s.Raw)+5)
+	for key, value := range s.Raw {
+		fields[key] = value
+	}
+	fields["Time"] = s.Time
+	if s.Switch != nil {
+		fields["Switch"] = s.Switch
+	}
+	if s.Energy != nil {
+		fields["ENERGY"] = s.Energy
+	}
+	if s.TempUnit != "" {
+		fields["TempUnit"] = s.TempUnit
+	}
+	if s.PressureUnit != "" {
+		fields["PressureUnit"] = s.PressureUnit
+	}
+	return json.Marshal(fields)
+}
+
+// Sensors returns the names of the sensor blocks, sorted.
+func (s *StatusSensor) Sensors() []string {
+	return slices.Sorted(maps.Keys(s.Raw))
+}
+
+// Sensor decodes the sensor block called name into v. It reports false if
+// the message has no such block.
+func (s *StatusSensor) Sensor(name string, v any) (bool, error) {
+	value, ok := s.Raw[name]
+	if !ok {
+		return false, nil
+	}
+	return true, unmarshalJSON(value, v)
+}
+
+// DS18B20 returns the readings of every DS18B20 probe.
+func (s *StatusSensor) DS18B20() ([]DS18B20Reading, error) {
+	return sensorReadings(s, "DS18B20", func(r *DS18B20Reading) *string { return &r.Name })
+}
+
+// Climate returns the readings of every temperature and humidity sensor of
+// the given type, e.g. "DHT11", "SI7021" or "BMP280".
+func (s *StatusSensor) Climate(sensor string) ([]ClimateReading, error) {
+	return sensorReadings(s, sensor, func(r *ClimateReading) *string { return &r.Name })
+}
+
+// AM2301 returns the readings of every AM2301 (DHT21/DHT22) sensor.
+func (s *StatusSensor) AM2301() ([]ClimateReading, error) {
+	return s.Climate("AM2301")
+}
+
+// SHT3X returns the readings of every SHT3x sensor.
+func (s *StatusSensor) SHT3X() ([]ClimateReading, error) {
+	return s.Climate("SHT3X")
+}
+
+// BME280 returns the readings of every BME280 sensor.
+func (s *StatusSensor) BME280() ([]ClimateReading, error) {
+	return s.Climate("BME280")
+}
+
+// BH1750 returns the readings of every BH1750 sensor.
+func (s *StatusSensor) BH1750() ([]BH1750Reading, error) {
+	return sensorReadings(s, "BH1750", func(r *BH1750Reading) *string { return &r.Name })
+}
+
+// PMS5003 returns the PMS5003 reading, or nil if there is none.
+func (s *StatusSensor) PMS5003() (*PMS5003Reading, error) {
+	var r PMS5003Reading
+	if ok, err := s.Sensor("PMS5003", &r); !ok || err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// SCD30 returns the SCD30 reading, or nil if there is none.
+func (s *StatusSensor) SCD30() (*SCD30Reading, error) {
+	var r SCD30Reading
+	if ok, err := s.Sensor("SCD30", &r); !ok || err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Analog returns the numeric values of the ANALOG block by name, e.g. "A0"
+// or "Temperature1", or nil if there is none.
+func (s *StatusSensor) Analog() (map[string]float64, error) {
+	var fields map[string]json.RawMessage
+	if ok, err := s.Sensor("ANALOG", &fields); !ok || err != nil {
+		return nil, err
+	}
+	values := make(map[string]float64, len(fields))
+	for key, value := range fields {
+		var f float64
+		if json.Unmarshal(value, &f) == nil {
+			values[key] = f
+		}
+	}
+	return values, nil
+}
+
+// Counters returns the pulse counters of the COUNTER block by number, or nil
+// if there is none.
+func (s *StatusSensor) Counters() (map[int]int64, error) {
+	var fields map[string]float64
+	if ok, err := s.Sensor("COUNTER", &fields); !ok || err != nil {
+		return nil, err
+	}
+	counters := make(map[int]int64, len(fields))
+	for key, value := range fields {
+		if n, err := strconv.Atoi(strings.TrimPrefix(key, "C")); err == nil {
+			counters[n] = int64(value)
+		}
+	}
+	return counters, nil
+}
+
+// sensorReadings decodes every block of a sensor type. The block is named
+// after the type when there is one sensor and <type>-<suffix> when there are
+// several.
+func sensorReadings[T any](s *StatusSensor, sensor string, name func(*T) *string) ([]T, error) {
+	var names []string
+	for key := range s.Raw {
+		if key == sensor || strings.HasPrefix(key, sensor+"-") {
+			names = append(names, key)
+		}
+	}
+	// Sort DS18B20-2 before DS18B20-10.
+	slices.SortFunc(names, func(a, b string) int {
+		return cmp.Or(cmp.Compare(len(a), len(b)), strings.Compare(a, b))
+	})
+
+	readings := make([]T, 0, len(names))
+	for _, key := range names {
+		var r T
+		if err := unmarshalJSON(s.Raw[key], &r); err != nil {
+			return nil, err
+		}
+		*name(&r) = key
+		readings = append(readings, r)
+	}
+	return readings, nil
+}
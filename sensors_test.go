@@ -0,0 +1,152 @@
+package tasmota
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/kradalby/tasmota-go/tasmotatest"
+)
+
+const sensorPayload = `{
+	"Time": "2024-01-01T12:00:00",
+	"Switch1": "ON",
+	"DS18B20-10": {"Id": "0316A2791A3A", "Temperature": 19.5},
+	"DS18B20-2": {"Id": "01144A0CB6AA", "Temperature": 21.2},
+	"AM2301": {"Temperature": 22.3, "Humidity": 45.2, "DewPoint": 9.8},
+	"BME280": {"Temperature": 20.1, "Humidity": 50.5, "DewPoint": 9.5, "Pressure": 1013.2, "SeaPressure": 1020.1},
+	"SHT3X-0x44": {"Temperature": 23.0, "Humidity": 40.0, "DewPoint": 8.8},
+	"SHT3X-0x45": {"Temperature": null, "Humidity": null, "DewPoint": null},
+	"BH1750": {"Illuminance": 312},
+	"ANALOG": {"A0": 512, "Temperature1": 24.5, "CTEnergy1": {"Power": 5}},
+	"PMS5003": {"CF1": 3, "CF2.5": 5, "CF10": 6, "PM1": 3, "PM2.5": 5, "PM10": 6, "PB0.3": 690, "PB0.5": 195, "PB1": 30, "PB2.5": 2, "PB5": 0, "PB10": 0},
+	"SCD30": {"CarbonDioxide": 612, "eCO2": 590, "Temperature": 22.6, "Humidity": 41.5, "DewPoint": 8.7},
+	"COUNTER": {"C1": 1234, "C2": 0},
+	"ENERGY": {"Total": 12.5, "Power": 40, "Voltage": 230},
+	"MyCustom": {"Level": 7},
+	"TempUnit": "C",
+	"PressureUnit": "hPa"
+}`
+
+func TestStatusSensor_UnmarshalJSON(t *testing.T) {
+	var s StatusSensor
+	if err := json.Unmarshal([]byte(sensorPayload), &s); err != nil {
+		t.Fatalf("Unmarshal() error: %v", err)
+	}
+
+	if s.Time != "2024-01-01T12:00:00" || s.TempUnit != "C" || s.PressureUnit != "hPa" {
+		t.Errorf("metadata = %q %q %q", s.Time, s.TempUnit, s.PressureUnit)
+	}
+	if s.Energy == nil || s.Energy.Power != 40 {
+		t.Errorf("Energy = %+v, want power 40", s.Energy)
+	}
+	if len(s.Raw) != 14 {
+		t.Errorf("Raw has %d blocks, want 14: %v", len(s.Raw), s.Sensors())
+	}
+
+	var custom struct{ Level int }
+	if ok, err := s.Sensor("MyCustom", &custom); !ok || err != nil || custom.Level != 7 {
+		t.Errorf("Sensor(MyCustom) = %v, %v, %+v", ok, err, custom)
+	}
+	if ok, err := s.Sensor("Missing", &custom); ok || err != nil {
+		t.Errorf("Sensor(Missing) = %v, %v, want false, nil", ok, err)
+	}
+
+	probes, err := s.DS18B20()
+	if err != nil {
+		t.Fatalf("DS18B20() error: %v", err)
+	}
+	wantProbes := []DS18B20Reading{
+		{Name: "DS18B20-2", ID: "01144A0CB6AA", Temperature: 21.2},
+		{Name: "DS18B20-10", ID: "0316A2791A3A", Temperature: 19.5},
+	}
+	if !reflect.DeepEqual(probes, wantProbes) {
+		t.Errorf("DS18B20() = %+v, want %+v", probes, wantProbes)
+	}
+
+	if am, err := s.AM2301(); err != nil || len(am) != 1 || am[0].Humidity != 45.2 {
+		t.Errorf("AM2301() = %+v, %v", am, err)
+	}
+	if bme, err := s.BME280(); err != nil || len(bme) != 1 || bme[0].Pressure != 1013.2 || bme[0].SeaPressure != 1020.1 {
+		t.Errorf("BME280() = %+v, %v", bme, err)
+	}
+	if sht, err := s.SHT3X(); err != nil || len(sht) != 2 || sht[0].Name != "SHT3X-0x44" || sht[1].Temperature != 0 {
+		t.Errorf("SHT3X() = %+v, %v", sht, err)
+	}
+	if lux, err := s.BH1750(); err != nil || len(lux) != 1 || lux[0].Illuminance != 312 {
+		t.Errorf("BH1750() = %+v, %v", lux, err)
+	}
+	if dht, err := s.Climate("DHT11"); err != nil || len(dht) != 0 {
+		t.Errorf("Climate(DHT11) = %+v, %v, want none", dht, err)
+	}
+
+	analog, err := s.Analog()
+	if err != nil || !reflect.DeepEqual(analog, map[string]float64{"A0": 512, "Temperature1": 24.5}) {
+		t.Errorf("Analog() = %v, %v", analog, err)
+	}
+	if pms, err := s.PMS5003(); err != nil || pms == nil || pms.PM25 != 5 || pms.PB03 != 690 {
+		t.Errorf("PMS5003() = %+v, %v", pms, err)
+	}
+	if scd, err := s.SCD30(); err != nil || scd == nil || scd.CarbonDioxide != 612 || scd.ECO2 != 590 {
+		t.Errorf("SCD30() = %+v, %v", scd, err)
+	}
+	if counters, err := s.Counters(); err != nil || !reflect.DeepEqual(counters, map[int]int64{1: 1234, 2: 0}) {
+		t.Errorf("Counters() = %v, %v", counters, err)
+	}
+
+	// Round trip through MarshalJSON keeps every block.
+	data, err := json.Marshal(&s)
+	if err != nil {
+		t.Fatalf("Marshal() error: %v", err)
+	}
+	var again StatusSensor
+	if err := json.Unmarshal(data, &again); err != nil {
+		t.Fatalf("Unmarshal(Marshal()) error: %v", err)
+	}
+	if !reflect.DeepEqual(again.Sensors(), s.Sensors()) || again.PressureUnit != "hPa" {
+		t.Errorf("round trip = %v, want %v", again.Sensors(), s.Sensors())
+	}
+}
+
+func TestStatusSensor_Absent(t *testing.T) {
+	var s StatusSensor
+	if err := json.Unmarshal([]byte(`{"Time":"2024-01-01T12:00:00"}`), &s); err != nil {
+		t.Fatalf("Unmarshal() error: %v", err)
+	}
+	if pms, err := s.PMS5003(); pms != nil || err != nil {
+		t.Errorf("PMS5003() = %+v, %v, want nil", pms, err)
+	}
+	if analog, err := s.Analog(); analog != nil || err != nil {
+		t.Errorf("Analog() = %v, %v, want nil", analog, err)
+	}
+
+	if err := json.Unmarshal([]byte(`{"DS18B20":{"Temperature":"hot"}}`), &s); err != nil {
+		t.Fatalf("Unmarshal() error: %v", err)
+	}
+	if _, err := s.DS18B20(); !IsParseError(err) {
+		t.Errorf("DS18B20() error = %v, want parse error", err)
+	}
+}
+
+func TestIntegration_Sensors(t *testing.T) {
+	_, client := newTestDevice(t,
+		tasmotatest.WithSensor("DS18B20-1", map[string]any{"Id": "01144A0CB6AA", "Temperature": 21.5}),
+		tasmotatest.WithSensor("BH1750", map[string]any{"Illuminance": 80}),
+	)
+
+	sensors, err := client.GetSensorData(context.Background())
+	if err != nil {
+		t.Fatalf("GetSensorData() error: %v", err)
+	}
+	if sensors.TempUnit != "C" {
+		t.Errorf("TempUnit = %q, want C", sensors.TempUnit)
+	}
+	probes, err := sensors.DS18B20()
+	if err != nil || len(probes) != 1 || probes[0].Temperature != 21.5 {
+		t.Errorf("DS18B20() = %+v, %v", probes, err)
+	}
+	if lux, err := sensors.BH1750(); err != nil || len(lux) != 1 || lux[0].Illuminance != 80 {
+		t.Errorf("BH1750() = %+v, %v", lux, err)
+	}
+}
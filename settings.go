@@ -0,0 +1,442 @@
+package tasmota
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Settings dumps are the raw settings struct as stored in flash. Every byte
+// after the first two is XORed with (settingsXOR + offset), and the struct
+// carries a CRC16 at 0x00E and a CRC32 in its last four bytes.
+const (
+	settingsXOR = 0x5A
+	// settingsCRC16Size is the number of bytes covered by the CRC16.
+	settingsCRC16Size = 3584
+)
+
+// settingsLayout describes where fields live in the settings struct for a
+// range of firmware versions. Offsets are relative to the start of the dump.
+type settingsLayout struct {
+	minVersion uint32
+	size       int
+	flags      int // SetOption0-31 bitfield
+	textPool   int // NUL-separated strings, indexed by settingsText
+	textSize   int
+	params     int // SetOption32-49, one byte each
+	timers     int // 16 packed uint32 timers
+	rules      int // 3 rule sets
+	ruleSize   int
+}
+
+// settingsLayouts lists the known layouts, newest first.
+var settingsLayouts = []settingsLayout{
+	{
+		// Tasmota 9.0 and later: text pool fills 0x017-0x2D1.
+		minVersion: 0x09000000,
+		size:       4096,
+		flags:      0x010,
+		textPool:   0x017,
+		textSize:   699,
+		params:     0x2FC,
+		timers:     0x670,
+		rules:      0x800,
+		ruleSize:   512,
+	},
+}
+
+// Indexes into the settings text pool, in firmware order.
+const (
+	settingsTextOTAURL = iota
+	settingsTextMQTTPrefix1
+	settingsTextMQTTPrefix2
+	settingsTextMQTTPrefix3
+	settingsTextSSID1
+	settingsTextSSID2
+	settingsTextPassword1
+	settingsTextPassword2
+	settingsTextHostname
+	settingsTextSyslogHost
+	settingsTextWebPassword
+	settingsTextCORS
+	settingsTextMQTTHost
+	settingsTextMQTTClient
+	settingsTextMQTTUser
+	settingsTextMQTTPassword
+	settingsTextMQTTFullTopic
+	settingsTextMQTTTopic
+	settingsTextMQTTButtonTopic
+	settingsTextMQTTSwitchTopic
+	settingsTextMQTTGroupTopic
+	settingsTextStateText1
+	settingsTextNTPServer1 = settingsTextStateText1 + 4
+	settingsTextMem1       = settingsTextNTPServer1 + 3
+	settingsTextFriendly1  = settingsTextMem1 + 16
+	settingsTextKnown      = settingsTextFriendly1 + 8
+)
+
+// Settings is a decoded settings dump, as downloaded from the device web UI.
+// Unlike the command API it includes passwords. Fields not covered by the
+// typed struct are kept and written back unchanged by Encode.
+type Settings struct {
+	// Version is the firmware version that wrote the dump, such as 0x0E020000 for 14.2.0.
+	Version   uint32
+	CfgHolder uint16
+	BootCount uint16
+	SaveFlag  uint32
+
+	// SetOptions holds SetOption0-49.
+	SetOptions map[int]int
+
+	OTAURL          string
+	MQTTPrefix      [3]string
+	SSID            [2]string
+	WiFiPassword    [2]Secret
+	Hostname        string
+	SyslogHost      string
+	WebPassword     Secret
+	CORS            string
+	MQTTHost        string
+	MQTTClient      string
+	MQTTUser        string
+	MQTTPassword    Secret
+	MQTTFullTopic   string
+	MQTTTopic       string
+	MQTTButtonTopic string
+	MQTTSwitchTopic string
+	MQTTGroupTopic  string
+	StateText       [4]string
+	NTPServer       [3]string
+	Mem             [16]string
+	FriendlyName    [8]string
+
+	Timers [16]SettingsTimer
+
+	// Rules holds the rule sets. Rule sets stored compressed cannot be
+	// decoded; they are left empty and kept as-is unless replaced.
+	Rules           [3]string
+	RulesCompressed [3]bool
+
+	layout *settingsLayout
+	raw    []byte // de-obfuscated dump
+	texts  []string
+}
+
+// SettingsTimer is a timer as packed in the settings struct.
+type SettingsTimer struct {
+	Arm bool
+	// Mode is 0 for a time of day, 1 for sunrise and 2 for sunset.
+	Mode int
+	// Time is minutes past midnight, or the offset for sunrise/sunset modes.
+	Time   int
+	Window int
+	// Days is a bitmask with bit 0 for Sunday.
+	Days   uint8
+	Repeat bool
+	// Output is the relay, starting at 1.
+	Output int
+	// Action is 0 off, 1 on, 2 toggle, 3 rule.
+	Action int
+}
+
+func decodeSettingsTimer(v uint32) SettingsTimer {
+	return SettingsTimer{
+		Time:   int(v & 0x7FF),
+		Window: int(v >> 11 & 0xF),
+		Repeat: v>>15&1 == 1,
+		Days:   uint8(v >> 16 & 0x7F),
+		Output: int(v>>23&0xF) + 1,
+		Action: int(v >> 27 & 0x3),
+		Mode:   int(v >> 29 & 0x3),
+		Arm:    v>>31 == 1,
+	}
+}
+
+func (t SettingsTimer) encode() (uint32, error) {
+	if t.Time < 0 || t.Time > 0x7FF || t.Window < 0 || t.Window > 15 || t.Days > 0x7F ||
+		t.Output < 1 || t.Output > 16 || t.Action < 0 || t.Action > 3 || t.Mode < 0 || t.Mode > 2 {
+		return 0, NewError(ErrorTypeCommand, fmt.Sprintf("timer value out of range: %+v", t), nil)
+	}
+
+	v := uint32(t.Time) | uint32(t.Window)<<11 | uint32(t.Days)<<16 |
+		uint32(t.Output-1)<<23 | uint32(t.Action)<<27 | uint32(t.Mode)<<29
+	if t.Repeat {
+		v |= 1 << 15
+	}
+	if t.Arm {
+		v |= 1 << 31
+	}
+	return v, nil
+}
+
+// VersionString formats Version as major.minor.patch.
+func (s *Settings) VersionString() string {
+	v := s.Version
+	version := fmt.Sprintf("%d.%d.%d", v>>24, v>>16&0xFF, v>>8&0xFF)
+	if build := v & 0xFF; build != 0 {
+		version += fmt.Sprintf(".%d", build)
+	}
+	return version
+}
+
+// obfuscateSettings toggles the dump obfuscation in place.
+func obfuscateSettings(data []byte) {
+	for i := 2; i < len(data); i++ {
+		data[i] ^= byte(settingsXOR + i)
+	}
+}
+
+// DecodeSettings decodes a settings dump (.dmp) as downloaded from /dl.
+// Only the layout of Tasmota 9.0 and later is known; dumps from older
+// firmware are rejected with a parse error.
+func DecodeSettings(dump []byte) (*Settings, error) {
+	if len(dump) < 16 {
+		return nil, NewError(ErrorTypeParse, "settings dump too short", nil)
+	}
+
+	raw := bytes.Clone(dump)
+	obfuscateSettings(raw)
+
+	s := &Settings{
+		CfgHolder: binary.LittleEndian.Uint16(raw[0x000:]),
+		SaveFlag:  binary.LittleEndian.Uint32(raw[0x004:]),
+		Version:   binary.LittleEndian.Uint32(raw[0x008:]),
+		BootCount: binary.LittleEndian.Uint16(raw[0x00C:]),
+		raw:       raw,
+	}
+
+	for i := range settingsLayouts {
+		if s.Version >= settingsLayouts[i].minVersion {
+			s.layout = &settingsLayouts[i]
+			break
+		}
+	}
+	if s.layout == nil {
+		oldest := settingsLayouts[len(settingsLayouts)-1].minVersion
+		return nil, NewError(ErrorTypeParse, fmt.Sprintf("settings from firmware %s are not supported, need %s or later",
+			s.VersionString(), (&Settings{Version: oldest}).VersionString()), nil)
+	}
+	l := s.layout
+
+	if size := int(binary.LittleEndian.Uint16(raw[0x002:])); size != l.size || len(raw) < l.size {
+		return nil, NewError(ErrorTypeParse, fmt.Sprintf("settings size %d (dump %d bytes), want %d", size, len(raw), l.size), nil)
+	}
+	if crc := binary.LittleEndian.Uint16(raw[0x00E:]); crc != settingsCRC16(raw) {
+		return nil, NewError(ErrorTypeParse, "settings CRC16 mismatch", nil)
+	}
+	if crc := binary.LittleEndian.Uint32(raw[l.size-4:]); crc != settingsCRC32(raw[:l.size-4]) {
+		return nil, NewError(ErrorTypeParse, "settings CRC32 mismatch", nil)
+	}
+
+	s.SetOptions = make(map[int]int, 50)
+	flags := binary.LittleEndian.Uint32(raw[l.flags:])
+	for bit := range 32 {
+		s.SetOptions[bit] = int(flags>>bit) & 1
+	}
+	for i := range 18 {
+		s.SetOptions[32+i] = int(raw[l.params+i])
+	}
+
+	// Unused space after the last string is zero filled
+	pool := bytes.TrimRight(raw[l.textPool:l.textPool+l.textSize], "\x00")
+	s.texts = strings.Split(string(pool), "\x00")
+	for len(s.texts) < settingsTextKnown {
+		s.texts = append(s.texts, "")
+	}
+	for idx, field := range s.textFields() {
+		*field = s.texts[idx]
+	}
+
+	for i := range s.Timers {
+		s.Timers[i] = decodeSettingsTimer(binary.LittleEndian.Uint32(raw[l.timers+4*i:]))
+	}
+
+	for i := range s.Rules {
+		rule := raw[l.rules+i*l.ruleSize : l.rules+(i+1)*l.ruleSize]
+		if rule[0] == 0 && rule[1] != 0 {
+			s.RulesCompressed[i] = true
+			continue
+		}
+		if end := bytes.IndexByte(rule, 0); end >= 0 {
+			rule = rule[:end]
+		}
+		s.Rules[i] = string(rule)
+	}
+
+	return s, nil
+}
+
+// textFields maps text pool indexes to the typed fields.
+func (s *Settings) textFields() map[int]*string {
+	fields := map[int]*string{
+		settingsTextOTAURL:          &s.OTAURL,
+		settingsTextMQTTPrefix1:     &s.MQTTPrefix[0],
+		settingsTextMQTTPrefix2:     &s.MQTTPrefix[1],
+		settingsTextMQTTPrefix3:     &s.MQTTPrefix[2],
+		settingsTextSSID1:           &s.SSID[0],
+		settingsTextSSID2:           &s.SSID[1],
+		settingsTextPassword1:       (*string)(&s.WiFiPassword[0]),
+		settingsTextPassword2:       (*string)(&s.WiFiPassword[1]),
+		settingsTextHostname:        &s.Hostname,
+		settingsTextSyslogHost:      &s.SyslogHost,
+		settingsTextWebPassword:     (*string)(&s.WebPassword),
+		settingsTextCORS:            &s.CORS,
+		settingsTextMQTTHost:        &s.MQTTHost,
+		settingsTextMQTTClient:      &s.MQTTClient,
+		settingsTextMQTTUser:        &s.MQTTUser,
+		settingsTextMQTTPassword:    (*string)(&s.MQTTPassword),
+		settingsTextMQTTFullTopic:   &s.MQTTFullTopic,
+		settingsTextMQTTTopic:       &s.MQTTTopic,
+		settingsTextMQTTButtonTopic: &s.MQTTButtonTopic,
+		settingsTextMQTTSwitchTopic: &s.MQTTSwitchTopic,
+		settingsTextMQTTGroupTopic:  &s.MQTTGroupTopic,
+	}
+	for i := range s.StateText {
+		fields[settingsTextStateText1+i] = &s.StateText[i]
+	}
+	for i := range s.NTPServer {
+		fields[settingsTextNTPServer1+i] = &s.NTPServer[i]
+	}
+	for i := range s.Mem {
+		fields[settingsTextMem1+i] = &s.Mem[i]
+	}
+	for i := range s.FriendlyName {
+		fields[settingsTextFriendly1+i] = &s.FriendlyName[i]
+	}
+	return fields
+}
+
+// Encode writes the settings back into dump form, ready for UploadSettings.
+// Only settings decoded by DecodeSettings can be encoded, since the dump
+// they came from supplies the fields not covered by Settings.
+func (s *Settings) Encode() ([]byte, error) {
+	if s.layout == nil || s.raw == nil {
+		return nil, NewError(ErrorTypeCommand, "settings must come from DecodeSettings", nil)
+	}
+	l := s.layout
+	raw := bytes.Clone(s.raw)
+
+	binary.LittleEndian.PutUint16(raw[0x000:], s.CfgHolder)
+	binary.LittleEndian.PutUint32(raw[0x004:], s.SaveFlag)
+	binary.LittleEndian.PutUint16(raw[0x00C:], s.BootCount)
+
+	var flags uint32
+	for bit := range 32 {
+		if s.SetOptions[bit] == 1 {
+			flags |= 1 << bit
+		}
+	}
+	binary.LittleEndian.PutUint32(raw[l.flags:], flags)
+	for i := range 18 {
+		value := s.SetOptions[32+i]
+		if value < 0 || value > 255 {
+			return nil, NewError(ErrorTypeCommand, fmt.Sprintf("SetOption%d must be between 0 and 255", 32+i), nil)
+		}
+		raw[l.params+i] = byte(value)
+	}
+
+	texts := append([]string(nil), s.texts...)
+	for idx, field := range s.textFields() {
+		if strings.ContainsRune(*field, 0) {
+			return nil, NewError(ErrorTypeCommand, "settings text cannot contain NUL", nil)
+		}
+		texts[idx] = *field
+	}
+	pool := strings.Join(texts, "\x00") + "\x00"
+	if len(pool) > l.textSize {
+		return nil, NewError(ErrorTypeCommand, fmt.Sprintf("settings text exceeds %d bytes", l.textSize), nil)
+	}
+	copy(raw[l.textPool:l.textPool+l.textSize], make([]byte, l.textSize))
+	copy(raw[l.textPool:], pool)
+
+	for i, t := range s.Timers {
+		v, err := t.encode()
+		if err != nil {
+			return nil, err
+		}
+		binary.LittleEndian.PutUint32(raw[l.timers+4*i:], v)
+	}
+
+	for i, rule := range s.Rules {
+		if s.RulesCompressed[i] && rule == "" {
+			continue
+		}
+		if len(rule) >= l.ruleSize {
+			return nil, NewError(ErrorTypeCommand, fmt.Sprintf("rule %d exceeds %d bytes", i+1, l.ruleSize-1), nil)
+		}
+		slot := raw[l.rules+i*l.ruleSize : l.rules+(i+1)*l.ruleSize]
+		copy(slot, make([]byte, l.ruleSize))
+		copy(slot, rule)
+	}
+
+	binary.LittleEndian.PutUint16(raw[0x00E:], settingsCRC16(raw))
+	binary.LittleEndian.PutUint32(raw[l.size-4:], settingsCRC32(raw[:l.size-4]))
+
+	obfuscateSettings(raw)
+	return raw, nil
+}
+
+// settingsCRC16 is the firmware's weighted byte sum, skipping the CRC itself.
+func settingsCRC16(raw []byte) uint16 {
+	var crc uint16
+	for i := 0; i < settingsCRC16Size && i < len(raw); i++ {
+		if i < 14 || i > 15 {
+			crc += uint16(raw[i]) * uint16(i+1)
+		}
+	}
+	return crc
+}
+
+// settingsCRC32 is the firmware's bitwise CRC32, which unlike IEEE CRC32
+// starts from zero.
+func settingsCRC32(data []byte) uint32 {
+	var crc uint32
+	for _, b := range data {
+		crc ^= uint32(b)
+		for range 8 {
+			crc = crc>>1 ^ -(crc&1)&0xEDB88320
+		}
+	}
+	return ^crc
+}
+
+// DownloadSettings downloads the settings dump from the web UI (/dl).
+// The dump contains passwords in recoverable form and should be stored securely.
+func (c *Client) DownloadSettings(ctx context.Context) ([]byte, error) {
+	urlStr, err := c.webURL("/dl", nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.webGet(ctx, urlStr)
+}
+
+// GetSettings downloads and decodes the settings dump.
+func (c *Client) GetSettings(ctx context.Context) (*Settings, error) {
+	dump, err := c.DownloadSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeSettings(dump)
+}
+
+// UploadSettings restores a settings dump through the web UI (/u2).
+// The device restarts with the new settings.
+func (c *Client) UploadSettings(ctx context.Context, dump []byte) error {
+	if _, err := DecodeSettings(dump); err != nil {
+		return err
+	}
+
+	// Opening the restore page selects settings as the upload type
+	return c.webUpload(ctx, "/rs", "settings.dmp", dump, nil)
+}
+
+// PutSettings encodes and uploads settings.
+func (c *Client) PutSettings(ctx context.Context, s *Settings) error {
+	dump, err := s.Encode()
+	if err != nil {
+		return err
+	}
+	return c.UploadSettings(ctx, dump)
+}
@@ -0,0 +1,214 @@
+package tasmota
+
+import (
+	"context"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/kradalby/tasmota-go/tasmotatest"
+)
+
+// newTestDump builds an obfuscated 14.2.0 settings dump, letting fill set
+// fields in the plain struct before the CRCs are computed.
+func newTestDump(t *testing.T, fill func(raw []byte)) []byte {
+	t.Helper()
+
+	raw := make([]byte, 4096)
+	binary.LittleEndian.PutUint16(raw[0x000:], 4617)
+	binary.LittleEndian.PutUint16(raw[0x002:], 4096)
+	binary.LittleEndian.PutUint32(raw[0x008:], 0x0E020000)
+	binary.LittleEndian.PutUint16(raw[0x00C:], 7)
+	if fill != nil {
+		fill(raw)
+	}
+	binary.LittleEndian.PutUint16(raw[0x00E:], settingsCRC16(raw))
+	binary.LittleEndian.PutUint32(raw[4092:], settingsCRC32(raw[:4092]))
+
+	obfuscateSettings(raw)
+	return raw
+}
+
+func fillTestSettings(raw []byte) {
+	texts := []string{
+		"http://ota.tasmota.com/tasmota/release/tasmota.bin.gz",
+		"cmnd", "stat", "tele",
+		"home", "", "wifi-secret", "",
+		"kitchen-plug", "", "web-secret", "",
+		"mqtt.home", "DVES_123456", "mqtt-user", "mqtt-secret",
+		"%prefix%/%topic%/", "kitchen",
+	}
+	copy(raw[0x017:], strings.Join(texts, "\x00")+"\x00")
+
+	binary.LittleEndian.PutUint32(raw[0x010:], 1<<0|1<<15)
+	raw[0x2FC+4] = 20 // SetOption36
+
+	// Timer 1: armed, 06:30 on weekdays, relay 2 on
+	timer := uint32(390) | 0b0111110<<16 | 1<<23 | 1<<27 | 1<<31
+	binary.LittleEndian.PutUint32(raw[0x670:], timer)
+
+	copy(raw[0x800:], "ON Power1#State=1 DO Publish stat/kitchen/on 1 ENDON")
+	// Rule 2 is compressed
+	raw[0xA00], raw[0xA01] = 0, 0x42
+
+	raw[0x400] = 0xAB // outside the typed fields
+}
+
+func TestDecodeSettings(t *testing.T) {
+	dump := newTestDump(t, fillTestSettings)
+	if dump[0] != 0x09 || dump[2] != 0x00^0x5C || dump[3] != 0x10^0x5D {
+		t.Fatalf("dump header = % x, want obfuscated from byte 2", dump[:4])
+	}
+
+	s, err := DecodeSettings(dump)
+	if err != nil {
+		t.Fatalf("DecodeSettings() error: %v", err)
+	}
+
+	if s.VersionString() != "14.2.0" || s.BootCount != 7 || s.CfgHolder != 4617 {
+		t.Errorf("header = %s boot %d holder %d", s.VersionString(), s.BootCount, s.CfgHolder)
+	}
+	if s.SSID[0] != "home" || s.WiFiPassword[0] != "wifi-secret" || s.WebPassword != "web-secret" {
+		t.Errorf("wifi = %q/%q, web = %q", s.SSID[0], s.WiFiPassword[0], s.WebPassword)
+	}
+	if s.MQTTHost != "mqtt.home" || s.MQTTPassword != "mqtt-secret" || s.MQTTTopic != "kitchen" || s.MQTTPrefix[2] != "tele" {
+		t.Errorf("mqtt = %q %q %q %q", s.MQTTHost, s.MQTTPassword, s.MQTTTopic, s.MQTTPrefix[2])
+	}
+	if s.SetOptions[0] != 1 || s.SetOptions[15] != 1 || s.SetOptions[1] != 0 || s.SetOptions[36] != 20 {
+		t.Errorf("SetOptions = %v", s.SetOptions)
+	}
+
+	want := SettingsTimer{Arm: true, Time: 390, Days: 0b0111110, Output: 2, Action: 1}
+	if s.Timers[0] != want {
+		t.Errorf("Timers[0] = %+v, want %+v", s.Timers[0], want)
+	}
+	if !strings.HasPrefix(s.Rules[0], "ON Power1#State=1") || s.Rules[1] != "" || !s.RulesCompressed[1] {
+		t.Errorf("Rules = %q, compressed %v", s.Rules, s.RulesCompressed)
+	}
+}
+
+func TestSettings_EncodeRoundTrip(t *testing.T) {
+	dump := newTestDump(t, fillTestSettings)
+	s, err := DecodeSettings(dump)
+	if err != nil {
+		t.Fatalf("DecodeSettings() error: %v", err)
+	}
+
+	unchanged, err := s.Encode()
+	if err != nil {
+		t.Fatalf("Encode() error: %v", err)
+	}
+	if string(unchanged) != string(dump) {
+		t.Error("Encode() of unmodified settings differs from the original dump")
+	}
+
+	s.WiFiPassword[1] = "guest-secret"
+	s.FriendlyName[0] = "Kettle"
+	s.SetOptions[19] = 1
+	s.Timers[3] = SettingsTimer{Mode: 2, Time: 30, Days: 0x7F, Repeat: true, Output: 1, Action: 2}
+	s.Rules[2] = "ON System#Boot DO Power ON ENDON"
+
+	encoded, err := s.Encode()
+	if err != nil {
+		t.Fatalf("Encode() error: %v", err)
+	}
+	got, err := DecodeSettings(encoded)
+	if err != nil {
+		t.Fatalf("DecodeSettings() error: %v", err)
+	}
+
+	if got.WiFiPassword[1] != "guest-secret" || got.FriendlyName[0] != "Kettle" || got.SetOptions[19] != 1 {
+		t.Errorf("text/options not encoded: %q %q %d", got.WiFiPassword[1], got.FriendlyName[0], got.SetOptions[19])
+	}
+	if got.Timers[3] != s.Timers[3] || got.Rules[2] != s.Rules[2] || !got.RulesCompressed[1] {
+		t.Errorf("timers/rules not encoded: %+v %q %v", got.Timers[3], got.Rules[2], got.RulesCompressed)
+	}
+	if got.raw[0x400] != 0xAB {
+		t.Error("bytes outside the typed fields were not preserved")
+	}
+
+	s.Timers[0].Output = 17
+	if _, err := s.Encode(); !IsCommandError(err) {
+		t.Errorf("Encode() invalid timer error = %v, want command error", err)
+	}
+	if _, err := (&Settings{}).Encode(); !IsCommandError(err) {
+		t.Errorf("Encode() without dump error = %v, want command error", err)
+	}
+}
+
+func TestDecodeSettings_Invalid(t *testing.T) {
+	corrupt := newTestDump(t, fillTestSettings)
+	corrupt[0x100] ^= 0xFF
+
+	old := newTestDump(t, func(raw []byte) {
+		binary.LittleEndian.PutUint32(raw[0x008:], 0x08050100)
+	})
+
+	tests := []struct {
+		name string
+		dump []byte
+	}{
+		{"short", []byte{1, 2, 3}},
+		{"truncated", newTestDump(t, nil)[:2048]},
+		{"corrupt", corrupt},
+		{"unknown version", old},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeSettings(tt.dump); !IsParseError(err) {
+				t.Errorf("DecodeSettings() error = %v, want parse error", err)
+			}
+		})
+	}
+}
+
+func TestDecodeSettings_OldFirmware(t *testing.T) {
+	old := newTestDump(t, func(raw []byte) {
+		binary.LittleEndian.PutUint32(raw[0x008:], 0x08050100)
+	})
+
+	_, err := DecodeSettings(old)
+	if want := "settings from firmware 8.5.1 are not supported, need 9.0.0 or later"; !IsParseError(err) || !strings.Contains(err.Error(), want) {
+		t.Errorf("DecodeSettings() error = %v, want parse error containing %q", err, want)
+	}
+}
+
+func TestIntegration_Settings(t *testing.T) {
+	srv, client := newTestDevice(t, tasmotatest.WithState(func(s *tasmotatest.State) {
+		s.SettingsDump = newTestDump(t, fillTestSettings)
+	}))
+	ctx := context.Background()
+
+	s, err := client.GetSettings(ctx)
+	if err != nil {
+		t.Fatalf("GetSettings() error: %v", err)
+	}
+	if s.MQTTPassword != "mqtt-secret" {
+		t.Errorf("MQTTPassword = %q", s.MQTTPassword)
+	}
+
+	s.MQTTHost = "broker.home"
+	if err := client.PutSettings(ctx, s); err != nil {
+		t.Fatalf("PutSettings() error: %v", err)
+	}
+
+	uploaded, err := DecodeSettings(srv.State().SettingsDump)
+	if err != nil {
+		t.Fatalf("DecodeSettings(uploaded) error: %v", err)
+	}
+	if uploaded.MQTTHost != "broker.home" {
+		t.Errorf("uploaded MQTTHost = %q", uploaded.MQTTHost)
+	}
+
+	unauthorized, err := NewClient(srv.URL, WithAuth("admin", "wrong"))
+	if err != nil {
+		t.Fatalf("NewClient() error: %v", err)
+	}
+	if _, err := unauthorized.DownloadSettings(ctx); !IsAuthError(err) {
+		t.Errorf("DownloadSettings() error = %v, want auth error", err)
+	}
+	if err := unauthorized.UploadSettings(ctx, []byte("junk")); !IsParseError(err) {
+		t.Errorf("UploadSettings() error = %v, want parse error", err)
+	}
+}
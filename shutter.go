@@ -0,0 +1,403 @@
+package tasmota
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxShutters is the most shutters a device supports (four on ESP8266).
+	MaxShutters = 16
+	// DefaultShutterTimeout is how long WaitShutter waits by default.
+	DefaultShutterTimeout = 2 * time.Minute
+	// DefaultShutterPollInterval is how often WaitShutter polls by default.
+	DefaultShutterPollInterval = time.Second
+)
+
+// ShutterDirection is the direction a shutter is moving in.
+type ShutterDirection int
+
+const (
+	// ShutterClosing moves the shutter down.
+	ShutterClosing ShutterDirection = -1
+	// ShutterStopped is a shutter at rest.
+	ShutterStopped ShutterDirection = 0
+	// ShutterOpening moves the shutter up.
+	ShutterOpening ShutterDirection = 1
+)
+
+// String returns the direction name: closing, stopped or opening.
+func (d ShutterDirection) String() string {
+	switch d {
+	case ShutterClosing:
+		return "closing"
+	case ShutterStopped:
+		return "stopped"
+	case ShutterOpening:
+		return "opening"
+	default:
+		return fmt.Sprintf("ShutterDirection(%d)", int(d))
+	}
+}
+
+// ShutterState is the position of a shutter, as reported in the
+// Shutter<n> object of sensor telemetry and Status 10.
+type ShutterState struct {
+	// Position and Target are in percent, 0 closed and 100 open.
+	Position  int              `json:"Position"`
+	Direction ShutterDirection `json:"Direction"`
+	Target    int              `json:"Target"`
+	// Tilt is the slat angle of venetian blinds, -90 to 90.
+	Tilt int `json:"Tilt"`
+}
+
+// ShutterConfig is the configuration of a shutter from Status 13.
+type ShutterConfig struct {
+	// Relay is the first of the shutter's two relays; 0 means unused.
+	Relay         int
+	OpenDuration  time.Duration
+	CloseDuration time.Duration
+	// Halfway is the position, in percent, the shutter is at after half
+	// of the open duration (ShutterSetHalfway).
+	Halfway    int
+	MotorDelay time.Duration
+	// Options are the ShutterInvert, ShutterLock and similar option bits
+	// as reported, such as "0000".
+	Options     string
+	Mode        int
+	Calibration []int
+	TiltConfig  []int
+}
+
+// GetShutter reads the position of shutter n (1-16) from Status 10.
+func (c *Client) GetShutter(ctx context.Context, n int) (*ShutterState, error) {
+	if err := checkShutter(n); err != nil {
+		return nil, err
+	}
+	raw, err := c.ExecuteCommand(ctx, "Status 10")
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		StatusSNS map[string]json.RawMessage `json:"StatusSNS"`
+	}
+	if err := unmarshalJSON(raw, &resp); err != nil {
+		return nil, err
+	}
+	state, ok, err := parseShutterState(resp.StatusSNS, n)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, NewError(ErrorTypeDevice, fmt.Sprintf("device reports no Shutter%d", n), nil)
+	}
+	return state, nil
+}
+
+// parseShutterState finds Shutter<n> in a sensor payload.
+func parseShutterState(fields map[string]json.RawMessage, n int) (*ShutterState, bool, error) {
+	value, ok := fields[fmt.Sprintf("Shutter%d", n)]
+	if !ok {
+		return nil, false, nil
+	}
+	var state ShutterState
+	if err := unmarshalJSON(value, &state); err != nil {
+		return nil, false, err
+	}
+	return &state, true, nil
+}
+
+// GetShutterConfigs reads the configuration of every shutter from Status 13.
+// The result is indexed by shutter number minus one.
+func (c *Client) GetShutterConfigs(ctx context.Context) ([]ShutterConfig, error) {
+	raw, err := c.ExecuteCommand(ctx, "Status 13")
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		StatusSHT map[string]struct {
+			Relay1     int    `json:"Relay1"`
+			Open       int    `json:"Open"`
+			Close      int    `json:"Close"`
+			Halfway    int    `json:"50perc"`
+			Delay      int    `json:"Delay"`
+			Opt        string `json:"Opt"`
+			Calib      []int  `json:"Calib"`
+			Mode       string `json:"Mode"`
+			TiltConfig []int  `json:"TiltConfig"`
+		} `json:"StatusSHT"`
+	}
+	if err := unmarshalJSON(raw, &resp); err != nil {
+		return nil, err
+	}
+	if resp.StatusSHT == nil {
+		return nil, NewError(ErrorTypeDevice, "device reports no shutters, is SetOption80 on?", nil)
+	}
+
+	var configs []ShutterConfig
+	for key, sht := range resp.StatusSHT {
+		// Shutters are numbered from zero: SHT0 is shutter 1
+		i, err := strconv.Atoi(strings.TrimPrefix(key, "SHT"))
+		if err != nil || i < 0 || i >= MaxShutters {
+			continue
+		}
+		for len(configs) <= i {
+			configs = append(configs, ShutterConfig{})
+		}
+		mode, _ := strconv.Atoi(sht.Mode)
+		configs[i] = ShutterConfig{
+			Relay:         sht.Relay1,
+			OpenDuration:  time.Duration(sht.Open) * time.Second / 10,
+			CloseDuration: time.Duration(sht.Close) * time.Second / 10,
+			Halfway:       sht.Halfway,
+			MotorDelay:    time.Duration(sht.Delay) * time.Second / 20,
+			Options:       sht.Opt,
+			Mode:          mode,
+			Calibration:   sht.Calib,
+			TiltConfig:    sht.TiltConfig,
+		}
+	}
+	return configs, nil
+}
+
+// GetShutterConfig reads the configuration of shutter n (1-16).
+func (c *Client) GetShutterConfig(ctx context.Context, n int) (*ShutterConfig, error) {
+	if err := checkShutter(n); err != nil {
+		return nil, err
+	}
+	configs, err := c.GetShutterConfigs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if n > len(configs) || configs[n-1].Relay == 0 {
+		return nil, NewError(ErrorTypeDevice, fmt.Sprintf("shutter %d is not configured", n), nil)
+	}
+	return &configs[n-1], nil
+}
+
+// OpenShutter starts opening shutter n (1-16).
+func (c *Client) OpenShutter(ctx context.Context, n int) error {
+	return c.shutterCommand(ctx, "ShutterOpen", n, "")
+}
+
+// CloseShutter starts closing shutter n (1-16).
+func (c *Client) CloseShutter(ctx context.Context, n int) error {
+	return c.shutterCommand(ctx, "ShutterClose", n, "")
+}
+
+// StopShutter stops shutter n (1-16).
+func (c *Client) StopShutter(ctx context.Context, n int) error {
+	return c.shutterCommand(ctx, "ShutterStop", n, "")
+}
+
+// SetShutterPosition starts moving shutter n (1-16) to position percent,
+// 0 closed and 100 open. Use WaitShutter to wait until it gets there.
+func (c *Client) SetShutterPosition(ctx context.Context, n, position int) error {
+	if position < 0 || position > 100 {
+		return NewError(ErrorTypeCommand, "shutter position must be between 0 and 100", nil)
+	}
+	return c.shutterCommand(ctx, "ShutterPosition", n, strconv.Itoa(position))
+}
+
+// SetShutterTilt sets the slat angle of shutter n (1-16), -90 to 90.
+func (c *Client) SetShutterTilt(ctx context.Context, n, tilt int) error {
+	if tilt < -90 || tilt > 90 {
+		return NewError(ErrorTypeCommand, "shutter tilt must be between -90 and 90", nil)
+	}
+	return c.shutterCommand(ctx, "ShutterTilt", n, strconv.Itoa(tilt))
+}
+
+// SetShutterRelay assigns relay and relay+1 to shutter n (1-16). Relay 0
+// removes the shutter. Shutters need SetOption80 1.
+func (c *Client) SetShutterRelay(ctx context.Context, n, relay int) error {
+	if relay < 0 || relay > 32 {
+		return NewError(ErrorTypeCommand, "shutter relay must be between 0 and 32", nil)
+	}
+	return c.shutterCommand(ctx, "ShutterRelay", n, strconv.Itoa(relay))
+}
+
+// SetShutterDurations sets how long shutter n (1-16) takes to fully open
+// and to fully close, with a resolution of 0.1s.
+func (c *Client) SetShutterDurations(ctx context.Context, n int, open, closing time.Duration) error {
+	if err := checkShutter(n); err != nil {
+		return err
+	}
+	if open < 100*time.Millisecond || closing < 100*time.Millisecond {
+		return NewError(ErrorTypeCommand, "shutter durations must be at least 0.1s", nil)
+	}
+	_, err := c.ExecuteBacklog(ctx,
+		fmt.Sprintf("ShutterOpenDuration%d %.1f", n, open.Seconds()),
+		fmt.Sprintf("ShutterCloseDuration%d %.1f", n, closing.Seconds()))
+	return err
+}
+
+// SetShutterHalfway calibrates shutter n (1-16) with the position, in
+// percent, it reaches after half of its open duration.
+func (c *Client) SetShutterHalfway(ctx context.Context, n, percent int) error {
+	if percent < 0 || percent > 100 {
+		return NewError(ErrorTypeCommand, "shutter halfway position must be between 0 and 100", nil)
+	}
+	return c.shutterCommand(ctx, "ShutterSetHalfway", n, strconv.Itoa(percent))
+}
+
+func (c *Client) shutterCommand(ctx context.Context, name string, n int, payload string) error {
+	if err := checkShutter(n); err != nil {
+		return err
+	}
+	cmd := fmt.Sprintf("%s%d", name, n)
+	if payload != "" {
+		cmd += " " + payload
+	}
+	_, err := c.ExecuteCommand(ctx, cmd)
+	return err
+}
+
+func checkShutter(n int) error {
+	if n < 1 || n > MaxShutters {
+		return NewError(ErrorTypeCommand, fmt.Sprintf("shutter number must be between 1 and %d", MaxShutters), nil)
+	}
+	return nil
+}
+
+// ShutterWaitOption configures WaitShutter.
+type ShutterWaitOption func(*shutterWaitOptions)
+
+type shutterWaitOptions struct {
+	timeout  time.Duration
+	interval time.Duration
+	stream   *TelemetryStream
+}
+
+// WithShutterTimeout sets how long WaitShutter waits. The default is
+// DefaultShutterTimeout.
+func WithShutterTimeout(d time.Duration) ShutterWaitOption {
+	return func(o *shutterWaitOptions) {
+		o.timeout = d
+	}
+}
+
+// WithShutterPollInterval sets how often WaitShutter polls Status 10. The
+// default is DefaultShutterPollInterval.
+func WithShutterPollInterval(d time.Duration) ShutterWaitOption {
+	return func(o *shutterWaitOptions) {
+		o.interval = d
+	}
+}
+
+// WithShutterTelemetry makes WaitShutter follow the shutter's position in
+// telemetry instead of polling. WaitShutter consumes events from the
+// stream while it waits, so other readers miss them. The device reports
+// shutter positions in RESULT messages while they move.
+func WithShutterTelemetry(stream *TelemetryStream) ShutterWaitOption {
+	return func(o *shutterWaitOptions) {
+		o.stream = stream
+	}
+}
+
+// WaitShutter waits until shutter n (1-16) stops at position. It returns a
+// device error if the shutter starts moving and then stops somewhere else,
+// and a timeout error if it does not arrive in time.
+func (c *Client) WaitShutter(ctx context.Context, n, position int, opts ...ShutterWaitOption) (*ShutterState, error) {
+	if err := checkShutter(n); err != nil {
+		return nil, err
+	}
+	o := shutterWaitOptions{timeout: DefaultShutterTimeout, interval: DefaultShutterPollInterval}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, o.timeout)
+	defer cancel()
+
+	moved := false
+	check := func(state *ShutterState) (bool, error) {
+		if state.Direction != ShutterStopped {
+			moved = true
+			return false, nil
+		}
+		// Positions are rounded by the firmware, so allow being one off
+		if state.Position >= position-1 && state.Position <= position+1 {
+			return true, nil
+		}
+		if moved {
+			return false, NewError(ErrorTypeDevice,
+				fmt.Sprintf("shutter %d stopped at %d%%, expected %d%%", n, state.Position, position), nil)
+		}
+		return false, nil
+	}
+
+	var (
+		state *ShutterState
+		err   error
+	)
+	if o.stream != nil {
+		state, err = waitShutterEvents(ctx, o.stream, n, check)
+	} else {
+		state, err = c.pollShutter(ctx, n, o.interval, check)
+	}
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return state, NewError(ErrorTypeTimeout,
+			fmt.Sprintf("shutter %d did not reach %d%% within %s", n, position, o.timeout), err)
+	}
+	return state, err
+}
+
+func (c *Client) pollShutter(ctx context.Context, n int, interval time.Duration, check func(*ShutterState) (bool, error)) (*ShutterState, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last *ShutterState
+	for {
+		state, err := c.GetShutter(ctx, n)
+		if err == nil {
+			last = state
+			done, err := check(state)
+			if done || err != nil {
+				return state, err
+			}
+		} else if !IsNetworkError(err) && !IsTimeoutError(err) {
+			return last, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return last, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func waitShutterEvents(ctx context.Context, stream *TelemetryStream, n int, check func(*ShutterState) (bool, error)) (*ShutterState, error) {
+	var last *ShutterState
+	for {
+		select {
+		case <-ctx.Done():
+			return last, ctx.Err()
+		case event, ok := <-stream.Events():
+			if !ok {
+				return last, NewError(ErrorTypeNetwork, "telemetry stream closed", nil)
+			}
+			if event.Raw == nil {
+				continue
+			}
+			var fields map[string]json.RawMessage
+			if json.Unmarshal(event.Raw, &fields) != nil {
+				continue
+			}
+			state, found, err := parseShutterState(fields, n)
+			if err != nil || !found {
+				continue
+			}
+			last = state
+			if done, err := check(state); done || err != nil {
+				return state, err
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package tasmota
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kradalby/tasmota-go/tasmotatest"
+)
+
+func TestIntegration_Shutter(t *testing.T) {
+	srv, client := newTestDevice(t, tasmotatest.WithShutters(2, 300*time.Millisecond))
+	ctx := context.Background()
+	poll := WithShutterPollInterval(10 * time.Millisecond)
+
+	if err := client.SetShutterPosition(ctx, 1, 60); err != nil {
+		t.Fatalf("SetShutterPosition() error: %v", err)
+	}
+	state, err := client.WaitShutter(ctx, 1, 60, poll)
+	if err != nil {
+		t.Fatalf("WaitShutter() error: %v", err)
+	}
+	if state.Position != 60 || state.Target != 60 || state.Direction != ShutterStopped {
+		t.Errorf("WaitShutter() = %+v", state)
+	}
+
+	if err := client.CloseShutter(ctx, 1); err != nil {
+		t.Fatalf("CloseShutter() error: %v", err)
+	}
+	state, err = client.GetShutter(ctx, 1)
+	if err != nil || state.Direction != ShutterClosing || state.Target != 0 {
+		t.Errorf("GetShutter() while closing = %+v, %v", state, err)
+	}
+	if _, err := client.WaitShutter(ctx, 1, 0, poll); err != nil {
+		t.Fatalf("WaitShutter(0) error: %v", err)
+	}
+
+	if err := client.OpenShutter(ctx, 1); err != nil {
+		t.Fatalf("OpenShutter() error: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := client.StopShutter(ctx, 1); err != nil {
+		t.Fatalf("StopShutter() error: %v", err)
+	}
+	if _, err := client.WaitShutter(ctx, 1, 100, poll, WithShutterTimeout(100*time.Millisecond)); !IsTimeoutError(err) {
+		t.Errorf("WaitShutter() after stop error = %v, want timeout", err)
+	}
+
+	if err := client.OpenShutter(ctx, 1); err != nil {
+		t.Fatalf("OpenShutter() error: %v", err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = client.StopShutter(ctx, 1)
+	}()
+	if _, err := client.WaitShutter(ctx, 1, 100, poll); !IsDeviceError(err) {
+		t.Errorf("WaitShutter() stopped midway error = %v, want device error", err)
+	}
+
+	if err := client.SetShutterDurations(ctx, 2, 1500*time.Millisecond, 2*time.Second); err != nil {
+		t.Fatalf("SetShutterDurations() error: %v", err)
+	}
+	if err := client.SetShutterHalfway(ctx, 2, 40); err != nil {
+		t.Fatalf("SetShutterHalfway() error: %v", err)
+	}
+	if err := client.SetShutterTilt(ctx, 2, -45); err != nil {
+		t.Fatalf("SetShutterTilt() error: %v", err)
+	}
+	config, err := client.GetShutterConfig(ctx, 2)
+	if err != nil {
+		t.Fatalf("GetShutterConfig() error: %v", err)
+	}
+	if config.Relay != 3 || config.OpenDuration != 1500*time.Millisecond || config.CloseDuration != 2*time.Second || config.Halfway != 40 {
+		t.Errorf("GetShutterConfig() = %+v", config)
+	}
+	if got := srv.State().Shutters[1].Tilt; got != -45 {
+		t.Errorf("Tilt = %d, want -45", got)
+	}
+
+	if err := client.SetShutterRelay(ctx, 2, 0); err != nil {
+		t.Fatalf("SetShutterRelay() error: %v", err)
+	}
+	configs, err := client.GetShutterConfigs(ctx)
+	if err != nil || len(configs) != 1 {
+		t.Errorf("GetShutterConfigs() = %+v, %v, want one shutter", configs, err)
+	}
+	if _, err := client.GetShutterConfig(ctx, 2); !IsDeviceError(err) {
+		t.Errorf("GetShutterConfig(removed) error = %v, want device error", err)
+	}
+	if _, err := client.GetShutter(ctx, 2); !IsDeviceError(err) {
+		t.Errorf("GetShutter(removed) error = %v, want device error", err)
+	}
+
+	for name, err := range map[string]error{
+		"number":   client.OpenShutter(ctx, 0),
+		"position": client.SetShutterPosition(ctx, 1, 101),
+		"tilt":     client.SetShutterTilt(ctx, 1, 91),
+		"relay":    client.SetShutterRelay(ctx, 1, -1),
+		"duration": client.SetShutterDurations(ctx, 1, 0, time.Second),
+		"halfway":  client.SetShutterHalfway(ctx, 1, -1),
+	} {
+		if !IsCommandError(err) {
+			t.Errorf("%s: error = %v, want command error", name, err)
+		}
+	}
+
+	_, relay := newTestDevice(t)
+	if _, err := relay.GetShutterConfigs(ctx); err == nil {
+		t.Error("GetShutterConfigs() without shutters should fail")
+	}
+}
+
+func TestWaitShutter_Telemetry(t *testing.T) {
+	broker := newMemBroker()
+	ctx := context.Background()
+	stream, err := SubscribeTelemetry(ctx, broker, DeviceTopics{Topic: "blind"})
+	if err != nil {
+		t.Fatalf("SubscribeTelemetry() error: %v", err)
+	}
+	defer func() { _ = stream.Close() }()
+
+	for _, payload := range []string{
+		`{"POWER1":"ON"}`,
+		`{"Shutter2":{"Position":0,"Direction":0,"Target":0,"Tilt":0}}`,
+		`{"Shutter1":{"Position":20,"Direction":1,"Target":50,"Tilt":0}}`,
+		`{"Shutter1":{"Position":50,"Direction":0,"Target":50,"Tilt":0}}`,
+	} {
+		if err := broker.Publish(ctx, "stat/blind/RESULT", []byte(payload)); err != nil {
+			t.Fatalf("Publish() error: %v", err)
+		}
+	}
+
+	client, err := NewClient("192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := client.WaitShutter(ctx, 1, 50, WithShutterTelemetry(stream), WithShutterTimeout(2*time.Second))
+	if err != nil {
+		t.Fatalf("WaitShutter() error: %v", err)
+	}
+	if state.Position != 50 {
+		t.Errorf("WaitShutter() = %+v", state)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 )
 
@@ -97,6 +98,40 @@ type StatusLog struct {
 	SetOption  []string `json:"SetOption"`
 }
 
+// SetOptions decodes the SetOption bitmasks into option numbers and values.
+// The first mask holds options 0-31, the second one byte per option for
+// 32-49, and the remaining masks hold 32 options each starting at 50.
+func (l *StatusLog) SetOptions() (map[int]int, error) {
+	options := make(map[int]int)
+
+	for i, mask := range l.SetOption {
+		if i == 1 {
+			for j := 0; j+2 <= len(mask) && 32+j/2 <= 49; j += 2 {
+				b, err := strconv.ParseUint(mask[j:j+2], 16, 8)
+				if err != nil {
+					return nil, NewError(ErrorTypeParse, fmt.Sprintf("invalid SetOption mask %q", mask), err)
+				}
+				options[32+j/2] = int(b)
+			}
+			continue
+		}
+
+		bits, err := strconv.ParseUint(mask, 16, 32)
+		if err != nil {
+			return nil, NewError(ErrorTypeParse, fmt.Sprintf("invalid SetOption mask %q", mask), err)
+		}
+		first := 0
+		if i > 1 {
+			first = 50 + (i-2)*32
+		}
+		for bit := range 32 {
+			options[first+bit] = int(bits>>bit) & 1
+		}
+	}
+
+	return options, nil
+}
+
 // StatusMemory contains memory information (Status 4).
 type StatusMemory struct {
 	ProgramSize      int      `json:"ProgramSize"`
@@ -159,28 +194,19 @@ type StatusTime struct {
 	Sunset   string `json:"Sunset"`
 }
 
-// StatusSensor contains sensor data (Status 8, Status 10).
+// StatusSensor contains sensor data (Status 8, Status 10, tele SENSOR).
+// Every sensor block is kept in Raw and can be read with Sensor or a typed
+// decoder such as DS18B20.
 type StatusSensor struct {
-	Time   string      `json:"Time"`
-	Switch []string    `json:"Switch,omitempty"`
-	Energy *EnergyData `json:"ENERGY,omitempty"`
-	// Add more sensor types as needed
-	Raw map[string]interface{} `json:"-"` // Catch-all for unknown sensors
-}
-
-// EnergyData contains power monitoring information.
-type EnergyData struct {
-	TotalStartTime string  `json:"TotalStartTime"`
-	Total          float64 `json:"Total"`
-	Yesterday      float64 `json:"Yesterday"`
-	Today          float64 `json:"Today"`
-	Period         float64 `json:"Period"`
-	Power          float64 `json:"Power"`
-	ApparentPower  float64 `json:"ApparentPower"`
-	ReactivePower  float64 `json:"ReactivePower"`
-	Factor         float64 `json:"Factor"`
-	Voltage        float64 `json:"Voltage"`
-	Current        float64 `json:"Current"`
+	Time   string
+	Switch []string
+	Energy *EnergyData
+	// TempUnit and PressureUnit are the units of temperature and pressure
+	// readings, e.g. "C" and "hPa".
+	TempUnit     string
+	PressureUnit string
+	// Raw holds every sensor block by name, e.g. "DS18B20-1" or "ENERGY".
+	Raw map[string]json.RawMessage
 }
 
 // StatusState contains current device state (Status 11).
@@ -203,6 +229,17 @@ type StatusState struct {
 	POWER7    string    `json:"POWER7,omitempty"`
 	POWER8    string    `json:"POWER8,omitempty"`
 	Wifi      *WifiInfo `json:"Wifi,omitempty"`
+	// Light fields, present on bulbs and LED strips; see Light.
+	Dimmer   int    `json:"Dimmer,omitempty"`
+	Color    string `json:"Color,omitempty"`
+	HSBColor string `json:"HSBColor,omitempty"`
+	White    int    `json:"White,omitempty"`
+	CT       int    `json:"CT,omitempty"`
+	Channel  []int  `json:"Channel,omitempty"`
+	Scheme   int    `json:"Scheme,omitempty"`
+	Fade     string `json:"Fade,omitempty"`
+	Speed    int    `json:"Speed,omitempty"`
+	LedTable string `json:"LedTable,omitempty"`
 }
 
 // WifiInfo contains WiFi connection information.
@@ -218,14 +255,6 @@ type WifiInfo struct {
 	Downtime  string  `json:"Downtime"`
 }
 
-// StatusPower contains power usage details.
-type StatusPower struct {
-	Power   float64 `json:"Power"`
-	Energy  float64 `json:"Energy"`
-	Voltage float64 `json:"Voltage"`
-	Current float64 `json:"Current"`
-}
-
 // Status queries device status information.
 // category can be 0 (all) or 1-11 for specific status types:
 //
@@ -547,3 +547,27 @@ func TestClient_GetDeviceInfo_MissingField(t *testing.T) {
 		t.Errorf("expected parse error, got %T", err)
 	}
 }
+
+func TestStatusLog_SetOptions(t *testing.T) {
+	log := &StatusLog{SetOption: []string{"00008009", "2805C80001000600003C5A0A190000000000", "00000080", "00006000", "00004000", "00000000"}}
+
+	options, err := log.SetOptions()
+	if err != nil {
+		t.Fatalf("SetOptions() error: %v", err)
+	}
+
+	want := map[int]int{0: 1, 3: 1, 15: 1, 1: 0, 32: 0x28, 33: 5, 34: 0xC8, 36: 1, 57: 1, 95: 1, 96: 1, 128: 1, 177: 0}
+	for option, value := range want {
+		if options[option] != value {
+			t.Errorf("SetOption%d = %d, want %d", option, options[option], value)
+		}
+	}
+	if len(options) != 178 {
+		t.Errorf("len(SetOptions()) = %d, want 178", len(options))
+	}
+
+	log.SetOption = []string{"nothex"}
+	if _, err := log.SetOptions(); !IsParseError(err) {
+		t.Errorf("SetOptions() error = %v, want parse error", err)
+	}
+}
@@ -0,0 +1,527 @@
+package tasmotatest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// builtin implements the commands the simulated device understands.
+// It returns nil for unknown commands.
+func (d *Device) builtin(cmd Command) map[string]any {
+	s := &d.state
+
+	switch strings.ToLower(cmd.Name) {
+	case "power":
+		return d.power(cmd)
+	case "status":
+		return d.status(cmd)
+
+	case "devicename":
+		if cmd.Payload != "" {
+			s.DeviceName = cmd.Payload
+		}
+		return map[string]any{"DeviceName": s.DeviceName}
+	case "friendlyname":
+		return d.friendlyName(cmd)
+	case "poweronstate":
+		setInt(&s.PowerOnState, cmd.Payload, 0, 5)
+		return map[string]any{"PowerOnState": s.PowerOnState}
+	case "ledstate":
+		setInt(&s.LedState, cmd.Payload, 0, 8)
+		return map[string]any{"LedState": s.LedState}
+	case "sleep":
+		setInt(&s.Sleep, cmd.Payload, 0, 250)
+		return map[string]any{"Sleep": s.Sleep}
+	case "buttonretain":
+		return retain("ButtonRetain", &s.ButtonRetain, cmd.Payload)
+	case "switchretain":
+		return retain("SwitchRetain", &s.SwitchRetain, cmd.Payload)
+	case "sensorretain":
+		return retain("SensorRetain", &s.SensorRetain, cmd.Payload)
+	case "powerretain":
+		return retain("PowerRetain", &s.PowerRetain, cmd.Payload)
+	case "teleperiod":
+		setInt(&s.TelePeriod, cmd.Payload, 0, 3600)
+		if s.TelePeriod > 0 && s.TelePeriod < 10 {
+			s.TelePeriod = 10
+		}
+		return map[string]any{"TelePeriod": s.TelePeriod}
+	case "setoption":
+		return d.setOption(cmd)
+	case "module":
+		if cmd.Payload != "" {
+			n, err := strconv.Atoi(cmd.Payload)
+			if err != nil || n < 0 {
+				return commandError()
+			}
+			s.Module = n
+		}
+		return map[string]any{"Module": map[string]any{strconv.Itoa(s.Module): fmt.Sprintf("Module %d", s.Module)}}
+	case "template":
+		return d.template(cmd)
+	case "pulsetime":
+		index := max(cmd.Index, 1)
+		if index > len(s.PulseTime) {
+			return nil
+		}
+		setInt(&s.PulseTime[index-1], cmd.Payload, 0, 65535)
+		return map[string]any{fmt.Sprintf("PulseTime%d", index): map[string]any{"Set": s.PulseTime[index-1], "Remaining": 0}}
+	case "restart":
+		if cmd.Payload != "1" && cmd.Payload != "99" {
+			return commandError()
+		}
+		d.restart()
+		return map[string]any{"Restart": "Restarting"}
+	case "otaurl":
+		setString(&s.OtaURL, cmd.Payload)
+		return map[string]any{"OtaUrl": s.OtaURL}
+	case "upgrade":
+		switch cmd.Payload {
+		case "":
+			return map[string]any{"Upgrade": fmt.Sprintf("Version %s from %s", s.Firmware, s.OtaURL)}
+		case "1":
+			from := s.OtaURL
+			if err := d.runUpgrade(from, nil); err != nil {
+				return map[string]any{"Upgrade": "Failed " + err.Error()}
+			}
+			return map[string]any{"Upgrade": fmt.Sprintf("Version %s from %s", s.Firmware, from)}
+		}
+		return commandError()
+	case "delay":
+		return map[string]any{"Delay": cmd.Payload}
+	case "webpassword":
+		if cmd.Payload != "" {
+			s.WebPassword = cmd.Payload
+		}
+		return map[string]any{"WebPassword": "****"}
+
+	case "mqtthost":
+		setString(&s.MQTT.Host, cmd.Payload)
+		return map[string]any{"MqttHost": s.MQTT.Host}
+	case "mqttport":
+		setInt(&s.MQTT.Port, cmd.Payload, 1, 65535)
+		return map[string]any{"MqttPort": s.MQTT.Port}
+	case "mqttuser":
+		setString(&s.MQTT.User, cmd.Payload)
+		return map[string]any{"MqttUser": s.MQTT.User}
+	case "mqttpassword":
+		setString(&s.MQTT.Password, cmd.Payload)
+		return map[string]any{"MqttPassword": "****"}
+	case "mqttclient":
+		setString(&s.MQTT.Client, cmd.Payload)
+		return map[string]any{"MqttClient": s.MQTT.Client}
+	case "topic":
+		setString(&s.MQTT.Topic, cmd.Payload)
+		return map[string]any{"Topic": s.MQTT.Topic}
+	case "fulltopic":
+		setString(&s.MQTT.FullTopic, cmd.Payload)
+		return map[string]any{"FullTopic": s.MQTT.FullTopic}
+	case "grouptopic":
+		setString(&s.MQTT.GroupTopic, cmd.Payload)
+		return map[string]any{"GroupTopic1": s.MQTT.GroupTopic}
+	case "prefix":
+		if cmd.Index < 1 || cmd.Index > 3 {
+			return nil
+		}
+		setString(&s.MQTT.Prefix[cmd.Index-1], cmd.Payload)
+		return map[string]any{cmd.Name + strconv.Itoa(cmd.Index): s.MQTT.Prefix[cmd.Index-1]}
+
+	case "hostname":
+		if len(cmd.Payload) <= 32 {
+			setString(&s.Network.Hostname, cmd.Payload)
+		}
+		return map[string]any{"Hostname": s.Network.Hostname}
+	case "ipaddress":
+		return d.ipAddress(cmd)
+	case "ssid":
+		if cmd.Index < 1 || cmd.Index > 2 {
+			return nil
+		}
+		setString(&s.Network.SSID[cmd.Index-1], cmd.Payload)
+		return map[string]any{fmt.Sprintf("SSId%d", cmd.Index): s.Network.SSID[cmd.Index-1]}
+	case "rule":
+		return d.rule(cmd)
+	case "timer":
+		return d.timer(cmd)
+	case "timers":
+		return d.timers(cmd)
+	case "shutteropen", "shutterclose", "shutterstop", "shutterposition", "shuttertilt",
+		"shutterrelay", "shutteropenduration", "shuttercloseduration", "shuttersethalfway":
+		return d.shutter(cmd)
+	case "dimmer", "color", "hsbcolor", "ct", "fade", "speed", "scheme", "wakeup", "wakeupduration":
+		if s.Light.Channels == 0 {
+			return nil
+		}
+		return d.light(cmd)
+
+	case "zbstatus", "zbinfo", "zbpermitjoin", "zbname", "zblight", "zbforget", "zbsend", "zbbind", "zbunbind":
+		if s.Zigbee == nil {
+			return nil
+		}
+		return d.zigbee(cmd)
+	case "irsend", "irhvac":
+		if s.IR == nil {
+			return nil
+		}
+		return d.ir(cmd)
+	case "rfsend", "rfsync", "rflow", "rfhigh", "rfcode", "rfraw", "rfkey":
+		if s.RF == nil {
+			return nil
+		}
+		return d.rf(cmd)
+	case "tuyamcu", "tuyasend", "tuyaenum", "tuyaenumlist":
+		if s.Tuya == nil {
+			return nil
+		}
+		return d.tuya(cmd)
+
+	case "password":
+		if cmd.Index < 1 || cmd.Index > 2 {
+			return nil
+		}
+		setString(&s.Network.Password[cmd.Index-1], cmd.Payload)
+		return map[string]any{fmt.Sprintf("Password%d", cmd.Index): "****"}
+	}
+
+	return nil
+}
+
+// power handles Power, Power<n> and Power0 (all relays).
+func (d *Device) power(cmd Command) map[string]any {
+	relays := d.state.Relays
+
+	var targets []int
+	switch {
+	case cmd.Indexed && cmd.Index == 0:
+		for n := range relays {
+			targets = append(targets, n+1)
+		}
+	case cmd.Index == 0:
+		targets = []int{1}
+	case cmd.Index > len(relays):
+		return nil
+	default:
+		targets = []int{cmd.Index}
+	}
+
+	var newState func(bool) bool
+	switch strings.ToUpper(cmd.Payload) {
+	case "":
+		newState = func(on bool) bool { return on }
+	case "ON", "1":
+		newState = func(bool) bool { return true }
+	case "OFF", "0":
+		newState = func(bool) bool { return false }
+	case "TOGGLE", "2":
+		newState = func(on bool) bool { return !on }
+	default:
+		return commandError()
+	}
+
+	resp := make(map[string]any, len(targets))
+	for _, n := range targets {
+		relays[n-1] = newState(relays[n-1])
+		resp[powerKey(n, len(relays))] = onOff(relays[n-1])
+	}
+	return resp
+}
+
+// powerKey returns the response key for relay n, which is POWER on single relay devices.
+func powerKey(n, relays int) string {
+	if relays == 1 {
+		return "POWER"
+	}
+	return fmt.Sprintf("POWER%d", n)
+}
+
+func (d *Device) friendlyName(cmd Command) map[string]any {
+	index := max(cmd.Index, 1)
+	if index > 8 {
+		return nil
+	}
+	names := d.state.FriendlyName
+	for len(names) < index {
+		names = append(names, fmt.Sprintf("Tasmota%d", len(names)+1))
+	}
+	setString(&names[index-1], cmd.Payload)
+	d.state.FriendlyName = names
+	return map[string]any{fmt.Sprintf("FriendlyName%d", index): names[index-1]}
+}
+
+// template handles Template: a JSON payload sets the template, and the
+// response is the active template.
+func (d *Device) template(cmd Command) map[string]any {
+	s := &d.state
+
+	if cmd.Payload != "" {
+		var tmpl map[string]any
+		if err := json.Unmarshal([]byte(cmd.Payload), &tmpl); err != nil {
+			return commandError()
+		}
+		data, _ := json.Marshal(tmpl)
+		s.Template = string(data)
+	}
+
+	var out map[string]any
+	if err := json.Unmarshal([]byte(s.Template), &out); err != nil {
+		return map[string]any{"NAME": "Generic", "GPIO": []int{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, "FLAG": 0, "BASE": s.Module}
+	}
+	return out
+}
+
+func (d *Device) setOption(cmd Command) map[string]any {
+	key := fmt.Sprintf("SetOption%d", cmd.Index)
+	numeric := cmd.Index >= 32 && cmd.Index <= 49
+
+	if cmd.Payload != "" {
+		value, ok := parseSwitch(cmd.Payload)
+		if numeric {
+			n, err := strconv.Atoi(cmd.Payload)
+			value, ok = n, err == nil
+		}
+		if !ok {
+			return commandError()
+		}
+		d.state.SetOptions[cmd.Index] = value
+		if cmd.Index == 3 {
+			d.state.MQTT.Enabled = value == 1
+		}
+	}
+
+	value := d.state.SetOptions[cmd.Index]
+	if cmd.Index == 3 {
+		value = boolInt(d.state.MQTT.Enabled)
+	}
+	if numeric {
+		return map[string]any{key: value}
+	}
+	return map[string]any{key: onOff(value == 1)}
+}
+
+func (d *Device) ipAddress(cmd Command) map[string]any {
+	net := &d.state.Network
+	var field *string
+	switch cmd.Index {
+	case 1:
+		field = &net.IPAddress
+	case 2:
+		field = &net.Gateway
+	case 3:
+		field = &net.Subnet
+	case 4:
+		field = &net.DNSServer
+	default:
+		return nil
+	}
+	setString(field, cmd.Payload)
+	return map[string]any{fmt.Sprintf("IPAddress%d", cmd.Index): *field}
+}
+
+// rule handles Rule<n>: 0/1 disable/enable, 4/5 once, 8/9 stop on error,
+// a leading + appends and a single " clears.
+func (d *Device) rule(cmd Command) map[string]any {
+	if cmd.Index < 1 || cmd.Index > 3 {
+		return nil
+	}
+	r := &d.state.Rules[cmd.Index-1]
+
+	switch cmd.Payload {
+	case "":
+	case "0", "1":
+		r.Enabled = cmd.Payload == "1"
+	case "4", "5":
+		r.Once = cmd.Payload == "5"
+	case "8", "9":
+		r.StopOnError = cmd.Payload == "9"
+	case `"`:
+		r.Rules = ""
+	default:
+		if rest, ok := strings.CutPrefix(cmd.Payload, "+"); ok {
+			r.Rules = strings.TrimSpace(r.Rules + " " + strings.TrimSpace(rest))
+		} else {
+			r.Rules = cmd.Payload
+		}
+	}
+
+	return map[string]any{fmt.Sprintf("Rule%d", cmd.Index): map[string]any{
+		"State":       onOff(r.Enabled),
+		"Once":        onOff(r.Once),
+		"StopOnError": onOff(r.StopOnError),
+		"Length":      len(r.Rules),
+		"Free":        511 - len(r.Rules),
+		"Rules":       r.Rules,
+	}}
+}
+
+// timer handles Timer<n>: 0 clears the timer, 1-16 copies that timer and a
+// (partial) JSON object updates it.
+func (d *Device) timer(cmd Command) map[string]any {
+	if cmd.Index < 1 || cmd.Index > 16 {
+		return nil
+	}
+	t := &d.state.Timers[cmd.Index-1]
+
+	if n, err := strconv.Atoi(cmd.Payload); err == nil {
+		switch {
+		case n == 0:
+			*t = defaultTimer()
+		case n >= 1 && n <= 16:
+			*t = d.state.Timers[n-1]
+		default:
+			return commandError()
+		}
+	} else if cmd.Payload != "" {
+		var update struct {
+			Enable *int    `json:"Enable"`
+			Arm    *int    `json:"Arm"`
+			Mode   *int    `json:"Mode"`
+			Time   *string `json:"Time"`
+			Window *int    `json:"Window"`
+			Days   *string `json:"Days"`
+			Repeat *int    `json:"Repeat"`
+			Output *int    `json:"Output"`
+			Action *int    `json:"Action"`
+		}
+		if err := json.Unmarshal([]byte(cmd.Payload), &update); err != nil {
+			return commandError()
+		}
+		if update.Arm != nil {
+			update.Enable = update.Arm
+		}
+		for dst, src := range map[*int]*int{
+			&t.Enable: update.Enable, &t.Mode: update.Mode, &t.Window: update.Window,
+			&t.Repeat: update.Repeat, &t.Output: update.Output, &t.Action: update.Action,
+		} {
+			if src != nil {
+				*dst = *src
+			}
+		}
+		if update.Time != nil {
+			t.Time = *update.Time
+		}
+		if update.Days != nil {
+			t.Days = timerDays(*update.Days)
+		}
+	}
+
+	return map[string]any{fmt.Sprintf("Timer%d", cmd.Index): timerJSON(*t)}
+}
+
+// timers handles Timers: 0/1/2 disables, enables or toggles all timers. The
+// response lists every timer in groups of four, as the web UI returns it.
+func (d *Device) timers(cmd Command) map[string]any {
+	switch strings.ToUpper(cmd.Payload) {
+	case "":
+	case "0", "OFF":
+		d.state.TimersEnabled = false
+	case "1", "ON":
+		d.state.TimersEnabled = true
+	case "2", "TOGGLE":
+		d.state.TimersEnabled = !d.state.TimersEnabled
+	default:
+		return commandError()
+	}
+
+	resp := map[string]any{"Timers": onOff(d.state.TimersEnabled)}
+	for group := range 4 {
+		timers := make(map[string]any)
+		for i := group * 4; i < group*4+4; i++ {
+			timers[fmt.Sprintf("Timer%d", i+1)] = timerJSON(d.state.Timers[i])
+		}
+		resp[fmt.Sprintf("Timers%d", group+1)] = timers
+	}
+	return resp
+}
+
+func defaultTimer() TimerState {
+	return TimerState{Time: "00:00", Days: "0000000", Output: 1}
+}
+
+func timerJSON(t TimerState) map[string]any {
+	return map[string]any{
+		"Enable": t.Enable,
+		"Mode":   t.Mode,
+		"Time":   t.Time,
+		"Window": t.Window,
+		"Days":   t.Days,
+		"Repeat": t.Repeat,
+		"Output": t.Output,
+		"Action": t.Action,
+	}
+}
+
+// timerDays normalizes a Days payload to the 0/1 form the firmware reports:
+// '0' and '-' are off and any other character is on.
+func timerDays(payload string) string {
+	var b strings.Builder
+	for i := range 7 {
+		if i < len(payload) && payload[i] != '0' && payload[i] != '-' {
+			b.WriteByte('1')
+		} else {
+			b.WriteByte('0')
+		}
+	}
+	return b.String()
+}
+
+// setInt stores payload in dst if it is an integer within [lo, hi].
+// Out of range values are ignored like the firmware does.
+func setInt(dst *int, payload string, lo, hi int) {
+	if payload == "" {
+		return
+	}
+	n, err := strconv.Atoi(payload)
+	if err != nil || n < lo || n > hi {
+		return
+	}
+	*dst = n
+}
+
+func setString(dst *string, payload string) {
+	switch {
+	case payload == "":
+	case payload == `"`:
+		// A single quote character clears the value.
+		*dst = ""
+	default:
+		*dst = payload
+	}
+}
+
+func retain(key string, dst *int, payload string) map[string]any {
+	if payload != "" {
+		value, ok := parseSwitch(payload)
+		if !ok {
+			return commandError()
+		}
+		*dst = value
+	}
+	return map[string]any{key: onOff(*dst == 1)}
+}
+
+// parseSwitch parses 0/1/OFF/ON.
+func parseSwitch(payload string) (int, bool) {
+	switch strings.ToUpper(payload) {
+	case "0", "OFF":
+		return 0, true
+	case "1", "ON":
+		return 1, true
+	}
+	return 0, false
+}
+
+func onOff(on bool) string {
+	if on {
+		return "ON"
+	}
+	return "OFF"
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,696 @@
+// Package tasmotatest provides an in-process simulated Tasmota device for tests.
+//
+// A Device serves the /cm endpoint with the same JSON shapes as real firmware
+// and keeps state between requests, so tests can assert on what the device
+// ended up with instead of on the URLs a client produced:
+//
+//	srv := tasmotatest.NewServer(tasmotatest.WithRelays(2))
+//	defer srv.Close()
+//
+//	client, _ := tasmota.NewClient(srv.URL)
+//	_ = client.SetPowerOn(ctx, 2)
+//
+//	if !srv.State().Relays[1] {
+//		t.Error("relay 2 is off")
+//	}
+package tasmotatest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MQTTState holds the MQTT settings of a simulated device.
+type MQTTState struct {
+	Enabled    bool
+	Host       string
+	Port       int
+	User       string
+	Password   string
+	Client     string
+	Topic      string
+	FullTopic  string
+	GroupTopic string
+	Prefix     [3]string
+}
+
+// NetworkState holds the network settings of a simulated device.
+// An IPAddress of 0.0.0.0 means DHCP.
+type NetworkState struct {
+	Hostname  string
+	IPAddress string
+	Gateway   string
+	Subnet    string
+	DNSServer string
+	MAC       string
+	SSID      [2]string
+	Password  [2]string
+}
+
+// RuleState holds one of the three rule sets.
+type RuleState struct {
+	Rules       string
+	Enabled     bool
+	Once        bool
+	StopOnError bool
+}
+
+// TimerState holds one of the sixteen timers, with the fields of the Timer<n> JSON.
+type TimerState struct {
+	Enable int
+	Mode   int
+	Time   string
+	Window int
+	Days   string
+	Repeat int
+	Output int
+	Action int
+}
+
+// LightState holds the light of a simulated bulb or LED strip. The light's
+// power is relay 1.
+type LightState struct {
+	// Channels is the number of PWM channels (1-5); 0 means no light.
+	Channels int
+	// Color is the output of each channel (0-255), in the order red,
+	// green, blue, cold white, warm white.
+	Color          [5]int
+	Dimmer         int
+	CT             int
+	Fade           bool
+	Speed          int
+	Scheme         int
+	WakeupDuration int
+}
+
+// ShutterState holds one shutter. Shutters move in real time, taking
+// OpenTime or CloseTime for a full stroke.
+type ShutterState struct {
+	// Relay is the first of the shutter's two relays; 0 means unused.
+	Relay int
+	// OpenTime and CloseTime are in tenths of a second.
+	OpenTime  int
+	CloseTime int
+	Halfway   int
+	Position  int
+	Target    int
+	Tilt      int
+	// from and started describe the current movement.
+	from    int
+	started time.Time
+}
+
+// State is the full settings and runtime state of a simulated device.
+type State struct {
+	Module int
+	// Template is the active template as compact JSON.
+	Template     string
+	DeviceName   string
+	FriendlyName []string
+	// Relays holds the power state of each relay; its length is the relay count.
+	Relays []bool
+	// PulseTime holds PulseTime1-8 in the device's encoding (0 off,
+	// 1-111 tenths of a second, 112+ seconds offset by 100).
+	PulseTime    [8]int
+	PowerOnState int
+	LedState     int
+	Sleep        int
+	ButtonRetain int
+	SwitchRetain int
+	SensorRetain int
+	PowerRetain  int
+	TelePeriod   int
+	SetOptions   map[int]int
+	Firmware     string
+	OtaURL       string
+	BootCount    int
+	WebPassword  string
+	MQTT         MQTTState
+	Network      NetworkState
+	Rules        [3]RuleState
+	Timers       [16]TimerState
+	// TimersEnabled is the global Timers switch.
+	TimersEnabled bool
+	Light         LightState
+	Shutters      [4]ShutterState
+	// Zigbee is the coordinator of a Zigbee2Tasmota bridge; nil means the
+	// device has none.
+	Zigbee *ZigbeeState
+	// IR is the IR transmitter; nil means the device has none.
+	IR *IRState
+	// RF is the radio of an RF bridge; nil means the device has none.
+	RF *RFState
+	// Tuya is the TuyaMCU of a Tuya device; nil means the device has none.
+	Tuya *TuyaState
+	// Sensors holds the sensor blocks reported by Status 8 and 10, by name.
+	Sensors map[string]any
+	// SettingsDump is served from /dl and replaced by uploads to /u2.
+	SettingsDump []byte
+}
+
+// clone returns a deep copy of s.
+func (s *State) clone() State {
+	c := *s
+	c.FriendlyName = append([]string(nil), s.FriendlyName...)
+	c.Relays = append([]bool(nil), s.Relays...)
+	c.SettingsDump = append([]byte(nil), s.SettingsDump...)
+	c.Zigbee = s.Zigbee.clone()
+	c.IR = s.IR.clone()
+	c.RF = s.RF.clone()
+	c.Tuya = s.Tuya.clone()
+	c.Sensors = maps.Clone(s.Sensors)
+	c.SetOptions = make(map[int]int, len(s.SetOptions))
+	for k, v := range s.SetOptions {
+		c.SetOptions[k] = v
+	}
+	return c
+}
+
+// Command is a single command received by the device.
+// Trailing digits of the name are split into Index, so "FriendlyName2 Lamp"
+// has Name "FriendlyName", Index 2 and Payload "Lamp".
+type Command struct {
+	Name    string
+	Index   int
+	Payload string
+	// Indexed reports whether the name carried an index, which tells
+	// "Power0" apart from "Power".
+	Indexed bool
+}
+
+// String returns the command as it was sent.
+func (c Command) String() string {
+	name := c.Name
+	if c.Indexed {
+		name += strconv.Itoa(c.Index)
+	}
+	if c.Payload == "" {
+		return name
+	}
+	return name + " " + c.Payload
+}
+
+// HandlerFunc implements a command on the device. It runs with the device
+// locked and may modify state. The returned map is sent as the JSON response;
+// nil is reported as an unknown command.
+type HandlerFunc func(state *State, cmd Command) map[string]any
+
+// Device is a stateful simulated Tasmota device. It implements http.Handler.
+type Device struct {
+	mu       sync.Mutex
+	state    State
+	username string
+	password string
+	handlers map[string]HandlerFunc
+	commands []string
+	// uploadType is set by the upgrade (/up) or restore (/rs) page and
+	// selects what the next upload to /u2 is.
+	uploadType   string
+	upgrade      UpgradeFunc
+	restartDelay time.Duration
+	downUntil    time.Time
+	drops        int
+}
+
+// UpgradeFunc resolves a firmware upgrade to the version the device reports
+// afterwards. source is the OtaUrl for "Upgrade 1" and empty for uploads,
+// which pass the image instead. An error fails the upgrade and the device
+// restarts on its current firmware.
+type UpgradeFunc func(source string, image []byte) (string, error)
+
+// Option configures a Device.
+type Option func(*Device)
+
+// WithRelays sets the number of relays (1-8).
+func WithRelays(n int) Option {
+	return func(d *Device) {
+		n = min(max(n, 1), 8)
+		d.state.Relays = make([]bool, n)
+		for len(d.state.FriendlyName) < n {
+			d.state.FriendlyName = append(d.state.FriendlyName,
+				fmt.Sprintf("Tasmota%d", len(d.state.FriendlyName)+1))
+		}
+	}
+}
+
+// WithLight makes the device a light with 1 to 5 channels: dimmer, CCT,
+// RGB, RGBW or RGBCCT.
+func WithLight(channels int) Option {
+	return func(d *Device) {
+		d.state.Light = LightState{
+			Channels:       min(max(channels, 1), 5),
+			Dimmer:         100,
+			CT:             153,
+			Speed:          1,
+			WakeupDuration: 60,
+		}
+		d.state.Light.setDimmer(100)
+	}
+}
+
+// WithShutters configures n shutters (1-4) on pairs of relays, with
+// SetOption80 on, each taking fullTravel to open or close completely.
+func WithShutters(n int, fullTravel time.Duration) Option {
+	return func(d *Device) {
+		n = min(max(n, 1), 4)
+		WithRelays(2 * n)(d)
+		d.state.SetOptions[80] = 1
+		tenths := max(int(fullTravel/(100*time.Millisecond)), 1)
+		for i := range n {
+			d.state.Shutters[i] = ShutterState{Relay: 2*i + 1, OpenTime: tenths, CloseTime: tenths, Halfway: 50}
+		}
+	}
+}
+
+// WithZigbee makes the device a Zigbee2Tasmota bridge with the given
+// devices paired.
+func WithZigbee(devices ...ZigbeeDevice) Option {
+	return func(d *Device) {
+		z := &ZigbeeState{Devices: devices}
+		d.state.Zigbee = z.clone()
+	}
+}
+
+// WithIR gives the device an IR transmitter for IRSend and IRHVAC.
+func WithIR() Option {
+	return func(d *Device) {
+		d.state.IR = &IRState{}
+	}
+}
+
+// WithRFBridge makes the device a Sonoff RF Bridge with the firmware's
+// default code and no learned slots.
+func WithRFBridge() Option {
+	return func(d *Device) {
+		d.state.RF = &RFState{Default: RfKeyState{Sync: 8470, Low: 270, High: 840, Code: 0x2E1A22}}
+	}
+}
+
+// WithTuyaMCU makes the device a TuyaMCU device with the given data point
+// mappings.
+func WithTuyaMCU(mappings ...TuyaMapping) Option {
+	return func(d *Device) {
+		t := &TuyaState{Mappings: mappings}
+		d.state.Tuya = t.clone()
+	}
+}
+
+// WithSensor adds a sensor block, such as "DS18B20-1" with a map holding
+// its Id and Temperature, to the sensor status.
+func WithSensor(name string, reading map[string]any) Option {
+	return func(d *Device) {
+		if d.state.Sensors == nil {
+			d.state.Sensors = make(map[string]any)
+		}
+		d.state.Sensors[name] = maps.Clone(reading)
+	}
+}
+
+// WithAuth requires the user and password query parameters on every request.
+func WithAuth(username, password string) Option {
+	return func(d *Device) {
+		d.username = username
+		d.password = password
+		d.state.WebPassword = password
+	}
+}
+
+// WithUpgrade sets how firmware upgrades resolve. Without it, upgrades
+// succeed and keep the current version.
+func WithUpgrade(fn UpgradeFunc) Option {
+	return func(d *Device) {
+		d.upgrade = fn
+	}
+}
+
+// WithRestartDelay makes the device unreachable for d after a restart.
+func WithRestartDelay(delay time.Duration) Option {
+	return func(d *Device) {
+		d.restartDelay = delay
+	}
+}
+
+// WithMAC sets the device MAC address, from which the default topic,
+// MQTT client and hostname are derived.
+func WithMAC(mac string) Option {
+	return func(d *Device) {
+		d.state.Network.MAC = strings.ToUpper(mac)
+		d.deriveNames()
+	}
+}
+
+// WithState modifies the initial state after the other options are applied.
+func WithState(fn func(*State)) Option {
+	return func(d *Device) {
+		fn(&d.state)
+	}
+}
+
+// NewDevice returns a device with factory-default settings and one relay.
+func NewDevice(opts ...Option) *Device {
+	d := &Device{
+		state: State{
+			Module:        1,
+			DeviceName:    "Tasmota",
+			FriendlyName:  []string{"Tasmota"},
+			Relays:        []bool{false},
+			PowerOnState:  3,
+			LedState:      1,
+			Sleep:         50,
+			TelePeriod:    300,
+			SetOptions:    make(map[int]int),
+			Firmware:      "14.2.0(tasmota)",
+			OtaURL:        "http://ota.tasmota.com/tasmota/release/tasmota.bin.gz",
+			BootCount:     1,
+			TimersEnabled: true,
+			MQTT: MQTTState{
+				Enabled:    true,
+				Port:       1883,
+				FullTopic:  "%prefix%/%topic%/",
+				GroupTopic: "tasmotas",
+				Prefix:     [3]string{"cmnd", "stat", "tele"},
+			},
+			Network: NetworkState{
+				IPAddress: "192.168.1.100",
+				Gateway:   "192.168.1.1",
+				Subnet:    "255.255.255.0",
+				DNSServer: "192.168.1.1",
+				MAC:       "AA:BB:CC:12:34:56",
+			},
+		},
+		handlers: make(map[string]HandlerFunc),
+	}
+	for i := range d.state.Timers {
+		d.state.Timers[i] = defaultTimer()
+	}
+	d.deriveNames()
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+// deriveNames sets the MAC based default names.
+func (d *Device) deriveNames() {
+	id := strings.ReplaceAll(d.state.Network.MAC, ":", "")
+	if len(id) > 6 {
+		id = id[len(id)-6:]
+	}
+	d.state.MQTT.Topic = "tasmota_" + id
+	d.state.MQTT.Client = "DVES_" + id
+	d.state.Network.Hostname = "tasmota-" + id
+}
+
+// Handle registers fn for a command name, overriding any built-in handling.
+// The name is matched case-insensitively and without its index.
+func (d *Device) Handle(name string, fn HandlerFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handlers[strings.ToLower(name)] = fn
+}
+
+// Drop makes the device fail the next n command requests with 503 Service
+// Unavailable, as if it were too busy to answer.
+func (d *Device) Drop(n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.drops = n
+}
+
+func (d *Device) dropRequest() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.drops == 0 {
+		return false
+	}
+	d.drops--
+	return true
+}
+
+// State returns a copy of the current device state.
+func (d *Device) State() State {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.moveShutters()
+	return d.state.clone()
+}
+
+// Update modifies the device state.
+func (d *Device) Update(fn func(*State)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fn(&d.state)
+}
+
+// Commands returns every command executed so far, with Backlog expanded.
+func (d *Device) Commands() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.commands...)
+}
+
+// ServeHTTP serves the /cm endpoint and the web UI settings backup (/dl),
+// restore (/rs) and firmware upgrade (/up) pages with their uploads (/u2).
+func (d *Device) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if d.restarting() {
+		http.Error(w, "restarting", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/cm":
+		if d.dropRequest() {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+	case "/dl", "/rs", "/up", "/u2":
+		d.serveWeb(w, r)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if d.username != "" || d.password != "" {
+		if r.Form.Get("user") != d.username || r.Form.Get("password") != d.password {
+			writeJSON(w, map[string]any{"WARNING": "Need user=<username>&password=<password>"})
+			return
+		}
+	}
+
+	writeJSON(w, d.Execute(r.Form.Get("cmnd")))
+}
+
+// serveWeb implements the web UI pages, which use basic auth with the user
+// admin and the web password.
+func (d *Device) serveWeb(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.state.WebPassword != "" {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "admin" || password != d.state.WebPassword {
+			w.Header().Set("WWW-Authenticate", `Basic realm="tasmota"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	switch {
+	case r.URL.Path == "/dl" && r.Method == http.MethodGet:
+		if d.state.SettingsDump == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", `attachment; filename="Config_tasmota.dmp"`)
+		_, _ = w.Write(d.state.SettingsDump)
+	case r.URL.Path == "/rs" && r.Method == http.MethodGet:
+		d.uploadType = "settings"
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = io.WriteString(w, "<html><body>Restore Configuration</body></html>")
+	case r.URL.Path == "/up" && r.Method == http.MethodGet:
+		d.uploadType = "firmware"
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = io.WriteString(w, "<html><body>Firmware Upgrade</body></html>")
+	case r.URL.Path == "/u2" && r.Method == http.MethodPost && d.uploadType != "":
+		uploadType := d.uploadType
+		d.uploadType = ""
+		file, _, err := r.FormFile("u2")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer func() { _ = file.Close() }()
+		dump, err := io.ReadAll(file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if uploadType == "firmware" {
+			// Like the firmware, failures are reported on the result page
+			// rather than with an HTTP status.
+			if len(dump) == 0 || (dump[0] != 0xE9 && dump[0] != 0x1F) {
+				uploadFailed(w, "Invalid file signature")
+				return
+			}
+			if err := d.runUpgrade("", dump); err != nil {
+				uploadFailed(w, err.Error())
+				return
+			}
+		} else {
+			d.state.SettingsDump = dump
+			d.restart()
+		}
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = io.WriteString(w, "<html><body>Upload Successful</body></html>")
+	default:
+		http.Error(w, "Upload buffer miscompare", http.StatusBadRequest)
+	}
+}
+
+func uploadFailed(w http.ResponseWriter, reason string) {
+	w.Header().Set("Content-Type", "text/html")
+	_, _ = io.WriteString(w, "<html><body><b>Upload Failed</b><br>Result: "+reason+"</body></html>")
+}
+
+// runUpgrade installs new firmware and restarts. On failure the device
+// still restarts, on its current firmware. The device must be locked.
+func (d *Device) runUpgrade(source string, image []byte) error {
+	defer d.restart()
+
+	if d.upgrade == nil {
+		return nil
+	}
+	version, err := d.upgrade(source, image)
+	if err != nil {
+		return err
+	}
+	d.state.Firmware = version
+	return nil
+}
+
+// restart counts a boot and starts the restart delay. The device must be locked.
+func (d *Device) restart() {
+	d.state.BootCount++
+	d.downUntil = time.Now().Add(d.restartDelay)
+}
+
+func (d *Device) restarting() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return time.Now().Before(d.downUntil)
+}
+
+// Execute runs a command line against the device and returns the response.
+func (d *Device) Execute(line string) map[string]any {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cmd := ParseCommand(line)
+	if cmd.Name == "" {
+		return unknown()
+	}
+
+	if strings.EqualFold(cmd.Name, "Backlog") {
+		merged := make(map[string]any)
+		for part := range strings.SplitSeq(cmd.Payload, ";") {
+			sub := ParseCommand(part)
+			if sub.Name == "" {
+				continue
+			}
+			for k, v := range d.execute(sub) {
+				merged[k] = v
+			}
+		}
+		return merged
+	}
+
+	return d.execute(cmd)
+}
+
+// ParseCommand splits a command line into name, index and payload.
+func ParseCommand(line string) Command {
+	line = strings.TrimSpace(line)
+	name, payload, _ := strings.Cut(line, " ")
+
+	cmd := Command{Name: name, Payload: strings.TrimSpace(payload)}
+
+	digits := len(name)
+	for digits > 0 && name[digits-1] >= '0' && name[digits-1] <= '9' {
+		digits--
+	}
+	if digits > 0 && digits < len(name) {
+		cmd.Index, _ = strconv.Atoi(name[digits:])
+		cmd.Name = name[:digits]
+		cmd.Indexed = true
+	}
+
+	return cmd
+}
+
+// execute runs a single command with the device locked.
+func (d *Device) execute(cmd Command) map[string]any {
+	d.commands = append(d.commands, cmd.String())
+
+	if fn, ok := d.handlers[strings.ToLower(cmd.Name)]; ok {
+		if resp := fn(&d.state, cmd); resp != nil {
+			return resp
+		}
+		return unknown()
+	}
+
+	if resp := d.builtin(cmd); resp != nil {
+		return resp
+	}
+	return unknown()
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write(data)
+}
+
+func unknown() map[string]any {
+	return map[string]any{"Command": "Unknown"}
+}
+
+func commandError() map[string]any {
+	return map[string]any{"Command": "Error"}
+}
+
+// Server is a Device served over HTTP by an httptest.Server.
+type Server struct {
+	*httptest.Server
+	*Device
+}
+
+// NewServer starts an httptest.Server for a new Device.
+// Callers should call Close when finished.
+func NewServer(opts ...Option) *Server {
+	d := NewDevice(opts...)
+	return &Server{
+		Server: httptest.NewServer(d),
+		Device: d,
+	}
+}
@@ -0,0 +1,404 @@
+package tasmotatest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func get(t *testing.T, srv *Server, query url.Values) map[string]any {
+	t.Helper()
+
+	resp, err := http.Get(srv.URL + "/cm?" + query.Encode())
+	if err != nil {
+		t.Fatalf("GET error: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+
+	var out map[string]any
+	if err := json.Unmarshal(body, &out); err != nil {
+		t.Fatalf("invalid JSON %q: %v", body, err)
+	}
+	return out
+}
+
+func cmnd(command string) url.Values {
+	return url.Values{"cmnd": {command}}
+}
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		line string
+		want Command
+	}{
+		{"Power", Command{Name: "Power"}},
+		{"Power0 ON", Command{Name: "Power", Index: 0, Payload: "ON", Indexed: true}},
+		{"FriendlyName2  Living Room ", Command{Name: "FriendlyName", Index: 2, Payload: "Living Room", Indexed: true}},
+		{"Status 5", Command{Name: "Status", Payload: "5"}},
+		{"SetOption55 1", Command{Name: "SetOption", Index: 55, Payload: "1", Indexed: true}},
+		{"", Command{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got := ParseCommand(tt.line)
+			if got != tt.want {
+				t.Errorf("ParseCommand(%q) = %+v, want %+v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDevice_Power(t *testing.T) {
+	tests := []struct {
+		name    string
+		relays  int
+		command string
+		want    map[string]any
+		relayOn []bool
+	}{
+		{"single relay on", 1, "Power ON", map[string]any{"POWER": "ON"}, []bool{true}},
+		{"single relay index", 1, "Power1 1", map[string]any{"POWER": "ON"}, []bool{true}},
+		{"multi relay default is relay 1", 2, "Power TOGGLE", map[string]any{"POWER1": "ON"}, []bool{true, false}},
+		{"multi relay index", 2, "Power2 on", map[string]any{"POWER2": "ON"}, []bool{false, true}},
+		{"all relays", 2, "Power0 ON", map[string]any{"POWER1": "ON", "POWER2": "ON"}, []bool{true, true}},
+		{"query", 2, "Power2", map[string]any{"POWER2": "OFF"}, []bool{false, false}},
+		{"relay out of range", 2, "Power3 ON", map[string]any{"Command": "Unknown"}, []bool{false, false}},
+		{"bad payload", 1, "Power maybe", map[string]any{"Command": "Error"}, []bool{false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDevice(WithRelays(tt.relays))
+
+			if got := d.Execute(tt.command); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Execute(%q) = %v, want %v", tt.command, got, tt.want)
+			}
+			if got := d.State().Relays; !reflect.DeepEqual(got, tt.relayOn) {
+				t.Errorf("Relays = %v, want %v", got, tt.relayOn)
+			}
+		})
+	}
+}
+
+func TestDevice_Backlog(t *testing.T) {
+	d := NewDevice()
+
+	got := d.Execute("Backlog DeviceName Kitchen; FriendlyName1 Lamp;Bogus 1; TelePeriod 60")
+	want := map[string]any{
+		"DeviceName":    "Kitchen",
+		"FriendlyName1": "Lamp",
+		"Command":       "Unknown",
+		"TelePeriod":    60,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Execute() = %v, want %v", got, want)
+	}
+
+	state := d.State()
+	if state.DeviceName != "Kitchen" || state.FriendlyName[0] != "Lamp" || state.TelePeriod != 60 {
+		t.Errorf("state = %+v, want backlog applied", state)
+	}
+
+	wantCommands := []string{"DeviceName Kitchen", "FriendlyName1 Lamp", "Bogus 1", "TelePeriod 60"}
+	if got := d.Commands(); !reflect.DeepEqual(got, wantCommands) {
+		t.Errorf("Commands() = %q, want %q", got, wantCommands)
+	}
+}
+
+func TestDevice_Settings(t *testing.T) {
+	d := NewDevice()
+
+	tests := []struct {
+		command string
+		want    map[string]any
+	}{
+		{"PowerOnState 9", map[string]any{"PowerOnState": 3}},
+		{"PowerOnState 1", map[string]any{"PowerOnState": 1}},
+		{"SetOption3 0", map[string]any{"SetOption3": "OFF"}},
+		{"SetOption36 20", map[string]any{"SetOption36": 20}},
+		{"MqttPassword secret", map[string]any{"MqttPassword": "****"}},
+		{"Prefix2 status", map[string]any{"Prefix2": "status"}},
+		{"IPAddress1 0.0.0.0", map[string]any{"IPAddress1": "0.0.0.0"}},
+		{"SSId2 guest", map[string]any{"SSId2": "guest"}},
+		{"Restart 1", map[string]any{"Restart": "Restarting"}},
+	}
+
+	for _, tt := range tests {
+		if got := d.Execute(tt.command); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Execute(%q) = %v, want %v", tt.command, got, tt.want)
+		}
+	}
+
+	state := d.State()
+	if state.MQTT.Enabled || state.MQTT.Password != "secret" || state.MQTT.Prefix[1] != "status" {
+		t.Errorf("MQTT = %+v", state.MQTT)
+	}
+	if state.Network.IPAddress != "0.0.0.0" || state.Network.SSID[1] != "guest" || state.BootCount != 2 {
+		t.Errorf("state = %+v", state)
+	}
+}
+
+func TestDevice_RulesTimers(t *testing.T) {
+	d := NewDevice()
+
+	d.Execute("Rule1 ON Power1#State DO Publish a ENDON")
+	d.Execute("Rule1 + ON Power2#State DO Publish b ENDON")
+	d.Execute("Rule1 1")
+	d.Execute("Rule1 5")
+	if r := d.State().Rules[0]; !r.Enabled || !r.Once || r.Rules != "ON Power1#State DO Publish a ENDON ON Power2#State DO Publish b ENDON" {
+		t.Errorf("Rules[0] = %+v", r)
+	}
+	d.Execute(`Rule1 "`)
+	if r := d.State().Rules[0]; r.Rules != "" {
+		t.Errorf("Rules[0].Rules = %q, want cleared", r.Rules)
+	}
+
+	got := d.Execute(`Timer2 {"Enable":1,"Time":"06:30","Action":2}`)
+	timer, ok := got["Timer2"].(map[string]any)
+	if !ok || timer["Time"] != "06:30" || timer["Enable"] != 1 || timer["Output"] != 1 {
+		t.Errorf("Execute(Timer2) = %v", got)
+	}
+	if got := d.Execute("Timer2 {bad"); !reflect.DeepEqual(got, map[string]any{"Command": "Error"}) {
+		t.Errorf("Execute(Timer2 {bad) = %v", got)
+	}
+
+	d.Execute("Timer3 2")
+	d.Execute("Timer2 0")
+	if ts := d.State().Timers; ts[2].Time != "06:30" || ts[1].Time != "00:00" || ts[1].Enable != 0 {
+		t.Errorf("Timers after copy and clear = %+v, %+v", ts[1], ts[2])
+	}
+
+	got = d.Execute("Timers 0")
+	group, ok := got["Timers1"].(map[string]any)
+	if got["Timers"] != "OFF" || !ok || group["Timer3"] == nil || d.State().TimersEnabled {
+		t.Errorf("Execute(Timers 0) = %v", got)
+	}
+}
+
+func TestDevice_Light(t *testing.T) {
+	d := NewDevice(WithLight(3))
+
+	got := d.Execute("Color 255,0,0")
+	if got["Color"] != "FF0000" || got["HSBColor"] != "0,100,100" || got["POWER"] != "ON" {
+		t.Errorf("Execute(Color) = %v", got)
+	}
+	got = d.Execute("Dimmer 20")
+	if got["Color"] != "330000" || got["Dimmer"] != 20 {
+		t.Errorf("Execute(Dimmer 20) = %v", got)
+	}
+	got = d.Execute("HSBColor 120,50,100")
+	if got["Color"] != "80FF80" || got["HSBColor"] != "120,50,100" {
+		t.Errorf("Execute(HSBColor) = %v", got)
+	}
+	if got := d.Execute("CT 300"); got["Command"] != "Unknown" {
+		t.Errorf("Execute(CT) on RGB = %v, want unknown", got)
+	}
+	if got := d.Execute("Dimmer 0"); got["POWER"] != "OFF" {
+		t.Errorf("Execute(Dimmer 0) = %v, want power off", got)
+	}
+	if got := NewDevice().Execute("Dimmer 50"); got["Command"] != "Unknown" {
+		t.Errorf("Execute(Dimmer) on a relay = %v, want unknown", got)
+	}
+}
+
+func TestDevice_Shutter(t *testing.T) {
+	if got := NewDevice().Execute("ShutterPosition1 50"); got["Command"] != "Unknown" {
+		t.Errorf("Execute(ShutterPosition) without shutters = %v, want unknown", got)
+	}
+
+	d := NewDevice(WithShutters(1, 100*time.Millisecond))
+	if got := d.Execute("ShutterPosition1 50"); got["ShutterPosition1"] != 50 {
+		t.Errorf("Execute(ShutterPosition1 50) = %v", got)
+	}
+	shutter := d.Execute("Status 10")["StatusSNS"].(map[string]any)["Shutter1"].(map[string]any)
+	if shutter["Direction"] != 1 || shutter["Target"] != 50 {
+		t.Errorf("Shutter1 while moving = %v", shutter)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if sh := d.State().Shutters[0]; sh.Position != 50 {
+		t.Errorf("Position = %d after the move, want 50", sh.Position)
+	}
+
+	d.Execute("ShutterOpenDuration1 12.5")
+	sht := d.Execute("Status 13")["StatusSHT"].(map[string]any)["SHT0"].(map[string]any)
+	if sht["Relay1"] != 1 || sht["Open"] != 125 {
+		t.Errorf("SHT0 = %v", sht)
+	}
+}
+
+func TestServer(t *testing.T) {
+	srv := NewServer(WithAuth("admin", "secret"), WithMAC("aa:bb:cc:00:11:22"))
+	defer srv.Close()
+
+	t.Run("missing credentials", func(t *testing.T) {
+		got := get(t, srv, cmnd("Power ON"))
+		if _, ok := got["WARNING"]; !ok {
+			t.Errorf("response = %v, want WARNING", got)
+		}
+		if srv.State().Relays[0] {
+			t.Error("relay switched without credentials")
+		}
+	})
+
+	t.Run("authenticated", func(t *testing.T) {
+		q := cmnd("Status 5")
+		q.Set("user", "admin")
+		q.Set("password", "secret")
+
+		got := get(t, srv, q)
+		net, ok := got["StatusNET"].(map[string]any)
+		if !ok {
+			t.Fatalf("response = %v, want StatusNET", got)
+		}
+		if net["Mac"] != "AA:BB:CC:00:11:22" || net["Hostname"] != "tasmota-001122" {
+			t.Errorf("StatusNET = %v", net)
+		}
+	})
+
+	t.Run("custom handler", func(t *testing.T) {
+		srv.Handle("Dimmer", func(_ *State, cmd Command) map[string]any {
+			return map[string]any{"Dimmer": cmd.Payload}
+		})
+
+		q := cmnd("Dimmer 40")
+		q.Set("user", "admin")
+		q.Set("password", "secret")
+
+		if got := get(t, srv, q); got["Dimmer"] != "40" {
+			t.Errorf("response = %v, want Dimmer 40", got)
+		}
+	})
+
+	t.Run("dropped requests", func(t *testing.T) {
+		srv.Drop(1)
+		resp, err := http.Get(srv.URL + "/cm?" + cmnd("Power").Encode())
+		if err != nil {
+			t.Fatalf("GET error: %v", err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("status = %d, want 503", resp.StatusCode)
+		}
+		if got := get(t, srv, cmnd("Power")); got["WARNING"] == nil {
+			t.Errorf("response after drop = %v, want a reply", got)
+		}
+	})
+
+	t.Run("wrong path", func(t *testing.T) {
+		resp, err := http.Get(srv.URL + "/")
+		if err != nil {
+			t.Fatalf("GET error: %v", err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("status = %d, want 404", resp.StatusCode)
+		}
+	})
+}
+
+func TestDevice_Zigbee(t *testing.T) {
+	if got := NewDevice().Execute("ZbStatus1"); got["Command"] != "Unknown" {
+		t.Errorf("Execute(ZbStatus1) without a coordinator = %v, want unknown", got)
+	}
+
+	d := NewDevice(WithZigbee(ZigbeeDevice{Device: "0x1234", IEEEAddr: "0x00158D0001A2B3C4", Endpoints: []int{1}}))
+	d.Execute("ZbName 0x1234,Lamp")
+	d.Execute(`ZbSend {"Device":"Lamp","Send":{"Dimmer":128,"0006!01":""}}`)
+	status := d.Execute("ZbStatus3 Lamp")["ZbStatus3"].([]map[string]any)[0]
+	if status["Name"] != "Lamp" || status["Dimmer"] != float64(128) || status["0006!01"] != nil {
+		t.Errorf("ZbStatus3 = %v", status)
+	}
+	if got := d.Execute("ZbForget 0x9999"); got["ZbForget"] != "Unknown device" {
+		t.Errorf("Execute(ZbForget unknown) = %v", got)
+	}
+	if got := d.State().Zigbee.Devices[0].Name; got != "Lamp" {
+		t.Errorf("Name = %q, want Lamp", got)
+	}
+}
+
+func TestDevice_IR(t *testing.T) {
+	if got := NewDevice().Execute("IRSend 0,100"); got["Command"] != "Unknown" {
+		t.Errorf("Execute(IRSend) without IR = %v, want unknown", got)
+	}
+
+	d := NewDevice(WithIR())
+	if got := d.Execute(`IRSend {"Protocol":"UNKNOWN","Data":"0x1"}`); got["IRSend"] != "Protocol not supported" {
+		t.Errorf("Execute(IRSend UNKNOWN) = %v", got)
+	}
+	if got := d.Execute(`IRSend {"Protocol":"NEC","Bits":32,"Data":"0x20DF10EF"}`); got["IRSend"] != "Done" {
+		t.Errorf("Execute(IRSend NEC) = %v", got)
+	}
+	hvac := d.Execute(`IRHVAC {"Vendor":"gree","Temp":19}`)["IRHVAC"].(map[string]any)
+	if hvac["Vendor"] != "GREE" || hvac["Temp"] != float64(19) || hvac["Mode"] != "Auto" {
+		t.Errorf("Execute(IRHVAC) = %v", hvac)
+	}
+	if got := len(d.State().IR.Sent); got != 1 {
+		t.Errorf("len(Sent) = %d, want 1", got)
+	}
+}
+
+func TestDevice_RFBridge(t *testing.T) {
+	if got := NewDevice().Execute("RfKey1"); got["Command"] != "Unknown" {
+		t.Errorf("Execute(RfKey1) without a bridge = %v, want unknown", got)
+	}
+
+	d := NewDevice(WithRFBridge())
+	key := d.Execute("RfKey1 5")["RfKey1"].(map[string]any)
+	if key["Default Sync"] != 8470 || key["Default Data"] != "2E1A22" {
+		t.Errorf("RfKey1 5 = %v", key)
+	}
+	d.Execute("Backlog RfSync 9000; RfCode #ABCDEF; RfKey1 4")
+	key = d.Execute("RfKey1 5")["RfKey1"].(map[string]any)
+	if key["Sync"] != 9000 || key["Data"] != "ABCDEF" {
+		t.Errorf("RfKey1 5 after learning = %v", key)
+	}
+	if got := d.Execute("RfKey2 2"); got["RfKey2"] != "Start learning" {
+		t.Errorf("Execute(RfKey2 2) = %v", got)
+	}
+	if got := d.Execute("RfRaw 1"); got["RfRaw"] != "ON" {
+		t.Errorf("Execute(RfRaw 1) = %v", got)
+	}
+}
+
+func TestDevice_Tuya(t *testing.T) {
+	if got := NewDevice().Execute("TuyaMCU"); got["Command"] != "Unknown" {
+		t.Errorf("Execute(TuyaMCU) without a TuyaMCU = %v, want unknown", got)
+	}
+
+	d := NewDevice(WithTuyaMCU(TuyaMapping{Fn: 11, DP: 1}))
+	d.Execute("Backlog TuyaMCU 21,2; TuyaMCU 11,0; TuyaEnumList2 5; TuyaEnum2 9; TuyaSend1 1,1")
+	mappings := d.Execute("TuyaMCU")["TuyaMCU"].([]map[string]int)
+	if len(mappings) != 1 || mappings[0]["fnId"] != 21 || mappings[0]["dpId"] != 2 {
+		t.Errorf("TuyaMCU = %v, want dimmer on dp 2", mappings)
+	}
+	if enums := d.State().Tuya.Enums; enums[1] != 0 {
+		t.Errorf("TuyaEnum2 = %d, want 0 as 9 is above its list", enums[1])
+	}
+	if got := d.Execute("TuyaSend1 1,2"); got["Command"] != "Error" {
+		t.Errorf("Execute(TuyaSend1 1,2) = %v, want error", got)
+	}
+	if sent := d.State().Tuya.Sent; len(sent) != 1 || sent[0] != (TuyaSent{DP: 1, Type: 1, Value: "1"}) {
+		t.Errorf("Sent = %+v", sent)
+	}
+}
+
+func TestDevice_Sensors(t *testing.T) {
+	d := NewDevice(WithSensor("AM2301", map[string]any{"Temperature": 22.3, "Humidity": 45.2}))
+	sns := d.Execute("Status 10")["StatusSNS"].(map[string]any)
+	if am, ok := sns["AM2301"].(map[string]any); !ok || am["Humidity"] != 45.2 {
+		t.Errorf("StatusSNS AM2301 = %v", sns["AM2301"])
+	}
+	if sns["TempUnit"] != "C" {
+		t.Errorf("TempUnit = %v, want C", sns["TempUnit"])
+	}
+}
@@ -0,0 +1,80 @@
+package tasmotatest
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// IRState holds the IR transmitter of a simulated IR blaster.
+type IRState struct {
+	// Sent holds the payload of every IRSend, JSON or raw timings.
+	Sent []string
+	// HVAC is the last IRHVAC state, with the defaults filled in.
+	HVAC map[string]any
+}
+
+// clone returns a deep copy of ir.
+func (ir *IRState) clone() *IRState {
+	if ir == nil {
+		return nil
+	}
+	return &IRState{Sent: slices.Clone(ir.Sent), HVAC: maps.Clone(ir.HVAC)}
+}
+
+// ir handles IRSend and IRHVAC. Codes are not transmitted anywhere; they
+// are checked and recorded in State.IR.
+func (d *Device) ir(cmd Command) map[string]any {
+	ir := d.state.IR
+
+	switch strings.ToLower(cmd.Name) {
+	case "irsend":
+		if !strings.HasPrefix(cmd.Payload, "{") {
+			for part := range strings.SplitSeq(cmd.Payload, ",") {
+				if _, err := strconv.Atoi(strings.TrimSpace(part)); err != nil {
+					return map[string]any{"IRSend": "Invalid data"}
+				}
+			}
+			ir.Sent = append(ir.Sent, cmd.Payload)
+			return map[string]any{"IRSend": "Done"}
+		}
+
+		var code struct {
+			Protocol string
+			Data     json.RawMessage
+		}
+		if err := json.Unmarshal([]byte(cmd.Payload), &code); err != nil {
+			return map[string]any{"IRSend": "Invalid JSON"}
+		}
+		if code.Protocol == "" || strings.EqualFold(code.Protocol, "UNKNOWN") {
+			return map[string]any{"IRSend": "Protocol not supported"}
+		}
+		if len(code.Data) == 0 {
+			return map[string]any{"IRSend": "No Data"}
+		}
+		ir.Sent = append(ir.Sent, cmd.Payload)
+		return map[string]any{"IRSend": "Done"}
+
+	case "irhvac":
+		var req map[string]any
+		if err := json.Unmarshal([]byte(cmd.Payload), &req); err != nil {
+			return map[string]any{"IRHVAC": "Invalid JSON"}
+		}
+		vendor, _ := req["Vendor"].(string)
+		if vendor == "" {
+			return map[string]any{"IRHVAC": "Wrong Vendor"}
+		}
+		state := map[string]any{
+			"Model": -1, "Power": "Off", "Mode": "Auto", "Celsius": "On", "Temp": 21,
+			"FanSpeed": "Auto", "SwingV": "Off", "SwingH": "Off", "Quiet": "Off", "Turbo": "Off",
+			"Econo": "Off", "Light": "Off", "Filter": "Off", "Clean": "Off", "Beep": "Off", "Sleep": -1,
+		}
+		maps.Copy(state, req)
+		state["Vendor"] = strings.ToUpper(vendor)
+		ir.HVAC = state
+		return map[string]any{"IRHVAC": state}
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package tasmotatest
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// light handles the light commands. Color and HSBColor set the channels and
+// the dimmer follows the brightest channel; Dimmer rescales the channels.
+// Like the firmware, Dimmer 0 turns the light off and other values turn it
+// on.
+func (d *Device) light(cmd Command) map[string]any {
+	l := &d.state.Light
+
+	switch strings.ToLower(cmd.Name) {
+	case "dimmer":
+		if cmd.Payload == "" {
+			return d.lightJSON()
+		}
+		pct := l.Dimmer
+		switch cmd.Payload {
+		case "+":
+			pct = min(pct+10, 100)
+		case "-":
+			pct = max(pct-10, 0)
+		default:
+			n, err := strconv.Atoi(cmd.Payload)
+			if err != nil || n < 0 || n > 100 {
+				return commandError()
+			}
+			pct = n
+		}
+		l.setDimmer(pct)
+		d.state.Relays[0] = pct > 0
+		return d.lightJSON()
+
+	case "color":
+		if cmd.Payload == "" {
+			return d.lightJSON()
+		}
+		channels, ok := parseChannels(cmd.Payload)
+		if !ok || len(channels) > l.Channels {
+			return commandError()
+		}
+		l.Color = [5]int{}
+		copy(l.Color[:], channels)
+		l.Dimmer = percent(slices.Max(l.Color[:l.Channels]))
+		d.state.Relays[0] = l.Dimmer > 0
+		return d.lightJSON()
+
+	case "hsbcolor":
+		if l.Channels < 3 {
+			return nil
+		}
+		if cmd.Payload == "" {
+			return d.lightJSON()
+		}
+		var h, s, b int
+		if _, err := fmt.Sscanf(cmd.Payload, "%d,%d,%d", &h, &s, &b); err != nil ||
+			h < 0 || h > 360 || s < 0 || s > 100 || b < 0 || b > 100 {
+			return commandError()
+		}
+		r, g, bl := hsbToRGB(h, s, b)
+		l.Color = [5]int{r, g, bl}
+		l.Dimmer = b
+		d.state.Relays[0] = b > 0
+		return d.lightJSON()
+
+	case "ct":
+		if l.Channels != 2 && l.Channels != 5 {
+			return nil
+		}
+		if cmd.Payload != "" {
+			n, err := strconv.Atoi(cmd.Payload)
+			if err != nil || n < 153 || n > 500 {
+				return commandError()
+			}
+			l.CT = n
+			l.Color = [5]int{}
+			l.setDimmer(l.Dimmer)
+		}
+		return d.lightJSON()
+
+	case "fade":
+		if cmd.Payload != "" {
+			v, ok := parseSwitch(cmd.Payload)
+			if !ok {
+				return commandError()
+			}
+			l.Fade = v == 1
+		}
+		return map[string]any{"Fade": onOff(l.Fade)}
+	case "speed":
+		setInt(&l.Speed, cmd.Payload, 1, 40)
+		return map[string]any{"Speed": l.Speed}
+	case "scheme":
+		setInt(&l.Scheme, cmd.Payload, 0, 12)
+		return map[string]any{"Scheme": l.Scheme}
+	case "wakeupduration":
+		setInt(&l.WakeupDuration, cmd.Payload, 1, 3000)
+		return map[string]any{"WakeupDuration": l.WakeupDuration}
+	case "wakeup":
+		if cmd.Payload != "" {
+			n, err := strconv.Atoi(cmd.Payload)
+			if err != nil || n < 0 || n > 100 {
+				return commandError()
+			}
+			l.setDimmer(n)
+		}
+		l.Scheme = 1
+		d.state.Relays[0] = true
+		return map[string]any{"Wakeup": "Started"}
+	}
+	return nil
+}
+
+// setDimmer scales the channels so the brightest is at pct. An all-off
+// light is set to white first.
+func (l *LightState) setDimmer(pct int) {
+	channels := l.Color[:l.Channels]
+	if slices.Max(channels) == 0 {
+		switch l.Channels {
+		case 2:
+			l.Color[0], l.Color[1] = 255-ctWarm(l.CT), ctWarm(l.CT)
+		case 5:
+			l.Color[3], l.Color[4] = 255-ctWarm(l.CT), ctWarm(l.CT)
+		case 4:
+			l.Color[3] = 255
+		default:
+			for i := range channels {
+				channels[i] = 255
+			}
+		}
+	}
+
+	peak := slices.Max(channels)
+	target := int(math.Round(float64(pct) * 255 / 100))
+	for i := range channels {
+		channels[i] = int(math.Round(float64(channels[i]) * float64(target) / float64(peak)))
+	}
+	l.Dimmer = pct
+}
+
+// ctWarm returns the warm white share of full brightness for a CT value.
+func ctWarm(ct int) int {
+	return int(math.Round(float64(ct-153) * 255 / (500 - 153)))
+}
+
+// lightJSON returns the light fields as reported in RESULT and StatusSTS.
+func (d *Device) lightJSON() map[string]any {
+	l := &d.state.Light
+
+	color := make([]byte, l.Channels)
+	channel := make([]int, l.Channels)
+	for i := range l.Channels {
+		color[i] = byte(l.Color[i])
+		channel[i] = percent(l.Color[i])
+	}
+
+	resp := map[string]any{
+		powerKey(1, len(d.state.Relays)): onOff(d.state.Relays[0]),
+		"Dimmer":                         l.Dimmer,
+		"Color":                          strings.ToUpper(hex.EncodeToString(color)),
+		"Channel":                        channel,
+	}
+	if l.Channels >= 3 {
+		h, s := rgbToHS(l.Color[0], l.Color[1], l.Color[2])
+		resp["HSBColor"] = fmt.Sprintf("%d,%d,%d", h, s, l.Dimmer)
+	}
+	if l.Channels == 4 {
+		resp["White"] = percent(l.Color[3])
+	}
+	if l.Channels == 2 || l.Channels == 5 {
+		resp["CT"] = l.CT
+	}
+	return resp
+}
+
+// parseChannels parses a Color payload as hex or comma separated decimals.
+func parseChannels(payload string) ([]int, bool) {
+	payload = strings.TrimPrefix(payload, "#")
+	var channels []int
+	if strings.Contains(payload, ",") {
+		for part := range strings.SplitSeq(payload, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || n < 0 || n > 255 {
+				return nil, false
+			}
+			channels = append(channels, n)
+		}
+		return channels, true
+	}
+
+	data, err := hex.DecodeString(payload)
+	if err != nil || len(data) == 0 {
+		return nil, false
+	}
+	for _, b := range data {
+		channels = append(channels, int(b))
+	}
+	return channels, true
+}
+
+func hsbToRGB(h, s, b int) (int, int, int) {
+	v := float64(b) / 100 * 255
+	c := v * float64(s) / 100
+	x := c * (1 - math.Abs(math.Mod(float64(h)/60, 2)-1))
+	m := v - c
+
+	var r, g, bl float64
+	switch {
+	case h < 60:
+		r, g = c, x
+	case h < 120:
+		r, g = x, c
+	case h < 180:
+		g, bl = c, x
+	case h < 240:
+		g, bl = x, c
+	case h < 300:
+		r, bl = x, c
+	default:
+		r, bl = c, x
+	}
+	round := func(f float64) int { return int(math.Round(f + m)) }
+	return round(r), round(g), round(bl)
+}
+
+// rgbToHS returns the hue and saturation of a color.
+func rgbToHS(r, g, b int) (int, int) {
+	hi := max(r, g, b)
+	lo := min(r, g, b)
+	if hi == 0 {
+		return 0, 0
+	}
+	delta := float64(hi - lo)
+	s := int(math.Round(delta / float64(hi) * 100))
+	if delta == 0 {
+		return 0, s
+	}
+
+	var h float64
+	switch hi {
+	case r:
+		h = math.Mod(float64(g-b)/delta, 6)
+	case g:
+		h = float64(b-r)/delta + 2
+	default:
+		h = float64(r-g)/delta + 4
+	}
+	h *= 60
+	if h < 0 {
+		h += 360
+	}
+	return int(math.Round(h)), s
+}
+
+func percent(channel int) int {
+	return int(math.Round(float64(channel) * 100 / 255))
+}
@@ -0,0 +1,143 @@
+package tasmotatest
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// RfKeyState is the code in an RfKey slot or in the RfSync, RfLow, RfHigh
+// and RfCode settings.
+type RfKeyState struct {
+	Sync, Low, High, Code int
+}
+
+// RFState holds the radio of a simulated Sonoff RF Bridge.
+type RFState struct {
+	// Default is the code set with RfSync, RfLow, RfHigh and RfCode, which
+	// unlearned slots send.
+	Default RfKeyState
+	// Keys holds the learned code of each slot; nil means not learned.
+	Keys [16]*RfKeyState
+	// Learning is the slot being learned, or 0.
+	Learning int
+	// Raw is the RfRaw sniffing mode.
+	Raw bool
+	// Sent holds every transmitted code: RfSend JSON, RfRaw frames and
+	// "RfKey<n>" for slots.
+	Sent []string
+}
+
+// clone returns a deep copy of rf.
+func (rf *RFState) clone() *RFState {
+	if rf == nil {
+		return nil
+	}
+	c := *rf
+	for i, k := range rf.Keys {
+		if k != nil {
+			key := *k
+			c.Keys[i] = &key
+		}
+	}
+	c.Sent = slices.Clone(rf.Sent)
+	return &c
+}
+
+// rf handles the RF bridge commands.
+func (d *Device) rf(cmd Command) map[string]any {
+	rf := d.state.RF
+
+	switch strings.ToLower(cmd.Name) {
+	case "rfsend":
+		var code struct{ Data json.RawMessage }
+		if err := json.Unmarshal([]byte(cmd.Payload), &code); err != nil || len(code.Data) == 0 {
+			return map[string]any{"RfSend": "Invalid data"}
+		}
+		rf.Sent = append(rf.Sent, cmd.Payload)
+		return map[string]any{"RfSend": "Done"}
+
+	case "rfsync":
+		return rfTiming("RfSync", &rf.Default.Sync, cmd.Payload)
+	case "rflow":
+		return rfTiming("RfLow", &rf.Default.Low, cmd.Payload)
+	case "rfhigh":
+		return rfTiming("RfHigh", &rf.Default.High, cmd.Payload)
+	case "rfcode":
+		if cmd.Payload != "" {
+			hex, isHex := strings.CutPrefix(cmd.Payload, "#")
+			base := 10
+			if isHex {
+				base = 16
+			}
+			n, err := strconv.ParseInt(hex, base, 32)
+			if err != nil || n < 1 || n > 0xFFFFFF {
+				return map[string]any{"RfCode": "Invalid data"}
+			}
+			rf.Default.Code = int(n)
+			rf.Sent = append(rf.Sent, fmt.Sprintf("#%06X", n))
+		}
+		return map[string]any{"RfCode": rf.Default.Code}
+
+	case "rfraw":
+		switch cmd.Payload {
+		case "":
+		case "0":
+			rf.Raw = false
+		case "1":
+			rf.Raw = true
+		default:
+			if !strings.HasPrefix(cmd.Payload, "AA") || !strings.HasSuffix(cmd.Payload, "55") {
+				return map[string]any{"RfRaw": "Invalid data"}
+			}
+			rf.Sent = append(rf.Sent, cmd.Payload)
+			return map[string]any{"RfRaw": "Done"}
+		}
+		return map[string]any{"RfRaw": onOff(rf.Raw)}
+
+	case "rfkey":
+		if cmd.Index < 1 || cmd.Index > len(rf.Keys) {
+			return nil
+		}
+		name := fmt.Sprintf("RfKey%d", cmd.Index)
+		slot := &rf.Keys[cmd.Index-1]
+		switch cmd.Payload {
+		case "", "1":
+			rf.Sent = append(rf.Sent, name)
+		case "2":
+			rf.Learning = cmd.Index
+			return map[string]any{name: "Start learning"}
+		case "3":
+			*slot = nil
+		case "4":
+			code := rf.Default
+			*slot = &code
+		case "5":
+			code, prefix := rf.Default, "Default "
+			if *slot != nil {
+				code, prefix = **slot, ""
+			}
+			return map[string]any{name: map[string]any{
+				prefix + "Sync": code.Sync, prefix + "Low": code.Low,
+				prefix + "High": code.High, prefix + "Data": fmt.Sprintf("%06X", code.Code),
+			}}
+		case "6":
+			if *slot == nil {
+				code := rf.Default
+				*slot = &code
+			}
+			(*slot).Code = rf.Default.Code
+		default:
+			return commandError()
+		}
+		return map[string]any{name: "Done"}
+	}
+	return nil
+}
+
+func rfTiming(name string, dst *int, payload string) map[string]any {
+	setInt(dst, payload, 1, 65535)
+	return map[string]any{name: *dst}
+}
@@ -0,0 +1,150 @@
+package tasmotatest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// shutter handles the Shutter commands for configured shutters.
+func (d *Device) shutter(cmd Command) map[string]any {
+	index := max(cmd.Index, 1)
+	if index > len(d.state.Shutters) || d.state.SetOptions[80] != 1 {
+		return nil
+	}
+	sh := &d.state.Shutters[index-1]
+	name := strings.ToLower(cmd.Name)
+	if sh.Relay == 0 && name != "shutterrelay" {
+		return nil
+	}
+	d.moveShutters()
+
+	switch name {
+	case "shutteropen":
+		sh.moveTo(100)
+	case "shutterclose":
+		sh.moveTo(0)
+	case "shutterstop":
+		sh.moveTo(sh.Position)
+	case "shutterposition":
+		if cmd.Payload != "" {
+			n, err := strconv.Atoi(cmd.Payload)
+			if err != nil || n < 0 || n > 100 {
+				return commandError()
+			}
+			sh.moveTo(n)
+		}
+	case "shuttertilt":
+		setInt(&sh.Tilt, cmd.Payload, -90, 90)
+		return map[string]any{fmt.Sprintf("ShutterTilt%d", index): sh.Tilt}
+	case "shutterrelay":
+		setInt(&sh.Relay, cmd.Payload, 0, 32)
+		return map[string]any{fmt.Sprintf("ShutterRelay%d", index): sh.Relay}
+	case "shutteropenduration", "shuttercloseduration":
+		dst := &sh.OpenTime
+		key := "ShutterOpenDuration"
+		if name == "shuttercloseduration" {
+			dst, key = &sh.CloseTime, "ShutterCloseDuration"
+		}
+		if cmd.Payload != "" {
+			seconds, err := strconv.ParseFloat(cmd.Payload, 64)
+			if err != nil || seconds < 0.1 || seconds > 240 {
+				return commandError()
+			}
+			*dst = int(seconds*10 + 0.5)
+		}
+		return map[string]any{fmt.Sprintf("%s%d", key, index): float64(*dst) / 10}
+	case "shuttersethalfway":
+		setInt(&sh.Halfway, cmd.Payload, 0, 100)
+		return map[string]any{fmt.Sprintf("ShutterSetHalfway%d", index): sh.Halfway}
+	}
+
+	return map[string]any{fmt.Sprintf("ShutterPosition%d", index): sh.Target}
+}
+
+// moveTo starts moving the shutter from its current position.
+func (sh *ShutterState) moveTo(target int) {
+	sh.from = sh.Position
+	sh.Target = target
+	sh.started = time.Now()
+}
+
+// moveShutters updates the position of moving shutters. The device must be locked.
+func (d *Device) moveShutters() {
+	now := time.Now()
+	for i := range d.state.Shutters {
+		sh := &d.state.Shutters[i]
+		if sh.started.IsZero() {
+			continue
+		}
+		stroke := sh.OpenTime
+		if sh.Target < sh.from {
+			stroke = sh.CloseTime
+		}
+		distance := sh.Target - sh.from
+		travel := time.Duration(abs(distance)) * time.Duration(stroke) * 100 * time.Millisecond / 100
+		elapsed := now.Sub(sh.started)
+		if elapsed >= travel {
+			sh.Position = sh.Target
+			sh.started = time.Time{}
+			continue
+		}
+		sh.Position = sh.from + int(float64(distance)*float64(elapsed)/float64(travel))
+	}
+}
+
+// statusShutter returns the StatusSHT object of Status 13.
+func (d *Device) statusShutter() map[string]any {
+	out := make(map[string]any)
+	for i, sh := range d.state.Shutters {
+		if sh.Relay == 0 {
+			continue
+		}
+		out[fmt.Sprintf("SHT%d", i)] = map[string]any{
+			"Relay1":     sh.Relay,
+			"Relay2":     sh.Relay + 1,
+			"Open":       sh.OpenTime,
+			"Close":      sh.CloseTime,
+			"50perc":     sh.Halfway,
+			"Delay":      0,
+			"Opt":        "0000",
+			"Calib":      []int{200, 400, 600, 800, 1000},
+			"Mode":       "0",
+			"TiltConfig": []int{0, 0, 0, 0, 0},
+		}
+	}
+	return out
+}
+
+// shutterJSON returns the Shutter<n> objects of sensor telemetry.
+func (d *Device) shutterJSON() map[string]any {
+	d.moveShutters()
+	out := make(map[string]any)
+	for i, sh := range d.state.Shutters {
+		if sh.Relay == 0 || d.state.SetOptions[80] != 1 {
+			continue
+		}
+		direction := 0
+		if !sh.started.IsZero() {
+			direction = 1
+			if sh.Target < sh.from {
+				direction = -1
+			}
+		}
+		out[fmt.Sprintf("Shutter%d", i+1)] = map[string]any{
+			"Position":  sh.Position,
+			"Direction": direction,
+			"Target":    sh.Target,
+			"Tilt":      sh.Tilt,
+		}
+	}
+	return out
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
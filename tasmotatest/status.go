@@ -0,0 +1,262 @@
+package tasmotatest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// status handles Status and Status <n>.
+func (d *Device) status(cmd Command) map[string]any {
+	if cmd.Payload == "" {
+		return map[string]any{"Status": d.statusInfo()}
+	}
+
+	category, err := strconv.Atoi(cmd.Payload)
+	if err != nil {
+		return commandError()
+	}
+
+	switch category {
+	case 0:
+		return map[string]any{
+			"Status":    d.statusInfo(),
+			"StatusPRM": d.statusParam(),
+			"StatusFWR": d.statusFirmware(),
+			"StatusLOG": d.statusLog(),
+			"StatusNET": d.statusNetwork(),
+			"StatusMQT": d.statusMQTT(),
+			"StatusSNS": d.statusSensor(),
+			"StatusSTS": d.statusState(),
+		}
+	case 1:
+		return map[string]any{"StatusPRM": d.statusParam()}
+	case 2:
+		return map[string]any{"StatusFWR": d.statusFirmware()}
+	case 3:
+		return map[string]any{"StatusLOG": d.statusLog()}
+	case 5:
+		return map[string]any{"StatusNET": d.statusNetwork()}
+	case 6:
+		return map[string]any{"StatusMQT": d.statusMQTT()}
+	case 8, 10:
+		return map[string]any{"StatusSNS": d.statusSensor()}
+	case 9:
+		if _, ok := d.state.Sensors["ENERGY"]; !ok {
+			return commandError()
+		}
+		return map[string]any{"StatusPTH": map[string]any{
+			"PowerDelta": []int{0, 0, 0}, "PowerLow": 0, "PowerHigh": 0,
+			"VoltageLow": 0, "VoltageHigh": 0, "CurrentLow": 0, "CurrentHigh": 0,
+		}}
+	case 11:
+		return map[string]any{"StatusSTS": d.statusState()}
+	case 13:
+		if d.state.SetOptions[80] != 1 {
+			return commandError()
+		}
+		return map[string]any{"StatusSHT": d.statusShutter()}
+	}
+
+	return commandError()
+}
+
+func (d *Device) statusInfo() map[string]any {
+	s := &d.state
+
+	power := 0
+	for i, on := range s.Relays {
+		if on {
+			power |= 1 << i
+		}
+	}
+
+	return map[string]any{
+		"Module":       s.Module,
+		"DeviceName":   s.DeviceName,
+		"FriendlyName": s.FriendlyName,
+		"Topic":        s.MQTT.Topic,
+		"ButtonTopic":  "0",
+		"Power":        power,
+		"PowerOnState": s.PowerOnState,
+		"LedState":     s.LedState,
+		"LedMask":      "FFFF",
+		"SaveData":     1,
+		"SaveState":    1,
+		"SwitchTopic":  "0",
+		"SwitchMode":   []int{0, 0, 0, 0, 0, 0, 0, 0},
+		"ButtonRetain": s.ButtonRetain,
+		"SwitchRetain": s.SwitchRetain,
+		"SensorRetain": s.SensorRetain,
+		"PowerRetain":  s.PowerRetain,
+	}
+}
+
+func (d *Device) statusParam() map[string]any {
+	return map[string]any{
+		"Baudrate":      115200,
+		"GroupTopic":    d.state.MQTT.GroupTopic,
+		"OtaUrl":        "http://ota.tasmota.com/tasmota/release/tasmota.bin.gz",
+		"RestartReason": "Software/System restart",
+		"Uptime":        "0T00:00:00",
+		"StartupUTC":    "",
+		"Sleep":         d.state.Sleep,
+		"CfgHolder":     4617,
+		"BootCount":     d.state.BootCount,
+		"SaveCount":     d.state.BootCount,
+	}
+}
+
+func (d *Device) statusFirmware() map[string]any {
+	return map[string]any{
+		"Version":       d.state.Firmware,
+		"BuildDateTime": "2024-01-01T00:00:00",
+		"Boot":          31,
+		"Core":          "2_7_4_9",
+		"SDK":           "2.2.2-dev(38a443e)",
+		"CpuFrequency":  80,
+		"Hardware":      "ESP8266EX",
+		"CR":            "400/699",
+	}
+}
+
+func (d *Device) statusLog() map[string]any {
+	s := &d.state
+	return map[string]any{
+		"SerialLog":  2,
+		"WebLog":     2,
+		"MqttLog":    0,
+		"SysLog":     0,
+		"LogHost":    "",
+		"LogPort":    514,
+		"SSId":       []string{s.Network.SSID[0], s.Network.SSID[1]},
+		"TelePeriod": s.TelePeriod,
+		"Resolution": "558180C0",
+		"SetOption":  d.setOptionMasks(),
+	}
+}
+
+// setOptionMasks encodes the SetOptions as Status 3 reports them: a 32-bit
+// mask for options 0-31, one byte per option for 32-49, then 32-bit masks
+// for 50-81, 82-113, 114-145 and 146-177.
+func (d *Device) setOptionMasks() []string {
+	s := &d.state
+
+	option := func(n int) int {
+		if n == 3 {
+			return boolInt(s.MQTT.Enabled)
+		}
+		return s.SetOptions[n]
+	}
+	mask := func(first int) string {
+		var m uint32
+		for bit := range 32 {
+			if option(first+bit) == 1 {
+				m |= 1 << bit
+			}
+		}
+		return fmt.Sprintf("%08X", m)
+	}
+
+	var params strings.Builder
+	for n := 32; n <= 49; n++ {
+		fmt.Fprintf(&params, "%02X", option(n)&0xFF)
+	}
+
+	return []string{mask(0), params.String(), mask(50), mask(82), mask(114), mask(146)}
+}
+
+func (d *Device) statusNetwork() map[string]any {
+	n := &d.state.Network
+	return map[string]any{
+		"Hostname":   n.Hostname,
+		"IPAddress":  n.IPAddress,
+		"Gateway":    n.Gateway,
+		"Subnetmask": n.Subnet,
+		"DNSServer1": n.DNSServer,
+		"DNSServer":  n.DNSServer,
+		"Mac":        n.MAC,
+		"Webserver":  2,
+		"HTTP_API":   1,
+		"WifiConfig": 4,
+		"WifiPower":  17.0,
+	}
+}
+
+func (d *Device) statusMQTT() map[string]any {
+	m := &d.state.MQTT
+
+	count := 0
+	if m.Enabled && m.Host != "" {
+		count = 1
+	}
+
+	return map[string]any{
+		"MqttHost":        m.Host,
+		"MqttPort":        m.Port,
+		"MqttClientMask":  m.Client,
+		"MqttClient":      m.Client,
+		"MqttUser":        m.User,
+		"MqttCount":       count,
+		"MAX_PACKET_SIZE": 1200,
+		"KEEPALIVE":       30,
+		"SOCKET_TIMEOUT":  4,
+	}
+}
+
+func (d *Device) statusSensor() map[string]any {
+	sensor := map[string]any{
+		"Time": time.Now().UTC().Format("2006-01-02T15:04:05"),
+	}
+	for k, v := range d.shutterJSON() {
+		sensor[k] = v
+	}
+	for k, v := range d.state.Sensors {
+		sensor[k] = v
+	}
+	if len(d.state.Sensors) > 0 {
+		sensor["TempUnit"] = "C"
+	}
+	return sensor
+}
+
+func (d *Device) statusState() map[string]any {
+	s := &d.state
+
+	state := map[string]any{
+		"Time":      time.Now().UTC().Format("2006-01-02T15:04:05"),
+		"Uptime":    "0T00:00:00",
+		"UptimeSec": 0,
+		"Heap":      26,
+		"SleepMode": "Dynamic",
+		"Sleep":     s.Sleep,
+		"LoadAvg":   19,
+		"MqttCount": d.statusMQTT()["MqttCount"],
+		"Wifi": map[string]any{
+			"AP":        1,
+			"SSId":      s.Network.SSID[0],
+			"BSSId":     "11:22:33:44:55:66",
+			"Channel":   1,
+			"Mode":      "11n",
+			"RSSI":      80,
+			"Signal":    -60,
+			"LinkCount": 1,
+			"Downtime":  "0T00:00:03",
+		},
+	}
+	for i, on := range s.Relays {
+		state[powerKey(i+1, len(s.Relays))] = onOff(on)
+	}
+	if s.Light.Channels > 0 {
+		for k, v := range d.lightJSON() {
+			state[k] = v
+		}
+		state["Scheme"] = s.Light.Scheme
+		state["Fade"] = onOff(s.Light.Fade)
+		state["Speed"] = s.Light.Speed
+		state["LedTable"] = "ON"
+	}
+
+	return state
+}
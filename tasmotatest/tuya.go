@@ -0,0 +1,137 @@
+package tasmotatest
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// TuyaMapping maps a data point to a function id, as set with TuyaMCU.
+type TuyaMapping struct {
+	Fn, DP int
+}
+
+// TuyaSent is a data point written with TuyaSend<type>.
+type TuyaSent struct {
+	DP    int
+	Type  int
+	Value string
+}
+
+// TuyaState holds the TuyaMCU settings of a simulated Tuya device.
+type TuyaState struct {
+	Mappings []TuyaMapping
+	// Enums and EnumLists hold TuyaEnum1-4 and their highest values.
+	Enums     [4]int
+	EnumLists [4]int
+	// Sent holds every data point written to the MCU.
+	Sent []TuyaSent
+	// Queries counts TuyaSend0 and TuyaSend8 status requests.
+	Queries int
+}
+
+// clone returns a deep copy of t.
+func (t *TuyaState) clone() *TuyaState {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	c.Mappings = slices.Clone(t.Mappings)
+	c.Sent = slices.Clone(t.Sent)
+	return &c
+}
+
+// tuya handles the TuyaMCU commands.
+func (d *Device) tuya(cmd Command) map[string]any {
+	t := d.state.Tuya
+
+	switch strings.ToLower(cmd.Name) {
+	case "tuyamcu":
+		if cmd.Payload != "" {
+			fn, dp, ok := tuyaPair(cmd.Payload)
+			if !ok || fn < 1 || fn > 99 || dp < 0 || dp > 255 {
+				return commandError()
+			}
+			t.Mappings = slices.DeleteFunc(t.Mappings, func(m TuyaMapping) bool { return m.Fn == fn })
+			if dp != 0 {
+				t.Mappings = append(t.Mappings, TuyaMapping{Fn: fn, DP: dp})
+			}
+		}
+		mappings := make([]map[string]int, 0, len(t.Mappings))
+		for _, m := range t.Mappings {
+			mappings = append(mappings, map[string]int{"fnId": m.Fn, "dpId": m.DP})
+		}
+		return map[string]any{"TuyaMCU": mappings}
+
+	case "tuyasend":
+		if !cmd.Indexed {
+			return nil
+		}
+		name := fmt.Sprintf("TuyaSend%d", cmd.Index)
+		switch cmd.Index {
+		case 0, 8:
+			t.Queries++
+			return map[string]any{name: "Done"}
+		case 1, 2, 3, 4:
+		default:
+			return nil
+		}
+		dpText, value, ok := strings.Cut(cmd.Payload, ",")
+		dp, err := strconv.Atoi(dpText)
+		if !ok || err != nil || dp < 1 || dp > 255 || !tuyaValid(cmd.Index, value) {
+			return commandError()
+		}
+		t.Sent = append(t.Sent, TuyaSent{DP: dp, Type: cmd.Index, Value: value})
+		return map[string]any{name: "Done"}
+
+	case "tuyaenum":
+		if cmd.Payload != "" {
+			if cmd.Index < 1 || cmd.Index > len(t.Enums) {
+				return commandError()
+			}
+			setInt(&t.Enums[cmd.Index-1], cmd.Payload, 0, t.EnumLists[cmd.Index-1])
+		}
+		return map[string]any{"TuyaEnum": tuyaEnums(t.Enums)}
+
+	case "tuyaenumlist":
+		if cmd.Payload != "" {
+			if cmd.Index < 1 || cmd.Index > len(t.EnumLists) {
+				return commandError()
+			}
+			setInt(&t.EnumLists[cmd.Index-1], cmd.Payload, 0, 31)
+			t.Enums[cmd.Index-1] = min(t.Enums[cmd.Index-1], t.EnumLists[cmd.Index-1])
+		}
+		return map[string]any{"TuyaEnumList": tuyaEnums(t.EnumLists)}
+	}
+	return nil
+}
+
+func tuyaPair(payload string) (int, int, bool) {
+	a, b, ok := strings.Cut(payload, ",")
+	fn, err1 := strconv.Atoi(strings.TrimSpace(a))
+	dp, err2 := strconv.Atoi(strings.TrimSpace(b))
+	return fn, dp, ok && err1 == nil && err2 == nil
+}
+
+func tuyaValid(typ int, value string) bool {
+	switch typ {
+	case 1:
+		return value == "0" || value == "1"
+	case 2:
+		n, err := strconv.ParseInt(value, 10, 64)
+		return err == nil && n >= -1<<31 && n < 1<<32
+	case 4:
+		n, err := strconv.Atoi(value)
+		return err == nil && n >= 0 && n <= 255
+	}
+	return true
+}
+
+func tuyaEnums(values [4]int) map[string]int {
+	enums := make(map[string]int, len(values))
+	for i, v := range values {
+		enums[fmt.Sprintf("Enum%d", i+1)] = v
+	}
+	return enums
+}
@@ -0,0 +1,236 @@
+package tasmotatest
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ZigbeeState holds the Zigbee coordinator of a Zigbee2Tasmota bridge.
+type ZigbeeState struct {
+	Devices []ZigbeeDevice
+	// PermitJoin is the last ZbPermitJoin mode: 0, 1 or 99.
+	PermitJoin int
+	Bindings   []ZigbeeBinding
+}
+
+// ZigbeeDevice is a device paired with the coordinator.
+type ZigbeeDevice struct {
+	// Device is the short address, such as "0x1234".
+	Device       string
+	IEEEAddr     string
+	Name         string
+	ModelID      string
+	Manufacturer string
+	Endpoints    []int
+	// Light is the ZbLight channel count (0-5); nil means not a light.
+	Light *int
+	// Attributes are the last known attributes, reported by ZbStatus3 and
+	// updated by ZbSend.
+	Attributes map[string]any
+}
+
+// ZigbeeBinding is a binding made with ZbBind.
+type ZigbeeBinding struct {
+	Device     string
+	Endpoint   int
+	Cluster    int
+	ToDevice   string
+	ToEndpoint int
+	ToGroup    int
+}
+
+// clone returns a deep copy of z.
+func (z *ZigbeeState) clone() *ZigbeeState {
+	if z == nil {
+		return nil
+	}
+	c := *z
+	c.Bindings = slices.Clone(z.Bindings)
+	c.Devices = make([]ZigbeeDevice, len(z.Devices))
+	for i, dev := range z.Devices {
+		dev.Endpoints = slices.Clone(dev.Endpoints)
+		dev.Attributes = maps.Clone(dev.Attributes)
+		c.Devices[i] = dev
+	}
+	return &c
+}
+
+// find returns the device with the given short address, IEEE address or
+// name, matched case-insensitively.
+func (z *ZigbeeState) find(ref string) *ZigbeeDevice {
+	for i := range z.Devices {
+		dev := &z.Devices[i]
+		if strings.EqualFold(ref, dev.Device) || strings.EqualFold(ref, dev.IEEEAddr) ||
+			(dev.Name != "" && strings.EqualFold(ref, dev.Name)) {
+			return dev
+		}
+	}
+	return nil
+}
+
+// zigbee handles the Zb commands of a bridge.
+func (d *Device) zigbee(cmd Command) map[string]any {
+	z := d.state.Zigbee
+	name := strings.ToLower(cmd.Name)
+	unknownDevice := map[string]any{cmd.Name: "Unknown device"}
+
+	switch name {
+	case "zbstatus":
+		level := max(cmd.Index, 1)
+		if level > 3 {
+			return nil
+		}
+		devices := z.Devices
+		if cmd.Payload != "" {
+			dev := z.find(cmd.Payload)
+			if dev == nil {
+				return map[string]any{fmt.Sprintf("ZbStatus%d", level): "Unknown device"}
+			}
+			devices = []ZigbeeDevice{*dev}
+		}
+		list := make([]map[string]any, 0, len(devices))
+		for _, dev := range devices {
+			list = append(list, dev.status(level))
+		}
+		return map[string]any{fmt.Sprintf("ZbStatus%d", level): list}
+
+	case "zbinfo":
+		dev := z.find(cmd.Payload)
+		if dev == nil {
+			return unknownDevice
+		}
+		info := dev.status(2)
+		info["Endpoints"] = dev.Endpoints
+		maps.Copy(info, dev.Attributes)
+		return map[string]any{"ZbInfo": map[string]any{dev.Device: info}}
+
+	case "zbpermitjoin":
+		switch cmd.Payload {
+		case "0", "1", "99":
+			z.PermitJoin, _ = strconv.Atoi(cmd.Payload)
+		default:
+			return commandError()
+		}
+		return map[string]any{"ZbPermitJoin": "Done"}
+
+	case "zbname", "zblight":
+		ref, value, hasValue := strings.Cut(cmd.Payload, ",")
+		dev := z.find(ref)
+		if dev == nil {
+			return unknownDevice
+		}
+		if name == "zbname" {
+			if hasValue {
+				dev.Name = value
+			}
+			return map[string]any{dev.Device: map[string]any{"Name": dev.Name}}
+		}
+		if hasValue {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < -1 || n > 5 {
+				return commandError()
+			}
+			dev.Light = &n
+			if n < 0 {
+				dev.Light = nil
+			}
+		}
+		light := -1
+		if dev.Light != nil {
+			light = *dev.Light
+		}
+		return map[string]any{dev.Device: map[string]any{"Light": light}}
+
+	case "zbforget":
+		dev := z.find(cmd.Payload)
+		if dev == nil {
+			return unknownDevice
+		}
+		short := dev.Device
+		z.Devices = slices.DeleteFunc(z.Devices, func(dev ZigbeeDevice) bool { return dev.Device == short })
+		return map[string]any{"ZbForget": "Done"}
+
+	case "zbsend":
+		var req struct {
+			Device string
+			Group  int
+			Send   map[string]any
+			Write  map[string]any
+		}
+		if err := json.Unmarshal([]byte(cmd.Payload), &req); err != nil {
+			return commandError()
+		}
+		if req.Group != 0 {
+			for i := range z.Devices {
+				z.Devices[i].apply(req.Send)
+			}
+			return map[string]any{"ZbSend": "Done"}
+		}
+		dev := z.find(req.Device)
+		if dev == nil {
+			return unknownDevice
+		}
+		dev.apply(req.Send)
+		dev.apply(req.Write)
+		return map[string]any{"ZbSend": "Done"}
+
+	case "zbbind", "zbunbind":
+		var b ZigbeeBinding
+		if err := json.Unmarshal([]byte(cmd.Payload), &b); err != nil {
+			return commandError()
+		}
+		if z.find(b.Device) == nil || (b.ToDevice != "" && z.find(b.ToDevice) == nil) {
+			return unknownDevice
+		}
+		if name == "zbbind" {
+			z.Bindings = append(z.Bindings, b)
+		} else {
+			z.Bindings = slices.DeleteFunc(z.Bindings, func(o ZigbeeBinding) bool { return o == b })
+		}
+		return map[string]any{cmd.Name: "Done"}
+	}
+	return nil
+}
+
+// status returns the ZbStatus entry of the device at level 1-3.
+func (dev *ZigbeeDevice) status(level int) map[string]any {
+	entry := map[string]any{"Device": dev.Device}
+	if dev.Name != "" {
+		entry["Name"] = dev.Name
+	}
+	if level >= 2 {
+		entry["IEEEAddr"] = dev.IEEEAddr
+		entry["ModelId"] = dev.ModelID
+		entry["Manufacturer"] = dev.Manufacturer
+	}
+	if level >= 3 {
+		endpoints := make(map[string]any, len(dev.Endpoints))
+		for _, ep := range dev.Endpoints {
+			endpoints[fmt.Sprintf("0x%02X", ep)] = map[string]any{"ProfileId": "0x0104"}
+		}
+		entry["Endpoints"] = endpoints
+		if dev.Light != nil {
+			entry["Light"] = *dev.Light
+		}
+		maps.Copy(entry, dev.Attributes)
+	}
+	return entry
+}
+
+// apply records the high level attributes of a ZbSend. Cluster commands,
+// such as "0006!01", are accepted and ignored.
+func (dev *ZigbeeDevice) apply(attrs map[string]any) {
+	for k, v := range attrs {
+		if strings.ContainsAny(k, "!/_") {
+			continue
+		}
+		if dev.Attributes == nil {
+			dev.Attributes = make(map[string]any)
+		}
+		dev.Attributes[k] = v
+	}
+}
@@ -0,0 +1,331 @@
+package tasmota
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTelemetryBuffer is how many events a TelemetryStream holds for a
+// slow consumer before it drops the oldest.
+const DefaultTelemetryBuffer = 256
+
+// EventType identifies the kind of telemetry event.
+type EventType int
+
+const (
+	// EventState is a periodic tele/<topic>/STATE message.
+	EventState EventType = iota
+	// EventSensor is a periodic tele/<topic>/SENSOR message.
+	EventSensor
+	// EventOnline is emitted when the device's LWT changes to online.
+	EventOnline
+	// EventOffline is emitted when the device's LWT changes to offline.
+	EventOffline
+	// EventPower is a stat/<topic>/POWERn relay state change.
+	EventPower
+	// EventResult is a stat/<topic>/RESULT command result, or a
+	// tele/<topic>/RESULT message such as IrReceived, RfReceived or
+	// TuyaReceived.
+	EventResult
+)
+
+// String returns a string representation of the EventType.
+func (e EventType) String() string {
+	switch e {
+	case EventState:
+		return "state"
+	case EventSensor:
+		return "sensor"
+	case EventOnline:
+		return "online"
+	case EventOffline:
+		return "offline"
+	case EventPower:
+		return "power"
+	case EventResult:
+		return "result"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a decoded telemetry message from a device.
+// Only the field matching Type is set; Raw always holds the payload.
+type Event struct {
+	Type     EventType
+	Topic    string
+	Device   string
+	Received time.Time
+	State    *StatusState
+	Sensor   *StatusSensor
+	Power    *PowerResponse
+	Raw      json.RawMessage
+	// Err is set when the payload could not be decoded.
+	Err error
+}
+
+// TelemetryStream delivers decoded telemetry events for a single device.
+type TelemetryStream struct {
+	device string
+	topics DeviceTopics
+	buffer int
+	events chan Event
+
+	mu      sync.Mutex
+	queue   []Event
+	dropped int
+	online  *bool
+	unsubs  []func() error
+	closed  bool
+	notify  chan struct{}
+	done    chan struct{}
+}
+
+// TelemetryOption is a functional option for configuring a TelemetryStream.
+type TelemetryOption func(*TelemetryStream)
+
+// WithTelemetryBuffer sets how many events are held while the consumer is
+// busy. When the buffer is full the oldest event is dropped; see Dropped.
+func WithTelemetryBuffer(n int) TelemetryOption {
+	return func(s *TelemetryStream) {
+		s.buffer = max(n, 1)
+	}
+}
+
+// SubscribeTelemetry subscribes to the device's tele and stat topics and
+// returns a stream of typed events. The stream ends when ctx is cancelled or
+// Close is called.
+func SubscribeTelemetry(ctx context.Context, conn MQTTConn, topics DeviceTopics, opts ...TelemetryOption) (*TelemetryStream, error) {
+	if conn == nil {
+		return nil, NewError(ErrorTypeNetwork, "MQTT connection cannot be nil", nil)
+	}
+	if topics.Topic == "" && topics.Hostname == "" {
+		return nil, NewError(ErrorTypeCommand, "MQTT topic cannot be empty", nil)
+	}
+
+	s := &TelemetryStream{
+		device: topics.Topic,
+		topics: topics,
+		buffer: DefaultTelemetryBuffer,
+		events: make(chan Event),
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	for _, filter := range []string{topics.Tele("+"), topics.Stat("+")} {
+		unsubscribe, err := conn.Subscribe(ctx, filter, s.handle)
+		if err != nil {
+			_ = s.Close()
+			return nil, NewError(ErrorTypeNetwork, "failed to subscribe to "+filter, err)
+		}
+		s.mu.Lock()
+		s.unsubs = append(s.unsubs, unsubscribe)
+		s.mu.Unlock()
+	}
+
+	go s.pump(ctx)
+
+	return s, nil
+}
+
+// SubscribeTelemetry subscribes to telemetry for the device the client talks
+// to. The client must use an MQTTTransport.
+func (c *Client) SubscribeTelemetry(ctx context.Context, opts ...TelemetryOption) (*TelemetryStream, error) {
+	t, ok := c.transport.(*MQTTTransport)
+	if !ok {
+		return nil, NewError(ErrorTypeCommand, "telemetry requires an MQTT transport", nil)
+	}
+	return SubscribeTelemetry(ctx, t.conn, t.topics, opts...)
+}
+
+// Events returns the channel events are delivered on.
+// It is closed when the stream ends.
+func (s *TelemetryStream) Events() <-chan Event {
+	return s.events
+}
+
+// Online reports the last LWT state of the device and whether it is known.
+func (s *TelemetryStream) Online() (online, known bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.online == nil {
+		return false, false
+	}
+	return *s.online, true
+}
+
+// Dropped returns how many events were dropped because the buffer was full.
+func (s *TelemetryStream) Dropped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Close unsubscribes from the broker and ends the stream.
+func (s *TelemetryStream) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	unsubs := s.unsubs
+	s.unsubs = nil
+	close(s.done)
+	s.mu.Unlock()
+
+	var firstErr error
+	for _, unsubscribe := range unsubs {
+		if err := unsubscribe(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// handle decodes a message and queues the resulting event without blocking.
+func (s *TelemetryStream) handle(msg MQTTMessage) {
+	event, ok := s.decode(msg)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	if event.Type == EventOnline || event.Type == EventOffline {
+		online := event.Type == EventOnline
+		if s.online != nil && *s.online == online {
+			s.mu.Unlock()
+			return
+		}
+		s.online = &online
+	}
+	if len(s.queue) >= s.buffer {
+		s.queue = s.queue[1:]
+		s.dropped++
+	}
+	s.queue = append(s.queue, event)
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// pump forwards queued events to the consumer in order.
+func (s *TelemetryStream) pump(ctx context.Context) {
+	defer close(s.events)
+	defer func() { _ = s.Close() }()
+
+	for {
+		s.mu.Lock()
+		var next *Event
+		if len(s.queue) > 0 {
+			next = &s.queue[0]
+			s.queue = s.queue[1:]
+		}
+		s.mu.Unlock()
+
+		if next == nil {
+			select {
+			case <-s.notify:
+				continue
+			case <-s.done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case s.events <- *next:
+		case <-s.done:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// decode turns a raw MQTT message into an Event.
+func (s *TelemetryStream) decode(msg MQTTMessage) (Event, bool) {
+	event := Event{
+		Topic:    msg.Topic,
+		Device:   s.device,
+		Received: time.Now(),
+		Raw:      json.RawMessage(msg.Payload),
+	}
+
+	teleBase := s.topics.Tele("")
+	statBase := s.topics.Stat("")
+
+	switch {
+	case strings.HasPrefix(msg.Topic, teleBase):
+		switch strings.TrimPrefix(msg.Topic, teleBase) {
+		case "STATE":
+			event.Type = EventState
+			event.State = &StatusState{}
+			event.Err = unmarshalJSON(msg.Payload, event.State)
+		case "SENSOR":
+			event.Type = EventSensor
+			event.Sensor = &StatusSensor{}
+			event.Err = unmarshalJSON(msg.Payload, event.Sensor)
+		case "LWT":
+			event.Type = EventOffline
+			if strings.EqualFold(strings.TrimSpace(string(msg.Payload)), "Online") {
+				event.Type = EventOnline
+			}
+			event.Raw = nil
+		case "RESULT":
+			event.Type = EventResult
+		default:
+			return event, false
+		}
+
+	case strings.HasPrefix(msg.Topic, statBase):
+		suffix := strings.TrimPrefix(msg.Topic, statBase)
+		switch {
+		case suffix == "RESULT":
+			event.Type = EventResult
+			var power PowerResponse
+			event.Err = unmarshalJSON(msg.Payload, &power)
+			if event.Err == nil && power != (PowerResponse{}) {
+				event.Power = &power
+			}
+		case strings.HasPrefix(suffix, "POWER"):
+			relay := 0
+			if n := strings.TrimPrefix(suffix, "POWER"); n != "" {
+				var err error
+				if relay, err = strconv.Atoi(n); err != nil {
+					return event, false
+				}
+			}
+			event.Type = EventPower
+			event.Power = &PowerResponse{}
+			if !event.Power.setState(relay, strings.TrimSpace(string(msg.Payload))) {
+				return event, false
+			}
+			event.Raw = nil
+		default:
+			return event, false
+		}
+
+	default:
+		return event, false
+	}
+
+	return event, true
+}
@@ -0,0 +1,191 @@
+package tasmota
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("events channel closed")
+		}
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	return Event{}
+}
+
+func TestSubscribeTelemetry(t *testing.T) {
+	broker := newMemBroker()
+	topics := DeviceTopics{Topic: "plug"}
+	ctx := context.Background()
+
+	stream, err := SubscribeTelemetry(ctx, broker, topics)
+	if err != nil {
+		t.Fatalf("SubscribeTelemetry() error: %v", err)
+	}
+	defer func() { _ = stream.Close() }()
+
+	publish := func(topic, payload string) {
+		if err := broker.Publish(ctx, topic, []byte(payload)); err != nil {
+			t.Fatalf("Publish() error: %v", err)
+		}
+	}
+
+	publish("tele/plug/LWT", "Online")
+	publish("tele/plug/LWT", "Online") // duplicate, no transition
+	publish("tele/plug/STATE", `{"Time":"2024-01-01T00:00:00","UptimeSec":42,"POWER":"ON","Wifi":{"RSSI":80}}`)
+	publish("tele/plug/SENSOR", `{"Time":"2024-01-01T00:00:00","ENERGY":{"Power":12.5,"Voltage":230}}`)
+	publish("stat/plug/POWER2", "OFF")
+	publish("stat/plug/RESULT", `{"POWER1":"ON"}`)
+	publish("tele/plug/RESULT", `{"IrReceived":{"Protocol":"NEC","Bits":32,"Data":"0x20DF10EF"}}`)
+	publish("stat/plug/STATUS", `{"Status":{}}`) // ignored
+	publish("tele/other/STATE", `{}`)            // other device, ignored
+	publish("tele/plug/LWT", "Offline")
+
+	event := nextEvent(t, stream.Events())
+	if event.Type != EventOnline || event.Device != "plug" {
+		t.Errorf("event 1 = %v for %q, want online for plug", event.Type, event.Device)
+	}
+
+	event = nextEvent(t, stream.Events())
+	if event.Type != EventState || event.State == nil {
+		t.Fatalf("event 2 = %v, want state", event.Type)
+	}
+	if event.State.UptimeSec != 42 || event.State.POWER != "ON" || event.State.Wifi.RSSI != 80 {
+		t.Errorf("state = %+v, want uptime 42, power ON, RSSI 80", event.State)
+	}
+
+	event = nextEvent(t, stream.Events())
+	if event.Type != EventSensor || event.Sensor == nil || event.Sensor.Energy == nil {
+		t.Fatalf("event 3 = %v, want sensor with energy", event.Type)
+	}
+	if event.Sensor.Energy.Power != 12.5 {
+		t.Errorf("energy power = %v, want 12.5", event.Sensor.Energy.Power)
+	}
+
+	event = nextEvent(t, stream.Events())
+	if event.Type != EventPower || event.Power == nil || event.Power.GetState(2) != "OFF" {
+		t.Errorf("event 4 = %v %+v, want power with relay 2 OFF", event.Type, event.Power)
+	}
+
+	event = nextEvent(t, stream.Events())
+	if event.Type != EventResult || event.Power == nil || !event.Power.IsOn(1) {
+		t.Errorf("event 5 = %v %+v, want result with relay 1 ON", event.Type, event.Power)
+	}
+
+	event = nextEvent(t, stream.Events())
+	if event.Type != EventResult || event.Topic != "tele/plug/RESULT" || event.Power != nil {
+		t.Errorf("event 6 = %v on %s, want tele result", event.Type, event.Topic)
+	}
+
+	event = nextEvent(t, stream.Events())
+	if event.Type != EventOffline {
+		t.Errorf("event 7 = %v, want offline", event.Type)
+	}
+	if online, known := stream.Online(); online || !known {
+		t.Errorf("Online() = %v, %v, want false, true", online, known)
+	}
+
+	_ = stream.Close()
+	select {
+	case _, ok := <-stream.Events():
+		if ok {
+			t.Error("unexpected event after Close()")
+		}
+	case <-time.After(time.Second):
+		t.Error("events channel not closed after Close()")
+	}
+}
+
+func TestSubscribeTelemetry_DecodeError(t *testing.T) {
+	broker := newMemBroker()
+
+	stream, err := SubscribeTelemetry(context.Background(), broker, DeviceTopics{Topic: "plug"})
+	if err != nil {
+		t.Fatalf("SubscribeTelemetry() error: %v", err)
+	}
+	defer func() { _ = stream.Close() }()
+
+	_ = broker.Publish(context.Background(), "tele/plug/STATE", []byte("not json"))
+
+	event := nextEvent(t, stream.Events())
+	if event.Type != EventState || !IsParseError(event.Err) {
+		t.Errorf("event = %v err %v, want state with parse error", event.Type, event.Err)
+	}
+}
+
+func TestWithTelemetryBuffer(t *testing.T) {
+	broker := newMemBroker()
+
+	stream, err := SubscribeTelemetry(context.Background(), broker, DeviceTopics{Topic: "plug"}, WithTelemetryBuffer(2))
+	if err != nil {
+		t.Fatalf("SubscribeTelemetry() error: %v", err)
+	}
+	defer func() { _ = stream.Close() }()
+
+	// Nobody reads while the device reports
+	const sent = 6
+	for n := 1; n <= sent; n++ {
+		_ = broker.Publish(context.Background(), "tele/plug/STATE", fmt.Appendf(nil, `{"UptimeSec":%d}`, n))
+	}
+
+	var uptimes []int
+collect:
+	for {
+		select {
+		case event := <-stream.Events():
+			uptimes = append(uptimes, event.State.UptimeSec)
+		case <-time.After(50 * time.Millisecond):
+			break collect
+		}
+	}
+
+	// The pump may hold one event on top of the buffer
+	if len(uptimes) < 2 || len(uptimes) > 3 || uptimes[len(uptimes)-1] != sent {
+		t.Errorf("received uptimes %v, want the newest 2 or 3 ending in %d", uptimes, sent)
+	}
+	if dropped := stream.Dropped(); dropped+len(uptimes) != sent {
+		t.Errorf("Dropped() = %d with %d received, want %d in total", dropped, len(uptimes), sent)
+	}
+}
+
+func TestSubscribeTelemetry_ContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stream, err := SubscribeTelemetry(ctx, newMemBroker(), DeviceTopics{Topic: "plug"})
+	if err != nil {
+		t.Fatalf("SubscribeTelemetry() error: %v", err)
+	}
+
+	cancel()
+	select {
+	case <-stream.Events():
+	case <-time.After(time.Second):
+		t.Error("events channel not closed after cancel")
+	}
+}
+
+func TestClient_SubscribeTelemetry(t *testing.T) {
+	client := &Client{}
+	if _, err := client.SubscribeTelemetry(context.Background()); !IsCommandError(err) {
+		t.Errorf("SubscribeTelemetry() over HTTP error = %v, want command error", err)
+	}
+
+	mqttClient, err := NewMQTTClient(newMemBroker(), DeviceTopics{Topic: "plug"})
+	if err != nil {
+		t.Fatalf("NewMQTTClient() error: %v", err)
+	}
+	stream, err := mqttClient.SubscribeTelemetry(context.Background())
+	if err != nil {
+		t.Fatalf("SubscribeTelemetry() error: %v", err)
+	}
+	_ = stream.Close()
+}
@@ -0,0 +1,328 @@
+package tasmota
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxTimers is the number of timers a device has.
+const MaxTimers = 16
+
+// TimerMode selects what a timer's Time is relative to.
+type TimerMode int
+
+const (
+	// TimerModeClock runs the timer at Time.
+	TimerModeClock TimerMode = 0
+	// TimerModeSunrise runs the timer at sunrise, offset by Time.
+	TimerModeSunrise TimerMode = 1
+	// TimerModeSunset runs the timer at sunset, offset by Time.
+	TimerModeSunset TimerMode = 2
+)
+
+// String returns the mode name: clock, sunrise or sunset.
+func (m TimerMode) String() string {
+	switch m {
+	case TimerModeClock:
+		return "clock"
+	case TimerModeSunrise:
+		return "sunrise"
+	case TimerModeSunset:
+		return "sunset"
+	default:
+		return fmt.Sprintf("TimerMode(%d)", int(m))
+	}
+}
+
+// TimerAction is what a timer does to its output.
+type TimerAction int
+
+const (
+	// TimerActionOff turns the output off.
+	TimerActionOff TimerAction = 0
+	// TimerActionOn turns the output on.
+	TimerActionOn TimerAction = 1
+	// TimerActionToggle toggles the output.
+	TimerActionToggle TimerAction = 2
+	// TimerActionRule only triggers the Clock#Timer=<n> rule event.
+	TimerActionRule TimerAction = 3
+)
+
+// String returns the action name: off, on, toggle or rule.
+func (a TimerAction) String() string {
+	switch a {
+	case TimerActionOff:
+		return "off"
+	case TimerActionOn:
+		return "on"
+	case TimerActionToggle:
+		return "toggle"
+	case TimerActionRule:
+		return "rule"
+	default:
+		return fmt.Sprintf("TimerAction(%d)", int(a))
+	}
+}
+
+// Timer is one of the device timers, in the form of the Timer<n> JSON.
+type Timer struct {
+	// Enable arms the timer.
+	Enable bool
+	Mode   TimerMode
+	// Time is "HH:MM" for clock timers. For sunrise and sunset timers it is
+	// an offset of up to 11:59, with a leading "-" for before the event.
+	Time string
+	// Window randomizes the time by up to this many minutes (0-15).
+	Window int
+	// Days lists the weekdays the timer runs on, Sunday first, as seven
+	// characters of '1' (on) and '0' or '-' (off). See TimerDays.
+	Days string
+	// Repeat keeps the timer armed after it has run.
+	Repeat bool
+	// Output is the relay the timer switches, starting at 1.
+	Output int
+	Action TimerAction
+}
+
+// timerJSON is the wire form of a Timer, with fields in the firmware's order.
+type timerJSON struct {
+	Enable int         `json:"Enable"`
+	Mode   TimerMode   `json:"Mode"`
+	Time   string      `json:"Time"`
+	Window int         `json:"Window"`
+	Days   string      `json:"Days"`
+	Repeat int         `json:"Repeat"`
+	Output int         `json:"Output"`
+	Action TimerAction `json:"Action"`
+}
+
+// MarshalJSON implements json.Marshaler, writing the JSON the device uses.
+func (t Timer) MarshalJSON() ([]byte, error) {
+	return json.Marshal(timerJSON{
+		Enable: boolToInt(t.Enable),
+		Mode:   t.Mode,
+		Time:   t.Time,
+		Window: t.Window,
+		Days:   t.Days,
+		Repeat: boolToInt(t.Repeat),
+		Output: t.Output,
+		Action: t.Action,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Older firmware names the
+// Enable field Arm.
+func (t *Timer) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		timerJSON
+		Arm *int `json:"Arm"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw.Arm != nil {
+		raw.Enable = *raw.Arm
+	}
+
+	*t = Timer{
+		Enable: raw.Enable != 0,
+		Mode:   raw.Mode,
+		Time:   raw.Time,
+		Window: raw.Window,
+		Days:   raw.Days,
+		Repeat: raw.Repeat != 0,
+		Output: raw.Output,
+		Action: raw.Action,
+	}
+	return nil
+}
+
+var timerTimePattern = regexp.MustCompile(`^(-?)(\d{2}):(\d{2})$`)
+
+// Validate checks the timer against the ranges the firmware accepts.
+func (t *Timer) Validate() error {
+	invalid := func(msg string) error {
+		return NewError(ErrorTypeCommand, msg, nil)
+	}
+
+	if t.Mode < TimerModeClock || t.Mode > TimerModeSunset {
+		return invalid("timer mode must be clock, sunrise or sunset")
+	}
+	m := timerTimePattern.FindStringSubmatch(t.Time)
+	if m == nil {
+		return invalid(fmt.Sprintf("invalid timer time %q, expected HH:MM", t.Time))
+	}
+	hour, _ := strconv.Atoi(m[2])
+	minute, _ := strconv.Atoi(m[3])
+	maxHour := 23
+	if t.Mode != TimerModeClock {
+		maxHour = 11
+	} else if m[1] != "" {
+		return invalid("only sunrise and sunset timers take a negative offset")
+	}
+	if hour > maxHour || minute > 59 {
+		return invalid(fmt.Sprintf("timer time %q out of range", t.Time))
+	}
+	if t.Window < 0 || t.Window > 15 {
+		return invalid("timer window must be between 0 and 15 minutes")
+	}
+	if len(t.Days) != 7 {
+		return invalid(fmt.Sprintf("invalid timer days %q, expected 7 characters", t.Days))
+	}
+	if t.Output < 1 || t.Output > 16 {
+		return invalid("timer output must be between 1 and 16")
+	}
+	if t.Action < TimerActionOff || t.Action > TimerActionRule {
+		return invalid("timer action must be off, on, toggle or rule")
+	}
+	return nil
+}
+
+// RunsOn reports whether the timer runs on day.
+func (t *Timer) RunsOn(day time.Weekday) bool {
+	i := int(day)
+	return i < len(t.Days) && t.Days[i] != '0' && t.Days[i] != '-'
+}
+
+// TimerDays builds a Days value running on the given weekdays.
+func TimerDays(days ...time.Weekday) string {
+	b := []byte("0000000")
+	for _, d := range days {
+		if d >= time.Sunday && d <= time.Saturday {
+			b[d] = '1'
+		}
+	}
+	return string(b)
+}
+
+// Timers is the response to the Timers command.
+type Timers struct {
+	// Enabled is the global switch for all timers.
+	Enabled bool
+	// Timers holds Timer1 to Timer16 in order.
+	Timers []Timer
+}
+
+// GetTimers reads every timer and the global timer switch.
+func (c *Client) GetTimers(ctx context.Context) (*Timers, error) {
+	raw, err := c.ExecuteCommand(ctx, "Timers")
+	if err != nil {
+		return nil, err
+	}
+
+	var resp map[string]json.RawMessage
+	if err := unmarshalJSON(raw, &resp); err != nil {
+		return nil, err
+	}
+	var state string
+	if err := unmarshalJSON(resp["Timers"], &state); err != nil {
+		return nil, err
+	}
+
+	// Timers are grouped as Timers1..Timers4 over HTTP; collect them
+	// wherever they appear.
+	found := make(map[string]json.RawMessage)
+	collectTimers(resp, found)
+
+	timers := &Timers{Enabled: state == "ON", Timers: make([]Timer, MaxTimers)}
+	for n := 1; n <= MaxTimers; n++ {
+		value, ok := found[fmt.Sprintf("Timer%d", n)]
+		if !ok {
+			return nil, NewError(ErrorTypeParse, fmt.Sprintf("Timers response missing Timer%d", n), nil)
+		}
+		if err := unmarshalJSON(value, &timers.Timers[n-1]); err != nil {
+			return nil, err
+		}
+	}
+	return timers, nil
+}
+
+// collectTimers finds Timer<n> objects at the top level or nested one level
+// down in Timers<n> groups.
+func collectTimers(resp map[string]json.RawMessage, found map[string]json.RawMessage) {
+	for key, value := range resp {
+		switch {
+		case strings.HasPrefix(key, "Timers") && key != "Timers":
+			var group map[string]json.RawMessage
+			if json.Unmarshal(value, &group) == nil {
+				collectTimers(group, found)
+			}
+		case strings.HasPrefix(key, "Timer"):
+			found[key] = value
+		}
+	}
+}
+
+// GetTimer reads timer n (1-16).
+func (c *Client) GetTimer(ctx context.Context, n int) (*Timer, error) {
+	if n < 1 || n > MaxTimers {
+		return nil, NewError(ErrorTypeCommand, "timer number must be between 1 and 16", nil)
+	}
+	return c.timerCommand(ctx, n, "")
+}
+
+// SetTimer replaces timer n (1-16) with t.
+func (c *Client) SetTimer(ctx context.Context, n int, t *Timer) error {
+	if n < 1 || n > MaxTimers {
+		return NewError(ErrorTypeCommand, "timer number must be between 1 and 16", nil)
+	}
+	if t == nil {
+		return NewError(ErrorTypeCommand, "timer cannot be nil", nil)
+	}
+	if err := t.Validate(); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(t)
+	if err != nil {
+		return NewError(ErrorTypeParse, "failed to encode timer", err)
+	}
+	_, err = c.timerCommand(ctx, n, string(payload))
+	return err
+}
+
+// ClearTimer resets timer n (1-16) to its defaults.
+func (c *Client) ClearTimer(ctx context.Context, n int) error {
+	if n < 1 || n > MaxTimers {
+		return NewError(ErrorTypeCommand, "timer number must be between 1 and 16", nil)
+	}
+	_, err := c.timerCommand(ctx, n, "0")
+	return err
+}
+
+// EnableTimers sets the global switch for all timers. Disabled timers keep
+// their settings.
+func (c *Client) EnableTimers(ctx context.Context, enabled bool) error {
+	_, err := c.ExecuteCommand(ctx, fmt.Sprintf("Timers %d", boolToInt(enabled)))
+	return err
+}
+
+func (c *Client) timerCommand(ctx context.Context, n int, payload string) (*Timer, error) {
+	cmd := fmt.Sprintf("Timer%d", n)
+	if payload != "" {
+		cmd += " " + payload
+	}
+	raw, err := c.ExecuteCommand(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp map[string]json.RawMessage
+	if err := unmarshalJSON(raw, &resp); err != nil {
+		return nil, err
+	}
+	value, ok := resp[fmt.Sprintf("Timer%d", n)]
+	if !ok {
+		return nil, NewError(ErrorTypeParse, fmt.Sprintf("response missing Timer%d", n), nil)
+	}
+	var t Timer
+	if err := unmarshalJSON(value, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -0,0 +1,164 @@
+package tasmota
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kradalby/tasmota-go/tasmotatest"
+)
+
+func TestTimer_JSONRoundTrip(t *testing.T) {
+	tests := []string{
+		`{"Enable":1,"Mode":0,"Time":"06:30","Window":0,"Days":"0111110","Repeat":1,"Output":2,"Action":1}`,
+		`{"Enable":0,"Mode":2,"Time":"-01:15","Window":5,"Days":"1111111","Repeat":0,"Output":1,"Action":3}`,
+		`{"Enable":1,"Mode":1,"Time":"00:30","Window":15,"Days":"1000001","Repeat":1,"Output":16,"Action":2}`,
+	}
+
+	for _, raw := range tests {
+		var timer Timer
+		if err := json.Unmarshal([]byte(raw), &timer); err != nil {
+			t.Fatalf("Unmarshal(%s) error: %v", raw, err)
+		}
+		got, err := json.Marshal(timer)
+		if err != nil {
+			t.Fatalf("Marshal() error: %v", err)
+		}
+		if string(got) != raw {
+			t.Errorf("round trip:\n got: %s\nwant: %s", got, raw)
+		}
+	}
+
+	var old Timer
+	if err := json.Unmarshal([]byte(`{"Arm":1,"Time":"07:00","Days":"1111111","Output":1}`), &old); err != nil || !old.Enable {
+		t.Errorf("Unmarshal(Arm) = %+v, %v", old, err)
+	}
+}
+
+func TestTimer_Validate(t *testing.T) {
+	valid := Timer{Time: "06:30", Days: "0111110", Output: 1}
+
+	tests := []struct {
+		name   string
+		modify func(*Timer)
+		ok     bool
+	}{
+		{"valid", func(*Timer) {}, true},
+		{"sunset offset", func(t *Timer) { t.Mode, t.Time = TimerModeSunset, "-01:30" }, true},
+		{"bad mode", func(t *Timer) { t.Mode = 3 }, false},
+		{"bad time", func(t *Timer) { t.Time = "6:30" }, false},
+		{"hour out of range", func(t *Timer) { t.Time = "24:00" }, false},
+		{"negative clock time", func(t *Timer) { t.Time = "-01:00" }, false},
+		{"offset out of range", func(t *Timer) { t.Mode, t.Time = TimerModeSunrise, "12:00" }, false},
+		{"window", func(t *Timer) { t.Window = 16 }, false},
+		{"days", func(t *Timer) { t.Days = "011" }, false},
+		{"output", func(t *Timer) { t.Output = 0 }, false},
+		{"action", func(t *Timer) { t.Action = 4 }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timer := valid
+			tt.modify(&timer)
+			err := timer.Validate()
+			if tt.ok && err != nil {
+				t.Errorf("Validate() error: %v", err)
+			}
+			if !tt.ok && !IsCommandError(err) {
+				t.Errorf("Validate() error = %v, want command error", err)
+			}
+		})
+	}
+}
+
+func TestTimerDays(t *testing.T) {
+	days := TimerDays(time.Monday, time.Friday, time.Sunday)
+	if days != "1100010" {
+		t.Errorf("TimerDays() = %q, want 1100010", days)
+	}
+
+	timer := Timer{Days: "-MTWTF-"}
+	if timer.RunsOn(time.Sunday) || !timer.RunsOn(time.Wednesday) || timer.RunsOn(time.Saturday) {
+		t.Errorf("RunsOn() wrong for %q", timer.Days)
+	}
+}
+
+func TestIntegration_Timers(t *testing.T) {
+	srv, client := newTestDevice(t, tasmotatest.WithRelays(2))
+	ctx := context.Background()
+
+	want := &Timer{
+		Enable: true,
+		Mode:   TimerModeSunset,
+		Time:   "-00:45",
+		Window: 10,
+		Days:   TimerDays(time.Saturday, time.Sunday),
+		Repeat: true,
+		Output: 2,
+		Action: TimerActionOn,
+	}
+	if err := client.SetTimer(ctx, 5, want); err != nil {
+		t.Fatalf("SetTimer() error: %v", err)
+	}
+	if got := srv.State().Timers[4]; got.Mode != 2 || got.Time != "-00:45" || got.Days != "1000001" || got.Output != 2 {
+		t.Errorf("device timer = %+v", got)
+	}
+
+	got, err := client.GetTimer(ctx, 5)
+	if err != nil {
+		t.Fatalf("GetTimer() error: %v", err)
+	}
+	if *got != *want {
+		t.Errorf("GetTimer() = %+v, want %+v", got, want)
+	}
+
+	if err := client.EnableTimers(ctx, false); err != nil {
+		t.Fatalf("EnableTimers() error: %v", err)
+	}
+	timers, err := client.GetTimers(ctx)
+	if err != nil {
+		t.Fatalf("GetTimers() error: %v", err)
+	}
+	if timers.Enabled || len(timers.Timers) != MaxTimers || timers.Timers[4] != *want || timers.Timers[0].Enable {
+		t.Errorf("GetTimers() = %+v", timers)
+	}
+
+	if err := client.ClearTimer(ctx, 5); err != nil {
+		t.Fatalf("ClearTimer() error: %v", err)
+	}
+	if got := srv.State().Timers[4]; got.Enable != 0 || got.Time != "00:00" || got.Output != 1 {
+		t.Errorf("cleared timer = %+v", got)
+	}
+
+	if err := client.SetTimer(ctx, 17, want); !IsCommandError(err) {
+		t.Errorf("SetTimer(17) error = %v, want command error", err)
+	}
+	if err := client.SetTimer(ctx, 1, &Timer{Time: "25:00"}); !IsCommandError(err) {
+		t.Errorf("SetTimer(invalid) error = %v, want command error", err)
+	}
+}
+
+func TestGetTimers_Flat(t *testing.T) {
+	srv, client := newTestDevice(t)
+	// Firmware that returns all timers at the top level
+	srv.Handle("Timers", func(_ *tasmotatest.State, _ tasmotatest.Command) map[string]any {
+		resp := map[string]any{"Timers": "ON"}
+		for n := 1; n <= MaxTimers; n++ {
+			resp[fmt.Sprintf("Timer%d", n)] = map[string]any{
+				"Enable": 1, "Mode": 0, "Time": fmt.Sprintf("%02d:00", n), "Window": 0,
+				"Days": "1111111", "Repeat": 1, "Output": 1, "Action": 0,
+			}
+		}
+		return resp
+	})
+
+	timers, err := client.GetTimers(context.Background())
+	if err != nil {
+		t.Fatalf("GetTimers() error: %v", err)
+	}
+	if !timers.Enabled || timers.Timers[15].Time != "16:00" {
+		t.Errorf("GetTimers() = %+v", timers)
+	}
+}
@@ -0,0 +1,412 @@
+package tasmota
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// TuyaEnums is the number of TuyaEnum settings.
+const TuyaEnums = 4
+
+// TuyaFunction is a Tasmota function a TuyaMCU data point is mapped to.
+type TuyaFunction int
+
+// Common TuyaMCU function ids.
+const (
+	TuyaFnSwitch1           TuyaFunction = 1
+	TuyaFnSwitch2           TuyaFunction = 2
+	TuyaFnSwitch3           TuyaFunction = 3
+	TuyaFnSwitch4           TuyaFunction = 4
+	TuyaFnRelay1            TuyaFunction = 11
+	TuyaFnRelay2            TuyaFunction = 12
+	TuyaFnRelay3            TuyaFunction = 13
+	TuyaFnRelay4            TuyaFunction = 14
+	TuyaFnRelay5            TuyaFunction = 15
+	TuyaFnRelay6            TuyaFunction = 16
+	TuyaFnRelay7            TuyaFunction = 17
+	TuyaFnRelay8            TuyaFunction = 18
+	TuyaFnDimmer            TuyaFunction = 21
+	TuyaFnDimmer2           TuyaFunction = 22
+	TuyaFnCT                TuyaFunction = 23
+	TuyaFnRGB               TuyaFunction = 24
+	TuyaFnWhite             TuyaFunction = 25
+	TuyaFnModeSet           TuyaFunction = 26
+	TuyaFnReport1           TuyaFunction = 27
+	TuyaFnReport2           TuyaFunction = 28
+	TuyaFnPower             TuyaFunction = 31
+	TuyaFnCurrent           TuyaFunction = 32
+	TuyaFnVoltage           TuyaFunction = 33
+	TuyaFnBatteryState      TuyaFunction = 34
+	TuyaFnBatteryPercentage TuyaFunction = 35
+	TuyaFnLowPowerMode      TuyaFunction = 51
+	TuyaFnEnum1             TuyaFunction = 61
+	TuyaFnEnum2             TuyaFunction = 62
+	TuyaFnEnum3             TuyaFunction = 63
+	TuyaFnEnum4             TuyaFunction = 64
+	TuyaFnTemperature       TuyaFunction = 71
+	TuyaFnTemperatureSet    TuyaFunction = 72
+	TuyaFnHumidity          TuyaFunction = 73
+	TuyaFnHumiditySet       TuyaFunction = 74
+	TuyaFnIlluminance       TuyaFunction = 75
+	TuyaFnTVOC              TuyaFunction = 76
+	TuyaFnCO2               TuyaFunction = 77
+	TuyaFnECO2              TuyaFunction = 78
+	TuyaFnPM25              TuyaFunction = 80
+	TuyaFnMotorDirection    TuyaFunction = 97
+	TuyaFnError             TuyaFunction = 98
+	TuyaFnDummy             TuyaFunction = 99
+)
+
+var tuyaFunctionNames = map[TuyaFunction]string{
+	TuyaFnDimmer:            "Dimmer",
+	TuyaFnDimmer2:           "Dimmer2",
+	TuyaFnCT:                "CT",
+	TuyaFnRGB:               "RGB",
+	TuyaFnWhite:             "White",
+	TuyaFnModeSet:           "ModeSet",
+	TuyaFnReport1:           "Report1",
+	TuyaFnReport2:           "Report2",
+	TuyaFnPower:             "Power",
+	TuyaFnCurrent:           "Current",
+	TuyaFnVoltage:           "Voltage",
+	TuyaFnBatteryState:      "BatteryState",
+	TuyaFnBatteryPercentage: "BatteryPercentage",
+	TuyaFnLowPowerMode:      "LowPowerMode",
+	TuyaFnTemperature:       "Temperature",
+	TuyaFnTemperatureSet:    "TemperatureSet",
+	TuyaFnHumidity:          "Humidity",
+	TuyaFnHumiditySet:       "HumiditySet",
+	TuyaFnIlluminance:       "Illuminance",
+	TuyaFnTVOC:              "TVOC",
+	TuyaFnCO2:               "CO2",
+	TuyaFnECO2:              "ECO2",
+	TuyaFnPM25:              "PM25",
+	TuyaFnMotorDirection:    "MotorDirection",
+	TuyaFnError:             "Error",
+	TuyaFnDummy:             "Dummy",
+}
+
+// String returns the name of the function, or its id if it has none.
+func (f TuyaFunction) String() string {
+	switch {
+	case f >= TuyaFnSwitch1 && f <= TuyaFnSwitch4:
+		return fmt.Sprintf("Switch%d", f-TuyaFnSwitch1+1)
+	case f >= TuyaFnRelay1 && f <= TuyaFnRelay8:
+		return fmt.Sprintf("Relay%d", f-TuyaFnRelay1+1)
+	case f >= TuyaFnEnum1 && f <= TuyaFnEnum4:
+		return fmt.Sprintf("Enum%d", f-TuyaFnEnum1+1)
+	}
+	if name, ok := tuyaFunctionNames[f]; ok {
+		return name
+	}
+	return strconv.Itoa(int(f))
+}
+
+// TuyaMapping maps a TuyaMCU data point to a Tasmota function.
+type TuyaMapping struct {
+	Function TuyaFunction `json:"fnId"`
+	DP       int          `json:"dpId"`
+}
+
+// TuyaDPType is the type of a TuyaMCU data point.
+type TuyaDPType int
+
+// Data point types.
+const (
+	TuyaDPRaw TuyaDPType = iota
+	TuyaDPBool
+	TuyaDPValue
+	TuyaDPString
+	TuyaDPEnum
+	TuyaDPBitmap
+)
+
+// String returns a string representation of the TuyaDPType.
+func (t TuyaDPType) String() string {
+	switch t {
+	case TuyaDPRaw:
+		return "raw"
+	case TuyaDPBool:
+		return "bool"
+	case TuyaDPValue:
+		return "value"
+	case TuyaDPString:
+		return "string"
+	case TuyaDPEnum:
+		return "enum"
+	case TuyaDPBitmap:
+		return "bitmap"
+	default:
+		return "unknown"
+	}
+}
+
+// TuyaDP is a data point reported by the MCU.
+type TuyaDP struct {
+	ID   int
+	Type TuyaDPType
+	// Data holds the bytes of the value as sent by the MCU.
+	Data []byte
+}
+
+// Value returns the decoded value: a bool, an int64 for value, enum and
+// bitmap data points, a string, or the bytes of a raw data point.
+func (dp TuyaDP) Value() any {
+	switch dp.Type {
+	case TuyaDPBool:
+		return len(dp.Data) > 0 && dp.Data[0] != 0
+	case TuyaDPValue:
+		// Values are 32 bit signed big endian integers.
+		return int64(int32(uint32(dp.uint())))
+	case TuyaDPEnum, TuyaDPBitmap:
+		return int64(dp.uint())
+	case TuyaDPString:
+		return string(dp.Data)
+	default:
+		return dp.Data
+	}
+}
+
+func (dp TuyaDP) uint() uint64 {
+	var n uint64
+	for _, b := range dp.Data {
+		n = n<<8 | uint64(b)
+	}
+	return n
+}
+
+// TuyaReceived is a message from the MCU decoded from a TuyaReceived
+// payload.
+type TuyaReceived struct {
+	// Cmnd is the Tuya protocol command, 7 for data point reports.
+	Cmnd int
+	// Frame is the whole serial frame.
+	Frame []byte
+	// DPs holds the reported data points ordered by id.
+	DPs []TuyaDP
+}
+
+// DP returns the data point with the given id.
+func (r *TuyaReceived) DP(id int) (TuyaDP, bool) {
+	for _, dp := range r.DPs {
+		if dp.ID == id {
+			return dp, true
+		}
+	}
+	return TuyaDP{}, false
+}
+
+// ParseTuyaReceived decodes the TuyaReceived message in a RESULT payload.
+func ParseTuyaReceived(payload []byte) (*TuyaReceived, error) {
+	var resp struct {
+		TuyaReceived map[string]json.RawMessage
+	}
+	if err := unmarshalJSON(payload, &resp); err != nil {
+		return nil, err
+	}
+	if resp.TuyaReceived == nil {
+		return nil, NewError(ErrorTypeParse, "payload has no TuyaReceived", nil)
+	}
+
+	received := &TuyaReceived{}
+	for key, value := range resp.TuyaReceived {
+		var err error
+		switch {
+		case key == "Cmnd":
+			err = json.Unmarshal(value, &received.Cmnd)
+		case key == "Data":
+			var data string
+			if err = json.Unmarshal(value, &data); err == nil {
+				received.Frame, err = hex.DecodeString(data)
+			}
+		case isDigits(key):
+			var dp struct {
+				DpId     int
+				DpIdType int
+				DpIdData string
+			}
+			if err = json.Unmarshal(value, &dp); err == nil {
+				var data []byte
+				if data, err = hex.DecodeString(dp.DpIdData); err == nil {
+					received.DPs = append(received.DPs, TuyaDP{ID: dp.DpId, Type: TuyaDPType(dp.DpIdType), Data: data})
+				}
+			}
+		}
+		if err != nil {
+			return nil, NewError(ErrorTypeParse, fmt.Sprintf("invalid TuyaReceived %s", key), err)
+		}
+	}
+	slices.SortFunc(received.DPs, func(a, b TuyaDP) int { return a.ID - b.ID })
+
+	return received, nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// GetTuyaMCU returns the data point mappings of the TuyaMCU.
+func (c *Client) GetTuyaMCU(ctx context.Context) ([]TuyaMapping, error) {
+	value, err := c.tuyaCommand(ctx, "TuyaMCU", "")
+	if err != nil {
+		return nil, err
+	}
+	var mappings []TuyaMapping
+	if err := unmarshalJSON(value, &mappings); err != nil {
+		return nil, err
+	}
+	return mappings, nil
+}
+
+// SetTuyaMCU maps data point dp to a function. A dp of 0 removes the
+// function's mapping.
+func (c *Client) SetTuyaMCU(ctx context.Context, fn TuyaFunction, dp int) error {
+	if fn < 1 || fn > 99 {
+		return NewError(ErrorTypeCommand, "TuyaMCU function id must be between 1 and 99", nil)
+	}
+	if dp < 0 || dp > 255 {
+		return NewError(ErrorTypeCommand, "TuyaMCU data point id must be between 0 and 255", nil)
+	}
+	_, err := c.tuyaCommand(ctx, "TuyaMCU", fmt.Sprintf("%d,%d", fn, dp))
+	return err
+}
+
+// TuyaSendBool sets a boolean data point.
+func (c *Client) TuyaSendBool(ctx context.Context, dp int, value bool) error {
+	return c.tuyaSend(ctx, TuyaDPBool, dp, strconv.Itoa(boolToInt(value)))
+}
+
+// TuyaSendValue sets a 32 bit value data point.
+func (c *Client) TuyaSendValue(ctx context.Context, dp int, value int) error {
+	if int64(value) < math.MinInt32 || int64(value) > math.MaxUint32 {
+		return NewError(ErrorTypeCommand, fmt.Sprintf("Tuya value %d does not fit in 32 bits", value), nil)
+	}
+	return c.tuyaSend(ctx, TuyaDPValue, dp, strconv.Itoa(value))
+}
+
+// TuyaSendString sets a string data point.
+func (c *Client) TuyaSendString(ctx context.Context, dp int, value string) error {
+	return c.tuyaSend(ctx, TuyaDPString, dp, value)
+}
+
+// TuyaSendEnum sets an enum data point.
+func (c *Client) TuyaSendEnum(ctx context.Context, dp int, value int) error {
+	if value < 0 || value > 255 {
+		return NewError(ErrorTypeCommand, "Tuya enum value must be between 0 and 255", nil)
+	}
+	return c.tuyaSend(ctx, TuyaDPEnum, dp, strconv.Itoa(value))
+}
+
+// TuyaQuery asks the MCU to report every data point. The values arrive as
+// TuyaReceived messages on tele/<topic>/RESULT.
+func (c *Client) TuyaQuery(ctx context.Context) error {
+	_, err := c.tuyaCommand(ctx, "TuyaSend8", "")
+	return err
+}
+
+func (c *Client) tuyaSend(ctx context.Context, typ TuyaDPType, dp int, value string) error {
+	if dp < 1 || dp > 255 {
+		return NewError(ErrorTypeCommand, "Tuya data point id must be between 1 and 255", nil)
+	}
+	_, err := c.tuyaCommand(ctx, fmt.Sprintf("TuyaSend%d", typ), fmt.Sprintf("%d,%s", dp, value))
+	return err
+}
+
+// GetTuyaEnums returns the values of TuyaEnum1 to TuyaEnum4.
+func (c *Client) GetTuyaEnums(ctx context.Context) ([TuyaEnums]int, error) {
+	return c.tuyaEnums(ctx, "TuyaEnum", "")
+}
+
+// SetTuyaEnum sets TuyaEnum<n> to value, which cannot exceed the maximum
+// set with SetTuyaEnumList.
+func (c *Client) SetTuyaEnum(ctx context.Context, n, value int) error {
+	if err := checkTuyaEnum(n, value); err != nil {
+		return err
+	}
+	_, err := c.tuyaEnums(ctx, "TuyaEnum", fmt.Sprintf("%d %d", n, value))
+	return err
+}
+
+// GetTuyaEnumLists returns the highest value of each TuyaEnum.
+func (c *Client) GetTuyaEnumLists(ctx context.Context) ([TuyaEnums]int, error) {
+	return c.tuyaEnums(ctx, "TuyaEnumList", "")
+}
+
+// SetTuyaEnumList sets the highest value TuyaEnum<n> accepts.
+func (c *Client) SetTuyaEnumList(ctx context.Context, n, highest int) error {
+	if err := checkTuyaEnum(n, highest); err != nil {
+		return err
+	}
+	_, err := c.tuyaEnums(ctx, "TuyaEnumList", fmt.Sprintf("%d %d", n, highest))
+	return err
+}
+
+// tuyaEnums runs a TuyaEnum or TuyaEnumList command; the response holds
+// all four enums whichever one was set.
+func (c *Client) tuyaEnums(ctx context.Context, name, args string) ([TuyaEnums]int, error) {
+	var enums [TuyaEnums]int
+	raw, err := c.ExecuteCommand(ctx, name+args)
+	if err != nil {
+		return enums, err
+	}
+	var resp map[string]map[string]int
+	if err := unmarshalJSON(raw, &resp); err != nil {
+		return enums, err
+	}
+	values, ok := resp[name]
+	if !ok {
+		return enums, NewError(ErrorTypeParse, fmt.Sprintf("response missing %s", name), nil)
+	}
+	for i := range enums {
+		enums[i] = values[fmt.Sprintf("Enum%d", i+1)]
+	}
+	return enums, nil
+}
+
+func (c *Client) tuyaCommand(ctx context.Context, name, payload string) (json.RawMessage, error) {
+	cmd := name
+	if payload != "" {
+		cmd += " " + payload
+	}
+	raw, err := c.ExecuteCommand(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	var resp map[string]json.RawMessage
+	if err := unmarshalJSON(raw, &resp); err != nil {
+		return nil, err
+	}
+	value, ok := resp[name]
+	if !ok {
+		return nil, NewError(ErrorTypeParse, fmt.Sprintf("response missing %s", name), nil)
+	}
+	var msg string
+	if json.Unmarshal(value, &msg) == nil && !strings.EqualFold(msg, "Done") {
+		return nil, NewError(ErrorTypeCommand, fmt.Sprintf("%s failed: %s", name, msg), nil)
+	}
+	return value, nil
+}
+
+func checkTuyaEnum(n, value int) error {
+	if n < 1 || n > TuyaEnums {
+		return NewError(ErrorTypeCommand, fmt.Sprintf("TuyaEnum must be between 1 and %d", TuyaEnums), nil)
+	}
+	if value < 0 || value > 31 {
+		return NewError(ErrorTypeCommand, "TuyaEnum values must be between 0 and 31", nil)
+	}
+	return nil
+}
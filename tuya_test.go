@@ -0,0 +1,154 @@
+package tasmota
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/kradalby/tasmota-go/tasmotatest"
+)
+
+func TestParseTuyaReceived(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		wantDPs []TuyaDP
+		values  []any
+		wantErr bool
+	}{
+		{
+			name:    "bool",
+			payload: `{"TuyaReceived":{"Data":"55AA03070005010100010116","Cmnd":7,"CmndData":"0101000101","DpType1Id1":1,"1":{"DpId":1,"DpIdType":1,"DpIdData":"01"}}}`,
+			wantDPs: []TuyaDP{{ID: 1, Type: TuyaDPBool, Data: []byte{1}}},
+			values:  []any{true},
+		},
+		{
+			name: "several",
+			payload: `{"TuyaReceived":{"Data":"55AA","Cmnd":7,` +
+				`"3":{"DpId":3,"DpIdType":4,"DpIdData":"02"},` +
+				`"2":{"DpId":2,"DpIdType":2,"DpIdData":"FFFFFFF6"},` +
+				`"101":{"DpId":101,"DpIdType":3,"DpIdData":"6F6B"}}}`,
+			wantDPs: []TuyaDP{
+				{ID: 2, Type: TuyaDPValue, Data: []byte{0xFF, 0xFF, 0xFF, 0xF6}},
+				{ID: 3, Type: TuyaDPEnum, Data: []byte{2}},
+				{ID: 101, Type: TuyaDPString, Data: []byte("ok")},
+			},
+			values: []any{int64(-10), int64(2), "ok"},
+		},
+		{
+			name:    "heartbeat",
+			payload: `{"TuyaReceived":{"Data":"55AA030000010003","Cmnd":0}}`,
+		},
+		{name: "bad data", payload: `{"TuyaReceived":{"1":{"DpId":1,"DpIdType":1,"DpIdData":"XY"}}}`, wantErr: true},
+		{name: "not tuya", payload: `{"POWER":"ON"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTuyaReceived([]byte(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTuyaReceived() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(got.DPs, tt.wantDPs) {
+				t.Errorf("DPs = %+v, want %+v", got.DPs, tt.wantDPs)
+			}
+			for i, dp := range got.DPs {
+				if v := dp.Value(); v != tt.values[i] {
+					t.Errorf("DP %d value = %#v, want %#v", dp.ID, v, tt.values[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTuyaFunction_String(t *testing.T) {
+	for fn, want := range map[TuyaFunction]string{
+		TuyaFnRelay3:  "Relay3",
+		TuyaFnDimmer:  "Dimmer",
+		TuyaFnEnum2:   "Enum2",
+		TuyaFnSwitch1: "Switch1",
+		42:            "42",
+	} {
+		if got := fn.String(); got != want {
+			t.Errorf("TuyaFunction(%d).String() = %q, want %q", int(fn), got, want)
+		}
+	}
+}
+
+func TestIntegration_TuyaMCU(t *testing.T) {
+	srv, client := newTestDevice(t, tasmotatest.WithTuyaMCU(tasmotatest.TuyaMapping{Fn: 11, DP: 1}))
+	ctx := context.Background()
+
+	if err := client.SetTuyaMCU(ctx, TuyaFnDimmer, 2); err != nil {
+		t.Fatalf("SetTuyaMCU() error: %v", err)
+	}
+	mappings, err := client.GetTuyaMCU(ctx)
+	if err != nil {
+		t.Fatalf("GetTuyaMCU() error: %v", err)
+	}
+	want := []TuyaMapping{{Function: TuyaFnRelay1, DP: 1}, {Function: TuyaFnDimmer, DP: 2}}
+	if !reflect.DeepEqual(mappings, want) {
+		t.Errorf("GetTuyaMCU() = %+v, want %+v", mappings, want)
+	}
+	if err := client.SetTuyaMCU(ctx, TuyaFnRelay1, 0); err != nil {
+		t.Fatalf("SetTuyaMCU(remove) error: %v", err)
+	}
+
+	if err := client.TuyaSendBool(ctx, 1, true); err != nil {
+		t.Fatalf("TuyaSendBool() error: %v", err)
+	}
+	if err := client.TuyaSendValue(ctx, 2, 500); err != nil {
+		t.Fatalf("TuyaSendValue() error: %v", err)
+	}
+	if err := client.TuyaSendString(ctx, 5, "ff0000"); err != nil {
+		t.Fatalf("TuyaSendString() error: %v", err)
+	}
+	if err := client.TuyaSendEnum(ctx, 4, 2); err != nil {
+		t.Fatalf("TuyaSendEnum() error: %v", err)
+	}
+	if err := client.TuyaQuery(ctx); err != nil {
+		t.Fatalf("TuyaQuery() error: %v", err)
+	}
+
+	if err := client.SetTuyaEnumList(ctx, 1, 3); err != nil {
+		t.Fatalf("SetTuyaEnumList() error: %v", err)
+	}
+	if err := client.SetTuyaEnum(ctx, 1, 2); err != nil {
+		t.Fatalf("SetTuyaEnum() error: %v", err)
+	}
+	if lists, err := client.GetTuyaEnumLists(ctx); err != nil || lists != [TuyaEnums]int{3, 0, 0, 0} {
+		t.Errorf("GetTuyaEnumLists() = %v, %v", lists, err)
+	}
+	if enums, err := client.GetTuyaEnums(ctx); err != nil || enums != [TuyaEnums]int{2, 0, 0, 0} {
+		t.Errorf("GetTuyaEnums() = %v, %v", enums, err)
+	}
+
+	tuya := srv.State().Tuya
+	wantSent := []tasmotatest.TuyaSent{
+		{DP: 1, Type: 1, Value: "1"},
+		{DP: 2, Type: 2, Value: "500"},
+		{DP: 5, Type: 3, Value: "ff0000"},
+		{DP: 4, Type: 4, Value: "2"},
+	}
+	if !reflect.DeepEqual(tuya.Sent, wantSent) {
+		t.Errorf("Sent = %+v, want %+v", tuya.Sent, wantSent)
+	}
+	if len(tuya.Mappings) != 1 || tuya.Queries != 1 {
+		t.Errorf("Tuya state = %+v", tuya)
+	}
+
+	for name, err := range map[string]error{
+		"SetTuyaMCU(0)":     client.SetTuyaMCU(ctx, 0, 1),
+		"TuyaSendBool(256)": client.TuyaSendBool(ctx, 256, true),
+		"TuyaSendEnum(300)": client.TuyaSendEnum(ctx, 1, 300),
+		"SetTuyaEnum(5)":    client.SetTuyaEnum(ctx, 5, 1),
+		"SetTuyaEnumList":   client.SetTuyaEnumList(ctx, 1, 32),
+	} {
+		if !IsCommandError(err) {
+			t.Errorf("%s error = %v, want command error", name, err)
+		}
+	}
+}
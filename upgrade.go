@@ -0,0 +1,327 @@
+package tasmota
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultUpgradeTimeout is the default time allowed for a whole upgrade,
+	// including restarts.
+	DefaultUpgradeTimeout = 5 * time.Minute
+	// DefaultUpgradePollInterval is how often a restarting device is polled.
+	DefaultUpgradePollInterval = 3 * time.Second
+)
+
+// UpgradeStage identifies a step of an upgrade.
+type UpgradeStage string
+
+// Upgrade stages reported to the progress callback.
+const (
+	UpgradeStageStarting  UpgradeStage = "starting"
+	UpgradeStageMinimal   UpgradeStage = "minimal"
+	UpgradeStageUploading UpgradeStage = "uploading"
+	UpgradeStageUpgrading UpgradeStage = "upgrading"
+	UpgradeStageWaiting   UpgradeStage = "waiting"
+	UpgradeStageVerifying UpgradeStage = "verifying"
+	UpgradeStageDone      UpgradeStage = "done"
+)
+
+// UpgradeProgress reports the progress of an upgrade. BytesSent and
+// BytesTotal are set while uploading.
+type UpgradeProgress struct {
+	Stage      UpgradeStage
+	Message    string
+	BytesSent  int64
+	BytesTotal int64
+}
+
+// UpgradeResult describes a completed upgrade.
+type UpgradeResult struct {
+	PreviousVersion string
+	Version         string
+	// UpToDate is set when the device already ran the expected version and
+	// no upgrade was started.
+	UpToDate bool
+	// Minimal is set when the device went through the minimal firmware.
+	Minimal  bool
+	Duration time.Duration
+}
+
+// UpgradeOption is a functional option for Upgrade and UpgradeFile.
+type UpgradeOption func(*upgradeConfig)
+
+type upgradeConfig struct {
+	expected     string
+	minimalURL   string
+	minimalImage []byte
+	timeout      time.Duration
+	pollInterval time.Duration
+	progress     func(UpgradeProgress)
+}
+
+// WithExpectedVersion verifies the device runs version after the upgrade,
+// and skips the upgrade if it already does. The version matches
+// StatusFWR.Version with or without the build suffix, so "14.3.0" matches
+// "14.3.0(tasmota)".
+func WithExpectedVersion(version string) UpgradeOption {
+	return func(cfg *upgradeConfig) {
+		cfg.expected = version
+	}
+}
+
+// WithMinimalURL installs the minimal firmware from url first on ESP8266
+// devices, which lack the flash space to download a full image while
+// running one.
+func WithMinimalURL(url string) UpgradeOption {
+	return func(cfg *upgradeConfig) {
+		cfg.minimalURL = url
+	}
+}
+
+// WithMinimalImage uploads the minimal firmware image first on ESP8266
+// devices, like WithMinimalURL.
+func WithMinimalImage(image []byte) UpgradeOption {
+	return func(cfg *upgradeConfig) {
+		cfg.minimalImage = image
+	}
+}
+
+// WithUpgradeTimeout sets the time allowed for the whole upgrade.
+func WithUpgradeTimeout(timeout time.Duration) UpgradeOption {
+	return func(cfg *upgradeConfig) {
+		if timeout > 0 {
+			cfg.timeout = timeout
+		}
+	}
+}
+
+// WithUpgradePollInterval sets how often a restarting device is polled.
+func WithUpgradePollInterval(interval time.Duration) UpgradeOption {
+	return func(cfg *upgradeConfig) {
+		if interval > 0 {
+			cfg.pollInterval = interval
+		}
+	}
+}
+
+// WithUpgradeProgress sets a callback for upgrade progress.
+func WithUpgradeProgress(fn func(UpgradeProgress)) UpgradeOption {
+	return func(cfg *upgradeConfig) {
+		cfg.progress = fn
+	}
+}
+
+// Upgrade upgrades the firmware over the air: it sets OtaUrl to otaURL,
+// runs "Upgrade 1" and waits for the device to restart.
+//
+// On ESP8266 a full image may not fit next to the running one. With
+// WithMinimalURL the minimal firmware is installed first; if the device
+// comes back running the minimal firmware anyway, the upgrade is started
+// again from it. The result is verified with WithExpectedVersion.
+func (c *Client) Upgrade(ctx context.Context, otaURL string, opts ...UpgradeOption) (*UpgradeResult, error) {
+	if otaURL == "" {
+		return nil, NewError(ErrorTypeCommand, "OTA URL cannot be empty", nil)
+	}
+	cfg := newUpgradeConfig(opts)
+
+	install := func(ctx context.Context, minimal bool) error {
+		url := otaURL
+		if minimal {
+			url = cfg.minimalURL
+		}
+		cfg.report(UpgradeProgress{Stage: UpgradeStageUpgrading, Message: "upgrading from " + url})
+		if _, err := c.ExecuteCommand(ctx, "OtaUrl "+url); err != nil {
+			return err
+		}
+		_, err := c.ExecuteCommand(ctx, "Upgrade 1")
+		return err
+	}
+
+	return c.upgrade(ctx, cfg, cfg.minimalURL != "", install)
+}
+
+// UpgradeFile upgrades the firmware by uploading image through the web UI,
+// like its Firmware Upgrade page, and waits for the device to restart. The
+// web UI authenticates with the web password.
+//
+// The upload is bound by the client's response timeout as well as the
+// upgrade timeout, so raise it with WithTimeout for slow links. Minimal
+// firmware handling works as in Upgrade, using WithMinimalImage.
+func (c *Client) UpgradeFile(ctx context.Context, image []byte, opts ...UpgradeOption) (*UpgradeResult, error) {
+	if len(image) == 0 {
+		return nil, NewError(ErrorTypeCommand, "firmware image cannot be empty", nil)
+	}
+	cfg := newUpgradeConfig(opts)
+
+	install := func(ctx context.Context, minimal bool) error {
+		data := image
+		if minimal {
+			data = cfg.minimalImage
+		}
+		return c.webUpload(ctx, "/up", "firmware.bin", data, func(sent, total int64) {
+			cfg.report(UpgradeProgress{Stage: UpgradeStageUploading, BytesSent: sent, BytesTotal: total})
+		})
+	}
+
+	return c.upgrade(ctx, cfg, cfg.minimalImage != nil, install)
+}
+
+func newUpgradeConfig(opts []UpgradeOption) *upgradeConfig {
+	cfg := &upgradeConfig{
+		timeout:      DefaultUpgradeTimeout,
+		pollInterval: DefaultUpgradePollInterval,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+func (cfg *upgradeConfig) report(p UpgradeProgress) {
+	if cfg.progress != nil {
+		cfg.progress(p)
+	}
+}
+
+// firmwareState is the part of Status 0 an upgrade tracks.
+type firmwareState struct {
+	version   string
+	hardware  string
+	bootCount int
+}
+
+// upgrade runs the upgrade workflow around install, which starts the
+// installation of the full or, if minimal, the minimal firmware.
+func (c *Client) upgrade(ctx context.Context, cfg *upgradeConfig, hasMinimal bool, install func(ctx context.Context, minimal bool) error) (*UpgradeResult, error) {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, cfg.timeout)
+	defer cancel()
+
+	cfg.report(UpgradeProgress{Stage: UpgradeStageStarting})
+	state, err := c.firmwareState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := &UpgradeResult{PreviousVersion: state.version, Version: state.version}
+
+	if cfg.expected != "" && versionMatches(state.version, cfg.expected) {
+		result.UpToDate = true
+		result.Duration = time.Since(start)
+		cfg.report(UpgradeProgress{Stage: UpgradeStageDone, Message: "already running " + state.version})
+		return result, nil
+	}
+
+	step := func(minimal bool) error {
+		if err := install(ctx, minimal); err != nil {
+			return err
+		}
+		state, err = c.waitForRestart(ctx, cfg, state.bootCount)
+		return err
+	}
+
+	if hasMinimal && strings.HasPrefix(state.hardware, "ESP8266") && !isMinimalFirmware(state.version) {
+		cfg.report(UpgradeProgress{Stage: UpgradeStageMinimal, Message: "installing minimal firmware"})
+		if err := step(true); err != nil {
+			return result, err
+		}
+		if !isMinimalFirmware(state.version) {
+			return result, NewError(ErrorTypeDevice,
+				fmt.Sprintf("device restarted on %s instead of the minimal firmware", state.version), nil)
+		}
+		result.Minimal = true
+	}
+
+	if err := step(false); err != nil {
+		return result, err
+	}
+
+	// The minimal firmware only exists to install the full image
+	if isMinimalFirmware(state.version) {
+		result.Minimal = true
+		cfg.report(UpgradeProgress{Stage: UpgradeStageMinimal, Message: "device is running the minimal firmware, upgrading again"})
+		if err := step(false); err != nil {
+			return result, err
+		}
+	}
+
+	result.Version = state.version
+	result.Duration = time.Since(start)
+
+	cfg.report(UpgradeProgress{Stage: UpgradeStageVerifying, Message: state.version})
+	if isMinimalFirmware(state.version) {
+		return result, NewError(ErrorTypeDevice, "device is still running the minimal firmware", nil)
+	}
+	if cfg.expected != "" && !versionMatches(state.version, cfg.expected) {
+		return result, NewError(ErrorTypeDevice,
+			fmt.Sprintf("device runs %s after upgrade, expected %s", state.version, cfg.expected), nil)
+	}
+
+	cfg.report(UpgradeProgress{Stage: UpgradeStageDone, Message: state.version})
+	return result, nil
+}
+
+// waitForRestart polls the device until its boot count passes bootCount.
+// Errors while the device is restarting are expected and ignored until ctx
+// expires.
+func (c *Client) waitForRestart(ctx context.Context, cfg *upgradeConfig, bootCount int) (firmwareState, error) {
+	cfg.report(UpgradeProgress{Stage: UpgradeStageWaiting, Message: "waiting for the device to restart"})
+
+	ticker := time.NewTicker(cfg.pollInterval)
+	defer ticker.Stop()
+
+	var lastErr error
+	for {
+		select {
+		case <-ctx.Done():
+			msg := "timed out waiting for the device to restart"
+			if lastErr != nil {
+				msg += " (last error: " + lastErr.Error() + ")"
+			}
+			return firmwareState{}, NewError(ErrorTypeTimeout, msg, ctx.Err())
+		case <-ticker.C:
+		}
+
+		state, err := c.firmwareState(ctx)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if state.bootCount > bootCount {
+			return state, nil
+		}
+	}
+}
+
+func (c *Client) firmwareState(ctx context.Context) (firmwareState, error) {
+	raw, err := c.ExecuteCommand(ctx, "Status 0")
+	if err != nil {
+		return firmwareState{}, err
+	}
+	var status StatusResponse
+	if err := unmarshalJSON(raw, &status); err != nil {
+		return firmwareState{}, err
+	}
+	if status.StatusFWR == nil || status.StatusPRM == nil {
+		return firmwareState{}, NewError(ErrorTypeParse, "status response missing firmware information", nil)
+	}
+
+	return firmwareState{
+		version:   status.StatusFWR.Version,
+		hardware:  status.StatusFWR.Hardware,
+		bootCount: status.StatusPRM.BootCount,
+	}, nil
+}
+
+// versionMatches reports whether a StatusFWR.Version such as
+// "14.3.0(tasmota)" is the expected version, which may omit the build.
+func versionMatches(version, expected string) bool {
+	rest, ok := strings.CutPrefix(version, expected)
+	return ok && (rest == "" || strings.HasPrefix(rest, "("))
+}
+
+func isMinimalFirmware(version string) bool {
+	return strings.Contains(version, "(minimal)")
+}
@@ -0,0 +1,193 @@
+package tasmota
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kradalby/tasmota-go/tasmotatest"
+)
+
+const (
+	testOTAURL     = "http://ota.example/tasmota.bin.gz"
+	testMinimalURL = "http://ota.example/tasmota-minimal.bin.gz"
+)
+
+// otaServer resolves URL upgrades: the minimal URL installs the minimal
+// firmware and testOTAURL installs version.
+func otaServer(version string) tasmotatest.UpgradeFunc {
+	return func(source string, image []byte) (string, error) {
+		switch {
+		case source == testMinimalURL:
+			return "14.3.0(minimal)", nil
+		case source == testOTAURL:
+			return version, nil
+		case image != nil && image[0] == 0xE9:
+			return version, nil
+		}
+		return "", errors.New("download failed")
+	}
+}
+
+func fastUpgrade(opts ...UpgradeOption) []UpgradeOption {
+	return append([]UpgradeOption{WithUpgradePollInterval(5 * time.Millisecond), WithUpgradeTimeout(2 * time.Second)}, opts...)
+}
+
+func TestIntegration_Upgrade(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		upgrade     tasmotatest.UpgradeFunc
+		opts        []UpgradeOption
+		wantVersion string
+		wantMinimal bool
+		wantErr     func(error) bool
+	}{
+		{
+			name:        "direct",
+			upgrade:     otaServer("14.3.0(tasmota)"),
+			opts:        []UpgradeOption{WithExpectedVersion("14.3.0")},
+			wantVersion: "14.3.0(tasmota)",
+		},
+		{
+			name:        "minimal first",
+			upgrade:     otaServer("14.3.0(tasmota)"),
+			opts:        []UpgradeOption{WithMinimalURL(testMinimalURL), WithExpectedVersion("14.3.0")},
+			wantVersion: "14.3.0(tasmota)",
+			wantMinimal: true,
+		},
+		{
+			name: "continues from minimal",
+			upgrade: func() tasmotatest.UpgradeFunc {
+				calls := 0
+				return func(string, []byte) (string, error) {
+					calls++
+					if calls == 1 {
+						return "14.3.0(minimal)", nil
+					}
+					return "14.3.0(tasmota)", nil
+				}
+			}(),
+			wantVersion: "14.3.0(tasmota)",
+			wantMinimal: true,
+		},
+		{
+			name:        "unexpected version",
+			upgrade:     otaServer("14.3.0(tasmota)"),
+			opts:        []UpgradeOption{WithExpectedVersion("14.4.0")},
+			wantVersion: "14.3.0(tasmota)",
+			wantErr:     IsDeviceError,
+		},
+		{
+			name:        "download fails",
+			upgrade:     otaServer("unused"),
+			opts:        []UpgradeOption{WithMinimalURL("http://ota.example/missing.bin.gz")},
+			wantVersion: "14.2.0(tasmota)",
+			wantErr:     IsDeviceError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, client := newTestDevice(t, tasmotatest.WithUpgrade(tt.upgrade), tasmotatest.WithRestartDelay(20*time.Millisecond))
+
+			var stages []UpgradeStage
+			opts := fastUpgrade(append(tt.opts, WithUpgradeProgress(func(p UpgradeProgress) {
+				stages = append(stages, p.Stage)
+			}))...)
+
+			result, err := client.Upgrade(ctx, testOTAURL, opts...)
+			if tt.wantErr != nil {
+				if !tt.wantErr(err) {
+					t.Fatalf("Upgrade() error = %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Upgrade() error: %v", err)
+			}
+
+			if result.PreviousVersion != "14.2.0(tasmota)" || result.Minimal != tt.wantMinimal {
+				t.Errorf("result = %+v", result)
+			}
+			if got := srv.State().Firmware; got != tt.wantVersion {
+				t.Errorf("firmware = %q, want %q", got, tt.wantVersion)
+			}
+			if tt.wantErr == nil && (result.Version != tt.wantVersion || stages[len(stages)-1] != UpgradeStageDone) {
+				t.Errorf("result version = %q, stages = %v", result.Version, stages)
+			}
+		})
+	}
+}
+
+func TestIntegration_UpgradeFile(t *testing.T) {
+	ctx := context.Background()
+	srv, client := newTestDevice(t, tasmotatest.WithUpgrade(otaServer("14.3.0(tasmota)")))
+
+	image := append([]byte{0xE9}, make([]byte, 64<<10)...)
+	var sent, total int64
+	result, err := client.UpgradeFile(ctx, image, fastUpgrade(
+		WithExpectedVersion("14.3.0"),
+		WithUpgradeProgress(func(p UpgradeProgress) {
+			if p.Stage == UpgradeStageUploading {
+				sent, total = p.BytesSent, p.BytesTotal
+			}
+		}),
+	)...)
+	if err != nil {
+		t.Fatalf("UpgradeFile() error: %v", err)
+	}
+	if result.Version != "14.3.0(tasmota)" || srv.State().BootCount != 2 {
+		t.Errorf("result = %+v, boot count %d", result, srv.State().BootCount)
+	}
+	if total <= int64(len(image)) || sent != total {
+		t.Errorf("upload progress = %d/%d", sent, total)
+	}
+
+	again, err := client.UpgradeFile(ctx, image, fastUpgrade(WithExpectedVersion("14.3.0"))...)
+	if err != nil || !again.UpToDate || srv.State().BootCount != 2 {
+		t.Errorf("UpgradeFile() up to date = %+v, %v", again, err)
+	}
+
+	if _, err := client.UpgradeFile(ctx, []byte("not firmware"), fastUpgrade()...); !IsDeviceError(err) {
+		t.Errorf("UpgradeFile() invalid image error = %v, want device error", err)
+	}
+}
+
+func TestUpgrade_Timeout(t *testing.T) {
+	srv, client := newTestDevice(t)
+	// A device that accepts the upgrade but never restarts
+	srv.Handle("Upgrade", func(_ *tasmotatest.State, _ tasmotatest.Command) map[string]any {
+		return map[string]any{"Upgrade": "Version 14.3.0 from " + testOTAURL}
+	})
+
+	_, err := client.Upgrade(context.Background(), testOTAURL,
+		WithUpgradePollInterval(5*time.Millisecond), WithUpgradeTimeout(50*time.Millisecond))
+	if !IsTimeoutError(err) {
+		t.Errorf("Upgrade() error = %v, want timeout error", err)
+	}
+	if !slices.ContainsFunc(srv.Commands(), func(c string) bool { return strings.HasPrefix(c, "OtaUrl ") }) {
+		t.Errorf("commands = %v, want OtaUrl", srv.Commands())
+	}
+}
+
+func TestVersionMatches(t *testing.T) {
+	tests := []struct {
+		version, expected string
+		want              bool
+	}{
+		{"14.3.0(tasmota)", "14.3.0", true},
+		{"14.3.0(tasmota)", "14.3.0(tasmota)", true},
+		{"14.3.0", "14.3.0", true},
+		{"14.3.01(tasmota)", "14.3.0", false},
+		{"14.3.0(tasmota)", "14.3.0(minimal)", false},
+	}
+
+	for _, tt := range tests {
+		if got := versionMatches(tt.version, tt.expected); got != tt.want {
+			t.Errorf("versionMatches(%q, %q) = %v, want %v", tt.version, tt.expected, got, tt.want)
+		}
+	}
+}
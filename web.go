@@ -0,0 +1,125 @@
+package tasmota
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+)
+
+// webURL builds a web UI URL. The web UI uses HTTP basic auth rather than
+// the user and password query parameters of /cm.
+func (c *Client) webURL(path string, query url.Values) (string, error) {
+	if c.transport != nil {
+		return "", NewError(ErrorTypeCommand, "the web UI is only available over HTTP", nil)
+	}
+
+	u, err := url.Parse(c.baseURL)
+	if err != nil {
+		return "", NewError(ErrorTypeNetwork, "invalid base URL", err)
+	}
+	u.Path = path
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// webGet fetches a web UI page.
+func (c *Client) webGet(ctx context.Context, urlStr string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlStr, nil)
+	if err != nil {
+		return nil, NewError(ErrorTypeNetwork, "failed to create request", err)
+	}
+	c.setWebAuth(req)
+
+	return c.doRequest(ctx, req)
+}
+
+// setWebAuth adds basic auth for the web password. The web UI user is
+// always admin unless another username was configured.
+func (c *Client) setWebAuth(req *http.Request) {
+	if c.password == "" {
+		return
+	}
+	username := c.username
+	if username == "" {
+		username = "admin"
+	}
+	req.SetBasicAuth(username, c.password)
+}
+
+// webUpload uploads a file through the web UI. Tasmota accepts uploads on
+// /u2 and decides what the file is by the page opened before it: /up for
+// firmware and /rs for settings. progress, if set, is called as the request
+// body is sent.
+func (c *Client) webUpload(ctx context.Context, page, filename string, data []byte, progress func(sent, total int64)) error {
+	pageURL, err := c.webURL(page, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := c.webGet(ctx, pageURL); err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("u2", filename)
+	if err != nil {
+		return NewError(ErrorTypeCommand, "failed to build upload", err)
+	}
+	if _, err := part.Write(data); err != nil {
+		return NewError(ErrorTypeCommand, "failed to build upload", err)
+	}
+	if err := form.Close(); err != nil {
+		return NewError(ErrorTypeCommand, "failed to build upload", err)
+	}
+
+	uploadURL, err := c.webURL("/u2", url.Values{"fsz": {fmt.Sprint(len(data))}})
+	if err != nil {
+		return err
+	}
+
+	size := int64(body.Len())
+	var reader io.Reader = &body
+	if progress != nil {
+		reader = &progressReader{r: &body, total: size, fn: progress}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadURL, reader)
+	if err != nil {
+		return NewError(ErrorTypeNetwork, "failed to create request", err)
+	}
+	// The device web server does not accept chunked uploads
+	req.ContentLength = size
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	c.setWebAuth(req)
+
+	resp, err := c.doRequest(ctx, req)
+	if err != nil {
+		return err
+	}
+	// The device reports a rejected upload on the result page
+	if bytes.Contains(resp, []byte("Upload Failed")) {
+		return NewError(ErrorTypeDevice, "device rejected the upload", nil)
+	}
+	return nil
+}
+
+// progressReader reports how much of the body has been read.
+type progressReader struct {
+	r     io.Reader
+	sent  int64
+	total int64
+	fn    func(sent, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.sent += int64(n)
+		p.fn(p.sent, p.total)
+	}
+	return n, err
+}
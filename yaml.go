@@ -0,0 +1,479 @@
+package tasmota
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// yamlToJSON converts a YAML document to JSON so it can be decoded with
+// encoding/json. Only the subset of YAML needed for configuration files is
+// supported: block mappings and sequences, plain, single and double quoted
+// scalars, literal (|) and folded (>) block scalars, flow sequences of
+// scalars and comments. Anchors, tags and multiple documents are not.
+//
+// Plain scalars are typed by the field of typ they end up in, so 1234 is
+// text for a string field and yes is true for a bool one. Without a matching
+// field, or with a nil typ, a scalar is typed by what it looks like.
+func yamlToJSON(data []byte, typ reflect.Type) ([]byte, error) {
+	p := &yamlParser{lines: strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")}
+
+	for i, line := range p.lines {
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if strings.Contains(indent, "\t") && strings.TrimSpace(line) != "" {
+			p.pos = i
+			return nil, p.errorf("tabs are not allowed for indentation")
+		}
+	}
+
+	// Skip a leading document marker
+	if indent, text, ok := p.peek(); ok && indent == 0 && text == "---" {
+		p.pos++
+	}
+
+	value, err := p.parseBlock(0)
+	if err != nil {
+		return nil, err
+	}
+	if _, text, ok := p.peek(); ok {
+		return nil, p.errorf("unexpected content %q", text)
+	}
+
+	return json.Marshal(resolveYAML(value, typ))
+}
+
+// yamlPlain is an unquoted scalar whose type is not known yet.
+type yamlPlain string
+
+// value returns the scalar typed by what it looks like.
+func (s yamlPlain) value() any {
+	text := string(s)
+	switch text {
+	case "null", "Null", "NULL", "~":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(text, 64); err == nil && !strings.ContainsAny(text, "xXpP_") {
+		return f
+	}
+	return text
+}
+
+// resolveYAML types the plain scalars in value for decoding into typ.
+func resolveYAML(value any, typ reflect.Type) any {
+	for typ != nil && typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	switch v := value.(type) {
+	case yamlPlain:
+		typed := v.value()
+		if typed == nil || typ == nil {
+			return typed
+		}
+		switch typ.Kind() {
+		case reflect.String:
+			return string(v)
+		case reflect.Bool:
+			switch strings.ToLower(string(v)) {
+			case "yes", "on":
+				return true
+			case "no", "off":
+				return false
+			}
+		}
+		return typed
+	case map[string]any:
+		for key, item := range v {
+			v[key] = resolveYAML(item, yamlFieldType(typ, key))
+		}
+	case []any:
+		var elem reflect.Type
+		if typ != nil && (typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array) {
+			elem = typ.Elem()
+		}
+		for i, item := range v {
+			v[i] = resolveYAML(item, elem)
+		}
+	}
+	return value
+}
+
+// yamlFieldType returns the type key decodes into within typ, matching
+// struct fields the way encoding/json does, or nil if there is none.
+func yamlFieldType(typ reflect.Type, key string) reflect.Type {
+	if typ == nil {
+		return nil
+	}
+	switch typ.Kind() {
+	case reflect.Map:
+		return typ.Elem()
+	case reflect.Struct:
+		for field := range typ.Fields() {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "" {
+				name = field.Name
+			}
+			if field.IsExported() && name != "-" && strings.EqualFold(name, key) {
+				return field.Type
+			}
+		}
+	}
+	return nil
+}
+
+type yamlParser struct {
+	lines []string
+	pos   int
+}
+
+func (p *yamlParser) errorf(format string, args ...any) error {
+	msg := fmt.Sprintf("yaml line %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+	return NewError(ErrorTypeParse, msg, nil)
+}
+
+// peek returns the indentation and comment-stripped text of the next
+// non-empty line without consuming it.
+func (p *yamlParser) peek() (int, string, bool) {
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		text := strings.TrimSpace(stripYAMLComment(line))
+		if text == "" {
+			p.pos++
+			continue
+		}
+		return len(line) - len(strings.TrimLeft(line, " ")), text, true
+	}
+	return 0, "", false
+}
+
+// parseBlock parses the mapping or sequence starting at the next line,
+// which must be indented at least minIndent.
+func (p *yamlParser) parseBlock(minIndent int) (any, error) {
+	indent, text, ok := p.peek()
+	if !ok || indent < minIndent {
+		return nil, nil
+	}
+	if isYAMLSeqItem(text) {
+		return p.parseSeq(indent)
+	}
+	if _, _, isMap := splitYAMLKey(text); isMap {
+		return p.parseMap(indent)
+	}
+
+	p.pos++
+	return parseYAMLScalar(text)
+}
+
+func (p *yamlParser) parseMap(indent int) (map[string]any, error) {
+	out := make(map[string]any)
+
+	for {
+		lineIndent, text, ok := p.peek()
+		if !ok || lineIndent < indent {
+			return out, nil
+		}
+		if lineIndent > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+		if isYAMLSeqItem(text) {
+			return out, nil
+		}
+
+		key, value, isMap := splitYAMLKey(text)
+		if !isMap {
+			return nil, p.errorf("expected key: value, got %q", text)
+		}
+		if _, dup := out[key]; dup {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		p.pos++
+
+		var err error
+		switch {
+		case value == "":
+			// Nested block, or a sequence at the same indentation as its key
+			nextIndent, nextText, ok := p.peek()
+			switch {
+			case ok && nextIndent > indent:
+				out[key], err = p.parseBlock(nextIndent)
+			case ok && nextIndent == indent && isYAMLSeqItem(nextText):
+				out[key], err = p.parseSeq(indent)
+			default:
+				out[key] = nil
+			}
+		case strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">"):
+			out[key], err = p.parseBlockScalar(indent, value)
+		default:
+			out[key], err = parseYAMLScalar(value)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *yamlParser) parseSeq(indent int) ([]any, error) {
+	out := []any{}
+
+	for {
+		lineIndent, text, ok := p.peek()
+		if !ok || lineIndent != indent || !isYAMLSeqItem(text) {
+			if ok && lineIndent > indent {
+				return nil, p.errorf("unexpected indentation")
+			}
+			return out, nil
+		}
+
+		item := strings.TrimSpace(strings.TrimPrefix(text, "-"))
+		switch {
+		case item == "":
+			p.pos++
+			value, err := p.parseBlock(indent + 1)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, value)
+		case isYAMLSeqItem(item):
+			return nil, p.errorf("nested inline sequences are not supported")
+		default:
+			if _, _, isMap := splitYAMLKey(item); isMap {
+				// "- key: value" starts a mapping indented past the dash
+				itemIndent := indent + strings.Index(p.lines[p.pos][indent:], item)
+				p.lines[p.pos] = strings.Repeat(" ", itemIndent) + item
+				value, err := p.parseMap(itemIndent)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, value)
+				continue
+			}
+			p.pos++
+			value, err := parseYAMLScalar(item)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, value)
+		}
+	}
+}
+
+// parseBlockScalar reads a literal (|) or folded (>) scalar whose lines are
+// indented past parentIndent.
+func (p *yamlParser) parseBlockScalar(parentIndent int, header string) (string, error) {
+	folded := header[0] == '>'
+	chomp := strings.TrimSpace(header[1:])
+	if chomp != "" && chomp != "-" && chomp != "+" {
+		return "", p.errorf("unsupported block scalar header %q", header)
+	}
+
+	var lines []string
+	blockIndent := -1
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if strings.TrimSpace(line) == "" {
+			lines = append(lines, "")
+			p.pos++
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if indent <= parentIndent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = indent
+		}
+		if indent < blockIndent {
+			break
+		}
+		lines = append(lines, line[blockIndent:])
+		p.pos++
+	}
+
+	// Trailing blank lines belong to chomping, not content
+	trailing := 0
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		trailing++
+	}
+
+	var text string
+	if folded {
+		var b strings.Builder
+		for i, line := range lines {
+			switch {
+			case i == 0:
+			case line == "":
+				b.WriteString("\n")
+			case lines[i-1] == "":
+			default:
+				b.WriteString(" ")
+			}
+			b.WriteString(line)
+		}
+		text = b.String()
+	} else {
+		text = strings.Join(lines, "\n")
+	}
+
+	switch chomp {
+	case "-":
+		return text, nil
+	case "+":
+		return text + strings.Repeat("\n", trailing+1), nil
+	default:
+		if text == "" {
+			return "", nil
+		}
+		return text + "\n", nil
+	}
+}
+
+func isYAMLSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey splits "key: value" and reports whether text is a mapping entry.
+func splitYAMLKey(text string) (string, string, bool) {
+	if text[0] == '"' || text[0] == '\'' {
+		end := closingQuote(text)
+		if end < 0 || end+1 >= len(text) || text[end+1] != ':' {
+			return "", "", false
+		}
+		key, err := parseYAMLScalar(text[:end+1])
+		if err != nil {
+			return "", "", false
+		}
+		rest := text[end+2:]
+		if rest != "" && rest[0] != ' ' {
+			return "", "", false
+		}
+		return fmt.Sprint(key), strings.TrimSpace(rest), true
+	}
+
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// closingQuote returns the index of the quote closing the string opened at text[0].
+func closingQuote(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case quote == '\'' && text[i] == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// stripYAMLComment removes a trailing # comment outside of quotes.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || line[i-1] == ' ' || line[i-1] == ':' || line[i-1] == '-' || line[i-1] == '[' || line[i-1] == ',' {
+				quote = c
+			}
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func parseYAMLScalar(text string) (any, error) {
+	text = strings.TrimSpace(text)
+
+	switch {
+	case text == "":
+		return nil, nil
+	case text[0] == '"':
+		var s string
+		if closingQuote(text) != len(text)-1 || json.Unmarshal([]byte(text), &s) != nil {
+			return nil, NewError(ErrorTypeParse, fmt.Sprintf("invalid double-quoted string %s", text), nil)
+		}
+		return s, nil
+	case text[0] == '\'':
+		if closingQuote(text) != len(text)-1 {
+			return nil, NewError(ErrorTypeParse, fmt.Sprintf("invalid single-quoted string %s", text), nil)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case text[0] == '[':
+		return parseYAMLFlowSeq(text)
+	case text == "{}":
+		return map[string]any{}, nil
+	case text[0] == '{':
+		return nil, NewError(ErrorTypeParse, "flow mappings are not supported", nil)
+	case text[0] == '&' || text[0] == '*' || text[0] == '!':
+		return nil, NewError(ErrorTypeParse, "anchors, aliases and tags are not supported", nil)
+	}
+
+	return yamlPlain(text), nil
+}
+
+func parseYAMLFlowSeq(text string) ([]any, error) {
+	if text[len(text)-1] != ']' {
+		return nil, NewError(ErrorTypeParse, fmt.Sprintf("unterminated flow sequence %s", text), nil)
+	}
+
+	inner := strings.TrimSpace(text[1 : len(text)-1])
+	out := []any{}
+	if inner == "" {
+		return out, nil
+	}
+
+	for inner != "" {
+		var item string
+		if inner[0] == '"' || inner[0] == '\'' {
+			end := closingQuote(inner)
+			if end < 0 {
+				return nil, NewError(ErrorTypeParse, fmt.Sprintf("unterminated string in %s", text), nil)
+			}
+			item, inner = inner[:end+1], strings.TrimSpace(inner[end+1:])
+			if inner != "" && inner[0] != ',' {
+				return nil, NewError(ErrorTypeParse, fmt.Sprintf("expected , in %s", text), nil)
+			}
+			inner = strings.TrimPrefix(inner, ",")
+		} else {
+			item, inner, _ = strings.Cut(inner, ",")
+		}
+		if strings.ContainsAny(strings.TrimSpace(item), "[{") {
+			return nil, NewError(ErrorTypeParse, "nested flow collections are not supported", nil)
+		}
+
+		value, err := parseYAMLScalar(item)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, value)
+		inner = strings.TrimSpace(inner)
+	}
+
+	return out, nil
+}
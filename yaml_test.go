@@ -0,0 +1,74 @@
+package tasmota
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestYAMLToJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "nested map",
+			input: "---\nMQTT:\n  Host: mqtt.home  # broker\n  Port: 1883\n",
+			want:  `{"MQTT":{"Host":"mqtt.home","Port":1883}}`,
+		},
+		{
+			name:  "scalars",
+			input: "a: true\nb: ~\nc: '0.0.0.0'\nd: \"x#y\"\ne: 1.5\nf: it's\n",
+			want:  `{"a":true,"b":null,"c":"0.0.0.0","d":"x#y","e":1.5,"f":"it's"}`,
+		},
+		{
+			name:  "sequences",
+			input: "names:\n- Kitchen\n- 'Light 2'\nflow: [a, \"b, c\", 3]\nempty: []\n",
+			want:  `{"empty":[],"flow":["a","b, c",3],"names":["Kitchen","Light 2"]}`,
+		},
+		{
+			name:  "sequence of maps",
+			input: "devices:\n  - name: a\n    host: 1.2.3.4\n  - name: b\n",
+			want:  `{"devices":[{"host":"1.2.3.4","name":"a"},{"name":"b"}]}`,
+		},
+		{
+			name:  "literal block",
+			input: "rule: |\n  ON a DO b ENDON\n  ON c DO d ENDON\nnext: 1\n",
+			want:  `{"next":1,"rule":"ON a DO b ENDON\nON c DO d ENDON\n"}`,
+		},
+		{
+			name:  "folded block strip",
+			input: "rule: >-\n  ON a\n  DO b\n\n  ENDON\n",
+			want:  `{"rule":"ON a DO b\nENDON"}`,
+		},
+		{
+			name:  "integer keys",
+			input: "SetOptions:\n  19: 0\n  55: 1\n",
+			want:  `{"SetOptions":{"19":0,"55":1}}`,
+		},
+		{name: "duplicate key", input: "a: 1\na: 2\n", wantErr: true},
+		{name: "bad indentation", input: "a: 1\n  b: 2\n", wantErr: true},
+		{name: "tab indentation", input: "a:\n\tb: 1\n", wantErr: true},
+		{name: "anchor", input: "a: &x 1\n", wantErr: true},
+		{name: "flow map", input: "a: {b: 1}\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := yamlToJSON([]byte(tt.input), nil)
+			if tt.wantErr {
+				if !IsParseError(err) {
+					t.Errorf("yamlToJSON() error = %v, want parse error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("yamlToJSON() error: %v", err)
+			}
+			if !json.Valid(got) || string(got) != tt.want {
+				t.Errorf("yamlToJSON() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,455 @@
+package tasmota
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ZigbeeStatusLevel selects how much ZbStatus reports about devices.
+type ZigbeeStatusLevel int
+
+const (
+	// ZigbeeStatusNames reports short addresses and names (ZbStatus1).
+	ZigbeeStatusNames ZigbeeStatusLevel = 1
+	// ZigbeeStatusInfo adds IEEE addresses, models and manufacturers (ZbStatus2).
+	ZigbeeStatusInfo ZigbeeStatusLevel = 2
+	// ZigbeeStatusFull adds endpoints, configuration and the last known
+	// attributes (ZbStatus3).
+	ZigbeeStatusFull ZigbeeStatusLevel = 3
+)
+
+// ZigbeeJoin is a ZbPermitJoin mode.
+type ZigbeeJoin int
+
+const (
+	// ZigbeeJoinOff stops accepting new devices.
+	ZigbeeJoinOff ZigbeeJoin = 0
+	// ZigbeeJoinMinute accepts new devices for 60 seconds.
+	ZigbeeJoinMinute ZigbeeJoin = 1
+	// ZigbeeJoinUntilRestart accepts new devices until the next restart.
+	ZigbeeJoinUntilRestart ZigbeeJoin = 99
+)
+
+// ZigbeeAttributes are the attributes a Zigbee device reported, keyed by
+// the names Zigbee2Tasmota uses, such as "Power", "Temperature" or
+// "0006/0000" for attributes it has no name for.
+type ZigbeeAttributes map[string]any
+
+// Float returns a numeric attribute.
+func (a ZigbeeAttributes) Float(name string) (float64, bool) {
+	switch v := a[name].(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Int returns a numeric attribute truncated to an int.
+func (a ZigbeeAttributes) Int(name string) (int, bool) {
+	f, ok := a.Float(name)
+	return int(f), ok
+}
+
+// String returns a string attribute.
+func (a ZigbeeAttributes) String(name string) (string, bool) {
+	s, ok := a[name].(string)
+	return s, ok
+}
+
+// Bool returns a boolean attribute. Numbers are true when not zero, which
+// covers attributes such as "Power":1.
+func (a ZigbeeAttributes) Bool(name string) (bool, bool) {
+	if b, ok := a[name].(bool); ok {
+		return b, true
+	}
+	f, ok := a.Float(name)
+	return f != 0, ok
+}
+
+// ZigbeeDevice is a device paired with the coordinator, as reported by
+// ZbStatus and ZbInfo. Fields beyond the requested level are empty.
+type ZigbeeDevice struct {
+	// Device is the short network address, such as "0x1234".
+	Device       string
+	Name         string
+	IEEEAddr     string
+	ModelID      string
+	Manufacturer string
+	Endpoints    []int
+	Config       []string
+	// Attributes holds the last known attributes, such as Power, Dimmer,
+	// Reachable, LinkQuality and BatteryPercentage.
+	Attributes ZigbeeAttributes
+}
+
+// UnmarshalJSON decodes a device, accepting endpoints as a list of numbers
+// or hex strings, or as an object keyed by endpoint.
+func (d *ZigbeeDevice) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	*d = ZigbeeDevice{}
+	for key, value := range fields {
+		var err error
+		switch key {
+		case "Device":
+			err = json.Unmarshal(value, &d.Device)
+		case "Name":
+			err = json.Unmarshal(value, &d.Name)
+		case "IEEEAddr":
+			err = json.Unmarshal(value, &d.IEEEAddr)
+		case "ModelId":
+			err = json.Unmarshal(value, &d.ModelID)
+		case "Manufacturer":
+			err = json.Unmarshal(value, &d.Manufacturer)
+		case "Config":
+			err = json.Unmarshal(value, &d.Config)
+		case "Endpoints":
+			d.Endpoints, err = parseZigbeeEndpoints(value)
+		default:
+			var v any
+			if err = json.Unmarshal(value, &v); err == nil {
+				if d.Attributes == nil {
+					d.Attributes = make(ZigbeeAttributes)
+				}
+				d.Attributes[key] = v
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("zigbee device field %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func parseZigbeeEndpoints(data json.RawMessage) ([]int, error) {
+	var keys []string
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		var byEndpoint map[string]json.RawMessage
+		if err := json.Unmarshal(data, &byEndpoint); err != nil {
+			return nil, err
+		}
+		for k := range byEndpoint {
+			keys = append(keys, k)
+		}
+	} else {
+		var list []any
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, err
+		}
+		for _, v := range list {
+			keys = append(keys, fmt.Sprint(v))
+		}
+	}
+
+	endpoints := make([]int, 0, len(keys))
+	for _, k := range keys {
+		n, err := strconv.ParseInt(k, 0, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid endpoint %q", k)
+		}
+		endpoints = append(endpoints, int(n))
+	}
+	sort.Ints(endpoints)
+	return endpoints, nil
+}
+
+// ZigbeeMessage is one device's entry in a ZbReceived message.
+type ZigbeeMessage struct {
+	Device      string
+	Name        string
+	Endpoint    int
+	Group       int
+	LinkQuality int
+	// Attributes holds the reported attributes, without the addressing
+	// fields above.
+	Attributes ZigbeeAttributes
+}
+
+// ParseZbReceived decodes the ZbReceived messages in a SENSOR or RESULT
+// payload, one per reporting device, sorted by device.
+func ParseZbReceived(payload []byte) ([]ZigbeeMessage, error) {
+	var resp struct {
+		ZbReceived map[string]map[string]any `json:"ZbReceived"`
+	}
+	if err := unmarshalJSON(payload, &resp); err != nil {
+		return nil, err
+	}
+	if resp.ZbReceived == nil {
+		return nil, NewError(ErrorTypeParse, "payload has no ZbReceived", nil)
+	}
+
+	messages := make([]ZigbeeMessage, 0, len(resp.ZbReceived))
+	for key, fields := range resp.ZbReceived {
+		attrs := ZigbeeAttributes(fields)
+		msg := ZigbeeMessage{Device: key}
+		// With SetOption83 the key is the name; Device always has the address
+		if device, ok := attrs.String("Device"); ok {
+			msg.Device = device
+		}
+		msg.Name, _ = attrs.String("Name")
+		msg.Endpoint, _ = attrs.Int("Endpoint")
+		msg.Group, _ = attrs.Int("Group")
+		msg.LinkQuality, _ = attrs.Int("LinkQuality")
+		for _, k := range []string{"Device", "Name", "Endpoint", "Group", "LinkQuality"} {
+			delete(attrs, k)
+		}
+		msg.Attributes = attrs
+		messages = append(messages, msg)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].Device < messages[j].Device })
+	return messages, nil
+}
+
+// ZigbeeCommand is a ZbSend request. Address a Device (short address, IEEE
+// address or name) or a Group, and set one of Send, Read or Write.
+type ZigbeeCommand struct {
+	Device   string `json:"Device,omitempty"`
+	Group    int    `json:"Group,omitempty"`
+	Endpoint int    `json:"Endpoint,omitempty"`
+	// Send holds high level commands such as {"Power":1} or {"Dimmer":128},
+	// or cluster commands such as {"0006!01":""}.
+	Send map[string]any `json:"Send,omitempty"`
+	// Read lists attributes to read, such as "Power" or "0006/0000".
+	Read []string `json:"Read,omitempty"`
+	// Write holds attributes to write.
+	Write map[string]any `json:"Write,omitempty"`
+}
+
+// Validate checks the command has one target and one action.
+func (z *ZigbeeCommand) Validate() error {
+	if (z.Device == "") == (z.Group == 0) {
+		return NewError(ErrorTypeCommand, "zigbee command needs either a device or a group", nil)
+	}
+	actions := 0
+	for _, set := range []bool{len(z.Send) > 0, len(z.Read) > 0, len(z.Write) > 0} {
+		if set {
+			actions++
+		}
+	}
+	if actions != 1 {
+		return NewError(ErrorTypeCommand, "zigbee command needs exactly one of Send, Read or Write", nil)
+	}
+	return nil
+}
+
+// ZigbeeBinding is a ZbBind or ZbUnbind request, binding a cluster of
+// Device to ToDevice or to ToGroup.
+type ZigbeeBinding struct {
+	Device     string `json:"Device"`
+	Endpoint   int    `json:"Endpoint,omitempty"`
+	Cluster    uint16 `json:"Cluster"`
+	ToDevice   string `json:"ToDevice,omitempty"`
+	ToEndpoint int    `json:"ToEndpoint,omitempty"`
+	ToGroup    int    `json:"ToGroup,omitempty"`
+}
+
+// Validate checks the binding has a source and one destination.
+func (b *ZigbeeBinding) Validate() error {
+	if b.Device == "" {
+		return NewError(ErrorTypeCommand, "zigbee binding needs a device", nil)
+	}
+	if (b.ToDevice == "") == (b.ToGroup == 0) {
+		return NewError(ErrorTypeCommand, "zigbee binding needs either ToDevice or ToGroup", nil)
+	}
+	return nil
+}
+
+// GetZigbeeDevices lists the paired devices with ZbStatus at level.
+func (c *Client) GetZigbeeDevices(ctx context.Context, level ZigbeeStatusLevel) ([]ZigbeeDevice, error) {
+	if level < ZigbeeStatusNames || level > ZigbeeStatusFull {
+		return nil, NewError(ErrorTypeCommand, "zigbee status level must be between 1 and 3", nil)
+	}
+	return c.zigbeeStatus(ctx, level, "")
+}
+
+// GetZigbeeDevice reads one device, given by short address, IEEE address
+// or name, with ZbStatus3.
+func (c *Client) GetZigbeeDevice(ctx context.Context, device string) (*ZigbeeDevice, error) {
+	if err := checkZigbeeDevice(device); err != nil {
+		return nil, err
+	}
+	devices, err := c.zigbeeStatus(ctx, ZigbeeStatusFull, device)
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return nil, NewError(ErrorTypeDevice, fmt.Sprintf("unknown zigbee device %q", device), nil)
+	}
+	return &devices[0], nil
+}
+
+func (c *Client) zigbeeStatus(ctx context.Context, level ZigbeeStatusLevel, device string) ([]ZigbeeDevice, error) {
+	cmd := fmt.Sprintf("ZbStatus%d", level)
+	if device != "" {
+		cmd += " " + device
+	}
+	raw, err := c.ExecuteCommand(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp map[string]json.RawMessage
+	if err := unmarshalJSON(raw, &resp); err != nil {
+		return nil, err
+	}
+	value, ok := resp[fmt.Sprintf("ZbStatus%d", level)]
+	if !ok {
+		return nil, NewError(ErrorTypeParse, fmt.Sprintf("response missing ZbStatus%d", level), nil)
+	}
+	var msg string
+	if json.Unmarshal(value, &msg) == nil {
+		return nil, NewError(ErrorTypeDevice, fmt.Sprintf("%s %s: %s", cmd, device, msg), nil)
+	}
+	var devices []ZigbeeDevice
+	if err := unmarshalJSON(value, &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// GetZigbeeInfo reads what the coordinator knows about a device with
+// ZbInfo. Firmware without ZbInfo, or that only publishes it over MQTT, is
+// read with ZbStatus3 instead.
+func (c *Client) GetZigbeeInfo(ctx context.Context, device string) (*ZigbeeDevice, error) {
+	if err := checkZigbeeDevice(device); err != nil {
+		return nil, err
+	}
+	raw, err := c.ExecuteCommand(ctx, "ZbInfo "+device)
+	if IsCommandError(err) {
+		return c.GetZigbeeDevice(ctx, device)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		ZbInfo json.RawMessage `json:"ZbInfo"`
+	}
+	if err := unmarshalJSON(raw, &resp); err != nil {
+		return nil, err
+	}
+	var byDevice map[string]ZigbeeDevice
+	if len(resp.ZbInfo) > 0 && json.Unmarshal(resp.ZbInfo, &byDevice) == nil {
+		for key, info := range byDevice {
+			if info.Device == "" {
+				info.Device = key
+			}
+			return &info, nil
+		}
+	}
+	return c.GetZigbeeDevice(ctx, device)
+}
+
+// ZigbeePermitJoin opens or closes the network for new devices.
+func (c *Client) ZigbeePermitJoin(ctx context.Context, mode ZigbeeJoin) error {
+	switch mode {
+	case ZigbeeJoinOff, ZigbeeJoinMinute, ZigbeeJoinUntilRestart:
+	default:
+		return NewError(ErrorTypeCommand, "zigbee join mode must be 0, 1 or 99", nil)
+	}
+	return c.zigbeeCommand(ctx, "ZbPermitJoin", strconv.Itoa(int(mode)))
+}
+
+// ZigbeeRename names a device; an empty name removes it.
+func (c *Client) ZigbeeRename(ctx context.Context, device, name string) error {
+	if err := checkZigbeeDevice(device); err != nil {
+		return err
+	}
+	if strings.ContainsAny(name, ",;") {
+		return NewError(ErrorTypeCommand, "zigbee device names cannot contain ',' or ';'", nil)
+	}
+	return c.zigbeeCommand(ctx, "ZbName", device+","+name)
+}
+
+// ZigbeeForget removes a device from the coordinator. The device stays
+// joined to the network until it is reset.
+func (c *Client) ZigbeeForget(ctx context.Context, device string) error {
+	if err := checkZigbeeDevice(device); err != nil {
+		return err
+	}
+	return c.zigbeeCommand(ctx, "ZbForget", device)
+}
+
+// ZigbeeSetLight sets how many light channels a device has (0-5), which
+// makes it show as a light in the web UI and Hue emulation. -1 removes the
+// light configuration.
+func (c *Client) ZigbeeSetLight(ctx context.Context, device string, channels int) error {
+	if err := checkZigbeeDevice(device); err != nil {
+		return err
+	}
+	if channels < -1 || channels > 5 {
+		return NewError(ErrorTypeCommand, "zigbee light channels must be between -1 and 5", nil)
+	}
+	return c.zigbeeCommand(ctx, "ZbLight", fmt.Sprintf("%s,%d", device, channels))
+}
+
+// ZigbeeSend sends a command to a device or group with ZbSend.
+func (c *Client) ZigbeeSend(ctx context.Context, cmd *ZigbeeCommand) error {
+	if err := cmd.Validate(); err != nil {
+		return err
+	}
+	return c.zigbeeJSONCommand(ctx, "ZbSend", cmd)
+}
+
+// ZigbeeBind binds a cluster of a device to another device or a group.
+func (c *Client) ZigbeeBind(ctx context.Context, b *ZigbeeBinding) error {
+	if err := b.Validate(); err != nil {
+		return err
+	}
+	return c.zigbeeJSONCommand(ctx, "ZbBind", b)
+}
+
+// ZigbeeUnbind removes a binding made with ZigbeeBind.
+func (c *Client) ZigbeeUnbind(ctx context.Context, b *ZigbeeBinding) error {
+	if err := b.Validate(); err != nil {
+		return err
+	}
+	return c.zigbeeJSONCommand(ctx, "ZbUnbind", b)
+}
+
+func (c *Client) zigbeeJSONCommand(ctx context.Context, name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return NewError(ErrorTypeCommand, fmt.Sprintf("failed to encode %s", name), err)
+	}
+	return c.zigbeeCommand(ctx, name, string(data))
+}
+
+// zigbeeCommand runs a Zb command. The bridge answers "Done" or a
+// per-device object on success, and a message such as "Unknown device"
+// under the command name on failure.
+func (c *Client) zigbeeCommand(ctx context.Context, name, payload string) error {
+	raw, err := c.ExecuteCommand(ctx, name+" "+payload)
+	if err != nil {
+		return err
+	}
+	var resp map[string]any
+	if err := unmarshalJSON(raw, &resp); err != nil {
+		return err
+	}
+	if msg, ok := resp[name].(string); ok && !strings.EqualFold(msg, "Done") {
+		return NewError(ErrorTypeDevice, fmt.Sprintf("%s %s: %s", name, payload, msg), nil)
+	}
+	return nil
+}
+
+func checkZigbeeDevice(device string) error {
+	if device == "" || strings.ContainsAny(device, ",; ") {
+		return NewError(ErrorTypeCommand, fmt.Sprintf("invalid zigbee device %q", device), nil)
+	}
+	return nil
+}
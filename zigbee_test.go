@@ -0,0 +1,188 @@
+package tasmota
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kradalby/tasmota-go/tasmotatest"
+)
+
+func TestZigbeeDevice_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		endpoints []int
+		wantErr   bool
+	}{
+		{"endpoint object", `{"Device":"0x1234","Endpoints":{"0x01":{"ProfileId":"0x0104"},"0x0B":{}}}`, []int{1, 11}, false},
+		{"hex list", `{"Device":"0x1234","Endpoints":["0x02","0x01"]}`, []int{1, 2}, false},
+		{"number list", `{"Device":"0x1234","Endpoints":[1]}`, []int{1}, false},
+		{"no endpoints", `{"Device":"0x1234"}`, nil, false},
+		{"bad endpoint", `{"Device":"0x1234","Endpoints":["x"]}`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dev ZigbeeDevice
+			err := json.Unmarshal([]byte(tt.input), &dev)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(dev.Endpoints, tt.endpoints) {
+				t.Errorf("Endpoints = %v, want %v", dev.Endpoints, tt.endpoints)
+			}
+		})
+	}
+}
+
+func TestParseZbReceived(t *testing.T) {
+	payload := `{"ZbReceived":{
+		"Kitchen":{"Device":"0x8F20","Name":"Kitchen","Temperature":21.5,"Humidity":48,"Endpoint":1,"LinkQuality":75},
+		"0x1234":{"Device":"0x1234","Power":1,"0006/4003":"FF","Endpoint":2,"Group":5}}}`
+
+	messages, err := ParseZbReceived([]byte(payload))
+	if err != nil {
+		t.Fatalf("ParseZbReceived() error: %v", err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("ParseZbReceived() = %d messages, want 2", len(messages))
+	}
+
+	lamp, sensor := messages[0], messages[1]
+	if lamp.Device != "0x1234" || lamp.Endpoint != 2 || lamp.Group != 5 {
+		t.Errorf("lamp = %+v", lamp)
+	}
+	if on, ok := lamp.Attributes.Bool("Power"); !on || !ok {
+		t.Errorf("Bool(Power) = %v, %v", on, ok)
+	}
+	if s, _ := lamp.Attributes.String("0006/4003"); s != "FF" {
+		t.Errorf("String(0006/4003) = %q", s)
+	}
+
+	if sensor.Device != "0x8F20" || sensor.Name != "Kitchen" || sensor.LinkQuality != 75 {
+		t.Errorf("sensor = %+v", sensor)
+	}
+	if temp, ok := sensor.Attributes.Float("Temperature"); temp != 21.5 || !ok {
+		t.Errorf("Float(Temperature) = %v, %v", temp, ok)
+	}
+	if _, ok := sensor.Attributes["Device"]; ok {
+		t.Error("Attributes still contain Device")
+	}
+
+	if _, err := ParseZbReceived([]byte(`{"Temperature":20}`)); !IsParseError(err) {
+		t.Errorf("ParseZbReceived() without ZbReceived error = %v, want parse error", err)
+	}
+}
+
+func TestZigbeeCommand_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmd     ZigbeeCommand
+		wantErr bool
+	}{
+		{"device send", ZigbeeCommand{Device: "0x1234", Send: map[string]any{"Power": 1}}, false},
+		{"group read", ZigbeeCommand{Group: 5, Read: []string{"Power"}}, false},
+		{"no target", ZigbeeCommand{Send: map[string]any{"Power": 1}}, true},
+		{"two targets", ZigbeeCommand{Device: "0x1234", Group: 5, Send: map[string]any{"Power": 1}}, true},
+		{"no action", ZigbeeCommand{Device: "0x1234"}, true},
+		{"two actions", ZigbeeCommand{Device: "0x1234", Read: []string{"Power"}, Write: map[string]any{"Power": 1}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cmd.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIntegration_Zigbee(t *testing.T) {
+	srv, client := newTestDevice(t, tasmotatest.WithZigbee(
+		tasmotatest.ZigbeeDevice{
+			Device: "0x1234", IEEEAddr: "0x00158D0001A2B3C4", ModelID: "TRADFRI bulb E27",
+			Manufacturer: "IKEA of Sweden", Endpoints: []int{1},
+			Attributes: map[string]any{"Power": 0, "Reachable": true},
+		},
+		tasmotatest.ZigbeeDevice{Device: "0x5678", IEEEAddr: "0x00158D0001D5E6F7", Name: "Remote", Endpoints: []int{1}},
+	))
+	ctx := context.Background()
+
+	devices, err := client.GetZigbeeDevices(ctx, ZigbeeStatusInfo)
+	if err != nil {
+		t.Fatalf("GetZigbeeDevices() error: %v", err)
+	}
+	if len(devices) != 2 || devices[0].ModelID != "TRADFRI bulb E27" || devices[1].Name != "Remote" {
+		t.Errorf("GetZigbeeDevices() = %+v", devices)
+	}
+
+	if err := client.ZigbeeRename(ctx, "0x1234", "Lamp"); err != nil {
+		t.Fatalf("ZigbeeRename() error: %v", err)
+	}
+	if err := client.ZigbeeSetLight(ctx, "Lamp", 1); err != nil {
+		t.Fatalf("ZigbeeSetLight() error: %v", err)
+	}
+	if err := client.ZigbeeSend(ctx, &ZigbeeCommand{Device: "Lamp", Send: map[string]any{"Power": 1}}); err != nil {
+		t.Fatalf("ZigbeeSend() error: %v", err)
+	}
+	lamp, err := client.GetZigbeeDevice(ctx, "Lamp")
+	if err != nil {
+		t.Fatalf("GetZigbeeDevice() error: %v", err)
+	}
+	if on, _ := lamp.Attributes.Bool("Power"); !on || lamp.Device != "0x1234" || !reflect.DeepEqual(lamp.Endpoints, []int{1}) {
+		t.Errorf("GetZigbeeDevice() = %+v", lamp)
+	}
+	if n, _ := lamp.Attributes.Int("Light"); n != 1 {
+		t.Errorf("Light = %d, want 1", n)
+	}
+
+	info, err := client.GetZigbeeInfo(ctx, "0x00158D0001A2B3C4")
+	if err != nil || info.Name != "Lamp" || info.Manufacturer != "IKEA of Sweden" {
+		t.Errorf("GetZigbeeInfo() = %+v, %v", info, err)
+	}
+	// Firmware without ZbInfo falls back to ZbStatus3.
+	srv.Handle("ZbInfo", func(_ *tasmotatest.State, _ tasmotatest.Command) map[string]any {
+		return map[string]any{"Command": "Unknown"}
+	})
+	if info, err := client.GetZigbeeInfo(ctx, "Lamp"); err != nil || info.Device != "0x1234" {
+		t.Errorf("GetZigbeeInfo() without ZbInfo = %+v, %v", info, err)
+	}
+
+	binding := &ZigbeeBinding{Device: "Remote", Endpoint: 1, Cluster: 6, ToDevice: "Lamp", ToEndpoint: 1}
+	if err := client.ZigbeeBind(ctx, binding); err != nil {
+		t.Fatalf("ZigbeeBind() error: %v", err)
+	}
+	if got := srv.State().Zigbee.Bindings; len(got) != 1 || got[0].Cluster != 6 {
+		t.Errorf("Bindings = %+v", got)
+	}
+	if err := client.ZigbeeUnbind(ctx, binding); err != nil {
+		t.Fatalf("ZigbeeUnbind() error: %v", err)
+	}
+
+	if err := client.ZigbeePermitJoin(ctx, ZigbeeJoinMinute); err != nil {
+		t.Fatalf("ZigbeePermitJoin() error: %v", err)
+	}
+	if err := client.ZigbeeForget(ctx, "Remote"); err != nil {
+		t.Fatalf("ZigbeeForget() error: %v", err)
+	}
+	state := srv.State().Zigbee
+	if state.PermitJoin != 1 || len(state.Devices) != 1 || len(state.Bindings) != 0 {
+		t.Errorf("Zigbee state = %+v", state)
+	}
+
+	if _, err := client.GetZigbeeDevice(ctx, "Remote"); !IsDeviceError(err) {
+		t.Errorf("GetZigbeeDevice(forgotten) error = %v, want device error", err)
+	}
+	if err := client.ZigbeeRename(ctx, "0x9999", "Ghost"); !IsDeviceError(err) || !strings.Contains(err.Error(), "Unknown device") {
+		t.Errorf("ZigbeeRename(unknown) error = %v, want device error", err)
+	}
+	if err := client.ZigbeeRename(ctx, "Lamp", "a,b"); !IsCommandError(err) {
+		t.Errorf("ZigbeeRename(comma) error = %v, want command error", err)
+	}
+	if err := client.ZigbeePermitJoin(ctx, 5); !IsCommandError(err) {
+		t.Errorf("ZigbeePermitJoin(5) error = %v, want command error", err)
+	}
+}